@@ -7,22 +7,28 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"dildogram/backend/internal/config"
 	"dildogram/backend/internal/handlers"
 	"dildogram/backend/internal/middleware"
-	"dildogram/backend/internal/models"
 	"dildogram/backend/internal/repository"
 	"dildogram/backend/internal/service"
+	"dildogram/backend/internal/sms"
+	"dildogram/backend/internal/storage"
 	"dildogram/backend/internal/websocket"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// Путь раздачи файлов локального хранилища
+const localFilesPath = "/uploads/files"
+
 func main() {
 	// Загружаем конфигурацию
 	cfg, err := config.Load()
@@ -30,6 +36,14 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Подкоманда управления миграциями: server migrate up|down|status|baseline
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
 	// Инициализируем базу данных
 	db, err := initDB(cfg)
 	if err != nil {
@@ -40,29 +54,85 @@ func main() {
 	userRepo := repository.NewUserRepository(db)
 	chatRepo := repository.NewChatRepository(db)
 	messageRepo := repository.NewMessageRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
+	smsCodeRepo := repository.NewSMSCodeRepository(db)
+	reactionRepo := repository.NewReactionRepository(db)
+	pinRepo := repository.NewPinRepository(db)
+	updateRepo := repository.NewUpdateRepository(db)
+	contactRepo := repository.NewContactRepository(db)
+	blockRepo := repository.NewBlockRepository(db)
+	inviteRepo := repository.NewInviteRepository(db)
+
+	// Отправка SMS кодов
+	smsSender, err := initSMSSender(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize SMS sender: %v", err)
+	}
 
 	// Создаём сервисы
-	authService := service.NewAuthService(userRepo, cfg)
-	chatService := service.NewChatService(chatRepo, userRepo)
-	messageService := service.NewMessageService(messageRepo, chatRepo)
+	authService := service.NewAuthService(userRepo, sessionRepo, smsCodeRepo, contactRepo, blockRepo, smsSender, cfg)
+	chatService := service.NewChatService(chatRepo, userRepo, messageRepo, pinRepo, contactRepo, blockRepo)
+	messageService := service.NewMessageService(messageRepo, chatRepo, attachmentRepo, reactionRepo, contactRepo, blockRepo, cfg)
+	syncService := service.NewSyncService(updateRepo, cfg)
+
+	// Журнал обновлений чистится в фоне, а не на каждой синхронизации
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	go syncService.RunCleanup(cleanupCtx)
+	contactService := service.NewContactService(contactRepo, blockRepo, userRepo)
+	blockService := service.NewBlockService(blockRepo, contactRepo, userRepo)
+	inviteService := service.NewInviteService(inviteRepo, chatRepo, contactRepo, blockRepo)
+
+	// Хранилище загруженных файлов
+	store, localStore, err := initStorage(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	mediaService := service.NewMediaService(attachmentRepo, messageRepo, chatRepo, blockRepo, store, cfg)
+	go mediaService.RunCleanup(cleanupCtx)
+
+	// Брокер событий хаба (Redis для нескольких реплик, иначе in-memory)
+	broker, err := initBroker(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize hub broker: %v", err)
+	}
+	defer broker.Close()
 
 	// Создаём WebSocket хаб
-	hub := websocket.NewHub(messageService, chatService, authService, messageRepo, chatRepo, userRepo)
+	hub := websocket.NewHub(messageService, chatService, authService, syncService, messageRepo, chatRepo, userRepo, broker)
 	go hub.Run()
 
 	// Создаём обработчики
-	authHandler := handlers.NewAuthHandler(authService)
-	chatHandler := handlers.NewChatHandler(chatService, messageService, hub)
+	authHandler := handlers.NewAuthHandler(authService, mediaService, contactService, hub)
+	chatHandler := handlers.NewChatHandler(chatService, messageService, mediaService, hub)
 	wsHandler := handlers.NewWSHandler(authService, hub)
+	mediaHandler := handlers.NewMediaHandler(mediaService, cfg.Upload.MaxFileSize)
+	syncHandler := handlers.NewSyncHandler(syncService)
+	contactHandler := handlers.NewContactHandler(contactService)
+	blockHandler := handlers.NewBlockHandler(blockService, hub)
+	inviteHandler := handlers.NewInviteHandler(inviteService, hub)
 
 	// Инициализируем Gin
 	r := gin.Default()
 
+	// Иначе X-Forwarded-For принимается от любого клиента и лимиты по IP обходятся подменой заголовка
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Middleware
 	r.Use(middleware.CORSMiddleware(cfg.FrontendURL))
 
-	// Статические файлы (аватарки)
-	r.Static("/uploads", "./uploads")
+	// Аватарки: постоянный URL перенаправляет на временную ссылку хранилища
+	r.GET("/uploads/avatars/:name", mediaHandler.Avatar)
+
+	// Файлы локального хранилища по подписанным ссылкам
+	if localStore != nil {
+		r.GET(localFilesPath+"/*key", func(c *gin.Context) {
+			localStore.Serve(c.Writer, c.Request, strings.TrimPrefix(c.Param("key"), "/"))
+		})
+	}
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -82,7 +152,8 @@ func main() {
 			auth.POST("/login", authHandler.Login)
 			auth.POST("/sms", authHandler.RequestSMS)
 			auth.POST("/verify-sms", authHandler.VerifySMS)
-			
+			auth.POST("/refresh", authHandler.Refresh)
+
 			// Защищённые эндпоинты
 			protected := auth.Group("")
 			protected.Use(middleware.AuthMiddleware(authService))
@@ -90,6 +161,13 @@ func main() {
 				protected.GET("/me", authHandler.GetMe)
 				protected.PUT("/me", authHandler.UpdateProfile)
 				protected.POST("/avatar", authHandler.UploadAvatar)
+				protected.GET("/privacy", authHandler.GetPrivacy)
+				protected.PUT("/privacy", authHandler.UpdatePrivacy)
+
+				// Сессии (устройства)
+				protected.GET("/sessions", authHandler.GetSessions)
+				protected.DELETE("/sessions", authHandler.RevokeOtherSessions)
+				protected.DELETE("/sessions/:id", authHandler.RevokeSession)
 			}
 		}
 
@@ -101,6 +179,41 @@ func main() {
 			users.GET("", authHandler.SearchUsers)
 		}
 
+		// Контакты
+		contacts := v1.Group("/contacts")
+		contacts.Use(middleware.AuthMiddleware(authService))
+		{
+			contacts.GET("", contactHandler.GetContacts)
+			contacts.POST("", contactHandler.AddContact)
+			contacts.POST("/import", contactHandler.ImportContacts)
+			contacts.DELETE("/:id", contactHandler.RemoveContact)
+		}
+
+		// Чёрный список
+		blocks := v1.Group("/blocks")
+		blocks.Use(middleware.AuthMiddleware(authService))
+		{
+			blocks.GET("", blockHandler.GetBlockedUsers)
+			blocks.POST("", blockHandler.BlockUser)
+			blocks.DELETE("/:id", blockHandler.UnblockUser)
+		}
+
+		// Вступление в группы по ссылкам
+		invites := v1.Group("/invites")
+		invites.Use(middleware.AuthMiddleware(authService))
+		{
+			invites.GET("/:code", inviteHandler.GetPreview)
+			invites.POST("/:code/join", inviteHandler.Join)
+		}
+
+		// Публичные каналы
+		channels := v1.Group("/channels")
+		channels.Use(middleware.AuthMiddleware(authService))
+		{
+			channels.GET("/:handle", chatHandler.GetChannel)
+			channels.POST("/:handle/join", chatHandler.JoinChannel)
+		}
+
 		// Чаты
 		chats := v1.Group("/chats")
 		chats.Use(middleware.AuthMiddleware(authService))
@@ -110,27 +223,79 @@ func main() {
 			chats.GET("/:id", chatHandler.GetChat)
 			chats.PUT("/:id", chatHandler.UpdateChat)
 			chats.DELETE("/:id", chatHandler.DeleteChat)
-			
+			chats.POST("/:id/avatar", chatHandler.UploadAvatar)
+			chats.PUT("/:id/handle", chatHandler.UpdateHandle)
+
 			// Участники
 			chats.POST("/:id/members", chatHandler.AddMember)
 			chats.DELETE("/:id/members/:userId", chatHandler.RemoveMember)
 			chats.GET("/:id/members", chatHandler.GetMembers)
-			
+			chats.PUT("/:id/permissions", chatHandler.UpdatePermissions)
+			chats.PUT("/:id/admins/:userId", chatHandler.PromoteAdmin)
+			chats.DELETE("/:id/admins/:userId", chatHandler.DemoteAdmin)
+			chats.POST("/:id/transfer", chatHandler.TransferOwnership)
+
+			// Ссылки-приглашения и заявки на вступление
+			chats.GET("/:id/invites", inviteHandler.GetInvites)
+			chats.POST("/:id/invites", inviteHandler.CreateInvite)
+			chats.DELETE("/:id/invites/:inviteId", inviteHandler.RevokeInvite)
+			chats.GET("/:id/join-requests", inviteHandler.GetJoinRequests)
+			chats.POST("/:id/join-requests/:userId/approve", inviteHandler.ApproveJoinRequest)
+			chats.DELETE("/:id/join-requests/:userId", inviteHandler.DeclineJoinRequest)
+
 			// Сообщения
 			chats.GET("/:id/messages", chatHandler.GetMessages)
 			chats.POST("/:id/messages", chatHandler.SendMessage)
+			chats.POST("/:id/messages/forward", chatHandler.ForwardMessages)
+			chats.PATCH("/:id/messages/:messageId", chatHandler.EditMessage)
+			chats.DELETE("/:id/messages/:messageId", chatHandler.DeleteMessage)
 			chats.POST("/:id/read", chatHandler.MarkChatAsRead)
+			chats.GET("/:id/messages/:messageId/receipts", chatHandler.GetReceipts)
+
+			// Закреплённые сообщения
+			chats.GET("/:id/pins", chatHandler.GetPins)
+			chats.POST("/:id/messages/:messageId/pin", chatHandler.PinMessage)
+			chats.DELETE("/:id/messages/:messageId/pin", chatHandler.UnpinMessage)
+
+			// Ветки ответов
+			chats.GET("/:id/messages/:messageId/thread", chatHandler.GetThread)
+			chats.POST("/:id/messages/:messageId/thread/read", chatHandler.MarkThreadRead)
+
+			// Реакции
+			chats.GET("/:id/messages/:messageId/reactions", chatHandler.GetReactions)
+			chats.POST("/:id/messages/:messageId/reactions", chatHandler.AddReaction)
+			chats.DELETE("/:id/messages/:messageId/reactions/:emoji", chatHandler.RemoveReaction)
+
+			// Вложения
+			chats.POST("/:id/media", mediaHandler.Upload)
+		}
+
+		// Вложения (только участникам чата)
+		media := v1.Group("/media")
+		media.Use(middleware.AuthMiddleware(authService))
+		{
+			media.GET("/:id", mediaHandler.Download)
+		}
+
+		// Поиск
+		search := v1.Group("/search")
+		search.Use(middleware.AuthMiddleware(authService))
+		{
+			search.GET("/messages", chatHandler.SearchMessages)
+			search.GET("/channels", chatHandler.SearchChannels)
+		}
+
+		// Досинхронизация после переподключения
+		sync := v1.Group("/sync")
+		sync.Use(middleware.AuthMiddleware(authService))
+		{
+			sync.GET("", syncHandler.GetUpdates)
 		}
 
 		// WebSocket
 		v1.GET("/ws", wsHandler.HandleWebSocket)
 	}
 
-	// Создаём директорию для загрузок
-	if err := os.MkdirAll("./uploads/avatars", 0755); err != nil {
-		log.Printf("Warning: failed to create uploads directory: %v", err)
-	}
-
 	// Запускаем сервер
 	srv := &http.Server{
 		Addr:    fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port),
@@ -171,30 +336,85 @@ func initDB(cfg *config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Автоматическая миграция моделей
-	if err := autoMigrate(db); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	// Схемой управляют SQL миграции; на неактуальной базе сервер не стартует
+	if err := checkMigrations(db); err != nil {
+		return nil, err
 	}
 
 	return db, nil
 }
 
-// autoMigrate выполняет миграцию моделей
-func autoMigrate(db *gorm.DB) error {
-	models := []interface{}{
-		&models.User{},
-		&models.SMSCode{},
-		&models.Chat{},
-		&models.ChatMembership{},
-		&models.Message{},
-		&models.MessageRead{},
+// initBroker создаёт брокер событий WebSocket хаба
+func initBroker(cfg *config.Config) (websocket.Broker, error) {
+	if !cfg.Redis.Enabled {
+		return websocket.NewMemoryBroker(), nil
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	for _, model := range models {
-		if err := db.AutoMigrate(model); err != nil {
-			return fmt.Errorf("failed to migrate %T: %w", model, err)
+	return websocket.NewRedisBroker(client), nil
+}
+
+// initStorage создаёт хранилище загруженных файлов.
+// Для локального хранилища также возвращает его для раздачи файлов.
+func initStorage(cfg *config.Config) (storage.Storage, *storage.LocalStorage, error) {
+	switch cfg.Upload.Backend {
+	case "local":
+		if err := os.MkdirAll(cfg.Upload.Dir, 0755); err != nil {
+			return nil, nil, fmt.Errorf("failed to create upload directory: %w", err)
 		}
+		local := storage.NewLocalStorage(cfg.Upload.Dir, localFilesPath, cfg.Upload.URLSecret)
+		return local, local, nil
+
+	case "s3":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		s3, err := storage.NewS3Storage(ctx, storage.S3Options{
+			Endpoint:       cfg.Upload.S3Endpoint,
+			PublicEndpoint: cfg.Upload.S3PublicEndpoint,
+			Region:         cfg.Upload.S3Region,
+			Bucket:         cfg.Upload.S3Bucket,
+			AccessKey:      cfg.Upload.S3AccessKey,
+			SecretKey:      cfg.Upload.S3SecretKey,
+			UseSSL:         cfg.Upload.S3UseSSL,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return s3, nil, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unknown storage backend %q", cfg.Upload.Backend)
 	}
+}
 
-	return nil
+// initSMSSender создаёт отправщик SMS по настройке SMS_PROVIDER
+func initSMSSender(cfg *config.Config) (sms.Sender, error) {
+	switch cfg.SMS.Provider {
+	case "log":
+		log.Println("SMS provider is not configured, codes are written to the log")
+		return sms.NewLogSender(), nil
+
+	case "http":
+		return sms.NewHTTPSender(sms.HTTPOptions{
+			URL:    cfg.SMS.HTTPURL,
+			Token:  cfg.SMS.HTTPToken,
+			Sender: cfg.SMS.HTTPSender,
+		})
+
+	default:
+		return nil, fmt.Errorf("unknown sms provider %q", cfg.SMS.Provider)
+	}
 }
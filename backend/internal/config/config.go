@@ -4,18 +4,23 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DB        DBConfig
-	JWT       JWTConfig
-	Server    ServerConfig
-	Upload    UploadConfig
-	Redis     RedisConfig
-	SMS       SMSConfig
+	DB      DBConfig
+	JWT     JWTConfig
+	Server  ServerConfig
+	Upload  UploadConfig
+	Redis   RedisConfig
+	SMS     SMSConfig
+	Message MessageConfig
+	Sync    SyncConfig
+
+	FrontendURL string
 }
 
 type DBConfig struct {
@@ -29,31 +34,83 @@ type DBConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string
-	ExpireHours int
-	ExpireDur  time.Duration
+	Secret              string
+	AccessExpireMinutes int
+	AccessExpireDur     time.Duration
+	RefreshExpireDays   int
+	RefreshExpireDur    time.Duration
 }
 
 type ServerConfig struct {
 	Host string
 	Port string
+	// TrustedProxies — адреса и подсети прокси, которым доверяется X-Forwarded-For.
+	// Пустой список — IP клиента берётся только из соединения.
+	TrustedProxies []string
 }
 
 type UploadConfig struct {
 	Dir         string
 	MaxFileSize int64
+
+	// Хранилище: "local" (Dir) или "s3"
+	Backend          string
+	URLSecret        string
+	URLExpireMinutes int
+	URLExpireDur     time.Duration
+	// Через сколько удаляются вложения, так и не отправленные в сообщении
+	UnlinkedTTLHours int
+	UnlinkedTTLDur   time.Duration
+
+	S3Endpoint       string
+	S3PublicEndpoint string
+	S3Region         string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+	S3UseSSL         bool
 }
 
 type RedisConfig struct {
+	Enabled  bool
 	Host     string
 	Port     string
 	Password string
+	DB       int
 	Addr     string
 }
 
 type SMSConfig struct {
 	CodeExpireMinutes int
 	CodeExpireDur     time.Duration
+
+	// Провайдер: "log" (коды пишутся в лог) или "http"
+	Provider   string
+	HTTPURL    string
+	HTTPToken  string
+	HTTPSender string
+
+	// Ограничения отправки и проверки кодов
+	ResendIntervalSeconds int
+	ResendIntervalDur     time.Duration
+	PhoneHourlyLimit      int
+	IPHourlyLimit         int
+	MaxAttempts           int
+	LockoutMinutes        int
+	LockoutDur            time.Duration
+}
+
+type MessageConfig struct {
+	EditWindowHours int
+	EditWindowDur   time.Duration
+}
+
+type SyncConfig struct {
+	// Сколько хранится журнал обновлений для досинхронизации клиентов
+	RetentionHours int
+	RetentionDur   time.Duration
+	// Отставание, после которого клиенту проще перезагрузить чаты целиком
+	MaxUpdates int
 }
 
 func Load() (*Config, error) {
@@ -76,26 +133,70 @@ func Load() (*Config, error) {
 
 	// JWT
 	cfg.JWT.Secret = getEnv("JWT_SECRET", "change-this-secret-key")
-	cfg.JWT.ExpireHours = getEnvInt("JWT_EXPIRE_HOURS", 72)
-	cfg.JWT.ExpireDur = time.Duration(cfg.JWT.ExpireHours) * time.Hour
+	cfg.JWT.AccessExpireMinutes = getEnvInt("JWT_ACCESS_EXPIRE_MINUTES", 15)
+	cfg.JWT.AccessExpireDur = time.Duration(cfg.JWT.AccessExpireMinutes) * time.Minute
+	cfg.JWT.RefreshExpireDays = getEnvInt("JWT_REFRESH_EXPIRE_DAYS", 30)
+	cfg.JWT.RefreshExpireDur = time.Duration(cfg.JWT.RefreshExpireDays) * 24 * time.Hour
 
 	// Server
 	cfg.Server.Host = getEnv("SERVER_HOST", "0.0.0.0")
 	cfg.Server.Port = getEnv("SERVER_PORT", "8080")
+	cfg.Server.TrustedProxies = getEnvList("TRUSTED_PROXIES")
+
+	// CORS
+	cfg.FrontendURL = getEnv("FRONTEND_URL", "http://localhost:3000")
 
 	// Upload
 	cfg.Upload.Dir = getEnv("UPLOAD_DIR", "./uploads")
 	cfg.Upload.MaxFileSize = getEnvInt64("MAX_UPLOAD_SIZE", 10*1024*1024)
+	cfg.Upload.Backend = getEnv("STORAGE_BACKEND", "local")
+	cfg.Upload.URLSecret = getEnv("STORAGE_URL_SECRET", "")
+	if cfg.Upload.URLSecret == "" {
+		cfg.Upload.URLSecret = cfg.JWT.Secret
+	}
+	cfg.Upload.URLExpireMinutes = getEnvInt("STORAGE_URL_EXPIRE_MINUTES", 15)
+	cfg.Upload.URLExpireDur = time.Duration(cfg.Upload.URLExpireMinutes) * time.Minute
+	cfg.Upload.UnlinkedTTLHours = getEnvInt("UPLOAD_UNLINKED_TTL_HOURS", 24)
+	cfg.Upload.UnlinkedTTLDur = time.Duration(cfg.Upload.UnlinkedTTLHours) * time.Hour
+	cfg.Upload.S3Endpoint = getEnv("S3_ENDPOINT", "localhost:9000")
+	cfg.Upload.S3PublicEndpoint = getEnv("S3_PUBLIC_ENDPOINT", "")
+	cfg.Upload.S3Region = getEnv("S3_REGION", "us-east-1")
+	cfg.Upload.S3Bucket = getEnv("S3_BUCKET", "dildogram")
+	cfg.Upload.S3AccessKey = getEnv("S3_ACCESS_KEY", "")
+	cfg.Upload.S3SecretKey = getEnv("S3_SECRET_KEY", "")
+	cfg.Upload.S3UseSSL = getEnvBool("S3_USE_SSL", false)
 
 	// Redis
+	cfg.Redis.Enabled = getEnvBool("REDIS_ENABLED", false)
 	cfg.Redis.Host = getEnv("REDIS_HOST", "localhost")
 	cfg.Redis.Port = getEnv("REDIS_PORT", "6379")
 	cfg.Redis.Password = getEnv("REDIS_PASSWORD", "")
+	cfg.Redis.DB = getEnvInt("REDIS_DB", 0)
 	cfg.Redis.Addr = fmt.Sprintf("%s:%s", cfg.Redis.Host, cfg.Redis.Port)
 
 	// SMS
 	cfg.SMS.CodeExpireMinutes = getEnvInt("SMS_CODE_EXPIRE_MINUTES", 5)
 	cfg.SMS.CodeExpireDur = time.Duration(cfg.SMS.CodeExpireMinutes) * time.Minute
+	cfg.SMS.Provider = getEnv("SMS_PROVIDER", "log")
+	cfg.SMS.HTTPURL = getEnv("SMS_HTTP_URL", "")
+	cfg.SMS.HTTPToken = getEnv("SMS_HTTP_TOKEN", "")
+	cfg.SMS.HTTPSender = getEnv("SMS_HTTP_SENDER", "Dildogram")
+	cfg.SMS.ResendIntervalSeconds = getEnvInt("SMS_RESEND_INTERVAL_SECONDS", 60)
+	cfg.SMS.ResendIntervalDur = time.Duration(cfg.SMS.ResendIntervalSeconds) * time.Second
+	cfg.SMS.PhoneHourlyLimit = getEnvInt("SMS_PHONE_HOURLY_LIMIT", 5)
+	cfg.SMS.IPHourlyLimit = getEnvInt("SMS_IP_HOURLY_LIMIT", 20)
+	cfg.SMS.MaxAttempts = getEnvInt("SMS_MAX_ATTEMPTS", 5)
+	cfg.SMS.LockoutMinutes = getEnvInt("SMS_LOCKOUT_MINUTES", 15)
+	cfg.SMS.LockoutDur = time.Duration(cfg.SMS.LockoutMinutes) * time.Minute
+
+	// Messages
+	cfg.Message.EditWindowHours = getEnvInt("MESSAGE_EDIT_WINDOW_HOURS", 48)
+	cfg.Message.EditWindowDur = time.Duration(cfg.Message.EditWindowHours) * time.Hour
+
+	// Sync
+	cfg.Sync.RetentionHours = getEnvInt("SYNC_RETENTION_HOURS", 168)
+	cfg.Sync.RetentionDur = time.Duration(cfg.Sync.RetentionHours) * time.Hour
+	cfg.Sync.MaxUpdates = getEnvInt("SYNC_MAX_UPDATES", 5000)
 
 	return cfg, nil
 }
@@ -116,6 +217,26 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList разбирает список значений через запятую
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getEnvInt64(key string, defaultValue int64) int64 {
 	if value, exists := os.LookupEnv(key); exists {
 		if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
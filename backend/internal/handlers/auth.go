@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
+	"time"
 
 	"dildogram/backend/internal/middleware"
 	"dildogram/backend/internal/models"
@@ -12,14 +15,14 @@ import (
 	"dildogram/backend/internal/websocket"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
+	gorillaws "github.com/gorilla/websocket"
 )
 
 // WSHandler обрабатывает WebSocket подключения
 type WSHandler struct {
 	authService *service.AuthService
 	hub         *websocket.Hub
-	upgrader    websocket.Upgrader
+	upgrader    gorillaws.Upgrader
 }
 
 // NewWSHandler создаёт новый WSHandler
@@ -27,7 +30,7 @@ func NewWSHandler(authService *service.AuthService, hub *websocket.Hub) *WSHandl
 	return &WSHandler{
 		authService: authService,
 		hub:         hub,
-		upgrader: websocket.Upgrader{
+		upgrader: gorillaws.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
 			CheckOrigin: func(r *http.Request) bool {
@@ -73,7 +76,7 @@ func (h *WSHandler) HandleWebSocket(c *gin.Context) {
 	}
 
 	// Создаём клиента
-	client := websocket.NewClient(h.hub, conn, claims.UserID, user.Username)
+	client := websocket.NewClient(h.hub, conn, claims.UserID, user.Username, claims.SessionID)
 
 	// Регистрируем клиента
 	h.hub.Register <- client
@@ -85,13 +88,19 @@ func (h *WSHandler) HandleWebSocket(c *gin.Context) {
 
 // AuthHandler обрабатывает запросы аутентификации
 type AuthHandler struct {
-	authService *service.AuthService
+	authService    *service.AuthService
+	mediaService   *service.MediaService
+	contactService *service.ContactService
+	hub            *websocket.Hub
 }
 
 // NewAuthHandler создаёт новый AuthHandler
-func NewAuthHandler(authService *service.AuthService) *AuthHandler {
+func NewAuthHandler(authService *service.AuthService, mediaService *service.MediaService, contactService *service.ContactService, hub *websocket.Hub) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
+		authService:    authService,
+		mediaService:   mediaService,
+		contactService: contactService,
+		hub:            hub,
 	}
 }
 
@@ -119,6 +128,30 @@ type VerifySMSRequest struct {
 	Code  string `json:"code" binding:"required,len=6"`
 }
 
+// RefreshRequest запрос на обновление токенов
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// sessionInfo извлекает данные об устройстве из запроса
+func sessionInfo(c *gin.Context) service.SessionInfo {
+	return service.SessionInfo{
+		DeviceInfo: c.Request.UserAgent(),
+		IPAddress:  c.ClientIP(),
+	}
+}
+
+// tokenResponse формирует ответ с пользователем и токенами сессии
+func tokenResponse(user *models.User, tokens *service.TokenPair) gin.H {
+	return gin.H{
+		"user":          user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+		"session_id":    tokens.SessionID,
+	}
+}
+
 // Register регистрирует пользователя
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req RegisterRequest
@@ -129,7 +162,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	user, token, err := h.authService.Register(c.Request.Context(), req.Phone, req.Username, req.Password)
+	user, tokens, err := h.authService.Register(c.Request.Context(), req.Phone, req.Username, req.Password, sessionInfo(c))
 	if err != nil {
 		if err == service.ErrUserExists {
 			c.JSON(http.StatusConflict, gin.H{
@@ -143,10 +176,20 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"user":  user,
-		"token": token,
-	})
+	h.claimImportedContacts(c, user)
+
+	c.JSON(http.StatusCreated, tokenResponse(user, tokens))
+}
+
+// claimImportedContacts добавляет нового пользователя в контакты тех, кто импортировал
+// его номер, и уведомляет их. Ошибка не мешает входу.
+func (h *AuthHandler) claimImportedContacts(c *gin.Context, user *models.User) {
+	contacts, err := h.contactService.ClaimImportedContacts(c.Request.Context(), user)
+	if err != nil {
+		log.Printf("failed to claim imported contacts for %s: %v", user.ID, err)
+		return
+	}
+	h.hub.NotifyContactJoined(user, contacts)
 }
 
 // Login выполняет вход
@@ -159,7 +202,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, token, err := h.authService.Login(c.Request.Context(), req.Phone, req.Password)
+	user, tokens, err := h.authService.Login(c.Request.Context(), req.Phone, req.Password, sessionInfo(c))
 	if err != nil {
 		if err == service.ErrUserNotFound || err == service.ErrInvalidCredentials {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -173,10 +216,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"user":  user,
-		"token": token,
-	})
+	c.JSON(http.StatusOK, tokenResponse(user, tokens))
 }
 
 // RequestSMS запрашивает SMS код
@@ -189,20 +229,44 @@ func (h *AuthHandler) RequestSMS(c *gin.Context) {
 		return
 	}
 
-	code, err := h.authService.RequestSMSCode(c.Request.Context(), req.Phone)
+	status, err := h.authService.RequestSMSCode(c.Request.Context(), req.Phone, c.ClientIP())
 	if err != nil {
+		if respondRateLimited(c, err) {
+			return
+		}
+		if err == service.ErrSMSDeliveryFailed {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": "Failed to send SMS code",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
-	// В реальном приложении код отправляется по SMS
-	// Для разработки возвращаем код в ответе (удалить в продакшене!)
 	c.JSON(http.StatusOK, gin.H{
-		"message": "SMS code sent",
-		"code":    code, // Удалить в продакшене!
+		"message":      "SMS code sent",
+		"expires_in":   int(status.ExpiresIn.Seconds()),
+		"resend_after": int(status.ResendAfter.Seconds()),
+	})
+}
+
+// respondRateLimited отвечает 429 с Retry-After, если err — ошибка ограничения частоты
+func respondRateLimited(c *gin.Context, err error) bool {
+	var limitErr *service.RateLimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(limitErr.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       limitErr.Error(),
+		"retry_after": retryAfter,
 	})
+	return true
 }
 
 // VerifySMS проверяет SMS код
@@ -215,8 +279,11 @@ func (h *AuthHandler) VerifySMS(c *gin.Context) {
 		return
 	}
 
-	user, token, err := h.authService.VerifySMSCode(c.Request.Context(), req.Phone, req.Code)
+	user, tokens, err := h.authService.VerifySMSCode(c.Request.Context(), req.Phone, req.Code, sessionInfo(c))
 	if err != nil {
+		if respondRateLimited(c, err) {
+			return
+		}
 		if err == service.ErrInvalidCode {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid or expired code",
@@ -229,9 +296,110 @@ func (h *AuthHandler) VerifySMS(c *gin.Context) {
 		return
 	}
 
+	// Вход по SMS может зарегистрировать нового пользователя
+	h.claimImportedContacts(c, user)
+
+	c.JSON(http.StatusOK, tokenResponse(user, tokens))
+}
+
+// Refresh обменивает refresh токен на новую пару токенов
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	user, tokens, err := h.authService.RefreshSession(c.Request.Context(), req.RefreshToken, sessionInfo(c))
+	if err != nil {
+		var reuseErr *service.TokenReuseError
+		if errors.As(err, &reuseErr) {
+			h.hub.DisconnectSessions(reuseErr.UserID, reuseErr.SessionID)
+		}
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid or expired refresh token",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(user, tokens))
+}
+
+// GetSessions возвращает активные сессии текущего пользователя
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	sessions, err := h.authService.GetSessions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions":           sessions,
+		"current_session_id": middleware.GetSessionID(c),
+	})
+}
+
+// RevokeSession отзывает сессию по ID
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid session ID",
+		})
+		return
+	}
+
+	if err := h.authService.RevokeSession(c.Request.Context(), userID, sessionID); err != nil {
+		if err == service.ErrSessionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Session not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	h.hub.DisconnectSessions(userID, sessionID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Session revoked",
+	})
+}
+
+// RevokeOtherSessions отзывает все сессии, кроме текущей
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	revoked, err := h.authService.RevokeOtherSessions(c.Request.Context(), userID, middleware.GetSessionID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	h.hub.DisconnectSessions(userID, revoked...)
+
 	c.JSON(http.StatusOK, gin.H{
-		"user":  user,
-		"token": token,
+		"message": "Sessions revoked",
+		"revoked": len(revoked),
 	})
 }
 
@@ -290,55 +458,124 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 	})
 }
 
-// UploadAvatar загружает аватар
-func (h *AuthHandler) UploadAvatar(c *gin.Context) {
+// UpdatePrivacyRequest запрос на изменение настроек приватности.
+// Незаданные поля не меняются.
+type UpdatePrivacyRequest struct {
+	LastSeen *models.PrivacyLevel `json:"last_seen"`
+	Online   *models.PrivacyLevel `json:"online"`
+	Phone    *models.PrivacyLevel `json:"phone"`
+	Avatar   *models.PrivacyLevel `json:"avatar"`
+}
+
+// GetPrivacy возвращает настройки приватности текущего пользователя
+func (h *AuthHandler) GetPrivacy(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
 
-	file, err := c.FormFile("avatar")
+	privacy, err := h.authService.GetPrivacy(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Avatar file required",
+		if err == service.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// Проверяем расширение
-	ext := filepath.Ext(file.Filename)
-	allowedExts := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
-	if !allowedExts[ext] {
+	c.JSON(http.StatusOK, gin.H{
+		"privacy": privacy,
+	})
+}
+
+// UpdatePrivacy изменяет настройки приватности текущего пользователя
+func (h *AuthHandler) UpdatePrivacy(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req UpdatePrivacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid file type. Allowed: jpg, jpeg, png, gif, webp",
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// Создаём уникальное имя файла
-	filename := uuid.New().String() + ext
-	uploadDir := "./uploads/avatars"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to create upload directory",
+	privacy, err := h.authService.UpdatePrivacy(c.Request.Context(), userID, service.PrivacyUpdate{
+		LastSeen: req.LastSeen,
+		Online:   req.Online,
+		Phone:    req.Phone,
+		Avatar:   req.Avatar,
+	})
+	if err != nil {
+		switch err {
+		case service.ErrInvalidPrivacyLevel:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Privacy level must be one of: everyone, contacts, nobody",
+			})
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"privacy": privacy,
+	})
+}
+
+// UploadAvatar загружает аватар
+func (h *AuthHandler) UploadAvatar(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Avatar file required",
 		})
 		return
 	}
 
-	filePath := filepath.Join(uploadDir, filename)
+	content, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Failed to read file",
+		})
+		return
+	}
+	defer content.Close()
 
-	// Сохраняем файл
-	if err := c.SaveUploadedFile(file, filePath); err != nil {
+	// Тип определяется по содержимому файла, а не по расширению
+	avatarURL, preview, err := h.mediaService.UploadAvatar(c.Request.Context(), content)
+	if err != nil {
+		if err == service.ErrUnsupportedMedia {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid file type. Allowed: jpg, jpeg, png, gif, webp",
+			})
+			return
+		}
+		if err == service.ErrFileTooLarge {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "File is too large",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to save file",
 		})
 		return
 	}
 
-	// Формируем URL
-	avatarURL := "/uploads/avatars/" + filename
-
 	// Обновляем аватар в БД
-	user, err := h.authService.UpdateAvatar(c.Request.Context(), userID, avatarURL)
+	user, err := h.authService.UpdateAvatar(c.Request.Context(), userID, avatarURL, preview)
 	if err != nil {
-		os.Remove(filePath)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to update avatar",
 		})
@@ -351,8 +588,10 @@ func (h *AuthHandler) UploadAvatar(c *gin.Context) {
 	})
 }
 
-// GetUser получает пользователя по ID
+// GetUser получает пользователя по ID с учётом его настроек приватности
 func (h *AuthHandler) GetUser(c *gin.Context) {
+	viewerID, _ := middleware.GetUserID(c)
+
 	idStr := c.Param("id")
 	userID, err := uuid.Parse(idStr)
 	if err != nil {
@@ -362,19 +601,19 @@ func (h *AuthHandler) GetUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authService.GetUserByID(c.Request.Context(), userID)
+	user, err := h.authService.GetPublicUser(c.Request.Context(), viewerID, userID)
 	if err != nil {
+		if err == service.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
-	if user == nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "User not found",
-		})
-		return
-	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"user": user,
@@ -383,6 +622,8 @@ func (h *AuthHandler) GetUser(c *gin.Context) {
 
 // SearchUsers ищет пользователей
 func (h *AuthHandler) SearchUsers(c *gin.Context) {
+	viewerID, _ := middleware.GetUserID(c)
+
 	query := c.Query("q")
 	if query == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -392,7 +633,7 @@ func (h *AuthHandler) SearchUsers(c *gin.Context) {
 	}
 
 	limit := 20
-	users, err := h.authService.SearchUsers(c.Request.Context(), query, limit)
+	users, err := h.authService.SearchUsers(c.Request.Context(), viewerID, query, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -409,24 +650,27 @@ func (h *AuthHandler) SearchUsers(c *gin.Context) {
 type ChatHandler struct {
 	chatService    *service.ChatService
 	messageService *service.MessageService
+	mediaService   *service.MediaService
 	hub            *websocket.Hub
 }
 
 // NewChatHandler создаёт новый ChatHandler
-func NewChatHandler(chatService *service.ChatService, messageService *service.MessageService, hub *websocket.Hub) *ChatHandler {
+func NewChatHandler(chatService *service.ChatService, messageService *service.MessageService, mediaService *service.MediaService, hub *websocket.Hub) *ChatHandler {
 	return &ChatHandler{
 		chatService:    chatService,
 		messageService: messageService,
+		mediaService:   mediaService,
 		hub:            hub,
 	}
 }
 
 // CreateChatRequest запрос на создание чата
 type CreateChatRequest struct {
-	Type        string    `json:"type" binding:"required,oneof=private group"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	MemberIDs   []string  `json:"member_ids"`
+	Type        string   `json:"type" binding:"required,oneof=private group channel"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	MemberIDs   []string `json:"member_ids"`
+	Handle      *string  `json:"handle"` // Только для каналов: публичный адрес
 }
 
 // CreateChat создаёт чат
@@ -459,12 +703,42 @@ func (h *ChatHandler) CreateChat(c *gin.Context) {
 
 		chat, err := h.chatService.CreatePrivateChat(c.Request.Context(), userID, otherUserID)
 		if err != nil {
+			if err == service.ErrUserBlocked {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
 			})
 			return
 		}
 
+		h.hub.NotifyNewChat(chat, []uuid.UUID{userID, otherUserID})
+
+		c.JSON(http.StatusCreated, gin.H{
+			"chat": chat,
+		})
+		return
+	}
+
+	if req.Type == "channel" {
+		if req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Channel requires a name",
+			})
+			return
+		}
+
+		chat, err := h.chatService.CreateChannel(c.Request.Context(), userID, req.Name, req.Description, req.Handle)
+		if err != nil {
+			respondChatError(c, err)
+			return
+		}
+
+		h.hub.NotifyNewChat(chat, []uuid.UUID{userID})
+
 		c.JSON(http.StatusCreated, gin.H{
 			"chat": chat,
 		})
@@ -493,12 +767,20 @@ func (h *ChatHandler) CreateChat(c *gin.Context) {
 
 	chat, err := h.chatService.CreateGroupChat(c.Request.Context(), userID, req.Name, req.Description, memberIDs)
 	if err != nil {
+		if err == service.ErrUserBlocked {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
+	h.hub.NotifyNewChat(chat, append(memberIDs, userID))
+
 	c.JSON(http.StatusCreated, gin.H{
 		"chat": chat,
 	})
@@ -560,8 +842,9 @@ func (h *ChatHandler) GetChat(c *gin.Context) {
 
 // UpdateChatRequest запрос на обновление чата
 type UpdateChatRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	ProtectedContent *bool  `json:"protected_content"`
 }
 
 // UpdateChat обновляет чат
@@ -584,33 +867,26 @@ func (h *ChatHandler) UpdateChat(c *gin.Context) {
 		return
 	}
 
-	chat, err := h.chatService.UpdateChat(c.Request.Context(), chatID, userID, req.Name, req.Description, "")
+	chat, err := h.chatService.UpdateChat(c.Request.Context(), chatID, userID, req.Name, req.Description, "", req.ProtectedContent)
 	if err != nil {
-		if err == service.ErrChatNotFound {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "Chat not found",
-			})
-			return
-		}
-		if err == service.ErrNoPermission {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "Access denied",
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		respondChatError(c, err)
 		return
 	}
 
+	h.hub.BroadcastChatUpdated(chat)
+
 	c.JSON(http.StatusOK, gin.H{
 		"chat": chat,
 	})
 }
 
-// DeleteChat удаляет чат
-func (h *ChatHandler) DeleteChat(c *gin.Context) {
+// UpdateHandleRequest запрос на смену публичного адреса канала
+type UpdateHandleRequest struct {
+	Handle *string `json:"handle"` // null или пустая строка — сделать канал частным
+}
+
+// UpdateHandle меняет публичный адрес канала
+func (h *ChatHandler) UpdateHandle(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
 
 	chatID, err := uuid.Parse(c.Param("id"))
@@ -621,64 +897,72 @@ func (h *ChatHandler) DeleteChat(c *gin.Context) {
 		return
 	}
 
-	if err := h.chatService.DeleteChat(c.Request.Context(), chatID, userID); err != nil {
-		if err == service.ErrChatNotFound {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "Chat not found",
-			})
-			return
-		}
-		if err == service.ErrNoPermission {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "Access denied",
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
+	var req UpdateHandleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
+	chat, err := h.chatService.UpdateHandle(c.Request.Context(), chatID, userID, req.Handle)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	h.hub.BroadcastChatUpdated(chat)
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Chat deleted",
+		"chat": chat,
 	})
 }
 
-// AddMemberRequest запрос на добавление участника
-type AddMemberRequest struct {
-	UserID string `json:"user_id" binding:"required"`
-}
-
-// AddMember добавляет участника в чат
-func (h *ChatHandler) AddMember(c *gin.Context) {
+// GetChannel возвращает сведения о публичном канале по адресу
+func (h *ChatHandler) GetChannel(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
 
-	chatID, err := uuid.Parse(c.Param("id"))
+	channel, err := h.chatService.GetChannel(c.Request.Context(), c.Param("handle"), userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid chat ID",
-		})
+		respondChatError(c, err)
 		return
 	}
 
-	var req AddMemberRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+	c.JSON(http.StatusOK, gin.H{
+		"channel": channel,
+	})
+}
+
+// JoinChannel подписывает пользователя на публичный канал
+func (h *ChatHandler) JoinChannel(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chat, err := h.chatService.JoinChannel(c.Request.Context(), c.Param("handle"), userID)
+	if err != nil {
+		respondChatError(c, err)
 		return
 	}
 
-	newMemberID, err := uuid.Parse(req.UserID)
-	if err != nil {
+	h.hub.BroadcastMemberAdded(chat, userID, userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"chat": chat,
+	})
+}
+
+// SearchChannels ищет публичные каналы
+func (h *ChatHandler) SearchChannels(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid user ID",
+			"error": "Query parameter 'q' required",
 		})
 		return
 	}
 
-	if err := h.chatService.AddMember(c.Request.Context(), chatID, userID, newMemberID); err != nil {
+	limit := 20
+	channels, err := h.chatService.SearchChannels(c.Request.Context(), query, limit)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -686,12 +970,12 @@ func (h *ChatHandler) AddMember(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Member added",
+		"channels": channels,
 	})
 }
 
-// RemoveMember удаляет участника из чата
-func (h *ChatHandler) RemoveMember(c *gin.Context) {
+// UploadAvatar загружает аватар чата
+func (h *ChatHandler) UploadAvatar(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
 
 	chatID, err := uuid.Parse(c.Param("id"))
@@ -702,28 +986,64 @@ func (h *ChatHandler) RemoveMember(c *gin.Context) {
 		return
 	}
 
-	memberID, err := uuid.Parse(c.Param("userId"))
+	// Права проверяем до сохранения файла в хранилище
+	if err := h.chatService.CheckCanChangeInfo(c.Request.Context(), chatID, userID); err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	file, err := c.FormFile("avatar")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid user ID",
+			"error": "Avatar file required",
+		})
+		return
+	}
+
+	content, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Failed to read file",
 		})
 		return
 	}
+	defer content.Close()
 
-	if err := h.chatService.RemoveMember(c.Request.Context(), chatID, userID, memberID); err != nil {
+	avatarURL, preview, err := h.mediaService.UploadAvatar(c.Request.Context(), content)
+	if err != nil {
+		if err == service.ErrUnsupportedMedia {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid file type. Allowed: jpg, jpeg, png, gif, webp",
+			})
+			return
+		}
+		if err == service.ErrFileTooLarge {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "File is too large",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
+			"error": "Failed to save file",
 		})
 		return
 	}
 
+	chat, err := h.chatService.UpdateAvatar(c.Request.Context(), chatID, userID, avatarURL, preview)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	h.hub.BroadcastChatUpdated(chat)
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Member removed",
+		"chat": chat,
 	})
 }
 
-// GetMembers получает участников чата
-func (h *ChatHandler) GetMembers(c *gin.Context) {
+// DeleteChat удаляет чат
+func (h *ChatHandler) DeleteChat(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
 
 	chatID, err := uuid.Parse(c.Param("id"))
@@ -734,27 +1054,67 @@ func (h *ChatHandler) GetMembers(c *gin.Context) {
 		return
 	}
 
-	members, err := h.chatService.GetMembers(c.Request.Context(), chatID, userID)
+	if err := h.chatService.DeleteChat(c.Request.Context(), chatID, userID); err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	h.hub.BroadcastChatDeleted(chatID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Chat deleted",
+	})
+}
+
+// AddMemberRequest запрос на добавление участника
+type AddMemberRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+// AddMember добавляет участника в чат
+func (h *ChatHandler) AddMember(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		if err == service.ErrNotMember {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "Access denied",
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	var req AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
+	newMemberID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	if err := h.chatService.AddMember(c.Request.Context(), chatID, userID, newMemberID); err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	if chat, err := h.chatService.GetChat(c.Request.Context(), chatID, newMemberID); err == nil {
+		h.hub.BroadcastMemberAdded(chat, newMemberID, userID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"members": members,
+		"message": "Member added",
 	})
 }
 
-// GetMessages получает сообщения чата
-func (h *ChatHandler) GetMessages(c *gin.Context) {
+// RemoveMember удаляет участника из чата
+func (h *ChatHandler) RemoveMember(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
 
 	chatID, err := uuid.Parse(c.Param("id"))
@@ -765,49 +1125,127 @@ func (h *ChatHandler) GetMessages(c *gin.Context) {
 		return
 	}
 
-	limit := 50
-	offset := 0
+	memberID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
 
-	if l := c.Query("limit"); l != "" {
-		if _, err := fmt.Sscanf(l, "%d", &limit); err != nil {
-			limit = 50
-		}
+	chat, err := h.chatService.RemoveMember(c.Request.Context(), chatID, userID, memberID)
+	if err != nil {
+		respondChatError(c, err)
+		return
 	}
-	if o := c.Query("offset"); o != "" {
-		if _, err := fmt.Sscanf(o, "%d", &offset); err != nil {
-			offset = 0
-		}
+
+	h.hub.BroadcastMemberRemoved(chat, memberID, userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member removed",
+	})
+}
+
+// UpdatePermissions меняет права обычных участников группы
+func (h *ChatHandler) UpdatePermissions(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
 	}
 
-	messages, err := h.messageService.GetMessages(c.Request.Context(), chatID, userID, limit, offset)
+	var req models.ChatPermissions
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	chat, err := h.chatService.UpdateDefaultPermissions(c.Request.Context(), chatID, userID, req)
 	if err != nil {
-		if err == service.ErrNotMember {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "Access denied",
+		respondChatError(c, err)
+		return
+	}
+
+	h.hub.BroadcastChatUpdated(chat)
+
+	c.JSON(http.StatusOK, gin.H{
+		"permissions": chat.DefaultPermissions,
+	})
+}
+
+// PromoteAdminRequest запрос на назначение админа. Без permissions — все права.
+type PromoteAdminRequest struct {
+	Permissions *models.ChatPermissions `json:"permissions"`
+}
+
+// PromoteAdmin назначает участника админом или меняет его права
+func (h *ChatHandler) PromoteAdmin(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, memberID, ok := parseMemberParams(c)
+	if !ok {
+		return
+	}
+
+	// Тело необязательно
+	var req PromoteAdminRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
 			})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+	}
+
+	membership, err := h.chatService.PromoteAdmin(c.Request.Context(), chatID, userID, memberID, req.Permissions)
+	if err != nil {
+		respondChatError(c, err)
 		return
 	}
 
+	h.hub.BroadcastMemberUpdated(membership, userID)
+
 	c.JSON(http.StatusOK, gin.H{
-		"messages": messages,
+		"member": membership,
 	})
 }
 
-// SendMessageRequest запрос на отправку сообщения
-type SendMessageRequest struct {
-	Content   string  `json:"content" binding:"required"`
-	MessageType string  `json:"message_type"`
-	MediaURL  *string `json:"media_url"`
-	ReplyToID *string `json:"reply_to_id"`
+// DemoteAdmin снимает с участника права админа
+func (h *ChatHandler) DemoteAdmin(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, memberID, ok := parseMemberParams(c)
+	if !ok {
+		return
+	}
+
+	membership, err := h.chatService.DemoteAdmin(c.Request.Context(), chatID, userID, memberID)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	h.hub.BroadcastMemberUpdated(membership, userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"member": membership,
+	})
 }
 
-// SendMessage отправляет сообщение
-func (h *ChatHandler) SendMessage(c *gin.Context) {
+// TransferOwnershipRequest запрос на передачу владения чатом
+type TransferOwnershipRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+// TransferOwnership передаёт владение группой другому участнику
+func (h *ChatHandler) TransferOwnership(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
 
 	chatID, err := uuid.Parse(c.Param("id"))
@@ -818,7 +1256,7 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	var req SendMessageRequest
+	var req TransferOwnershipRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
@@ -826,58 +1264,957 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	messageType := models.MessageTypeText
-	if req.MessageType != "" {
-		messageType = models.MessageType(req.MessageType)
-	}
-
-	var replyToID *uuid.UUID
-	if req.ReplyToID != nil {
-		id, err := uuid.Parse(*req.ReplyToID)
-		if err == nil {
-			replyToID = &id
-		}
+	newOwnerID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
 	}
 
-	message, err := h.messageService.SendMessage(
-		c.Request.Context(),
-		chatID,
-		userID,
-		req.Content,
-		messageType,
-		req.MediaURL,
-		replyToID,
-	)
+	members, err := h.chatService.TransferOwnership(c.Request.Context(), chatID, userID, newOwnerID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		respondChatError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": message,
+	for i := range members {
+		h.hub.BroadcastMemberUpdated(&members[i], userID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Ownership transferred",
 	})
 }
 
-// MarkChatAsRead отмечает чат как прочитанный
-func (h *ChatHandler) MarkChatAsRead(c *gin.Context) {
-	userID, _ := middleware.GetUserID(c)
-
+// parseMemberParams разбирает ID чата и участника из пути
+func parseMemberParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
 	chatID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid chat ID",
 		})
-		return
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	memberID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return uuid.Nil, uuid.Nil, false
 	}
 
-	if err := h.messageService.MarkChatAsRead(c.Request.Context(), chatID, userID); err != nil {
+	return chatID, memberID, true
+}
+
+// respondChatError отвечает на ошибку управления чатом и его участниками
+func respondChatError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrChatNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Chat not found",
+		})
+	case service.ErrNotMember, service.ErrNoPermission:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Access denied",
+		})
+	case service.ErrCannotRemoveOwner, service.ErrUserBlocked:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+	case service.ErrCannotAddSelf, service.ErrChatExists, service.ErrNotGroupChat, service.ErrNotAdmin, service.ErrOwnerMustTransfer,
+		service.ErrPrivateChat, service.ErrNotChannel, service.ErrInvalidHandle:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	case service.ErrHandleTaken, service.ErrAlreadyMember:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+	default:
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
-		return
 	}
+}
+
+// GetMembers получает участников чата
+func (h *ChatHandler) GetMembers(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	members, err := h.chatService.GetMembers(c.Request.Context(), chatID, userID)
+	if err != nil {
+		if err == service.ErrNotMember || err == service.ErrNoPermission {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Access denied",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": members,
+	})
+}
+
+// GetMessages получает страницу сообщений чата.
+// Параметры: before, after или around (ID сообщения) и limit.
+func (h *ChatHandler) GetMessages(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	params, ok := parsePageParams(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.messageService.GetMessagesPage(c.Request.Context(), chatID, userID, params)
+	if err != nil {
+		if err == service.ErrChatNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Chat not found",
+			})
+			return
+		}
+		if err == service.ErrNotMember {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Access denied",
+			})
+			return
+		}
+		if err == service.ErrInvalidCursor {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// parsePageParams разбирает параметры прокрутки истории: before, after, around и limit
+func parsePageParams(c *gin.Context) (service.MessagePageParams, bool) {
+	var params service.MessagePageParams
+	cursors := 0
+	for key, target := range map[string]**uuid.UUID{
+		"before": &params.Before,
+		"after":  &params.After,
+		"around": &params.Around,
+	} {
+		value := c.Query(key)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid " + key + " cursor",
+			})
+			return params, false
+		}
+		*target = &id
+		cursors++
+	}
+	if cursors > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Only one of before, after or around is allowed",
+		})
+		return params, false
+	}
+
+	// offset больше не поддерживается: вместо тихой выдачи первой страницы
+	// старым клиентам отвечаем ошибкой. offset=0 совпадает с первой страницей.
+	if o := c.Query("offset"); o != "" && o != "0" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "offset is no longer supported, use the before cursor from before_cursor",
+		})
+		return params, false
+	}
+
+	if l := c.Query("limit"); l != "" {
+		if _, err := fmt.Sscanf(l, "%d", &params.Limit); err != nil {
+			params.Limit = 0
+		}
+	}
+
+	return params, true
+}
+
+// SearchMessages ищет сообщения по чатам пользователя.
+// Параметры: q, chat_id, from (ID отправителя), before, after (дата), type, cursor и limit.
+func (h *ChatHandler) SearchMessages(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	params := service.MessageSearchParams{
+		Query: c.Query("q"),
+	}
+
+	for key, target := range map[string]**uuid.UUID{
+		"chat_id": &params.ChatID,
+		"from":    &params.SenderID,
+		"cursor":  &params.Cursor,
+	} {
+		value := c.Query(key)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid " + key,
+			})
+			return
+		}
+		*target = &id
+	}
+
+	for key, target := range map[string]**time.Time{
+		"before": &params.Before,
+		"after":  &params.After,
+	} {
+		value := c.Query(key)
+		if value == "" {
+			continue
+		}
+		t, err := parseSearchDate(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid " + key + " date, expected RFC3339 or YYYY-MM-DD",
+			})
+			return
+		}
+		*target = &t
+	}
+
+	if t := c.Query("type"); t != "" {
+		messageType := models.MessageType(t)
+		switch messageType {
+		case models.MessageTypeText, models.MessageTypeImage, models.MessageTypeFile, models.MessageTypeVoice:
+			params.MessageType = &messageType
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid message type",
+			})
+			return
+		}
+	}
+
+	if l := c.Query("limit"); l != "" {
+		if _, err := fmt.Sscanf(l, "%d", &params.Limit); err != nil {
+			params.Limit = 0
+		}
+	}
+
+	page, err := h.messageService.SearchMessages(c.Request.Context(), userID, params)
+	if err != nil {
+		if err == service.ErrChatNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Chat not found",
+			})
+			return
+		}
+		if err == service.ErrNotMember {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Access denied",
+			})
+			return
+		}
+		if err == service.ErrEmptyQuery || err == service.ErrInvalidCursor {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// parseSearchDate разбирает дату фильтра поиска в формате RFC3339 или YYYY-MM-DD
+func parseSearchDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// SendMessageRequest запрос на отправку сообщения
+type SendMessageRequest struct {
+	Content     string  `json:"content"`
+	MessageType string  `json:"message_type"`
+	MediaURL    *string `json:"media_url"`
+	ReplyToID   *string `json:"reply_to_id"`
+}
+
+// SendMessage отправляет сообщение.
+// Заголовок Idempotency-Key делает запрос идемпотентным: повтор с тем же ключом
+// возвращает уже созданное сообщение с заголовком Idempotent-Replayed.
+func (h *ChatHandler) SendMessage(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	var req SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	messageType := models.MessageTypeText
+	if req.MessageType != "" {
+		messageType = models.MessageType(req.MessageType)
+	}
+
+	var replyToID *uuid.UUID
+	if req.ReplyToID != nil {
+		id, err := uuid.Parse(*req.ReplyToID)
+		if err == nil {
+			replyToID = &id
+		}
+	}
+
+	var idempotencyKey *string
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		idempotencyKey = &key
+	}
+
+	message, created, err := h.messageService.SendMessage(
+		c.Request.Context(),
+		chatID,
+		userID,
+		req.Content,
+		messageType,
+		req.MediaURL,
+		replyToID,
+		idempotencyKey,
+	)
+	if err != nil {
+		if err == service.ErrChatNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Chat not found",
+			})
+			return
+		}
+		if err == service.ErrNotMember {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Access denied",
+			})
+			return
+		}
+		if err == service.ErrAttachmentNotFound || err == service.ErrAttachmentUnavailable || err == service.ErrReplyNotFound ||
+			err == service.ErrEmptyContent || err == service.ErrInvalidClientMsgID {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err == service.ErrClientMsgIDReused {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err == service.ErrUserBlocked || err == service.ErrNoPermission {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if !created {
+		c.Header("Idempotent-Replayed", "true")
+	} else {
+		h.hub.BroadcastNewMessage(message)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": message,
+	})
+}
+
+// ForwardMessagesRequest запрос на пересылку сообщений
+type ForwardMessagesRequest struct {
+	MessageIDs    []uuid.UUID `json:"message_ids" binding:"required"`
+	TargetChatIDs []uuid.UUID `json:"target_chat_ids" binding:"required"`
+}
+
+// ForwardMessages пересылает сообщения чата в другие чаты пользователя
+func (h *ChatHandler) ForwardMessages(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	var req ForwardMessagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	messages, err := h.messageService.ForwardMessages(c.Request.Context(), userID, chatID, req.MessageIDs, req.TargetChatIDs)
+	if err != nil {
+		switch err {
+		case service.ErrChatNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Chat not found",
+			})
+		case service.ErrMessageNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Message not found",
+			})
+		case service.ErrNotMember:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Access denied",
+			})
+		case service.ErrForwardRestricted, service.ErrUserBlocked, service.ErrNoPermission:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": err.Error(),
+			})
+		case service.ErrMessageDeleted, service.ErrNothingToForward, service.ErrTooManyForwards:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	for i := range messages {
+		h.hub.BroadcastNewMessage(&messages[i])
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"messages": messages,
+	})
+}
+
+// EditMessageRequest запрос на редактирование сообщения
+type EditMessageRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// EditMessage редактирует сообщение
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid message ID",
+		})
+		return
+	}
+
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	message, err := h.messageService.UpdateMessage(c.Request.Context(), chatID, messageID, userID, req.Content)
+	if err != nil {
+		switch err {
+		case service.ErrChatNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Chat not found",
+			})
+		case service.ErrMessageNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Message not found",
+			})
+		case service.ErrNotMember, service.ErrNoPermission:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Access denied",
+			})
+		case service.ErrUserBlocked:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": err.Error(),
+			})
+		case service.ErrEmptyContent, service.ErrMessageDeleted, service.ErrEditWindowExpired:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	h.hub.BroadcastMessageEdited(message)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+	})
+}
+
+// DeleteMessage удаляет сообщение (?for_everyone=true — у всех участников)
+func (h *ChatHandler) DeleteMessage(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid message ID",
+		})
+		return
+	}
+
+	forEveryone := c.Query("for_everyone") == "true"
+
+	if _, err := h.messageService.DeleteMessage(c.Request.Context(), chatID, messageID, userID, forEveryone); err != nil {
+		switch err {
+		case service.ErrMessageNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Message not found",
+			})
+		case service.ErrNotMember, service.ErrNoPermission:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Access denied",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	h.hub.BroadcastMessageDeleted(userID, chatID, messageID, forEveryone)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Message deleted",
+	})
+}
+
+// GetThread возвращает корневое сообщение и страницу ответов ветки.
+// Параметры прокрутки те же, что у GetMessages.
+func (h *ChatHandler) GetThread(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, messageID, ok := parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	params, ok := parsePageParams(c)
+	if !ok {
+		return
+	}
+
+	thread, err := h.messageService.GetThread(c.Request.Context(), chatID, messageID, userID, params)
+	if err != nil {
+		respondThreadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, thread)
+}
+
+// MarkThreadRead отмечает ветку прочитанной
+func (h *ChatHandler) MarkThreadRead(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, messageID, ok := parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.messageService.MarkThreadRead(c.Request.Context(), chatID, messageID, userID); err != nil {
+		respondThreadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Thread marked as read",
+	})
+}
+
+// respondThreadError отвечает на ошибку операции с веткой
+func respondThreadError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrChatNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Chat not found",
+		})
+	case service.ErrMessageNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Thread not found",
+		})
+	case service.ErrNotMember:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Access denied",
+		})
+	case service.ErrInvalidCursor:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+	}
+}
+
+// ReactionRequest запрос на добавление реакции
+type ReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+// GetReactions возвращает пользователей, отреагировавших на сообщение (?emoji= — фильтр).
+// Подписчикам канала возвращается только сводка counts.
+func (h *ChatHandler) GetReactions(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, messageID, ok := parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	reactions, err := h.messageService.GetReactions(c.Request.Context(), chatID, messageID, userID, c.Query("emoji"))
+	if err != nil {
+		respondReactionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reactions)
+}
+
+// AddReaction ставит реакцию на сообщение
+func (h *ChatHandler) AddReaction(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, messageID, ok := parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	var req ReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	update, err := h.messageService.AddReaction(c.Request.Context(), chatID, messageID, userID, req.Emoji)
+	if err != nil {
+		respondReactionError(c, err)
+		return
+	}
+
+	h.hub.BroadcastReactionUpdated(update)
+
+	c.JSON(http.StatusOK, update)
+}
+
+// RemoveReaction снимает реакцию с сообщения
+func (h *ChatHandler) RemoveReaction(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, messageID, ok := parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	update, err := h.messageService.RemoveReaction(c.Request.Context(), chatID, messageID, userID, c.Param("emoji"))
+	if err != nil {
+		respondReactionError(c, err)
+		return
+	}
+
+	h.hub.BroadcastReactionUpdated(update)
+
+	c.JSON(http.StatusOK, update)
+}
+
+// parseMessageParams разбирает ID чата и сообщения из пути
+func parseMessageParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	messageID, err := uuid.Parse(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid message ID",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return chatID, messageID, true
+}
+
+// respondReactionError отвечает на ошибку операции с реакциями
+func respondReactionError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrChatNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Chat not found",
+		})
+	case service.ErrMessageNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Message not found",
+		})
+	case service.ErrNotMember:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Access denied",
+		})
+	case service.ErrUserBlocked:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+	case service.ErrInvalidReaction:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	case service.ErrMessageDeleted, service.ErrTooManyReactions:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+	}
+}
+
+// GetPins возвращает закреплённые сообщения чата
+func (h *ChatHandler) GetPins(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	pins, err := h.chatService.GetPins(c.Request.Context(), chatID, userID)
+	if err != nil {
+		respondPinError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pins": pins,
+	})
+}
+
+// PinMessage закрепляет сообщение в чате
+func (h *ChatHandler) PinMessage(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, messageID, ok := parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	pin, added, err := h.chatService.PinMessage(c.Request.Context(), chatID, messageID, userID)
+	if err != nil {
+		respondPinError(c, err)
+		return
+	}
+
+	if added {
+		h.hub.BroadcastMessagePinned(pin)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pin": pin,
+	})
+}
+
+// UnpinMessage открепляет сообщение
+func (h *ChatHandler) UnpinMessage(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, messageID, ok := parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	removed, err := h.chatService.UnpinMessage(c.Request.Context(), chatID, messageID, userID)
+	if err != nil {
+		respondPinError(c, err)
+		return
+	}
+
+	if removed {
+		h.hub.BroadcastMessageUnpinned(chatID, messageID, userID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Message unpinned",
+	})
+}
+
+// respondPinError отвечает на ошибку закрепления сообщения
+func respondPinError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrChatNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Chat not found",
+		})
+	case service.ErrMessageNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Message not found",
+		})
+	case service.ErrNotMember, service.ErrNoPermission:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Access denied",
+		})
+	case service.ErrMessageDeleted, service.ErrTooManyPins:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+	}
+}
+
+// GetReceipts возвращает отметки доставки и прочтения сообщения (только для отправителя)
+func (h *ChatHandler) GetReceipts(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, messageID, ok := parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	receipts, err := h.messageService.GetReceipts(c.Request.Context(), chatID, messageID, userID)
+	if err != nil {
+		switch err {
+		case service.ErrChatNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Chat not found",
+			})
+		case service.ErrMessageNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Message not found",
+			})
+		case service.ErrNotMember, service.ErrNoPermission:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Access denied",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"receipts": receipts,
+	})
+}
+
+// MarkChatAsRead отмечает чат как прочитанный
+func (h *ChatHandler) MarkChatAsRead(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	update, err := h.messageService.MarkChatAsRead(c.Request.Context(), chatID, userID)
+	if err != nil {
+		if err == service.ErrNotMember {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Access denied",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	h.hub.BroadcastRead(update)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Chat marked as read",
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+
+	"dildogram/backend/internal/middleware"
+	"dildogram/backend/internal/service"
+	"dildogram/backend/internal/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// BlockHandler обрабатывает запросы чёрного списка
+type BlockHandler struct {
+	blockService *service.BlockService
+	hub          *websocket.Hub
+}
+
+// NewBlockHandler создаёт новый BlockHandler
+func NewBlockHandler(blockService *service.BlockService, hub *websocket.Hub) *BlockHandler {
+	return &BlockHandler{
+		blockService: blockService,
+		hub:          hub,
+	}
+}
+
+// BlockUserRequest запрос на блокировку пользователя
+type BlockUserRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+// GetBlockedUsers возвращает чёрный список текущего пользователя
+func (h *BlockHandler) GetBlockedUsers(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	blocked, err := h.blockService.GetBlockedUsers(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"blocked": blocked,
+	})
+}
+
+// BlockUser добавляет пользователя в чёрный список
+func (h *BlockHandler) BlockUser(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req BlockUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	blockedUserID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	added, err := h.blockService.BlockUser(c.Request.Context(), userID, blockedUserID)
+	if err != nil {
+		switch err {
+		case service.ErrCannotBlockSelf:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Cannot block yourself",
+			})
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	// Статус, полученный до блокировки, больше не обновится — скрываем его сразу
+	if added {
+		h.hub.HidePresence(userID, blockedUserID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User blocked",
+	})
+}
+
+// UnblockUser убирает пользователя из чёрного списка
+func (h *BlockHandler) UnblockUser(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	blockedUserID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	if err := h.blockService.UnblockUser(c.Request.Context(), userID, blockedUserID); err != nil {
+		if err == service.ErrNotBlocked {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User is not blocked",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User unblocked",
+	})
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"net/http"
+
+	"dildogram/backend/internal/middleware"
+	"dildogram/backend/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ContactHandler обрабатывает запросы контактов
+type ContactHandler struct {
+	contactService *service.ContactService
+}
+
+// NewContactHandler создаёт новый ContactHandler
+func NewContactHandler(contactService *service.ContactService) *ContactHandler {
+	return &ContactHandler{
+		contactService: contactService,
+	}
+}
+
+// AddContactRequest запрос на добавление контакта
+type AddContactRequest struct {
+	UserID    string `json:"user_id" binding:"required"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// ImportContactEntry запись адресной книги.
+// Передаётся phone (номер с кодом страны) или phone_hash — SHA-256 номера в E.164 в hex.
+// client_id возвращается в ответе, чтобы клиент сопоставил результат со своей записью.
+type ImportContactEntry struct {
+	ClientID  string `json:"client_id"`
+	Phone     string `json:"phone"`
+	PhoneHash string `json:"phone_hash"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// ImportContactsRequest запрос на импорт адресной книги
+type ImportContactsRequest struct {
+	Contacts []ImportContactEntry `json:"contacts" binding:"required"`
+}
+
+// GetContacts возвращает контакты текущего пользователя
+func (h *ContactHandler) GetContacts(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	contacts, err := h.contactService.GetContacts(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"contacts": contacts,
+	})
+}
+
+// AddContact добавляет пользователя в контакты или меняет имя контакта
+func (h *ContactHandler) AddContact(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req AddContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	contactUserID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	contact, err := h.contactService.AddContact(c.Request.Context(), userID, contactUserID, req.FirstName, req.LastName)
+	if err != nil {
+		switch err {
+		case service.ErrCannotAddSelfContact:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Cannot add yourself to contacts",
+			})
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"contact": contact,
+	})
+}
+
+// RemoveContact удаляет пользователя из контактов
+func (h *ContactHandler) RemoveContact(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	contactUserID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	if err := h.contactService.RemoveContact(c.Request.Context(), userID, contactUserID); err != nil {
+		if err == service.ErrContactNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Contact not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Contact removed",
+	})
+}
+
+// ImportContacts сопоставляет адресную книгу с зарегистрированными пользователями.
+// Сверх суточной квоты номеров отвечает 429 с Retry-After.
+func (h *ContactHandler) ImportContacts(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req ImportContactsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	entries := make([]service.ContactImport, len(req.Contacts))
+	for i, entry := range req.Contacts {
+		entries[i] = service.ContactImport{
+			ClientID:  entry.ClientID,
+			Phone:     entry.Phone,
+			PhoneHash: entry.PhoneHash,
+			FirstName: entry.FirstName,
+			LastName:  entry.LastName,
+		}
+	}
+
+	result, err := h.contactService.ImportContacts(c.Request.Context(), userID, entries)
+	if err != nil {
+		if respondRateLimited(c, err) {
+			return
+		}
+		switch err {
+		case service.ErrNothingToImport, service.ErrTooManyContacts, service.ErrContactLimitReached:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
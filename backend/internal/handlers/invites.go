@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"dildogram/backend/internal/middleware"
+	"dildogram/backend/internal/service"
+	"dildogram/backend/internal/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// InviteHandler обрабатывает запросы ссылок-приглашений и заявок на вступление
+type InviteHandler struct {
+	inviteService *service.InviteService
+	hub           *websocket.Hub
+}
+
+// NewInviteHandler создаёт новый InviteHandler
+func NewInviteHandler(inviteService *service.InviteService, hub *websocket.Hub) *InviteHandler {
+	return &InviteHandler{
+		inviteService: inviteService,
+		hub:           hub,
+	}
+}
+
+// CreateInviteRequest запрос на создание ссылки-приглашения
+type CreateInviteRequest struct {
+	Name             string     `json:"name"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	UsageLimit       *int       `json:"usage_limit"`
+	RequiresApproval bool       `json:"requires_approval"`
+}
+
+// GetInvites возвращает ссылки-приглашения группы
+func (h *InviteHandler) GetInvites(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	invites, err := h.inviteService.GetInvites(c.Request.Context(), chatID, userID)
+	if err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invites": invites,
+	})
+}
+
+// CreateInvite создаёт ссылку-приглашение в группу
+func (h *InviteHandler) CreateInvite(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	invite, err := h.inviteService.CreateInvite(c.Request.Context(), chatID, userID, service.InviteParams{
+		Name:             req.Name,
+		ExpiresAt:        req.ExpiresAt,
+		UsageLimit:       req.UsageLimit,
+		RequiresApproval: req.RequiresApproval,
+	})
+	if err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invite": invite,
+	})
+}
+
+// RevokeInvite отзывает ссылку-приглашение
+func (h *InviteHandler) RevokeInvite(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	inviteID, err := uuid.Parse(c.Param("inviteId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid invite ID",
+		})
+		return
+	}
+
+	if err := h.inviteService.RevokeInvite(c.Request.Context(), chatID, userID, inviteID); err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invite revoked",
+	})
+}
+
+// GetPreview возвращает сведения о группе по коду ссылки
+func (h *InviteHandler) GetPreview(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	preview, err := h.inviteService.GetPreview(c.Request.Context(), c.Param("code"), userID)
+	if err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chat": preview,
+	})
+}
+
+// Join вступает в группу по ссылке. Если ссылка требует одобрения,
+// создаётся заявка и возвращается 202.
+func (h *InviteHandler) Join(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	result, err := h.inviteService.JoinByInvite(c.Request.Context(), c.Param("code"), userID)
+	if err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	if result.Request != nil {
+		if len(result.Approvers) > 0 {
+			h.hub.NotifyJoinRequest(result.Request, result.Approvers)
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Join request sent",
+		})
+		return
+	}
+
+	h.hub.BroadcastMemberAdded(result.Chat, userID, userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"chat": result.Chat,
+	})
+}
+
+// GetJoinRequests возвращает заявки на вступление в группу
+func (h *InviteHandler) GetJoinRequests(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	requests, err := h.inviteService.GetJoinRequests(c.Request.Context(), chatID, userID)
+	if err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requests": requests,
+	})
+}
+
+// ApproveJoinRequest одобряет заявку на вступление
+func (h *InviteHandler) ApproveJoinRequest(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, requesterID, ok := parseMemberParams(c)
+	if !ok {
+		return
+	}
+
+	chat, err := h.inviteService.ApproveJoinRequest(c.Request.Context(), chatID, userID, requesterID)
+	if err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	if chat != nil {
+		h.hub.BroadcastMemberAdded(chat, requesterID, userID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Join request approved",
+	})
+}
+
+// DeclineJoinRequest отклоняет заявку на вступление
+func (h *InviteHandler) DeclineJoinRequest(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, requesterID, ok := parseMemberParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.inviteService.DeclineJoinRequest(c.Request.Context(), chatID, userID, requesterID); err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Join request declined",
+	})
+}
+
+// respondInviteError отвечает на ошибку ссылок-приглашений и заявок
+func respondInviteError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrInviteNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Invite link not found",
+		})
+	case service.ErrJoinRequestNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Join request not found",
+		})
+	case service.ErrInviteExpired:
+		c.JSON(http.StatusGone, gin.H{
+			"error": err.Error(),
+		})
+	case service.ErrAlreadyMember:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+	case service.ErrInvalidInviteSettings:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		respondChatError(c, err)
+	}
+}
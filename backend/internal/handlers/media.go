@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dildogram/backend/internal/middleware"
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Запас на заголовки multipart сверх максимального размера файла
+const multipartOverhead = 1 << 20
+
+// MediaHandler обрабатывает загрузку и выдачу вложений
+type MediaHandler struct {
+	mediaService *service.MediaService
+	maxFileSize  int64
+}
+
+// NewMediaHandler создаёт новый MediaHandler
+func NewMediaHandler(mediaService *service.MediaService, maxFileSize int64) *MediaHandler {
+	return &MediaHandler{
+		mediaService: mediaService,
+		maxFileSize:  maxFileSize,
+	}
+}
+
+// Upload загружает вложение в чат.
+// Тело multipart/form-data: необязательные поля type (image, file, voice) и duration,
+// за которыми следует файл в поле file. Файл пишется потоково, без буферизации в памяти.
+func (h *MediaHandler) Upload(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid chat ID",
+		})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxFileSize+multipartOverhead)
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Multipart form expected",
+		})
+		return
+	}
+
+	var upload service.MediaUpload
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Failed to read multipart form",
+			})
+			return
+		}
+
+		switch part.FormName() {
+		case "type":
+			value, _ := io.ReadAll(io.LimitReader(part, 32))
+			upload.Kind = models.MessageType(strings.TrimSpace(string(value)))
+
+		case "duration":
+			value, _ := io.ReadAll(io.LimitReader(part, 32))
+			duration, err := strconv.ParseFloat(strings.TrimSpace(string(value)), 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid duration",
+				})
+				return
+			}
+			upload.Duration = &duration
+
+		case "file":
+			upload.FileName = part.FileName()
+			upload.Content = part
+
+			attachment, err := h.mediaService.Upload(c.Request.Context(), chatID, userID, upload)
+			if err != nil {
+				h.respondUploadError(c, err)
+				return
+			}
+
+			c.JSON(http.StatusCreated, gin.H{
+				"attachment": attachment,
+				"media_url":  attachment.URL(),
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": "File required",
+	})
+}
+
+// respondUploadError отвечает на ошибку загрузки вложения
+func (h *MediaHandler) respondUploadError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case err == service.ErrChatNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Chat not found",
+		})
+	case err == service.ErrNotMember || err == service.ErrNoPermission:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Access denied",
+		})
+	case err == service.ErrUserBlocked:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+	case err == service.ErrFileTooLarge || errors.As(err, &maxBytesErr):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File is too large",
+			"max_size": h.maxFileSize,
+		})
+	case err == service.ErrUnsupportedMedia || err == service.ErrInvalidDuration:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to save file",
+		})
+	}
+}
+
+// Download перенаправляет участника чата на временную ссылку на вложение
+func (h *MediaHandler) Download(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	attachmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid attachment ID",
+		})
+		return
+	}
+
+	// size — размер превью изображения (см. attachment.preview.thumbnails)
+	size := 0
+	if value := c.Query("size"); value != "" {
+		if size, err = strconv.Atoi(value); err != nil || size <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid size",
+			})
+			return
+		}
+	}
+
+	url, err := h.mediaService.DownloadURL(c.Request.Context(), attachmentID, userID, size)
+	if err != nil {
+		if err == service.ErrAttachmentNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Attachment not found",
+			})
+			return
+		}
+		if err == service.ErrNotMember {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Access denied",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Сам файл отдаёт хранилище по временной подписанной ссылке
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, url)
+}
+
+// Avatar перенаправляет на временную ссылку на файл аватара.
+// URL аватара в профиле постоянный, а ссылки хранилища истекают.
+func (h *MediaHandler) Avatar(c *gin.Context) {
+	url, err := h.mediaService.AvatarURL(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		if err == service.ErrAttachmentNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Avatar not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, url)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"dildogram/backend/internal/middleware"
+	"dildogram/backend/internal/service"
+	"dildogram/backend/internal/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// SyncHandler отдаёт клиентам обновления, пропущенные без соединения
+type SyncHandler struct {
+	syncService *service.SyncService
+}
+
+// NewSyncHandler создаёт новый SyncHandler
+func NewSyncHandler(syncService *service.SyncService) *SyncHandler {
+	return &SyncHandler{
+		syncService: syncService,
+	}
+}
+
+// GetUpdates возвращает обновления пользователя во всех чатах после since.
+// Параметры: since (номер последнего полученного обновления), channel_pts
+// (отметка каналов из прошлого ответа) и limit.
+// При has_more клиент повторяет запрос с seq из ответа, при too_far_behind —
+// перезагружает чаты целиком и продолжает с seq. Историю каналов из channels
+// клиент догружает сам.
+func (h *SyncHandler) GetUpdates(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	since, err := strconv.ParseInt(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid since",
+		})
+		return
+	}
+
+	channelPts, err := strconv.ParseInt(c.DefaultQuery("channel_pts", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid channel_pts",
+		})
+		return
+	}
+
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		if _, err := fmt.Sscanf(l, "%d", &limit); err != nil {
+			limit = 0
+		}
+	}
+
+	result, err := h.syncService.GetUpdates(c.Request.Context(), userID, since, channelPts, limit)
+	if err != nil {
+		if err == service.ErrInvalidSyncState {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, websocket.ToSyncResultPayload(result))
+}
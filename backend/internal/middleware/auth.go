@@ -5,14 +5,14 @@ import (
 	"strings"
 
 	"dildogram/backend/internal/service"
-	"dildogram/backend/pkg/jwt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 const (
-	UserIDKey = "userID"
-	UsernameKey = "username"
+	UserIDKey    = "userID"
+	UsernameKey  = "username"
+	SessionIDKey = "sessionID"
 )
 
 // AuthMiddleware создаёт middleware для JWT аутентификации
@@ -49,6 +49,7 @@ func AuthMiddleware(authService *service.AuthService) gin.HandlerFunc {
 		// Сохраняем данные пользователя в контексте
 		c.Set(UserIDKey, claims.UserID.String())
 		c.Set(UsernameKey, claims.Username)
+		c.Set(SessionIDKey, claims.SessionID)
 
 		c.Next()
 	}
@@ -70,6 +71,7 @@ func OptionalAuthMiddleware(authService *service.AuthService) gin.HandlerFunc {
 			if err == nil {
 				c.Set(UserIDKey, claims.UserID.String())
 				c.Set(UsernameKey, claims.Username)
+				c.Set(SessionIDKey, claims.SessionID)
 			}
 		}
 
@@ -95,6 +97,15 @@ func GetUserID(c *gin.Context) (uuid.UUID, error) {
 	return uuid.Nil, nil
 }
 
+// GetSessionID извлекает ID текущей сессии из контекста
+func GetSessionID(c *gin.Context) uuid.UUID {
+	sessionID, _ := c.Get(SessionIDKey)
+	if id, ok := sessionID.(uuid.UUID); ok {
+		return id
+	}
+	return uuid.Nil
+}
+
 // GetUsername извлекает имя пользователя из контекста
 func GetUsername(c *gin.Context) string {
 	username, _ := c.Get(UsernameKey)
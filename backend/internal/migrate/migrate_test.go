@@ -0,0 +1,249 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dildogram/backend/migrations"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// openTestDB создаёт на сервере из TEST_DATABASE_URL отдельную пустую базу
+// и удаляет её после теста: миграции откатывают схему целиком, поэтому
+// общую с другими тестами базу трогать нельзя.
+// Без TEST_DATABASE_URL тест пропускается.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("invalid TEST_DATABASE_URL: %v", err)
+	}
+	admin := stdlib.OpenDB(*cfg)
+	t.Cleanup(func() { admin.Close() })
+
+	name := "migrate_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec(`CREATE DATABASE ` + name); err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+
+	cfg.Database = name
+	db := stdlib.OpenDB(*cfg)
+	t.Cleanup(func() {
+		db.Close()
+		if _, err := admin.Exec(`DROP DATABASE IF EXISTS ` + name); err != nil {
+			t.Errorf("failed to drop test database: %v", err)
+		}
+	})
+	return db
+}
+
+func newTestMigrator(t *testing.T, db *sql.DB) *Migrator {
+	t.Helper()
+
+	migrator, err := New(db, migrations.FS)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	return migrator
+}
+
+// tableExists проверяет, есть ли таблица в базе
+func tableExists(t *testing.T, db *sql.DB, table string) bool {
+	t.Helper()
+
+	var exists bool
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+		t.Fatalf("failed to check table %s: %v", table, err)
+	}
+	return exists
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrator := newTestMigrator(t, db)
+	total := len(migrator.migrations)
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if len(applied) != total {
+		t.Fatalf("Up() applied %d migrations, want %d", len(applied), total)
+	}
+	if !tableExists(t, db, "users") {
+		t.Fatal("users table is missing after Up()")
+	}
+
+	// Повторный запуск ничего не делает
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("second Up() = %d migrations, %v; want none", len(applied), err)
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("Pending() = %d migrations, %v; want none", len(pending), err)
+	}
+
+	// Откат последней миграции делает её снова неприменённой
+	reverted, err := migrator.Down(ctx, 1)
+	if err != nil {
+		t.Fatalf("Down(1) error = %v", err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != migrator.Latest() {
+		t.Fatalf("Down(1) reverted %v, want version %d", reverted, migrator.Latest())
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if last := statuses[len(statuses)-1]; last.AppliedAt != nil {
+		t.Fatalf("version %d is still applied after Down(1)", last.Version)
+	}
+
+	// Полный откат и повторное применение проверяют все down-файлы
+	if reverted, err := migrator.Down(ctx, total); err != nil || len(reverted) != total-1 {
+		t.Fatalf("Down(all) = %d migrations, %v; want %d", len(reverted), err, total-1)
+	}
+	if tableExists(t, db, "users") {
+		t.Fatal("users table is left after full Down()")
+	}
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != total {
+		t.Fatalf("Up() after Down() = %d migrations, %v; want %d", len(applied), err, total)
+	}
+}
+
+func TestUpRefusesLegacySchema(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrator := newTestMigrator(t, db)
+
+	// Схема, созданная AutoMigrate без истории миграций
+	if _, err := db.Exec(`CREATE TABLE users (id UUID PRIMARY KEY)`); err != nil {
+		t.Fatalf("failed to create legacy table: %v", err)
+	}
+
+	if _, err := migrator.Up(ctx); !errors.Is(err, ErrLegacySchema) {
+		t.Fatalf("Up() error = %v, want ErrLegacySchema", err)
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil || len(pending) != len(migrator.migrations) {
+		t.Fatalf("Pending() = %d migrations, %v; want all", len(pending), err)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrator := newTestMigrator(t, db)
+	first := migrator.migrations[0].Version
+
+	if err := migrator.Baseline(ctx, 999999); !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("Baseline(unknown) error = %v, want ErrUnknownVersion", err)
+	}
+
+	// Первая миграция уже применена вручную: отмечаем её и применяем остальные
+	if _, err := db.Exec(migrator.migrations[0].Up); err != nil {
+		t.Fatalf("failed to apply first migration by hand: %v", err)
+	}
+	if err := migrator.Baseline(ctx, first); err != nil {
+		t.Fatalf("Baseline() error = %v", err)
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil || len(pending) != len(migrator.migrations)-1 {
+		t.Fatalf("Pending() after Baseline() = %d migrations, %v; want %d", len(pending), err, len(migrator.migrations)-1)
+	}
+
+	if err := migrator.Baseline(ctx, first); !errors.Is(err, ErrAlreadyTracked) {
+		t.Fatalf("second Baseline() error = %v, want ErrAlreadyTracked", err)
+	}
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != len(migrator.migrations)-1 {
+		t.Fatalf("Up() after Baseline() = %d migrations, %v; want %d", len(applied), err, len(migrator.migrations)-1)
+	}
+}
+
+func TestUpWaitsForMigrationLock(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrator := newTestMigrator(t, db)
+
+	// Другая реплика держит блокировку
+	holder, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to open connection: %v", err)
+	}
+	defer holder.Close()
+	if _, err := holder.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		t.Fatalf("failed to take lock: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := migrator.Up(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Up() finished while lock was held: %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if tableExists(t, db, "users") {
+		t.Fatal("Up() migrated while lock was held")
+	}
+
+	if _, err := holder.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+		t.Fatalf("failed to release lock: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Up() did not finish after lock was released")
+	}
+}
+
+func TestConcurrentUpAppliesEachMigrationOnce(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int
+	)
+	for i := 0; i < 3; i++ {
+		migrator := newTestMigrator(t, db)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied, err := migrator.Up(ctx)
+			if err != nil {
+				t.Errorf("Up() error = %v", err)
+			}
+			mu.Lock()
+			total += len(applied)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if want := len(newTestMigrator(t, db).migrations); total != want {
+		t.Fatalf("replicas applied %d migrations in total, want %d", total, want)
+	}
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MediaURLPrefix префикс URL, по которому участники чата получают вложения
+const MediaURLPrefix = "/api/v1/media/"
+
+// Attachment представляет загруженный файл (изображение, документ, голосовое)
+type Attachment struct {
+	ID         uuid.UUID    `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ChatID     uuid.UUID    `gorm:"type:uuid;not null;index" json:"chat_id"`
+	UploaderID uuid.UUID    `gorm:"type:uuid;not null;index" json:"uploader_id"`
+	MessageID  *uuid.UUID   `gorm:"type:uuid;uniqueIndex" json:"message_id,omitempty"`
+	Kind       MessageType  `gorm:"size:20;not null" json:"kind"`
+	StorageKey string       `gorm:"size:500;not null" json:"-"`
+	FileName   string       `gorm:"size:255;not null;default:''" json:"file_name"`
+	MimeType   string       `gorm:"size:100;not null" json:"mime_type"`
+	Size       int64        `gorm:"not null" json:"size"`
+	Width      *int         `json:"width,omitempty"`
+	Height     *int         `json:"height,omitempty"`
+	Duration   *float64     `json:"duration,omitempty"`
+	Preview    ImagePreview `gorm:"embedded" json:"preview"`
+	CreatedAt  time.Time    `gorm:"not null;default:now()" json:"created_at"`
+}
+
+// TableName возвращает имя таблицы
+func (Attachment) TableName() string {
+	return "attachments"
+}
+
+// URL возвращает адрес вложения для Message.MediaURL
+func (a *Attachment) URL() string {
+	return MediaURLPrefix + a.ID.String()
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserBlock запись чёрного списка: UserID заблокировал BlockedUserID
+type UserBlock struct {
+	UserID        uuid.UUID `gorm:"type:uuid;primary_key" json:"-"`
+	BlockedUserID uuid.UUID `gorm:"type:uuid;primary_key" json:"blocked_user_id"`
+	CreatedAt     time.Time `gorm:"not null;default:now()" json:"created_at"`
+
+	// Связи
+	BlockedUser *User `gorm:"foreignKey:BlockedUserID" json:"-"`
+}
+
+// TableName возвращает имя таблицы
+func (UserBlock) TableName() string {
+	return "user_blocks"
+}
+
+// BlockInfo заблокированный пользователь с профилем, каким его видит заблокировавший
+type BlockInfo struct {
+	User      PublicUser `json:"user"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -12,6 +12,7 @@ type ChatType string
 const (
 	ChatTypePrivate ChatType = "private"
 	ChatTypeGroup   ChatType = "group"
+	ChatTypeChannel ChatType = "channel" // Пишут владелец и админы, подписчики только читают
 )
 
 // MemberRole определяет роль участника
@@ -25,21 +26,30 @@ const (
 
 // Chat представляет чат (личный или групповой)
 type Chat struct {
-	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	Type          ChatType   `gorm:"size:20;not null" json:"type"`
-	Name          string     `gorm:"size:100;not null;default:''" json:"name"`
-	Description   string     `gorm:"type:text;not null;default:''" json:"description"`
-	AvatarURL     string     `gorm:"size:500;not null;default:''" json:"avatar_url"`
-	CreatedBy     uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
-	CreatedAt     time.Time  `gorm:"not null;default:now()" json:"created_at"`
-	UpdatedAt     time.Time  `gorm:"not null;default:now()" json:"updated_at"`
-	LastMessageAt *time.Time `gorm:"index" json:"last_message_at"`
-	DeletedAt     *time.Time `gorm:"index" json:"-"`
+	ID                 uuid.UUID       `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Type               ChatType        `gorm:"size:20;not null" json:"type"`
+	Name               string          `gorm:"size:100;not null;default:''" json:"name"`
+	Description        string          `gorm:"type:text;not null;default:''" json:"description"`
+	AvatarURL          string          `gorm:"size:500;not null;default:''" json:"avatar_url"`
+	AvatarPreview      ImagePreview    `gorm:"embedded;embeddedPrefix:avatar_" json:"avatar_preview"`
+	ProtectedContent   bool            `gorm:"not null;default:false" json:"protected_content"`          // Запрет пересылки сообщений из чата
+	Handle             *string         `gorm:"size:32" json:"handle,omitempty"`                          // Публичный адрес канала, nil — канал частный
+	DefaultPermissions ChatPermissions `gorm:"embedded;embeddedPrefix:perm_" json:"default_permissions"` // Права обычных участников группы
+	CreatedBy          uuid.UUID       `gorm:"type:uuid;not null" json:"created_by"`
+	CreatedAt          time.Time       `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt          time.Time       `gorm:"not null;default:now()" json:"updated_at"`
+	LastMessageAt      *time.Time      `gorm:"index" json:"last_message_at"`
+	DeletedAt          *time.Time      `gorm:"index" json:"-"`
 
 	// Связи
-	Creator   *User            `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
-	Members   []ChatMembership `gorm:"foreignKey:ChatID" json:"members,omitempty"`
-	Messages  []Message        `gorm:"foreignKey:ChatID" json:"-"`
+	Creator  *User            `gorm:"foreignKey:CreatedBy" json:"-"`
+	Members  []ChatMembership `gorm:"foreignKey:ChatID" json:"members,omitempty"`
+	Messages []Message        `gorm:"foreignKey:ChatID" json:"-"`
+
+	// Заполняется сервисом для каналов, список участников которых не отдаётся
+	MemberCount *int64 `gorm:"-" json:"member_count,omitempty"`
+	// Профиль создателя, каким его видит запросивший чат. Заполняется сервисом.
+	CreatorProfile *PublicUser `gorm:"-" json:"creator,omitempty"`
 }
 
 // TableName возвращает имя таблицы
@@ -49,16 +59,20 @@ func (Chat) TableName() string {
 
 // ChatMembership представляет участника чата
 type ChatMembership struct {
-	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	ChatID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_chat_user" json:"chat_id"`
-	UserID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_chat_user" json:"user_id"`
-	Role      MemberRole `gorm:"size:20;not null;default:'member'" json:"role"`
-	JoinedAt  time.Time  `gorm:"not null;default:now()" json:"joined_at"`
-	LeftAt    *time.Time `gorm:"index" json:"left_at"`
+	ID               uuid.UUID       `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ChatID           uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_chat_user" json:"chat_id"`
+	UserID           uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_chat_user" json:"user_id"`
+	Role             MemberRole      `gorm:"size:20;not null;default:'member'" json:"role"`
+	AdminPermissions ChatPermissions `gorm:"embedded;embeddedPrefix:perm_" json:"admin_permissions"` // Права админа, у остальных ролей не используются
+	JoinedAt         time.Time       `gorm:"not null;default:now()" json:"joined_at"`
+	LeftAt           *time.Time      `gorm:"index" json:"left_at"`
 
 	// Связи
 	Chat *Chat `gorm:"foreignKey:ChatID" json:"-"`
-	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	User *User `gorm:"foreignKey:UserID" json:"-"`
+
+	// Профиль участника, каким его видит запросивший. Заполняется сервисом.
+	UserProfile *PublicUser `gorm:"-" json:"user,omitempty"`
 }
 
 // TableName возвращает имя таблицы
@@ -71,13 +85,128 @@ func (m *ChatMembership) IsActive() bool {
 	return m.LeftAt == nil
 }
 
+// Permissions возвращает действующие права участника в чате.
+// В личных чатах оба собеседника могут писать, отправлять медиа и закреплять сообщения.
+// В группах и каналах владельцу доступно всё, админу — выданные ему права.
+// Участникам групп доступны права участников, подписчики каналов только читают.
+func (m *ChatMembership) Permissions(chat *Chat) ChatPermissions {
+	switch {
+	case chat.Type == ChatTypePrivate:
+		return ChatPermissions{SendMessages: true, SendMedia: true, PinMessages: true}
+	case m.Role == MemberRoleOwner:
+		return AllChatPermissions()
+	case m.Role == MemberRoleAdmin:
+		return m.AdminPermissions
+	case chat.Type == ChatTypeChannel:
+		return ChatPermissions{}
+	default:
+		return chat.DefaultPermissions
+	}
+}
+
+// ChatPermission право участника чата
+type ChatPermission string
+
+const (
+	PermissionSendMessages   ChatPermission = "send_messages"
+	PermissionSendMedia      ChatPermission = "send_media"
+	PermissionAddMembers     ChatPermission = "add_members"
+	PermissionPinMessages    ChatPermission = "pin_messages"
+	PermissionChangeInfo     ChatPermission = "change_info"
+	PermissionDeleteMessages ChatPermission = "delete_messages" // Удаление чужих сообщений у всех
+)
+
+// ChatPermissions набор прав участника чата.
+// У колонок нет default в gorm: иначе false не записался бы в базу.
+type ChatPermissions struct {
+	SendMessages   bool `gorm:"not null" json:"send_messages"`
+	SendMedia      bool `gorm:"not null" json:"send_media"`
+	AddMembers     bool `gorm:"not null" json:"add_members"`
+	PinMessages    bool `gorm:"not null" json:"pin_messages"`
+	ChangeInfo     bool `gorm:"not null" json:"change_info"`
+	DeleteMessages bool `gorm:"not null" json:"delete_messages"`
+}
+
+// DefaultMemberPermissions права участников новой группы
+func DefaultMemberPermissions() ChatPermissions {
+	return ChatPermissions{SendMessages: true, SendMedia: true}
+}
+
+// AllChatPermissions все права — у владельца и у нового админа
+func AllChatPermissions() ChatPermissions {
+	return ChatPermissions{
+		SendMessages:   true,
+		SendMedia:      true,
+		AddMembers:     true,
+		PinMessages:    true,
+		ChangeInfo:     true,
+		DeleteMessages: true,
+	}
+}
+
+// Has проверяет, входит ли право в набор
+func (p ChatPermissions) Has(permission ChatPermission) bool {
+	switch permission {
+	case PermissionSendMessages:
+		return p.SendMessages
+	case PermissionSendMedia:
+		return p.SendMedia
+	case PermissionAddMembers:
+		return p.AddMembers
+	case PermissionPinMessages:
+		return p.PinMessages
+	case PermissionChangeInfo:
+		return p.ChangeInfo
+	case PermissionDeleteMessages:
+		return p.DeleteMessages
+	default:
+		return false
+	}
+}
+
 // ChatWithLastMessage представляет чат с последним сообщением
 type ChatWithLastMessage struct {
 	Chat
-	LastMessageID     *uuid.UUID `json:"last_message_id"`
-	LastMessageContent *string   `json:"last_message_content"`
-	LastMessageSenderID *uuid.UUID `json:"last_message_sender_id"`
+	LastMessageID        *uuid.UUID `json:"last_message_id"`
+	LastMessageContent   *string    `json:"last_message_content"`
+	LastMessageSenderID  *uuid.UUID `json:"last_message_sender_id"`
 	LastMessageCreatedAt *time.Time `json:"last_message_created_at"`
-	LastMessageStatus *string    `json:"last_message_status"`
-	UnreadCount       int64      `json:"unread_count"`
+	LastMessageStatus    *string    `json:"last_message_status"`
+	UnreadCount          int64      `json:"unread_count"`
+
+	// Последнее закреплённое сообщение
+	PinnedMessageID       *uuid.UUID `json:"pinned_message_id"`
+	PinnedMessageContent  *string    `json:"pinned_message_content"`
+	PinnedMessageSenderID *uuid.UUID `json:"pinned_message_sender_id"`
+	PinnedMessageType     *string    `json:"pinned_message_type"`
+	PinnedAt              *time.Time `json:"pinned_at"`
+}
+
+// ChannelInfo сведения о публичном канале, которые видны до подписки
+type ChannelInfo struct {
+	ID            uuid.UUID     `json:"id"`
+	Name          string        `json:"name"`
+	Description   string        `json:"description"`
+	Handle        string        `json:"handle"`
+	AvatarURL     string        `json:"avatar_url"`
+	AvatarPreview *ImagePreview `json:"avatar_preview,omitempty"`
+	MemberCount   int64         `json:"member_count"`
+	IsMember      bool          `json:"is_member"`
+}
+
+// PinnedMessage представляет сообщение, закреплённое в чате
+type PinnedMessage struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ChatID    uuid.UUID  `gorm:"type:uuid;not null" json:"chat_id"`
+	MessageID uuid.UUID  `gorm:"type:uuid;not null" json:"message_id"`
+	PinnedBy  *uuid.UUID `gorm:"type:uuid" json:"pinned_by"`
+	PinnedAt  time.Time  `gorm:"not null;default:now()" json:"pinned_at"`
+
+	// Связи
+	Message *Message `gorm:"foreignKey:MessageID" json:"message,omitempty"`
+}
+
+// TableName возвращает имя таблицы
+func (PinnedMessage) TableName() string {
+	return "pinned_messages"
 }
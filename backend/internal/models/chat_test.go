@@ -0,0 +1,53 @@
+package models
+
+import "testing"
+
+func TestMembershipPermissions(t *testing.T) {
+	adminPermissions := ChatPermissions{PinMessages: true, DeleteMessages: true}
+	groupPermissions := ChatPermissions{SendMessages: true}
+
+	tests := []struct {
+		name     string
+		chatType ChatType
+		role     MemberRole
+		want     ChatPermissions
+	}{
+		{"channel subscriber", ChatTypeChannel, MemberRoleMember, ChatPermissions{}},
+		{"channel admin", ChatTypeChannel, MemberRoleAdmin, adminPermissions},
+		{"channel owner", ChatTypeChannel, MemberRoleOwner, AllChatPermissions()},
+		{"group member", ChatTypeGroup, MemberRoleMember, groupPermissions},
+		{"group admin", ChatTypeGroup, MemberRoleAdmin, adminPermissions},
+		{"private chat", ChatTypePrivate, MemberRoleMember, ChatPermissions{SendMessages: true, SendMedia: true, PinMessages: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat := &Chat{Type: tt.chatType, DefaultPermissions: groupPermissions}
+			member := &ChatMembership{Role: tt.role, AdminPermissions: adminPermissions}
+
+			if got := member.Permissions(chat); got != tt.want {
+				t.Errorf("Permissions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelSubscriberHasNoPermissions(t *testing.T) {
+	// Права участников по умолчанию на подписчиков канала не распространяются
+	chat := &Chat{Type: ChatTypeChannel, DefaultPermissions: AllChatPermissions()}
+	member := &ChatMembership{Role: MemberRoleMember}
+
+	permissions := member.Permissions(chat)
+	for _, permission := range []ChatPermission{
+		PermissionSendMessages,
+		PermissionSendMedia,
+		PermissionAddMembers,
+		PermissionPinMessages,
+		PermissionChangeInfo,
+		PermissionDeleteMessages,
+	} {
+		if permissions.Has(permission) {
+			t.Errorf("channel subscriber has %s", permission)
+		}
+	}
+}
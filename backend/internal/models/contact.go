@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Contact представляет пользователя в контактах другого пользователя.
+// FirstName и LastName — имя, под которым владелец записал контакт.
+type Contact struct {
+	UserID        uuid.UUID `gorm:"type:uuid;primary_key" json:"-"`
+	ContactUserID uuid.UUID `gorm:"type:uuid;primary_key" json:"contact_user_id"`
+	FirstName     string    `gorm:"size:50;not null;default:''" json:"first_name"`
+	LastName      string    `gorm:"size:50;not null;default:''" json:"last_name"`
+	CreatedAt     time.Time `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"not null;default:now()" json:"updated_at"`
+
+	// Связи
+	ContactUser *User `gorm:"foreignKey:ContactUserID" json:"-"`
+}
+
+// TableName возвращает имя таблицы
+func (Contact) TableName() string {
+	return "contacts"
+}
+
+// ImportedContact номер из адресной книги, владелец которого ещё не зарегистрирован
+type ImportedContact struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primary_key" json:"-"`
+	PhoneHash string    `gorm:"size:64;primary_key" json:"phone_hash"`
+	FirstName string    `gorm:"size:50;not null;default:''" json:"first_name"`
+	LastName  string    `gorm:"size:50;not null;default:''" json:"last_name"`
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+}
+
+// TableName возвращает имя таблицы
+func (ImportedContact) TableName() string {
+	return "imported_contacts"
+}
+
+// ContactInfo контакт вместе с профилем пользователя, каким его видит владелец
+type ContactInfo struct {
+	User      PublicUser `json:"user"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	// Mutual — владелец тоже есть в контактах этого пользователя
+	Mutual    bool      `json:"mutual"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ContactImportLog импорт адресной книги: сколько номеров пользователь сверил с базой.
+// По этим записям считается суточная квота импорта.
+type ContactImportLog struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"-"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null" json:"-"`
+	Numbers   int       `gorm:"not null" json:"numbers"`
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+}
+
+// TableName возвращает имя таблицы
+func (ContactImportLog) TableName() string {
+	return "contact_imports"
+}
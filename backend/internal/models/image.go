@@ -0,0 +1,58 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Размеры превью изображений (по большей стороне, для аватаров — квадрат)
+const (
+	ThumbnailSmall  = 64
+	ThumbnailMedium = 256
+	ThumbnailLarge  = 1024
+)
+
+// Thumbnails уменьшенные копии изображения: размер в пикселях → URL
+type Thumbnails map[string]string
+
+// GormDataType возвращает тип колонки
+func (Thumbnails) GormDataType() string {
+	return "jsonb"
+}
+
+// Value сериализует превью в JSON для записи в БД
+func (t Thumbnails) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan читает превью из JSON-колонки
+func (t *Thumbnails) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported thumbnails value type %T", value)
+	}
+	return json.Unmarshal(data, t)
+}
+
+// ImagePreview описывает превью изображения для быстрой отрисовки в списках
+type ImagePreview struct {
+	Thumbnails    Thumbnails `gorm:"type:jsonb" json:"thumbnails,omitempty"`
+	Blurhash      string     `gorm:"size:64;not null;default:''" json:"blurhash,omitempty"`
+	DominantColor string     `gorm:"size:7;not null;default:''" json:"dominant_color,omitempty"`
+}
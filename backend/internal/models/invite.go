@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChatInvite ссылка-приглашение в группу
+type ChatInvite struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ChatID           uuid.UUID  `gorm:"type:uuid;not null" json:"chat_id"`
+	Code             string     `gorm:"size:32;not null;uniqueIndex" json:"code"`
+	CreatorID        uuid.UUID  `gorm:"type:uuid;not null" json:"creator_id"`
+	Name             string     `gorm:"size:64;not null;default:''" json:"name"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	UsageLimit       *int       `json:"usage_limit"` // nil — без ограничения
+	UsageCount       int        `gorm:"not null;default:0" json:"usage_count"`
+	RequiresApproval bool       `gorm:"not null;default:false" json:"requires_approval"` // Вступление только после одобрения админом
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `gorm:"not null;default:now()" json:"created_at"`
+
+	// Связи
+	Creator *User `gorm:"foreignKey:CreatorID" json:"-"`
+
+	// Профиль создателя ссылки, каким его видит запросивший. Заполняется сервисом.
+	CreatorProfile *PublicUser `gorm:"-" json:"creator,omitempty"`
+}
+
+// TableName возвращает имя таблицы
+func (ChatInvite) TableName() string {
+	return "chat_invites"
+}
+
+// IsUsable проверяет, можно ли вступить по ссылке в момент now
+func (i *ChatInvite) IsUsable(now time.Time) bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && !i.ExpiresAt.After(now) {
+		return false
+	}
+	return i.UsageLimit == nil || i.UsageCount < *i.UsageLimit
+}
+
+// ChatJoinRequest заявка на вступление в группу по ссылке с одобрением
+type ChatJoinRequest struct {
+	ChatID    uuid.UUID  `gorm:"type:uuid;primary_key" json:"chat_id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;primary_key" json:"user_id"`
+	InviteID  *uuid.UUID `gorm:"type:uuid" json:"invite_id"`
+	CreatedAt time.Time  `gorm:"not null;default:now()" json:"created_at"`
+
+	// Связи
+	User *User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// TableName возвращает имя таблицы
+func (ChatJoinRequest) TableName() string {
+	return "chat_join_requests"
+}
+
+// JoinRequestInfo заявка на вступление с профилем, каким его видит админ
+type JoinRequestInfo struct {
+	User      PublicUser `json:"user"`
+	InviteID  *uuid.UUID `json:"invite_id"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// InvitePreview сведения о группе, которые видны по ссылке до вступления
+type InvitePreview struct {
+	ChatID           uuid.UUID     `json:"chat_id"`
+	Name             string        `json:"name"`
+	Description      string        `json:"description"`
+	AvatarURL        string        `json:"avatar_url"`
+	AvatarPreview    *ImagePreview `json:"avatar_preview,omitempty"`
+	MemberCount      int64         `json:"member_count"`
+	RequiresApproval bool          `json:"requires_approval"`
+	IsMember         bool          `json:"is_member"`
+	RequestPending   bool          `json:"request_pending"`
+}
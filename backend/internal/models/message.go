@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,37 +17,110 @@ const (
 	MessageTypeVoice MessageType = "voice"
 )
 
-// MessageStatus определяет статус сообщения
+// MessageStatus определяет сводный статус сообщения для отправителя:
+// delivered — доставлено всем получателям, read — прочитано всеми
 type MessageStatus string
 
 const (
-	MessageStatusPending  MessageStatus = "pending"
-	MessageStatusSent     MessageStatus = "sent"
+	MessageStatusPending   MessageStatus = "pending"
+	MessageStatusSent      MessageStatus = "sent"
 	MessageStatusDelivered MessageStatus = "delivered"
-	MessageStatusRead     MessageStatus = "read"
+	MessageStatusRead      MessageStatus = "read"
 )
 
 // Message представляет сообщение в чате
 type Message struct {
-	ID          uuid.UUID    `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	ChatID      uuid.UUID    `gorm:"type:uuid;not null;index:idx_chat_created" json:"chat_id"`
-	SenderID    uuid.UUID    `gorm:"type:uuid;not null" json:"sender_id"`
-	Content     string       `gorm:"type:text;not null" json:"content"`
-	MessageType MessageType  `gorm:"size:20;not null;default:'text'" json:"message_type"`
-	MediaURL    *string      `gorm:"size:500" json:"media_url,omitempty"`
-	ReplyToID   *uuid.UUID   `gorm:"type:uuid" json:"reply_to_id,omitempty"`
-	IsEdited    bool         `gorm:"not null;default:false" json:"is_edited"`
-	IsDeleted   bool         `gorm:"not null;default:false;index" json:"is_deleted"`
-	Status      MessageStatus `gorm:"size:20;not null;default:'sent';index" json:"status"`
-	CreatedAt   time.Time    `gorm:"not null;default:now();index:idx_chat_created" json:"created_at"`
-	UpdatedAt   time.Time    `gorm:"not null;default:now()" json:"updated_at"`
-	DeletedAt   *time.Time   `gorm:"index" json:"-"`
+	ID                     uuid.UUID     `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ChatID                 uuid.UUID     `gorm:"type:uuid;not null;index:idx_chat_created" json:"chat_id"`
+	SenderID               uuid.UUID     `gorm:"type:uuid;not null" json:"sender_id"`
+	Content                string        `gorm:"type:text;not null" json:"content"`
+	MessageType            MessageType   `gorm:"size:20;not null;default:'text'" json:"message_type"`
+	MediaURL               *string       `gorm:"size:500" json:"media_url,omitempty"`
+	ReplyToID              *uuid.UUID    `gorm:"type:uuid" json:"reply_to_id,omitempty"`
+	ThreadID               *uuid.UUID    `gorm:"type:uuid" json:"thread_id,omitempty"` // Корневое сообщение ветки
+	ForwardedFromMessageID *uuid.UUID    `gorm:"type:uuid" json:"forwarded_from_message_id,omitempty"`
+	ForwardedFromUserID    *uuid.UUID    `gorm:"type:uuid" json:"forwarded_from_user_id,omitempty"`
+	ForwardedFromCreatedAt *time.Time    `json:"forwarded_from_created_at,omitempty"`    // Время исходного сообщения
+	ClientMsgID            *string       `gorm:"size:64" json:"client_msg_id,omitempty"` // ID, сгенерированный клиентом отправителя
+	IsEdited               bool          `gorm:"not null;default:false" json:"is_edited"`
+	IsDeleted              bool          `gorm:"not null;default:false;index" json:"is_deleted"`
+	Status                 MessageStatus `gorm:"size:20;not null;default:'sent';index" json:"status"`
+	ViewCount              int           `gorm:"not null;default:0" json:"view_count,omitempty"` // Просмотры в канале
+	CreatedAt              time.Time     `gorm:"not null;default:now();index:idx_chat_created" json:"created_at"`
+	UpdatedAt              time.Time     `gorm:"not null;default:now()" json:"updated_at"`
+	DeletedAt              *time.Time    `gorm:"index" json:"-"`
 
 	// Связи
-	Chat      *Chat       `gorm:"foreignKey:ChatID" json:"-"`
-	Sender    *User       `gorm:"foreignKey:SenderID" json:"sender,omitempty"`
-	ReplyTo   *Message    `gorm:"foreignKey:ReplyToID" json:"reply_to,omitempty"`
-	Reads     []MessageRead `gorm:"foreignKey:MessageID" json:"reads,omitempty"`
+	Chat              *Chat       `gorm:"foreignKey:ChatID" json:"-"`
+	Sender            *User       `gorm:"foreignKey:SenderID" json:"-"`
+	ReplyTo           *Message    `gorm:"foreignKey:ReplyToID" json:"-"`
+	ForwardedFromUser *User       `gorm:"foreignKey:ForwardedFromUserID" json:"-"`
+	Attachment        *Attachment `gorm:"foreignKey:MessageID" json:"attachment,omitempty"`
+
+	// Заполняются репозиторием и сервисом
+	ReplyPreview *ReplyPreview   `gorm:"-" json:"reply_preview,omitempty"`
+	Thread       *ThreadStats    `gorm:"-" json:"thread,omitempty"`
+	Reactions    []ReactionCount `gorm:"-" json:"reactions,omitempty"`
+
+	// Профили отправителя и автора пересланного сообщения,
+	// какими их видит запросивший
+	SenderProfile        *PublicUser `gorm:"-" json:"sender,omitempty"`
+	ForwardedFromProfile *PublicUser `gorm:"-" json:"forwarded_from_user,omitempty"`
+}
+
+// IsForwarded проверяет, переслано ли сообщение из другого чата
+func (m *Message) IsForwarded() bool {
+	return m.ForwardedFromCreatedAt != nil
+}
+
+// Длина фрагмента текста в превью ответа (в символах)
+const replySnippetLength = 100
+
+// ReplyPreview краткое описание сообщения, на которое дан ответ
+type ReplyPreview struct {
+	ID          uuid.UUID   `json:"id"`
+	SenderID    uuid.UUID   `json:"sender_id"`
+	SenderName  string      `json:"sender_name"`
+	Snippet     string      `json:"snippet"`
+	MessageType MessageType `json:"message_type"`
+	IsDeleted   bool        `json:"is_deleted"`
+}
+
+// NewReplyPreview строит превью сообщения. Текст удалённого сообщения не раскрывается.
+func NewReplyPreview(m *Message) *ReplyPreview {
+	preview := &ReplyPreview{
+		ID:          m.ID,
+		SenderID:    m.SenderID,
+		MessageType: m.MessageType,
+		IsDeleted:   m.IsDeleted,
+	}
+	if m.Sender != nil {
+		preview.SenderName = m.Sender.GetFullName()
+	}
+	if !m.IsDeleted {
+		preview.Snippet = snippet(m.Content, replySnippetLength)
+	}
+	return preview
+}
+
+// snippet возвращает первую строку текста, обрезанную до max символов
+func snippet(text string, max int) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) > max {
+		return string(runes[:max]) + "…"
+	}
+	return string(runes)
+}
+
+// ThreadStats сводка ветки ответов на сообщение.
+// UnreadCount считается только для веток, за которыми следит пользователь.
+type ThreadStats struct {
+	ReplyCount  int64     `json:"reply_count"`
+	LastReplyAt time.Time `json:"last_reply_at"`
+	UnreadCount int64     `json:"unread_count"`
 }
 
 // TableName возвращает имя таблицы
@@ -54,21 +128,96 @@ func (Message) TableName() string {
 	return "messages"
 }
 
-// MessageRead представляет факт прочтения сообщения
-type MessageRead struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	MessageID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_message_user" json:"message_id"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_message_user" json:"user_id"`
-	ReadAt    time.Time `gorm:"not null;default:now()" json:"read_at"`
+// MessageReceipt отметка доставки и прочтения сообщения получателем.
+// ReadAt == nil — сообщение доставлено, но ещё не прочитано.
+type MessageReceipt struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	MessageID   uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_message_user" json:"message_id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_message_user" json:"user_id"`
+	DeliveredAt time.Time  `gorm:"not null;default:now()" json:"delivered_at"`
+	ReadAt      *time.Time `json:"read_at"`
 
 	// Связи
 	Message *Message `gorm:"foreignKey:MessageID" json:"-"`
-	User    *User    `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	User    *User    `gorm:"foreignKey:UserID" json:"-"`
+
+	// Профиль получателя, каким его видит запросивший. Заполняется сервисом.
+	UserProfile *PublicUser `gorm:"-" json:"user,omitempty"`
+}
+
+// TableName возвращает имя таблицы
+func (MessageReceipt) TableName() string {
+	return "message_receipts"
+}
+
+// MessageStatusChange изменение сводного статуса сообщения для его отправителя
+type MessageStatusChange struct {
+	MessageID uuid.UUID     `json:"message_id"`
+	ChatID    uuid.UUID     `json:"chat_id"`
+	SenderID  uuid.UUID     `json:"sender_id"`
+	Status    MessageStatus `json:"status"`
+}
+
+// MessageDeletion представляет сообщение, удалённое пользователем только у себя
+type MessageDeletion struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	MessageID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_message_deletion_user" json:"message_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_message_deletion_user" json:"user_id"`
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+}
+
+// TableName возвращает имя таблицы
+func (MessageDeletion) TableName() string {
+	return "message_deletions"
+}
+
+// MessageReaction представляет реакцию пользователя на сообщение
+type MessageReaction struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	MessageID uuid.UUID `gorm:"type:uuid;not null" json:"message_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	Emoji     string    `gorm:"size:32;not null" json:"emoji"`
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+
+	// Связи
+	User *User `gorm:"foreignKey:UserID" json:"-"`
+
+	// Профиль поставившего реакцию, каким его видит запросивший. Заполняется сервисом.
+	UserProfile *PublicUser `gorm:"-" json:"user,omitempty"`
 }
 
 // TableName возвращает имя таблицы
-func (MessageRead) TableName() string {
-	return "message_reads"
+func (MessageReaction) TableName() string {
+	return "message_reactions"
+}
+
+// ReactionCount агрегированная реакция на сообщение.
+// Reacted — поставил ли её пользователь, запросивший сообщения.
+type ReactionCount struct {
+	Emoji   string `json:"emoji"`
+	Count   int64  `json:"count"`
+	Reacted bool   `json:"reacted,omitempty"`
+}
+
+// ThreadRead хранит момент, до которого пользователь прочитал ветку.
+// Наличие записи означает, что пользователь следит за веткой.
+type ThreadRead struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ThreadID   uuid.UUID `gorm:"type:uuid;not null" json:"thread_id"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	LastReadAt time.Time `gorm:"not null;default:now()" json:"last_read_at"`
+}
+
+// TableName возвращает имя таблицы
+func (ThreadRead) TableName() string {
+	return "thread_reads"
+}
+
+// MessageSearchResult представляет найденное сообщение с подсвеченным фрагментом.
+// Snippet экранирован для HTML, совпадения обёрнуты в <mark>.
+type MessageSearchResult struct {
+	Message
+	Snippet string `json:"snippet"`
 }
 
 // MessageWithSender представляет сообщение с данными отправителя
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Update представляет запись в журнале обновлений пользователя.
+// Data хранит событие WebSocket в том виде, в каком оно ушло клиенту.
+type Update struct {
+	UserID    uuid.UUID       `gorm:"type:uuid;primary_key" json:"-"`
+	Seq       int64           `gorm:"primary_key" json:"seq"`
+	Type      string          `gorm:"size:50;not null" json:"type"`
+	Data      json.RawMessage `gorm:"type:jsonb;not null" json:"data"`
+	CreatedAt time.Time       `gorm:"not null;default:now()" json:"created_at"`
+}
+
+// TableName возвращает имя таблицы
+func (Update) TableName() string {
+	return "user_updates"
+}
@@ -8,24 +8,27 @@ import (
 
 // User представляет пользователя в системе
 type User struct {
-	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	Phone        string     `gorm:"size:20;uniqueIndex;not null" json:"phone"`
-	Username     string     `gorm:"size:50;uniqueIndex;not null" json:"username"`
-	PasswordHash *string    `gorm:"size:255" json:"-"` // Pointer - может быть NULL для SMS
-	FirstName    string     `gorm:"size:50;not null;default:''" json:"first_name"`
-	LastName     string     `gorm:"size:50;not null;default:''" json:"last_name"`
-	Bio          string     `gorm:"type:text;not null;default:''" json:"bio"`
-	AvatarURL    string     `gorm:"size:500;not null;default:''" json:"avatar_url"`
-	IsActive     bool       `gorm:"not null;default:true" json:"is_active"`
-	IsOnline     bool       `gorm:"not null;default:false" json:"is_online"`
-	LastSeen     time.Time  `gorm:"not null;default:now()" json:"last_seen"`
-	CreatedAt    time.Time  `gorm:"not null;default:now()" json:"created_at"`
-	UpdatedAt    time.Time  `gorm:"not null;default:now()" json:"updated_at"`
+	ID            uuid.UUID       `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Phone         string          `gorm:"size:20;uniqueIndex;not null" json:"phone"`
+	PhoneHash     *string         `gorm:"size:64;index" json:"-"` // SHA-256 номера в E.164, NULL если номер не в E.164
+	Username      string          `gorm:"size:50;uniqueIndex;not null" json:"username"`
+	PasswordHash  *string         `gorm:"size:255" json:"-"` // Pointer - может быть NULL для SMS
+	FirstName     string          `gorm:"size:50;not null;default:''" json:"first_name"`
+	LastName      string          `gorm:"size:50;not null;default:''" json:"last_name"`
+	Bio           string          `gorm:"type:text;not null;default:''" json:"bio"`
+	AvatarURL     string          `gorm:"size:500;not null;default:''" json:"avatar_url"`
+	AvatarPreview ImagePreview    `gorm:"embedded;embeddedPrefix:avatar_" json:"avatar_preview"`
+	IsActive      bool            `gorm:"not null;default:true" json:"is_active"`
+	IsOnline      bool            `gorm:"not null;default:false" json:"is_online"`
+	LastSeen      time.Time       `gorm:"not null;default:now()" json:"last_seen"`
+	Privacy       PrivacySettings `gorm:"embedded;embeddedPrefix:privacy_" json:"-"`
+	CreatedAt     time.Time       `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt     time.Time       `gorm:"not null;default:now()" json:"updated_at"`
 
 	// Связи
-	OwnedChats   []Chat          `gorm:"foreignKey:CreatedBy" json:"-"`
+	OwnedChats   []Chat           `gorm:"foreignKey:CreatedBy" json:"-"`
 	Memberships  []ChatMembership `gorm:"foreignKey:UserID" json:"-"`
-	SentMessages []Message       `gorm:"foreignKey:SenderID" json:"-"`
+	SentMessages []Message        `gorm:"foreignKey:SenderID" json:"-"`
 }
 
 // TableName возвращает имя таблицы
@@ -41,14 +44,68 @@ func (u *User) GetFullName() string {
 	return u.FirstName + " " + u.LastName
 }
 
-// SMSCode представляет код для SMS авторизации
+// PrivacyLevel определяет, кому виден элемент профиля
+type PrivacyLevel string
+
+const (
+	PrivacyEveryone PrivacyLevel = "everyone"
+	PrivacyContacts PrivacyLevel = "contacts"
+	PrivacyNobody   PrivacyLevel = "nobody"
+)
+
+// IsValid проверяет, известен ли уровень
+func (l PrivacyLevel) IsValid() bool {
+	return l == PrivacyEveryone || l == PrivacyContacts || l == PrivacyNobody
+}
+
+// Allows проверяет, виден ли элемент профиля пользователю.
+// isContact — пользователь входит в контакты владельца профиля.
+func (l PrivacyLevel) Allows(isContact bool) bool {
+	switch l {
+	case PrivacyEveryone:
+		return true
+	case PrivacyContacts:
+		return isContact
+	default:
+		return false
+	}
+}
+
+// PrivacySettings настройки приватности пользователя
+type PrivacySettings struct {
+	LastSeen PrivacyLevel `gorm:"size:20;not null;default:'everyone'" json:"last_seen"`
+	Online   PrivacyLevel `gorm:"size:20;not null;default:'everyone'" json:"online"`
+	Phone    PrivacyLevel `gorm:"size:20;not null;default:'contacts'" json:"phone"`
+	Avatar   PrivacyLevel `gorm:"size:20;not null;default:'everyone'" json:"avatar"`
+}
+
+// PublicUser профиль пользователя, каким его видят другие.
+// Поля, скрытые настройками приватности, пусты.
+type PublicUser struct {
+	ID            uuid.UUID     `json:"id"`
+	Phone         string        `json:"phone,omitempty"`
+	Username      string        `json:"username"`
+	FirstName     string        `json:"first_name"`
+	LastName      string        `json:"last_name"`
+	Bio           string        `json:"bio"`
+	AvatarURL     string        `json:"avatar_url"`
+	AvatarPreview *ImagePreview `json:"avatar_preview,omitempty"`
+	IsOnline      bool          `json:"is_online"`
+	LastSeen      *time.Time    `json:"last_seen,omitempty"`
+}
+
+// SMSCode представляет код для SMS авторизации.
+// Сам код не хранится — только его HMAC.
 type SMSCode struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	Phone     string    `gorm:"size:20;not null;index" json:"phone"`
-	Code      string    `gorm:"size:6;not null" json:"-"`
-	IsUsed    bool      `gorm:"not null;default:false" json:"is_used"`
-	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
-	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Phone       string     `gorm:"size:20;not null;index" json:"phone"`
+	Code        string     `gorm:"size:64;not null" json:"-"`
+	IPAddress   string     `gorm:"size:45;not null;default:''" json:"-"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	IsUsed      bool       `gorm:"not null;default:false" json:"is_used"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	CreatedAt   time.Time  `gorm:"not null;default:now()" json:"created_at"`
 }
 
 func (SMSCode) TableName() string {
@@ -59,3 +116,25 @@ func (SMSCode) TableName() string {
 func (s *SMSCode) IsExpired() bool {
 	return time.Now().After(s.ExpiresAt)
 }
+
+// UserSession представляет сессию пользователя на устройстве
+type UserSession struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	UserID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	RefreshTokenHash string     `gorm:"size:255;not null;index" json:"-"`
+	DeviceInfo       string     `gorm:"size:255;not null;default:''" json:"device_info"`
+	IPAddress        string     `gorm:"size:45;not null;default:''" json:"ip_address"`
+	ExpiresAt        time.Time  `gorm:"not null" json:"expires_at"`
+	CreatedAt        time.Time  `gorm:"not null;default:now()" json:"created_at"`
+	LastUsedAt       time.Time  `gorm:"not null;default:now()" json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
+
+// IsActive проверяет, что сессия не отозвана и не истекла
+func (s *UserSession) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
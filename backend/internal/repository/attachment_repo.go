@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AttachmentRepository определяет интерфейс для работы с вложениями
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *models.Attachment) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Attachment, error)
+	DeleteUnlinkedBefore(ctx context.Context, before time.Time, limit int) ([]models.Attachment, error)
+}
+
+type attachmentRepository struct {
+	db *gorm.DB
+}
+
+// NewAttachmentRepository создаёт новый AttachmentRepository
+func NewAttachmentRepository(db *gorm.DB) AttachmentRepository {
+	return &attachmentRepository{db: db}
+}
+
+func (r *attachmentRepository) Create(ctx context.Context, attachment *models.Attachment) error {
+	return r.db.WithContext(ctx).Create(attachment).Error
+}
+
+func (r *attachmentRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := r.db.WithContext(ctx).First(&attachment, "id = ?", id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// DeleteUnlinkedBefore удаляет до limit вложений, загруженных до before и так
+// и не привязанных к сообщению, и возвращает их для очистки хранилища.
+// Условие на message_id повторяется в DELETE: вложение, привязанное
+// между выборкой и удалением, остаётся.
+func (r *attachmentRepository) DeleteUnlinkedBefore(ctx context.Context, before time.Time, limit int) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("id IN (?) AND message_id IS NULL",
+			r.db.Model(&models.Attachment{}).
+				Select("id").
+				Where("message_id IS NULL AND created_at < ?", before).
+				Limit(limit),
+		).
+		Delete(&attachments).Error
+	return attachments, err
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BlockRepository определяет интерфейс для работы с чёрным списком
+type BlockRepository interface {
+	Block(ctx context.Context, userID, blockedUserID uuid.UUID) (bool, error)
+	Unblock(ctx context.Context, userID, blockedUserID uuid.UUID) (bool, error)
+	List(ctx context.Context, userID uuid.UUID) ([]models.UserBlock, error)
+	IsBlockedEither(ctx context.Context, userID, otherID uuid.UUID) (bool, error)
+	IsBlockedInPrivateChat(ctx context.Context, chatID, userID uuid.UUID) (bool, error)
+	GetBlockedIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	FilterBlockers(ctx context.Context, blockerIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]bool, error)
+}
+
+type blockRepository struct {
+	db *gorm.DB
+}
+
+// NewBlockRepository создаёт новый BlockRepository
+func NewBlockRepository(db *gorm.DB) BlockRepository {
+	return &blockRepository{db: db}
+}
+
+// Block добавляет пользователя в чёрный список. Возвращает false, если он уже там.
+func (r *blockRepository) Block(ctx context.Context, userID, blockedUserID uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UserBlock{UserID: userID, BlockedUserID: blockedUserID})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Unblock убирает пользователя из чёрного списка. Возвращает false, если его там не было.
+func (r *blockRepository) Unblock(ctx context.Context, userID, blockedUserID uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND blocked_user_id = ?", userID, blockedUserID).
+		Delete(&models.UserBlock{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// List возвращает чёрный список пользователя, последние блокировки первыми
+func (r *blockRepository) List(ctx context.Context, userID uuid.UUID) ([]models.UserBlock, error) {
+	var blocks []models.UserBlock
+	err := r.db.WithContext(ctx).
+		Preload("BlockedUser").
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&blocks).Error
+	return blocks, err
+}
+
+// IsBlockedEither проверяет, заблокировал ли кто-то из двух пользователей другого
+func (r *blockRepository) IsBlockedEither(ctx context.Context, userID, otherID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.UserBlock{}).
+		Where("(user_id = ? AND blocked_user_id = ?) OR (user_id = ? AND blocked_user_id = ?)",
+			userID, otherID, otherID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// IsBlockedInPrivateChat проверяет, что чат личный и пользователь с собеседником
+// заблокировал один другого
+func (r *blockRepository) IsBlockedInPrivateChat(ctx context.Context, chatID, userID uuid.UUID) (bool, error) {
+	var blocked bool
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT EXISTS (
+			SELECT 1
+			FROM chats c
+			INNER JOIN chat_members m ON m.chat_id = c.id AND m.user_id != ? AND m.left_at IS NULL
+			INNER JOIN user_blocks b ON (b.user_id = m.user_id AND b.blocked_user_id = ?)
+				OR (b.user_id = ? AND b.blocked_user_id = m.user_id)
+			WHERE c.id = ? AND c.type = ?
+		)
+	`, userID, userID, userID, chatID, models.ChatTypePrivate).Scan(&blocked).Error
+	return blocked, err
+}
+
+// GetBlockedIDs возвращает пользователей, заблокированных userID
+func (r *blockRepository) GetBlockedIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).
+		Model(&models.UserBlock{}).
+		Where("user_id = ?", userID).
+		Pluck("blocked_user_id", &ids).Error
+	return ids, err
+}
+
+// FilterBlockers возвращает тех из blockerIDs, кто заблокировал userID
+func (r *blockRepository) FilterBlockers(ctx context.Context, blockerIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]bool, error) {
+	blockers := make(map[uuid.UUID]bool)
+	if len(blockerIDs) == 0 {
+		return blockers, nil
+	}
+
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).
+		Model(&models.UserBlock{}).
+		Where("blocked_user_id = ? AND user_id IN ?", userID, blockerIDs).
+		Pluck("user_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		blockers[id] = true
+	}
+	return blockers, nil
+}
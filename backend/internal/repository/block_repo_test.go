@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestIsBlockedInPrivateChatWorksBothWays(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	blocks := NewBlockRepository(db)
+
+	alice, bob, carol := createTestUser(t, db), createTestUser(t, db), createTestUser(t, db)
+	private := createTestChat(t, db, models.ChatTypePrivate, alice, bob)
+	other := createTestChat(t, db, models.ChatTypePrivate, alice, carol)
+	group := createTestChat(t, db, models.ChatTypeGroup, alice, bob)
+
+	if _, err := blocks.Block(ctx, alice, bob); err != nil {
+		t.Fatalf("Block() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		chatID uuid.UUID
+		userID uuid.UUID
+		want   bool
+	}{
+		{"blocker", private, alice, true},
+		{"blocked", private, bob, true},
+		{"other private chat", other, alice, false},
+		{"group", group, bob, false},
+	}
+	for _, tc := range tests {
+		blocked, err := blocks.IsBlockedInPrivateChat(ctx, tc.chatID, tc.userID)
+		if err != nil {
+			t.Fatalf("%s: IsBlockedInPrivateChat() error = %v", tc.name, err)
+		}
+		if blocked != tc.want {
+			t.Errorf("%s: IsBlockedInPrivateChat() = %v, want %v", tc.name, blocked, tc.want)
+		}
+	}
+
+	if _, err := blocks.Unblock(ctx, alice, bob); err != nil {
+		t.Fatalf("Unblock() error = %v", err)
+	}
+	if blocked, err := blocks.IsBlockedInPrivateChat(ctx, private, bob); err != nil || blocked {
+		t.Errorf("IsBlockedInPrivateChat() after Unblock() = %v, %v; want false", blocked, err)
+	}
+}
+
+func TestFilterBlockersReturnsOnlyWhoBlockedUser(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	blocks := NewBlockRepository(db)
+
+	user := createTestUser(t, db)
+	blocker, blockedByUser, stranger := createTestUser(t, db), createTestUser(t, db), createTestUser(t, db)
+
+	if _, err := blocks.Block(ctx, blocker, user); err != nil {
+		t.Fatalf("Block() error = %v", err)
+	}
+	// Обратная блокировка не делает заблокированного «заблокировавшим»
+	if _, err := blocks.Block(ctx, user, blockedByUser); err != nil {
+		t.Fatalf("Block() error = %v", err)
+	}
+
+	blockers, err := blocks.FilterBlockers(ctx, []uuid.UUID{blocker, blockedByUser, stranger}, user)
+	if err != nil {
+		t.Fatalf("FilterBlockers() error = %v", err)
+	}
+	if len(blockers) != 1 || !blockers[blocker] {
+		t.Errorf("FilterBlockers() = %v, want only %s", blockers, blocker)
+	}
+
+	if blockers, err := blocks.FilterBlockers(ctx, nil, user); err != nil || len(blockers) != 0 {
+		t.Errorf("FilterBlockers(nil) = %v, %v; want empty", blockers, err)
+	}
+}
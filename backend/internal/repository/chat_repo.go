@@ -7,20 +7,30 @@ import (
 	"dildogram/backend/internal/models"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ChatRepository определяет интерфейс для работы с чатами
 type ChatRepository interface {
 	Create(ctx context.Context, chat *models.Chat) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Chat, error)
+	GetByHandle(ctx context.Context, handle string) (*models.Chat, error)
+	SearchChannels(ctx context.Context, query string, limit int) ([]models.Chat, error)
 	GetUserChats(ctx context.Context, userID uuid.UUID) ([]models.ChatWithLastMessage, error)
 	Update(ctx context.Context, chat *models.Chat) error
 	Delete(ctx context.Context, id uuid.UUID) error
-	AddMember(ctx context.Context, membership *models.ChatMembership) error
+	AddMember(ctx context.Context, membership *models.ChatMembership) (bool, error)
 	RemoveMember(ctx context.Context, chatID, userID uuid.UUID) error
 	GetMember(ctx context.Context, chatID, userID uuid.UUID) (*models.ChatMembership, error)
+	GetMemberWithChat(ctx context.Context, chatID, userID uuid.UUID) (*models.ChatMembership, error)
+	UpdateMemberRole(ctx context.Context, chatID, userID uuid.UUID, role models.MemberRole, permissions models.ChatPermissions) error
+	TransferOwnership(ctx context.Context, chatID, ownerID, newOwnerID uuid.UUID) error
+	UpdateDefaultPermissions(ctx context.Context, chatID uuid.UUID, permissions models.ChatPermissions) error
 	GetMembers(ctx context.Context, chatID uuid.UUID) ([]models.ChatMembership, error)
 	IsMember(ctx context.Context, chatID, userID uuid.UUID) (bool, error)
+	CountMembers(ctx context.Context, chatID uuid.UUID) (int64, error)
+	CountMembersMany(ctx context.Context, chatIDs []uuid.UUID) (map[uuid.UUID]int64, error)
+	GetAdmins(ctx context.Context, chatID uuid.UUID) ([]models.ChatMembership, error)
 	FindPrivateChat(ctx context.Context, user1, user2 uuid.UUID) (*models.Chat, error)
 }
 
@@ -37,11 +47,12 @@ func (r *chatRepository) Create(ctx context.Context, chat *models.Chat) error {
 	return r.db.WithContext(ctx).Create(chat).Error
 }
 
+// GetByID возвращает чат с создателем и участниками.
+// Подписчиков каналов не загружаем: их может быть очень много.
 func (r *chatRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Chat, error) {
 	var chat models.Chat
 	err := r.db.WithContext(ctx).
 		Preload("Creator").
-		Preload("Members.User").
 		First(&chat, "id = ?", id).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -49,9 +60,47 @@ func (r *chatRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Cha
 		}
 		return nil, err
 	}
+
+	if chat.Type != models.ChatTypeChannel {
+		err = r.db.WithContext(ctx).
+			Preload("User").
+			Where("chat_id = ?", id).
+			Find(&chat.Members).Error
+		if err != nil {
+			return nil, err
+		}
+	}
 	return &chat, nil
 }
 
+// GetByHandle возвращает неудалённый чат по публичному адресу без учёта регистра
+func (r *chatRepository) GetByHandle(ctx context.Context, handle string) (*models.Chat, error) {
+	var chat models.Chat
+	err := r.db.WithContext(ctx).
+		First(&chat, "LOWER(handle) = LOWER(?) AND deleted_at IS NULL", handle).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &chat, nil
+}
+
+// SearchChannels ищет публичные каналы по адресу и названию.
+// Сначала идут совпадения по началу адреса.
+func (r *chatRepository) SearchChannels(ctx context.Context, query string, limit int) ([]models.Chat, error) {
+	var chats []models.Chat
+	searchPattern := "%" + query + "%"
+	err := r.db.WithContext(ctx).
+		Where("type = ? AND handle IS NOT NULL AND deleted_at IS NULL", models.ChatTypeChannel).
+		Where("handle ILIKE ? OR name ILIKE ?", searchPattern, searchPattern).
+		Order(gorm.Expr("handle ILIKE ? DESC, name", query+"%")).
+		Limit(limit).
+		Find(&chats).Error
+	return chats, err
+}
+
 func (r *chatRepository) GetUserChats(ctx context.Context, userID uuid.UUID) ([]models.ChatWithLastMessage, error) {
 	var chats []models.ChatWithLastMessage
 
@@ -62,6 +111,17 @@ func (r *chatRepository) GetUserChats(ctx context.Context, userID uuid.UUID) ([]
 			c.name,
 			c.description,
 			c.avatar_url,
+			c.avatar_thumbnails,
+			c.avatar_blurhash,
+			c.avatar_dominant_color,
+			c.protected_content,
+			c.handle,
+			c.perm_send_messages,
+			c.perm_send_media,
+			c.perm_add_members,
+			c.perm_pin_messages,
+			c.perm_change_info,
+			c.perm_delete_messages,
 			c.created_by,
 			c.created_at,
 			c.updated_at,
@@ -72,30 +132,49 @@ func (r *chatRepository) GetUserChats(ctx context.Context, userID uuid.UUID) ([]
 			lm.sender_id as last_message_sender_id,
 			lm.created_at as last_message_created_at,
 			lm.status as last_message_status,
-			COALESCE(ur.unread_count, 0) as unread_count
+			COALESCE(ur.unread_count, 0) as unread_count,
+			pm.message_id as pinned_message_id,
+			pm.content as pinned_message_content,
+			pm.sender_id as pinned_message_sender_id,
+			pm.message_type as pinned_message_type,
+			pm.pinned_at
 		FROM chats c
 		INNER JOIN chat_members cm ON c.id = cm.chat_id AND cm.left_at IS NULL
 		LEFT JOIN LATERAL (
-			SELECT id, content, sender_id, created_at, status
+			SELECT id AS message_id, content, sender_id, created_at, status
 			FROM messages
 			WHERE chat_id = c.id AND is_deleted = false
+				AND NOT EXISTS (
+					SELECT 1 FROM message_deletions md
+					WHERE md.message_id = messages.id AND md.user_id = ?
+				)
 			ORDER BY created_at DESC
 			LIMIT 1
 		) lm ON true
 		LEFT JOIN LATERAL (
 			SELECT COUNT(*) as unread_count
 			FROM messages m
-			LEFT JOIN message_reads mr ON m.id = mr.message_id AND mr.user_id = ?
+			LEFT JOIN message_receipts mr ON m.id = mr.message_id AND mr.user_id = ?
+			LEFT JOIN message_deletions md ON m.id = md.message_id AND md.user_id = ?
 			WHERE m.chat_id = c.id 
 				AND m.is_deleted = false 
 				AND m.sender_id != ?
 				AND mr.read_at IS NULL
+				AND md.id IS NULL
 		) ur ON true
+		LEFT JOIN LATERAL (
+			SELECT p.message_id, m.content, m.sender_id, m.message_type, p.pinned_at
+			FROM pinned_messages p
+			INNER JOIN messages m ON m.id = p.message_id AND m.is_deleted = false
+			WHERE p.chat_id = c.id
+			ORDER BY p.pinned_at DESC, p.id DESC
+			LIMIT 1
+		) pm ON true
 		WHERE cm.user_id = ?
 		ORDER BY COALESCE(c.last_message_at, c.created_at) DESC
 	`
 
-	err := r.db.WithContext(ctx).Raw(query, userID, userID, userID).Scan(&chats).Error
+	err := r.db.WithContext(ctx).Raw(query, userID, userID, userID, userID, userID).Scan(&chats).Error
 	return chats, err
 }
 
@@ -103,16 +182,46 @@ func (r *chatRepository) Update(ctx context.Context, chat *models.Chat) error {
 	return r.db.WithContext(ctx).Save(chat).Error
 }
 
+// Delete помечает чат удалённым и освобождает его публичный адрес
 func (r *chatRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	now := time.Now()
 	return r.db.WithContext(ctx).
 		Model(&models.Chat{}).
 		Where("id = ?", id).
-		Update("deleted_at", now).Error
+		Updates(map[string]interface{}{
+			"deleted_at": now,
+			"handle":     nil,
+		}).Error
 }
 
-func (r *chatRepository) AddMember(ctx context.Context, membership *models.ChatMembership) error {
-	return r.db.WithContext(ctx).Create(membership).Error
+// AddMember добавляет участника. Вышедший ранее участник возвращается в свою запись
+// с новой ролью и правами, запись активного участника не меняется.
+// Возвращает false, если участник уже состоял в чате.
+func (r *chatRepository) AddMember(ctx context.Context, membership *models.ChatMembership) (bool, error) {
+	return insertMember(r.db.WithContext(ctx), membership)
+}
+
+// insertMember добавляет или возвращает участника в db (в том числе в транзакции).
+// Возвращает true, если запись создана или вышедший участник вернулся.
+func insertMember(db *gorm.DB, membership *models.ChatMembership) (bool, error) {
+	result := db.
+		Omit(clause.Associations).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "chat_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"role", "joined_at", "left_at",
+				"perm_send_messages", "perm_send_media", "perm_add_members",
+				"perm_pin_messages", "perm_change_info", "perm_delete_messages",
+			}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{SQL: "chat_members.left_at IS NOT NULL"},
+			}},
+		}).
+		Create(membership)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
 }
 
 func (r *chatRepository) RemoveMember(ctx context.Context, chatID, userID uuid.UUID) error {
@@ -137,6 +246,82 @@ func (r *chatRepository) GetMember(ctx context.Context, chatID, userID uuid.UUID
 	return &membership, nil
 }
 
+// GetMemberWithChat возвращает участие пользователя вместе с чатом, без списка участников
+func (r *chatRepository) GetMemberWithChat(ctx context.Context, chatID, userID uuid.UUID) (*models.ChatMembership, error) {
+	var membership models.ChatMembership
+	err := r.db.WithContext(ctx).
+		Preload("Chat").
+		Preload("User").
+		First(&membership, "chat_id = ? AND user_id = ?", chatID, userID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// UpdateMemberRole меняет роль участника и его права админа
+func (r *chatRepository) UpdateMemberRole(ctx context.Context, chatID, userID uuid.UUID, role models.MemberRole, permissions models.ChatPermissions) error {
+	return r.db.WithContext(ctx).
+		Model(&models.ChatMembership{}).
+		Where("chat_id = ? AND user_id = ? AND left_at IS NULL", chatID, userID).
+		Updates(memberRoleColumns(role, permissions)).Error
+}
+
+// TransferOwnership передаёт владение чатом: новый владелец получает роль owner,
+// прежний становится админом со всеми правами
+func (r *chatRepository) TransferOwnership(ctx context.Context, chatID, ownerID, newOwnerID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.ChatMembership{}).
+			Where("chat_id = ? AND user_id = ?", chatID, ownerID).
+			Updates(memberRoleColumns(models.MemberRoleAdmin, models.AllChatPermissions())).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.ChatMembership{}).
+			Where("chat_id = ? AND user_id = ? AND left_at IS NULL", chatID, newOwnerID).
+			Updates(memberRoleColumns(models.MemberRoleOwner, models.ChatPermissions{}))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// memberRoleColumns возвращает колонки роли и прав участника для обновления.
+// Через map, чтобы false тоже записывался.
+func memberRoleColumns(role models.MemberRole, permissions models.ChatPermissions) map[string]interface{} {
+	columns := permissionColumns(permissions)
+	columns["role"] = role
+	return columns
+}
+
+// permissionColumns возвращает колонки набора прав
+func permissionColumns(permissions models.ChatPermissions) map[string]interface{} {
+	return map[string]interface{}{
+		"perm_send_messages":   permissions.SendMessages,
+		"perm_send_media":      permissions.SendMedia,
+		"perm_add_members":     permissions.AddMembers,
+		"perm_pin_messages":    permissions.PinMessages,
+		"perm_change_info":     permissions.ChangeInfo,
+		"perm_delete_messages": permissions.DeleteMessages,
+	}
+}
+
+// UpdateDefaultPermissions меняет права обычных участников чата
+func (r *chatRepository) UpdateDefaultPermissions(ctx context.Context, chatID uuid.UUID, permissions models.ChatPermissions) error {
+	return r.db.WithContext(ctx).
+		Model(&models.Chat{}).
+		Where("id = ?", chatID).
+		Updates(permissionColumns(permissions)).Error
+}
+
 func (r *chatRepository) GetMembers(ctx context.Context, chatID uuid.UUID) ([]models.ChatMembership, error) {
 	var memberships []models.ChatMembership
 	err := r.db.WithContext(ctx).
@@ -155,6 +340,53 @@ func (r *chatRepository) IsMember(ctx context.Context, chatID, userID uuid.UUID)
 	return count > 0, err
 }
 
+// CountMembers возвращает число активных участников чата
+func (r *chatRepository) CountMembers(ctx context.Context, chatID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.ChatMembership{}).
+		Where("chat_id = ? AND left_at IS NULL", chatID).
+		Count(&count).Error
+	return count, err
+}
+
+// CountMembersMany возвращает число активных участников нескольких чатов
+func (r *chatRepository) CountMembersMany(ctx context.Context, chatIDs []uuid.UUID) (map[uuid.UUID]int64, error) {
+	counts := make(map[uuid.UUID]int64, len(chatIDs))
+	if len(chatIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ChatID uuid.UUID
+		Count  int64
+	}
+	err := r.db.WithContext(ctx).
+		Model(&models.ChatMembership{}).
+		Select("chat_id, COUNT(*) AS count").
+		Where("chat_id IN ? AND left_at IS NULL", chatIDs).
+		Group("chat_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.ChatID] = row.Count
+	}
+	return counts, nil
+}
+
+// GetAdmins возвращает владельца и админов чата
+func (r *chatRepository) GetAdmins(ctx context.Context, chatID uuid.UUID) ([]models.ChatMembership, error) {
+	var memberships []models.ChatMembership
+	err := r.db.WithContext(ctx).
+		Where("chat_id = ? AND role IN ? AND left_at IS NULL", chatID,
+			[]models.MemberRole{models.MemberRoleOwner, models.MemberRoleAdmin}).
+		Find(&memberships).Error
+	return memberships, err
+}
+
 func (r *chatRepository) FindPrivateChat(ctx context.Context, user1, user2 uuid.UUID) (*models.Chat, error) {
 	var chat models.Chat
 
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dildogram/backend/internal/models"
+)
+
+func TestGetUserChatsReturnsLastAndPinnedMessages(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	alice, bob := createTestUser(t, db), createTestUser(t, db)
+	chatID := createTestChat(t, db, models.ChatTypePrivate, alice, bob)
+
+	now := time.Now()
+	pinned := createTestMessage(t, db, chatID, alice, "pinned", now.Add(-2*time.Minute))
+	last := createTestMessage(t, db, chatID, alice, "last", now.Add(-time.Minute))
+
+	if _, err := NewPinRepository(db).Add(ctx, &models.PinnedMessage{ChatID: chatID, MessageID: pinned, PinnedBy: &alice}); err != nil {
+		t.Fatalf("Add() pin error = %v", err)
+	}
+
+	chats, err := NewChatRepository(db).GetUserChats(ctx, bob)
+	if err != nil {
+		t.Fatalf("GetUserChats() error = %v", err)
+	}
+	if len(chats) != 1 {
+		t.Fatalf("GetUserChats() returned %d chats, want 1", len(chats))
+	}
+
+	chat := chats[0]
+	if chat.ID != chatID {
+		t.Errorf("ID = %s, want %s", chat.ID, chatID)
+	}
+	if chat.LastMessageID == nil || *chat.LastMessageID != last {
+		t.Errorf("LastMessageID = %v, want %s", chat.LastMessageID, last)
+	}
+	if chat.LastMessageContent == nil || *chat.LastMessageContent != "last" {
+		t.Errorf("LastMessageContent = %v, want %q", chat.LastMessageContent, "last")
+	}
+	if chat.UnreadCount != 2 {
+		t.Errorf("UnreadCount = %d, want 2", chat.UnreadCount)
+	}
+	if chat.PinnedMessageID == nil || *chat.PinnedMessageID != pinned {
+		t.Errorf("PinnedMessageID = %v, want %s", chat.PinnedMessageID, pinned)
+	}
+	if chat.PinnedMessageContent == nil || *chat.PinnedMessageContent != "pinned" {
+		t.Errorf("PinnedMessageContent = %v, want %q", chat.PinnedMessageContent, "pinned")
+	}
+}
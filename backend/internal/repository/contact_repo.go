@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImportHistory описывает прежние импорты пользователя, по которым проверяются лимиты
+type ImportHistory struct {
+	// Numbers — сколько номеров сверено с базой с момента since, Oldest — время самого раннего из этих импортов
+	Numbers int64
+	Oldest  *time.Time
+	// Stored — сколько номеров сохранено у пользователя: контакты и ожидающие регистрации
+	Stored int64
+	// New — сколько номеров импорта ещё не сохранено у пользователя
+	New int64
+}
+
+// ContactRepository определяет интерфейс для работы с контактами
+type ContactRepository interface {
+	Upsert(ctx context.Context, contacts []models.Contact) error
+	Get(ctx context.Context, userID, contactUserID uuid.UUID) (*models.Contact, error)
+	List(ctx context.Context, userID uuid.UUID) ([]models.Contact, error)
+	GetMany(ctx context.Context, userID uuid.UUID, contactUserIDs []uuid.UUID) ([]models.Contact, error)
+	Delete(ctx context.Context, userID, contactUserID uuid.UUID) (bool, error)
+	GetContactIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	GetOwnerIDs(ctx context.Context, contactUserID uuid.UUID) ([]uuid.UUID, error)
+	FilterOwners(ctx context.Context, ownerIDs []uuid.UUID, contactUserID uuid.UUID) (map[uuid.UUID]bool, error)
+	SaveImported(ctx context.Context, imported []models.ImportedContact) error
+	RecordImportIfAllowed(ctx context.Context, userID uuid.UUID, hashes []string, since time.Time, check func(*ImportHistory) error) error
+	ClaimImported(ctx context.Context, phoneHash string, userID uuid.UUID) ([]models.Contact, error)
+}
+
+type contactRepository struct {
+	db *gorm.DB
+}
+
+// NewContactRepository создаёт новый ContactRepository
+func NewContactRepository(db *gorm.DB) ContactRepository {
+	return &contactRepository{db: db}
+}
+
+// Upsert добавляет контакты, у существующих обновляет имя
+func (r *contactRepository) Upsert(ctx context.Context, contacts []models.Contact) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "contact_user_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"first_name": gorm.Expr("EXCLUDED.first_name"),
+				"last_name":  gorm.Expr("EXCLUDED.last_name"),
+				"updated_at": gorm.Expr("NOW()"),
+			}),
+		}).
+		Create(&contacts).Error
+}
+
+func (r *contactRepository) Get(ctx context.Context, userID, contactUserID uuid.UUID) (*models.Contact, error) {
+	var contact models.Contact
+	err := r.db.WithContext(ctx).
+		Preload("ContactUser").
+		Where("user_id = ? AND contact_user_id = ?", userID, contactUserID).
+		First(&contact).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &contact, nil
+}
+
+// List возвращает контакты пользователя, упорядоченные по имени
+func (r *contactRepository) List(ctx context.Context, userID uuid.UUID) ([]models.Contact, error) {
+	var contacts []models.Contact
+	err := r.db.WithContext(ctx).
+		Preload("ContactUser").
+		Where("user_id = ?", userID).
+		Order("first_name, last_name, created_at").
+		Find(&contacts).Error
+	return contacts, err
+}
+
+// GetMany возвращает контакты пользователя из списка contactUserIDs
+func (r *contactRepository) GetMany(ctx context.Context, userID uuid.UUID, contactUserIDs []uuid.UUID) ([]models.Contact, error) {
+	var contacts []models.Contact
+	if len(contactUserIDs) == 0 {
+		return contacts, nil
+	}
+	err := r.db.WithContext(ctx).
+		Preload("ContactUser").
+		Where("user_id = ? AND contact_user_id IN ?", userID, contactUserIDs).
+		Order("first_name, last_name, created_at").
+		Find(&contacts).Error
+	return contacts, err
+}
+
+// Delete удаляет контакт. Возвращает false, если его не было.
+func (r *contactRepository) Delete(ctx context.Context, userID, contactUserID uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND contact_user_id = ?", userID, contactUserID).
+		Delete(&models.Contact{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetContactIDs возвращает пользователей из контактов userID
+func (r *contactRepository) GetContactIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).
+		Model(&models.Contact{}).
+		Where("user_id = ?", userID).
+		Pluck("contact_user_id", &ids).Error
+	return ids, err
+}
+
+// GetOwnerIDs возвращает пользователей, у которых contactUserID записан в контактах
+func (r *contactRepository) GetOwnerIDs(ctx context.Context, contactUserID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).
+		Model(&models.Contact{}).
+		Where("contact_user_id = ?", contactUserID).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// FilterOwners возвращает тех из ownerIDs, у кого contactUserID записан в контактах
+func (r *contactRepository) FilterOwners(ctx context.Context, ownerIDs []uuid.UUID, contactUserID uuid.UUID) (map[uuid.UUID]bool, error) {
+	owners := make(map[uuid.UUID]bool)
+	if len(ownerIDs) == 0 {
+		return owners, nil
+	}
+
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).
+		Model(&models.Contact{}).
+		Where("contact_user_id = ? AND user_id IN ?", contactUserID, ownerIDs).
+		Pluck("user_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		owners[id] = true
+	}
+	return owners, nil
+}
+
+// SaveImported запоминает номера незарегистрированных пользователей из адресной книги
+func (r *contactRepository) SaveImported(ctx context.Context, imported []models.ImportedContact) error {
+	if len(imported) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "phone_hash"}},
+			DoUpdates: clause.AssignmentColumns([]string{"first_name", "last_name"}),
+		}).
+		Create(&imported).Error
+}
+
+// RecordImportIfAllowed учитывает импорт номеров hashes, если check разрешает его
+// по истории с момента since. Ошибка check возвращается как есть.
+//
+// Проверка и запись идут в одной транзакции под advisory lock пользователя:
+// параллельные импорты ждут друг друга и видят уже учтённые, поэтому квота не превышается.
+// Сами контакты сохраняются после, так что лимит сохранённых номеров параллельными
+// импортами может быть превышен не больше чем на размер одного импорта.
+func (r *contactRepository) RecordImportIfAllowed(ctx context.Context, userID uuid.UUID, hashes []string, since time.Time, check func(*ImportHistory) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "contact_import:"+userID.String()).Error; err != nil {
+			return err
+		}
+
+		// Импорты вне окна квоты больше не нужны
+		err := tx.Where("user_id = ? AND created_at < ?", userID, since).
+			Delete(&models.ContactImportLog{}).Error
+		if err != nil {
+			return err
+		}
+
+		var history ImportHistory
+		err = tx.Model(&models.ContactImportLog{}).
+			Select("COALESCE(SUM(numbers), 0) AS numbers, MIN(created_at) AS oldest").
+			Where("user_id = ?", userID).
+			Scan(&history).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Raw(`
+			SELECT (SELECT COUNT(*) FROM contacts WHERE user_id = ?)
+				+ (SELECT COUNT(*) FROM imported_contacts WHERE user_id = ?)
+		`, userID, userID).Scan(&history.Stored).Error
+		if err != nil {
+			return err
+		}
+
+		history.New = int64(len(hashes))
+		if len(hashes) > 0 {
+			var known int64
+			err = tx.Raw(`
+				SELECT COUNT(*) FROM (
+					SELECT phone_hash FROM imported_contacts
+					WHERE user_id = ? AND phone_hash IN ?
+					UNION
+					SELECT u.phone_hash FROM contacts c
+					INNER JOIN users u ON u.id = c.contact_user_id
+					WHERE c.user_id = ? AND u.phone_hash IN ?
+				) known
+			`, userID, hashes, userID, hashes).Scan(&known).Error
+			if err != nil {
+				return err
+			}
+			history.New -= known
+		}
+
+		if err := check(&history); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.ContactImportLog{
+			UserID:  userID,
+			Numbers: len(hashes),
+		}).Error
+	})
+}
+
+// ClaimImported превращает импортированные номера с хешем phoneHash в контакты
+// зарегистрировавшегося пользователя userID. Возвращает созданные контакты.
+func (r *contactRepository) ClaimImported(ctx context.Context, phoneHash string, userID uuid.UUID) ([]models.Contact, error) {
+	var contacts []models.Contact
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var imported []models.ImportedContact
+		err := tx.Clauses(clause.Returning{}).
+			Where("phone_hash = ? AND user_id != ?", phoneHash, userID).
+			Delete(&imported).Error
+		if err != nil || len(imported) == 0 {
+			return err
+		}
+
+		for _, entry := range imported {
+			contacts = append(contacts, models.Contact{
+				UserID:        entry.UserID,
+				ContactUserID: userID,
+				FirstName:     entry.FirstName,
+				LastName:      entry.LastName,
+			})
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&contacts).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contacts, nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"dildogram/backend/internal/migrate"
+	"dildogram/backend/internal/models"
+	"dildogram/backend/migrations"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB подключается к базе из TEST_DATABASE_URL, применяет миграции
+// и возвращает транзакцию, которая откатывается после теста.
+// Без TEST_DATABASE_URL тест пропускается.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrator, err := migrate.New(sqlDB, migrations.FS)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatalf("failed to begin transaction: %v", tx.Error)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+// createTestUser добавляет пользователя и возвращает его ID
+func createTestUser(t *testing.T, db *gorm.DB) uuid.UUID {
+	t.Helper()
+
+	id := uuid.New()
+	err := db.Exec("INSERT INTO users (id, phone, username) VALUES (?, ?, ?)",
+		id, "+1"+id.String()[:10], "u"+strings.ReplaceAll(id.String(), "-", "")[:20]).Error
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return id
+}
+
+// createTestChat добавляет чат с участниками; первый из них становится владельцем
+func createTestChat(t *testing.T, db *gorm.DB, chatType models.ChatType, userIDs ...uuid.UUID) uuid.UUID {
+	t.Helper()
+
+	id := uuid.New()
+	if err := db.Exec("INSERT INTO chats (id, type, created_by) VALUES (?, ?, ?)", id, chatType, userIDs[0]).Error; err != nil {
+		t.Fatalf("failed to create chat: %v", err)
+	}
+	for i, userID := range userIDs {
+		role := models.MemberRoleMember
+		if i == 0 {
+			role = models.MemberRoleOwner
+		}
+		if err := db.Exec("INSERT INTO chat_members (chat_id, user_id, role) VALUES (?, ?, ?)", id, userID, role).Error; err != nil {
+			t.Fatalf("failed to add chat member: %v", err)
+		}
+	}
+	return id
+}
+
+// createTestMessage добавляет текстовое сообщение со временем createdAt
+func createTestMessage(t *testing.T, db *gorm.DB, chatID, senderID uuid.UUID, content string, createdAt time.Time) uuid.UUID {
+	t.Helper()
+
+	id := uuid.New()
+	err := db.Exec("INSERT INTO messages (id, chat_id, sender_id, content, created_at) VALUES (?, ?, ?, ?, ?)",
+		id, chatID, senderID, content, createdAt).Error
+	if err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	return id
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InviteRepository определяет интерфейс для работы со ссылками-приглашениями и заявками на вступление
+type InviteRepository interface {
+	Create(ctx context.Context, invite *models.ChatInvite) error
+	GetByCode(ctx context.Context, code string) (*models.ChatInvite, error)
+	List(ctx context.Context, chatID uuid.UUID) ([]models.ChatInvite, error)
+	Revoke(ctx context.Context, chatID, inviteID uuid.UUID) (bool, error)
+	UseToJoin(ctx context.Context, inviteID uuid.UUID, membership *models.ChatMembership) (bool, bool, error)
+	CreateJoinRequest(ctx context.Context, request *models.ChatJoinRequest) (bool, error)
+	GetJoinRequest(ctx context.Context, chatID, userID uuid.UUID) (*models.ChatJoinRequest, error)
+	ListJoinRequests(ctx context.Context, chatID uuid.UUID) ([]models.ChatJoinRequest, error)
+	DeleteJoinRequest(ctx context.Context, chatID, userID uuid.UUID) (bool, error)
+	ApproveJoinRequest(ctx context.Context, membership *models.ChatMembership) (bool, bool, error)
+}
+
+type inviteRepository struct {
+	db *gorm.DB
+}
+
+// NewInviteRepository создаёт новый InviteRepository
+func NewInviteRepository(db *gorm.DB) InviteRepository {
+	return &inviteRepository{db: db}
+}
+
+func (r *inviteRepository) Create(ctx context.Context, invite *models.ChatInvite) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Create(invite).Error
+}
+
+func (r *inviteRepository) GetByCode(ctx context.Context, code string) (*models.ChatInvite, error) {
+	var invite models.ChatInvite
+	err := r.db.WithContext(ctx).First(&invite, "code = ?", code).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// List возвращает ссылки чата вместе с отозванными, начиная с новых
+func (r *inviteRepository) List(ctx context.Context, chatID uuid.UUID) ([]models.ChatInvite, error) {
+	var invites []models.ChatInvite
+	err := r.db.WithContext(ctx).
+		Preload("Creator").
+		Where("chat_id = ?", chatID).
+		Order("created_at DESC").
+		Find(&invites).Error
+	return invites, err
+}
+
+// Revoke отзывает ссылку. Возвращает false, если ссылки нет или она уже отозвана.
+func (r *inviteRepository) Revoke(ctx context.Context, chatID, inviteID uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.ChatInvite{}).
+		Where("id = ? AND chat_id = ? AND revoked_at IS NULL", inviteID, chatID).
+		Update("revoked_at", gorm.Expr("NOW()"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// useInvite атомарно засчитывает вступление по ссылке.
+// Возвращает false, если ссылка отозвана, истекла или исчерпала лимит.
+func useInvite(db *gorm.DB, inviteID uuid.UUID) (bool, error) {
+	result := db.
+		Model(&models.ChatInvite{}).
+		Where("id = ? AND revoked_at IS NULL", inviteID).
+		Where("expires_at IS NULL OR expires_at > NOW()").
+		Where("usage_limit IS NULL OR usage_count < usage_limit").
+		Update("usage_count", gorm.Expr("usage_count + 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UseToJoin засчитывает использование ссылки и добавляет по ней участника в одной транзакции.
+// Возвращает, засчитано ли использование и добавлен ли участник. Если участник
+// уже состоит в чате, использование не засчитывается.
+func (r *inviteRepository) UseToJoin(ctx context.Context, inviteID uuid.UUID, membership *models.ChatMembership) (bool, bool, error) {
+	// Сигналы отката транзакции, наружу не возвращаются
+	errNotUsed := errors.New("invite not used")
+	errNotAdded := errors.New("member not added")
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		used, err := useInvite(tx, inviteID)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errNotUsed
+		}
+
+		added, err := insertMember(tx, membership)
+		if err != nil {
+			return err
+		}
+		if !added {
+			// Откатываем использование ссылки
+			return errNotAdded
+		}
+		return nil
+	})
+	switch err {
+	case nil:
+		return true, true, nil
+	case errNotUsed:
+		return false, false, nil
+	case errNotAdded:
+		return true, false, nil
+	}
+	return false, false, err
+}
+
+// CreateJoinRequest сохраняет заявку. Повторная заявка того же пользователя
+// игнорируется: возвращается false.
+func (r *inviteRepository) CreateJoinRequest(ctx context.Context, request *models.ChatJoinRequest) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Omit(clause.Associations).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(request)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *inviteRepository) GetJoinRequest(ctx context.Context, chatID, userID uuid.UUID) (*models.ChatJoinRequest, error) {
+	var request models.ChatJoinRequest
+	err := r.db.WithContext(ctx).
+		First(&request, "chat_id = ? AND user_id = ?", chatID, userID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &request, nil
+}
+
+// ListJoinRequests возвращает заявки чата с пользователями, начиная с ранних
+func (r *inviteRepository) ListJoinRequests(ctx context.Context, chatID uuid.UUID) ([]models.ChatJoinRequest, error) {
+	var requests []models.ChatJoinRequest
+	err := r.db.WithContext(ctx).
+		Preload("User").
+		Where("chat_id = ?", chatID).
+		Order("created_at").
+		Find(&requests).Error
+	return requests, err
+}
+
+// DeleteJoinRequest удаляет заявку. Возвращает false, если её не было.
+func (r *inviteRepository) DeleteJoinRequest(ctx context.Context, chatID, userID uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Delete(&models.ChatJoinRequest{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ApproveJoinRequest удаляет заявку и добавляет заявителя в чат в одной транзакции.
+// Возвращает, была ли заявка и добавлен ли участник. Если заявитель уже состоит
+// в чате, заявка всё равно удаляется.
+func (r *inviteRepository) ApproveJoinRequest(ctx context.Context, membership *models.ChatMembership) (bool, bool, error) {
+	// Сигнал отката транзакции, наружу не возвращается
+	errNoRequest := errors.New("join request not found")
+
+	var added bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.
+			Where("chat_id = ? AND user_id = ?", membership.ChatID, membership.UserID).
+			Delete(&models.ChatJoinRequest{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNoRequest
+		}
+
+		var err error
+		added, err = insertMember(tx, membership)
+		return err
+	})
+	switch err {
+	case nil:
+		return true, added, nil
+	case errNoRequest:
+		return false, false, nil
+	}
+	return false, false, err
+}
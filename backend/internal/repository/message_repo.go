@@ -2,22 +2,76 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"time"
 
 	"dildogram/backend/internal/models"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // MessageRepository определяет интерфейс для работы с сообщениями
 type MessageRepository interface {
-	Create(ctx context.Context, message *models.Message) error
+	Create(ctx context.Context, message *models.Message) (bool, error)
+	CreateWithAttachment(ctx context.Context, message *models.Message, attachmentID uuid.UUID) (created bool, linked bool, err error)
+	CreateBatch(ctx context.Context, messages []models.Message) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Message, error)
-	GetChatMessages(ctx context.Context, chatID uuid.UUID, limit, offset int) ([]models.Message, error)
+	GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Message, error)
+	GetByClientMsgID(ctx context.Context, senderID uuid.UUID, clientMsgID string) (*models.Message, error)
+	GetChatMessagesPage(ctx context.Context, query MessagePageQuery) ([]models.Message, bool, error)
+	Search(ctx context.Context, query MessageSearchQuery) ([]models.MessageSearchResult, bool, error)
 	Update(ctx context.Context, message *models.Message) error
-	UpdateStatus(ctx context.Context, id uuid.UUID, status models.MessageStatus) error
-	MarkAsRead(ctx context.Context, chatID, userID uuid.UUID) error
+	DeleteForUser(ctx context.Context, messageID, userID uuid.UUID) error
 	GetUnreadCount(ctx context.Context, chatID, userID uuid.UUID) (int64, error)
-	MarkChatAsRead(ctx context.Context, chatID, userID uuid.UUID) error
+	MarkDelivered(ctx context.Context, messageID uuid.UUID, userIDs []uuid.UUID) (int64, error)
+	MarkChatDelivered(ctx context.Context, chatID, userID uuid.UUID, messageIDs []uuid.UUID) ([]uuid.UUID, error)
+	MarkRead(ctx context.Context, chatID, userID uuid.UUID, upTo *MessageCursor) ([]MessageCursor, error)
+	RefreshStatuses(ctx context.Context, messageIDs []uuid.UUID) ([]models.MessageStatusChange, error)
+	AddViews(ctx context.Context, messageIDs []uuid.UUID) error
+	GetReceipts(ctx context.Context, messageID uuid.UUID) ([]models.MessageReceipt, error)
+	GetThreadStats(ctx context.Context, threadIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]models.ThreadStats, error)
+	MarkThreadRead(ctx context.Context, threadID, userID uuid.UUID, readAt time.Time) error
+	HasForwardedMedia(ctx context.Context, mediaURL string, userID uuid.UUID) (bool, error)
+}
+
+// PageDirection определяет направление выборки истории сообщений
+type PageDirection int
+
+const (
+	PageBefore PageDirection = iota // Более старые сообщения
+	PageAfter                       // Более новые сообщения
+)
+
+// MessageCursor позиция сообщения в истории чата
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// MessagePageQuery параметры keyset-пагинации истории чата
+type MessagePageQuery struct {
+	ChatID    uuid.UUID
+	UserID    uuid.UUID
+	ThreadID  *uuid.UUID     // Только ответы в ветке; nil — вся история чата
+	Cursor    *MessageCursor // nil — начиная с самых новых сообщений
+	Direction PageDirection
+	Inclusive bool // Включать ли сообщение-курсор в выборку
+	Limit     int
+}
+
+// MessageSearchQuery параметры полнотекстового поиска по чатам пользователя
+type MessageSearchQuery struct {
+	UserID      uuid.UUID
+	Query       string
+	ChatID      *uuid.UUID
+	SenderID    *uuid.UUID
+	MessageType *models.MessageType
+	Before      *time.Time
+	After       *time.Time
+	Cursor      *MessageCursor // nil — начиная с самых новых совпадений
+	Limit       int
 }
 
 type messageRepository struct {
@@ -29,15 +83,79 @@ func NewMessageRepository(db *gorm.DB) MessageRepository {
 	return &messageRepository{db: db}
 }
 
-func (r *messageRepository) Create(ctx context.Context, message *models.Message) error {
-	return r.db.WithContext(ctx).Create(message).Error
+// onClientMsgIDConflict пропускает вставку повторно отправленного сообщения
+var onClientMsgIDConflict = clause.OnConflict{
+	Columns:     []clause.Column{{Name: "sender_id"}, {Name: "client_msg_id"}},
+	TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "client_msg_id IS NOT NULL"}}},
+	DoNothing:   true,
+}
+
+// Create создаёт сообщение. Возвращает false, если у отправителя уже есть
+// сообщение с тем же client_msg_id.
+func (r *messageRepository) Create(ctx context.Context, message *models.Message) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Omit(clause.Associations).
+		Clauses(onClientMsgIDConflict).
+		Create(message)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CreateBatch создаёт несколько сообщений одной транзакцией
+func (r *messageRepository) CreateBatch(ctx context.Context, messages []models.Message) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Create(&messages).Error
+}
+
+// CreateWithAttachment создаёт сообщение и привязывает к нему вложение в одной транзакции.
+// created = false, если у отправителя уже есть сообщение с тем же client_msg_id.
+// linked = false, если вложение уже привязано к другому сообщению;
+// созданное сообщение тогда откатывается.
+func (r *messageRepository) CreateWithAttachment(ctx context.Context, message *models.Message, attachmentID uuid.UUID) (bool, bool, error) {
+	// Сигналы отката транзакции, наружу не возвращаются
+	errNotCreated := errors.New("message not created")
+	errNotLinked := errors.New("attachment not linked")
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		created := tx.Omit(clause.Associations).Clauses(onClientMsgIDConflict).Create(message)
+		if created.Error != nil {
+			return created.Error
+		}
+		if created.RowsAffected == 0 {
+			return errNotCreated
+		}
+
+		result := tx.Model(&models.Attachment{}).
+			Where("id = ? AND message_id IS NULL", attachmentID).
+			Update("message_id", message.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Откатываем создание сообщения
+			return errNotLinked
+		}
+		return nil
+	})
+	switch err {
+	case nil:
+		return true, true, nil
+	case errNotCreated:
+		return false, false, nil
+	case errNotLinked:
+		return true, false, nil
+	}
+	return false, false, err
 }
 
 func (r *messageRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Message, error) {
 	var message models.Message
 	err := r.db.WithContext(ctx).
 		Preload("Sender").
-		Preload("Reads").
+		Preload("Attachment").
+		Preload("ReplyTo.Sender").
+		Preload("ForwardedFromUser").
 		First(&message, "id = ?", id).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -45,115 +163,494 @@ func (r *messageRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.
 		}
 		return nil, err
 	}
-	return &message, nil
+	setReplyPreview(&message)
+
+	messages := []models.Message{message}
+	if err := r.setForwardedAttachments(ctx, messages); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// GetByClientMsgID возвращает сообщение отправителя по клиентскому ID
+func (r *messageRepository) GetByClientMsgID(ctx context.Context, senderID uuid.UUID, clientMsgID string) (*models.Message, error) {
+	var message models.Message
+	err := r.db.WithContext(ctx).
+		Select("id").
+		Where("sender_id = ? AND client_msg_id = ?", senderID, clientMsgID).
+		First(&message).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return r.GetByID(ctx, message.ID)
 }
 
-func (r *messageRepository) GetChatMessages(ctx context.Context, chatID uuid.UUID, limit, offset int) ([]models.Message, error) {
+// GetByIDs возвращает сообщения с отправителями и вложениями в хронологическом порядке
+func (r *messageRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Message, error) {
 	var messages []models.Message
 	err := r.db.WithContext(ctx).
 		Preload("Sender").
-		Preload("Reads").
-		Where("chat_id = ? AND is_deleted = false", chatID).
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
+		Preload("Attachment").
+		Preload("ForwardedFromUser").
+		Where("id IN ?", ids).
+		Order("created_at, id").
 		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := r.setForwardedAttachments(ctx, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// GetChatMessagesPage возвращает страницу истории чата в хронологическом порядке
+// и признак наличия сообщений дальше в направлении выборки.
+func (r *messageRepository) GetChatMessagesPage(ctx context.Context, query MessagePageQuery) ([]models.Message, bool, error) {
+	var messages []models.Message
+
+	db := r.db.WithContext(ctx).
+		Preload("Sender").
+		Preload("Attachment").
+		Preload("ReplyTo.Sender").
+		Preload("ForwardedFromUser").
+		Where("chat_id = ? AND is_deleted = false", query.ChatID).
+		Where("NOT EXISTS (SELECT 1 FROM message_deletions md WHERE md.message_id = messages.id AND md.user_id = ?)", query.UserID)
+
+	if query.ThreadID != nil {
+		db = db.Where("thread_id = ?", *query.ThreadID)
+	}
+
+	// Keyset-пагинация по (created_at, id): стабильна при появлении новых сообщений
+	if query.Cursor != nil {
+		op := "<"
+		if query.Direction == PageAfter {
+			op = ">"
+		}
+		if query.Inclusive {
+			op += "="
+		}
+		db = db.Where("(created_at, id) "+op+" (?, ?)", query.Cursor.CreatedAt, query.Cursor.ID)
+	}
+
+	order := "created_at DESC, id DESC"
+	if query.Direction == PageAfter {
+		order = "created_at ASC, id ASC"
+	}
+
+	// Запрашиваем на одну запись больше, чтобы узнать, есть ли ещё сообщения
+	err := db.Order(order).
+		Limit(query.Limit + 1).
+		Find(&messages).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > query.Limit
+	if hasMore {
+		messages = messages[:query.Limit]
+	}
+	for i := range messages {
+		setReplyPreview(&messages[i])
+	}
+	if err := r.setForwardedAttachments(ctx, messages); err != nil {
+		return nil, false, err
+	}
 
 	// Реверсируем порядок для хронологического отображения
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	if query.Direction == PageBefore {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
 	}
 
-	return messages, err
+	return messages, hasMore, nil
 }
 
-func (r *messageRepository) Update(ctx context.Context, message *models.Message) error {
-	return r.db.WithContext(ctx).Save(message).Error
-}
+// Search ищет сообщения в активных чатах пользователя, от новых к старым.
+// Возвращает также признак наличия более старых совпадений.
+func (r *messageRepository) Search(ctx context.Context, query MessageSearchQuery) ([]models.MessageSearchResult, bool, error) {
+	var hits []struct {
+		ID      uuid.UUID
+		Snippet string
+	}
 
-func (r *messageRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status models.MessageStatus) error {
-	return r.db.WithContext(ctx).
-		Model(&models.Message{}).
-		Where("id = ?", id).
-		Update("status", status).Error
-}
+	// Экранируем HTML до подсветки, чтобы фрагмент можно было безопасно отрисовать
+	db := r.db.WithContext(ctx).
+		Table("messages m").
+		Select(`m.id, ts_headline('simple',
+			replace(replace(replace(m.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+			websearch_to_tsquery('simple', ?),
+			'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5') AS snippet`, query.Query).
+		Joins("INNER JOIN chats c ON c.id = m.chat_id AND c.deleted_at IS NULL").
+		Joins("INNER JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = ? AND cm.left_at IS NULL", query.UserID).
+		Where("m.search_vector @@ websearch_to_tsquery('simple', ?)", query.Query).
+		Where("m.is_deleted = false").
+		Where("NOT EXISTS (SELECT 1 FROM message_deletions md WHERE md.message_id = m.id AND md.user_id = ?)", query.UserID)
+
+	if query.ChatID != nil {
+		db = db.Where("m.chat_id = ?", *query.ChatID)
+	}
+	if query.SenderID != nil {
+		db = db.Where("m.sender_id = ?", *query.SenderID)
+	}
+	if query.MessageType != nil {
+		db = db.Where("m.message_type = ?", *query.MessageType)
+	}
+	if query.Before != nil {
+		db = db.Where("m.created_at < ?", *query.Before)
+	}
+	if query.After != nil {
+		db = db.Where("m.created_at > ?", *query.After)
+	}
+	if query.Cursor != nil {
+		db = db.Where("(m.created_at, m.id) < (?, ?)", query.Cursor.CreatedAt, query.Cursor.ID)
+	}
+
+	err := db.Order("m.created_at DESC, m.id DESC").
+		Limit(query.Limit + 1).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(hits) > query.Limit
+	if hasMore {
+		hits = hits[:query.Limit]
+	}
+	if len(hits) == 0 {
+		return []models.MessageSearchResult{}, false, nil
+	}
 
-func (r *messageRepository) MarkAsRead(ctx context.Context, chatID, userID uuid.UUID) error {
-	tx := r.db.WithContext(ctx).Begin()
-	defer tx.Rollback()
+	// Догружаем сообщения с отправителями и сохраняем порядок выдачи
+	ids := make([]uuid.UUID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
 
-	// Получаем все непрочитанные сообщения в чате от других пользователей
 	var messages []models.Message
-	err := tx.Where("chat_id = ? AND sender_id != ? AND is_deleted = false", chatID, userID).
+	err = r.db.WithContext(ctx).
+		Preload("Sender").
+		Preload("Attachment").
+		Preload("ReplyTo.Sender").
+		Preload("ForwardedFromUser").
+		Where("id IN ?", ids).
 		Find(&messages).Error
 	if err != nil {
-		return err
+		return nil, false, err
+	}
+	if err := r.setForwardedAttachments(ctx, messages); err != nil {
+		return nil, false, err
 	}
 
-	// Для каждого сообщения создаём запись о прочтении
+	byID := make(map[uuid.UUID]models.Message, len(messages))
 	for _, msg := range messages {
-		// Проверяем, не прочитано ли уже
-		var existing models.MessageRead
-		result := tx.Where("message_id = ? AND user_id = ?", msg.ID, userID).First(&existing)
-		if result.Error == gorm.ErrRecordNotFound {
-			read := models.MessageRead{
-				MessageID: msg.ID,
-				UserID:    userID,
-			}
-			if err := tx.Create(&read).Error; err != nil {
-				return err
-			}
-		}
+		setReplyPreview(&msg)
+		byID[msg.ID] = msg
 	}
 
-	// Обновляем статус последних сообщений на "read"
-	if len(messages) > 0 {
-		var messageIDs []uuid.UUID
-		for _, msg := range messages {
-			messageIDs = append(messageIDs, msg.ID)
+	results := make([]models.MessageSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		if msg, ok := byID[hit.ID]; ok {
+			results = append(results, models.MessageSearchResult{
+				Message: msg,
+				Snippet: hit.Snippet,
+			})
 		}
-		tx.Model(&models.Message{}).
-			Where("id IN ? AND status != ?", messageIDs, models.MessageStatusRead).
-			Update("status", models.MessageStatusRead)
 	}
 
-	return tx.Commit().Error
+	return results, hasMore, nil
+}
+
+func (r *messageRepository) Update(ctx context.Context, message *models.Message) error {
+	// Загруженные связи (отправитель, исходное сообщение ответа) не сохраняем
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(message).Error
+}
+
+func (r *messageRepository) DeleteForUser(ctx context.Context, messageID, userID uuid.UUID) error {
+	deletion := models.MessageDeletion{
+		MessageID: messageID,
+		UserID:    userID,
+	}
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "message_id"}, {Name: "user_id"}},
+			DoNothing: true,
+		}).
+		Create(&deletion).Error
 }
 
 func (r *messageRepository) GetUnreadCount(ctx context.Context, chatID, userID uuid.UUID) (int64, error) {
 	var count int64
 	err := r.db.WithContext(ctx).
 		Model(&models.Message{}).
-		Joins("LEFT JOIN message_reads mr ON messages.id = mr.message_id AND mr.user_id = ?", userID).
+		Joins("LEFT JOIN message_receipts mr ON messages.id = mr.message_id AND mr.user_id = ?", userID).
 		Where("messages.chat_id = ? AND messages.sender_id != ? AND messages.is_deleted = false AND mr.read_at IS NULL",
 			chatID, userID).
 		Count(&count).Error
 	return count, err
 }
 
-func (r *messageRepository) MarkChatAsRead(ctx context.Context, chatID, userID uuid.UUID) error {
-	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// Получаем все сообщения в чате от других пользователей
-		var messages []models.Message
-		err := tx.Where("chat_id = ? AND sender_id != ? AND is_deleted = false", chatID, userID).
-			Find(&messages).Error
+// MarkDelivered отмечает доставку сообщения участникам чата userIDs (кроме отправителя).
+// Возвращает число новых отметок.
+func (r *messageRepository) MarkDelivered(ctx context.Context, messageID uuid.UUID, userIDs []uuid.UUID) (int64, error) {
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+
+	result := r.db.WithContext(ctx).Exec(`
+		INSERT INTO message_receipts (message_id, user_id, delivered_at)
+		SELECT m.id, cm.user_id, NOW()
+		FROM messages m
+		INNER JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.left_at IS NULL AND cm.user_id IN ?
+		WHERE m.id = ? AND cm.user_id <> m.sender_id
+		ON CONFLICT (message_id, user_id) DO NOTHING
+	`, userIDs, messageID)
+	return result.RowsAffected, result.Error
+}
+
+// MarkChatDelivered отмечает доставку пользователю сообщений чата messageIDs без отметки.
+// Сообщения, отправленные до вступления пользователя в чат, не отмечаются.
+// Возвращает ID отмеченных сообщений.
+func (r *messageRepository) MarkChatDelivered(ctx context.Context, chatID, userID uuid.UUID, messageIDs []uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if len(messageIDs) == 0 {
+		return ids, nil
+	}
+
+	err := r.db.WithContext(ctx).Raw(`
+		INSERT INTO message_receipts (message_id, user_id, delivered_at)
+		SELECT m.id, cm.user_id, NOW()
+		FROM messages m
+		INNER JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = ? AND cm.left_at IS NULL
+		WHERE m.chat_id = ? AND m.id IN ? AND m.sender_id <> cm.user_id
+			AND m.is_deleted = false AND m.created_at >= cm.joined_at
+		ON CONFLICT (message_id, user_id) DO NOTHING
+		RETURNING message_id
+	`, userID, chatID, messageIDs).Scan(&ids).Error
+	return ids, err
+}
+
+// MarkRead отмечает прочитанными сообщения чата от других участников,
+// до upTo включительно (nil — все). Прочитанное считается и доставленным.
+// Возвращает позиции впервые прочитанных сообщений в хронологическом порядке.
+func (r *messageRepository) MarkRead(ctx context.Context, chatID, userID uuid.UUID, upTo *MessageCursor) ([]MessageCursor, error) {
+	bound := ""
+	args := []interface{}{userID, chatID, userID, userID}
+	if upTo != nil {
+		bound = "AND (m.created_at, m.id) <= (?, ?)"
+		args = append(args, upTo.CreatedAt, upTo.ID)
+	}
+
+	var read []MessageCursor
+	err := r.db.WithContext(ctx).Raw(`
+		WITH marked AS (
+			INSERT INTO message_receipts (message_id, user_id, delivered_at, read_at)
+			SELECT m.id, ?, NOW(), NOW()
+			FROM messages m
+			WHERE m.chat_id = ? AND m.sender_id <> ? AND m.is_deleted = false
+				AND NOT EXISTS (
+					SELECT 1 FROM message_receipts mr
+					WHERE mr.message_id = m.id AND mr.user_id = ? AND mr.read_at IS NOT NULL
+				)
+				`+bound+`
+			ON CONFLICT (message_id, user_id) DO UPDATE SET read_at = EXCLUDED.read_at
+			WHERE message_receipts.read_at IS NULL
+			RETURNING message_id
+		)
+		SELECT m.created_at, m.id
+		FROM messages m
+		INNER JOIN marked ON marked.message_id = m.id
+		ORDER BY m.created_at, m.id
+	`, args...).Scan(&read).Error
+	return read, err
+}
+
+// AddViews засчитывает по одному просмотру сообщениям канала
+func (r *messageRepository) AddViews(ctx context.Context, messageIDs []uuid.UUID) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).
+		Model(&models.Message{}).
+		Where("id IN ?", messageIDs).
+		UpdateColumn("view_count", gorm.Expr("view_count + 1")).Error
+}
+
+// Размер пачки сообщений при пересчёте статусов
+const statusRefreshBatch = 1000
+
+// RefreshStatuses пересчитывает сводные статусы сообщений по отметкам получателей.
+// Получатели — активные участники, вступившие до отправки, кроме отправителя.
+// Статус только повышается (sent → delivered → read). Возвращает изменённые статусы.
+func (r *messageRepository) RefreshStatuses(ctx context.Context, messageIDs []uuid.UUID) ([]models.MessageStatusChange, error) {
+	var changes []models.MessageStatusChange
+
+	for start := 0; start < len(messageIDs); start += statusRefreshBatch {
+		end := start + statusRefreshBatch
+		if end > len(messageIDs) {
+			end = len(messageIDs)
+		}
+
+		var batch []models.MessageStatusChange
+		err := r.db.WithContext(ctx).Raw(`
+			UPDATE messages m
+			SET status = s.status
+			FROM (
+				SELECT msg.id,
+					CASE
+						WHEN COUNT(*) = COUNT(mr.read_at) THEN 'read'
+						WHEN COUNT(*) = COUNT(mr.message_id) THEN 'delivered'
+						ELSE 'sent'
+					END AS status
+				FROM messages msg
+				INNER JOIN chat_members cm ON cm.chat_id = msg.chat_id AND cm.user_id <> msg.sender_id
+					AND cm.left_at IS NULL AND cm.joined_at <= msg.created_at
+				LEFT JOIN message_receipts mr ON mr.message_id = msg.id AND mr.user_id = cm.user_id
+				WHERE msg.id IN ?
+				GROUP BY msg.id
+			) s
+			WHERE m.id = s.id
+				AND ((s.status = 'read' AND m.status <> 'read')
+					OR (s.status = 'delivered' AND m.status IN ('pending', 'sent')))
+			RETURNING m.id AS message_id, m.chat_id, m.sender_id, m.status
+		`, messageIDs[start:end]).Scan(&batch).Error
 		if err != nil {
-			return err
+			return nil, err
 		}
+		changes = append(changes, batch...)
+	}
 
-		// Создаём записи о прочтении для каждого сообщения
-		for _, msg := range messages {
-			read := models.MessageRead{
-				MessageID: msg.ID,
-				UserID:    userID,
-			}
-			// Используем OnConflict для предотвращения дубликатов
-			tx.Clauses(gorm.OnConflict{
-				Columns:   []gorm.Column{{Name: "message_id"}, {Name: "user_id"}},
-				DoNothing: true,
-			}).Create(&read)
+	return changes, nil
+}
+
+// GetReceipts возвращает отметки получателей сообщения: сначала прочитавшие по времени прочтения
+func (r *messageRepository) GetReceipts(ctx context.Context, messageID uuid.UUID) ([]models.MessageReceipt, error) {
+	var receipts []models.MessageReceipt
+	err := r.db.WithContext(ctx).
+		Preload("User").
+		Where("message_id = ?", messageID).
+		Order("read_at ASC NULLS LAST, delivered_at ASC").
+		Find(&receipts).Error
+	return receipts, err
+}
+
+// GetThreadStats возвращает число ответов, время последнего ответа и число
+// непрочитанных ответов пользователя для веток с корнями threadIDs
+func (r *messageRepository) GetThreadStats(ctx context.Context, threadIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]models.ThreadStats, error) {
+	stats := make(map[uuid.UUID]models.ThreadStats)
+	if len(threadIDs) == 0 {
+		return stats, nil
+	}
+
+	var rows []struct {
+		ThreadID    uuid.UUID
+		ReplyCount  int64
+		LastReplyAt time.Time
+		UnreadCount int64
+	}
+	err := r.db.WithContext(ctx).
+		Table("messages m").
+		Select(`m.thread_id,
+			COUNT(*) AS reply_count,
+			MAX(m.created_at) AS last_reply_at,
+			COUNT(*) FILTER (WHERE m.created_at > tr.last_read_at AND m.sender_id <> ?) AS unread_count`, userID).
+		Joins("LEFT JOIN thread_reads tr ON tr.thread_id = m.thread_id AND tr.user_id = ?", userID).
+		Where("m.thread_id IN ? AND m.is_deleted = false", threadIDs).
+		Group("m.thread_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		stats[row.ThreadID] = models.ThreadStats{
+			ReplyCount:  row.ReplyCount,
+			LastReplyAt: row.LastReplyAt,
+			UnreadCount: row.UnreadCount,
 		}
+	}
+	return stats, nil
+}
 
+// MarkThreadRead отмечает ветку прочитанной до readAt и подписывает пользователя на неё
+func (r *messageRepository) MarkThreadRead(ctx context.Context, threadID, userID uuid.UUID, readAt time.Time) error {
+	read := models.ThreadRead{
+		ThreadID:   threadID,
+		UserID:     userID,
+		LastReadAt: readAt,
+	}
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "thread_id"}, {Name: "user_id"}},
+			DoUpdates: clause.Set{{
+				Column: clause.Column{Name: "last_read_at"},
+				Value:  gorm.Expr("GREATEST(thread_reads.last_read_at, EXCLUDED.last_read_at)"),
+			}},
+		}).
+		Create(&read).Error
+}
+
+// HasForwardedMedia проверяет, доступно ли вложение пользователю через пересланную копию
+// сообщения в одном из его чатов
+func (r *messageRepository) HasForwardedMedia(ctx context.Context, mediaURL string, userID uuid.UUID) (bool, error) {
+	var exists bool
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT EXISTS (
+			SELECT 1 FROM messages m
+			INNER JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = ? AND cm.left_at IS NULL
+			WHERE m.media_url = ? AND m.forwarded_from_created_at IS NOT NULL AND m.is_deleted = false
+		)
+	`, userID, mediaURL).Scan(&exists).Error
+	return exists, err
+}
+
+// setForwardedAttachments подставляет вложения в пересланные копии:
+// вложение привязано только к исходному сообщению, копия ссылается на него через media_url
+func (r *messageRepository) setForwardedAttachments(ctx context.Context, messages []models.Message) error {
+	byAttachment := make(map[uuid.UUID][]int)
+	for i := range messages {
+		message := &messages[i]
+		if message.Attachment != nil || !message.IsForwarded() || message.MediaURL == nil {
+			continue
+		}
+		if !strings.HasPrefix(*message.MediaURL, models.MediaURLPrefix) {
+			continue
+		}
+		id, err := uuid.Parse(strings.TrimPrefix(*message.MediaURL, models.MediaURLPrefix))
+		if err != nil {
+			continue
+		}
+		byAttachment[id] = append(byAttachment[id], i)
+	}
+	if len(byAttachment) == 0 {
 		return nil
-	})
+	}
+
+	ids := make([]uuid.UUID, 0, len(byAttachment))
+	for id := range byAttachment {
+		ids = append(ids, id)
+	}
+
+	var attachments []models.Attachment
+	if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&attachments).Error; err != nil {
+		return err
+	}
+
+	for i := range attachments {
+		for _, idx := range byAttachment[attachments[i].ID] {
+			messages[idx].Attachment = &attachments[i]
+		}
+	}
+	return nil
+}
+
+// setReplyPreview строит превью сообщения, на которое дан ответ (ReplyTo должен быть загружен)
+func setReplyPreview(message *models.Message) {
+	if message.ReplyTo != nil {
+		message.ReplyPreview = models.NewReplyPreview(message.ReplyTo)
+	}
 }
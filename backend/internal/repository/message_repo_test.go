@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestGetChatMessagesPageWalksHistoryWithoutGaps(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(db)
+
+	alice := createTestUser(t, db)
+	chatID := createTestChat(t, db, models.ChatTypeGroup, alice)
+
+	// Сообщения с одинаковым временем упорядочиваются по ID, поэтому граница
+	// страницы может прийтись между ними
+	now := time.Now().Truncate(time.Microsecond)
+	times := []time.Time{
+		now.Add(-3 * time.Minute),
+		now.Add(-2 * time.Minute),
+		now.Add(-2 * time.Minute),
+		now.Add(-2 * time.Minute),
+		now.Add(-time.Minute),
+	}
+	type entry struct {
+		id        uuid.UUID
+		createdAt time.Time
+	}
+	var history []entry
+	for _, createdAt := range times {
+		history = append(history, entry{createTestMessage(t, db, chatID, alice, "hello", createdAt), createdAt})
+	}
+	slices.SortFunc(history, func(a, b entry) int {
+		if c := a.createdAt.Compare(b.createdAt); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.id[:], b.id[:])
+	})
+	want := make([]uuid.UUID, len(history))
+	for i, e := range history {
+		want[i] = e.id
+	}
+
+	// Назад от самых новых страницами по два
+	var backward []uuid.UUID
+	query := MessagePageQuery{ChatID: chatID, UserID: alice, Direction: PageBefore, Limit: 2}
+	for {
+		page, hasMore, err := repo.GetChatMessagesPage(ctx, query)
+		if err != nil {
+			t.Fatalf("GetChatMessagesPage(before) error = %v", err)
+		}
+		ids := make([]uuid.UUID, len(page))
+		for i := range page {
+			ids[i] = page[i].ID
+		}
+		backward = append(ids, backward...)
+		if !hasMore {
+			break
+		}
+		query.Cursor = &MessageCursor{CreatedAt: page[0].CreatedAt, ID: page[0].ID}
+	}
+	if !slices.Equal(backward, want) {
+		t.Errorf("backward walk = %v, want %v", backward, want)
+	}
+
+	// Вперёд от самого старого, включая его
+	var forward []uuid.UUID
+	query = MessagePageQuery{
+		ChatID:    chatID,
+		UserID:    alice,
+		Direction: PageAfter,
+		Inclusive: true,
+		Cursor:    &MessageCursor{CreatedAt: history[0].createdAt, ID: history[0].id},
+		Limit:     2,
+	}
+	for {
+		page, hasMore, err := repo.GetChatMessagesPage(ctx, query)
+		if err != nil {
+			t.Fatalf("GetChatMessagesPage(after) error = %v", err)
+		}
+		for i := range page {
+			forward = append(forward, page[i].ID)
+		}
+		if !hasMore {
+			break
+		}
+		last := page[len(page)-1]
+		query.Cursor = &MessageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		query.Inclusive = false
+	}
+	if !slices.Equal(forward, want) {
+		t.Errorf("forward walk = %v, want %v", forward, want)
+	}
+}
+
+func TestSearchReturnsOnlyMessagesFromUserChats(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(db)
+
+	alice, bob := createTestUser(t, db), createTestUser(t, db)
+	shared := createTestChat(t, db, models.ChatTypeGroup, alice, bob)
+	foreign := createTestChat(t, db, models.ChatTypeGroup, bob)
+	left := createTestChat(t, db, models.ChatTypeGroup, bob, alice)
+	if err := db.Exec("UPDATE chat_members SET left_at = NOW() WHERE chat_id = ? AND user_id = ?", left, alice).Error; err != nil {
+		t.Fatalf("failed to leave chat: %v", err)
+	}
+
+	now := time.Now()
+	visible := createTestMessage(t, db, shared, bob, "quarterly report", now.Add(-time.Minute))
+	hidden := createTestMessage(t, db, shared, bob, "quarterly report draft", now.Add(-2*time.Minute))
+	if err := repo.DeleteForUser(ctx, hidden, alice); err != nil {
+		t.Fatalf("DeleteForUser() error = %v", err)
+	}
+	createTestMessage(t, db, foreign, bob, "quarterly report", now)
+	createTestMessage(t, db, left, bob, "quarterly report", now)
+
+	results, hasMore, err := repo.Search(ctx, MessageSearchQuery{UserID: alice, Query: "quarterly", Limit: 10})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if hasMore || len(results) != 1 || results[0].ID != visible {
+		ids := make([]uuid.UUID, len(results))
+		for i := range results {
+			ids[i] = results[i].ID
+		}
+		t.Fatalf("Search() = %v (has more %v), want only %s", ids, hasMore, visible)
+	}
+
+	// Бобу видны сообщения всех трёх его чатов
+	results, _, err = repo.Search(ctx, MessageSearchQuery{UserID: bob, Query: "quarterly", Limit: 10})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) != 4 {
+		t.Errorf("Search() for bob returned %d results, want 4", len(results))
+	}
+}
+
+func TestGetThreadStatsCountsRepliesAndUnread(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(db)
+
+	alice, bob := createTestUser(t, db), createTestUser(t, db)
+	chatID := createTestChat(t, db, models.ChatTypeGroup, alice, bob)
+
+	now := time.Now().Truncate(time.Microsecond)
+	root := createTestMessage(t, db, chatID, alice, "root", now.Add(-time.Hour))
+	replies := make([]uuid.UUID, 4)
+	senders := []uuid.UUID{bob, bob, alice, bob}
+	for i := range replies {
+		replies[i] = createTestMessage(t, db, chatID, senders[i], "reply", now.Add(time.Duration(i-4)*time.Minute))
+	}
+	if err := db.Exec("UPDATE messages SET thread_id = ? WHERE id IN ?", root, replies).Error; err != nil {
+		t.Fatalf("failed to link replies: %v", err)
+	}
+	// Удалённый ответ не считается
+	if err := db.Exec("UPDATE messages SET is_deleted = true WHERE id = ?", replies[3]).Error; err != nil {
+		t.Fatalf("failed to delete reply: %v", err)
+	}
+
+	// Алиса прочитала ветку до первого ответа; свой ответ не считается непрочитанным
+	if err := repo.MarkThreadRead(ctx, root, alice, now.Add(-4*time.Minute)); err != nil {
+		t.Fatalf("MarkThreadRead() error = %v", err)
+	}
+
+	stats, err := repo.GetThreadStats(ctx, []uuid.UUID{root, replies[0]}, alice)
+	if err != nil {
+		t.Fatalf("GetThreadStats() error = %v", err)
+	}
+	if _, ok := stats[replies[0]]; ok {
+		t.Error("stats returned for a message without replies")
+	}
+	thread := stats[root]
+	if thread.ReplyCount != 3 || thread.UnreadCount != 1 || !thread.LastReplyAt.Equal(now.Add(-2*time.Minute)) {
+		t.Errorf("stats = %+v, want 3 replies, 1 unread, last at %v", thread, now.Add(-2*time.Minute))
+	}
+
+	// Без отметки о прочтении непрочитанных нет: пользователь не следит за веткой
+	stats, err = repo.GetThreadStats(ctx, []uuid.UUID{root}, bob)
+	if err != nil {
+		t.Fatalf("GetThreadStats() error = %v", err)
+	}
+	if stats[root].ReplyCount != 3 || stats[root].UnreadCount != 0 {
+		t.Errorf("stats for bob = %+v, want 3 replies, 0 unread", stats[root])
+	}
+}
+
+func TestRefreshStatusesAggregatesRecipients(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(db)
+
+	alice, bob, carol, dave := createTestUser(t, db), createTestUser(t, db), createTestUser(t, db), createTestUser(t, db)
+	chatID := createTestChat(t, db, models.ChatTypeGroup, alice, bob, carol, dave)
+	messageID := createTestMessage(t, db, chatID, alice, "hello", time.Now())
+
+	// Дэйв вступил после отправки и в статусе не учитывается
+	if err := db.Exec("UPDATE chat_members SET joined_at = NOW() + interval '1 minute' WHERE chat_id = ? AND user_id = ?", chatID, dave).Error; err != nil {
+		t.Fatalf("failed to move join time: %v", err)
+	}
+
+	refresh := func(want models.MessageStatus) {
+		t.Helper()
+
+		changes, err := repo.RefreshStatuses(ctx, []uuid.UUID{messageID})
+		if err != nil {
+			t.Fatalf("RefreshStatuses() error = %v", err)
+		}
+		if want == "" {
+			if len(changes) != 0 {
+				t.Fatalf("RefreshStatuses() = %+v, want no changes", changes)
+			}
+			return
+		}
+		if len(changes) != 1 || changes[0].MessageID != messageID || changes[0].SenderID != alice || changes[0].Status != want {
+			t.Fatalf("RefreshStatuses() = %+v, want %s for %s", changes, want, messageID)
+		}
+	}
+
+	// Доставлено не всем — статус не меняется
+	if _, err := repo.MarkDelivered(ctx, messageID, []uuid.UUID{bob}); err != nil {
+		t.Fatalf("MarkDelivered() error = %v", err)
+	}
+	refresh("")
+
+	if _, err := repo.MarkDelivered(ctx, messageID, []uuid.UUID{carol}); err != nil {
+		t.Fatalf("MarkDelivered() error = %v", err)
+	}
+	refresh(models.MessageStatusDelivered)
+	refresh("")
+
+	// Прочитано не всеми — статус остаётся «доставлено»
+	if _, err := repo.MarkRead(ctx, chatID, bob, nil); err != nil {
+		t.Fatalf("MarkRead() error = %v", err)
+	}
+	refresh("")
+
+	if _, err := repo.MarkRead(ctx, chatID, carol, nil); err != nil {
+		t.Fatalf("MarkRead() error = %v", err)
+	}
+	refresh(models.MessageStatusRead)
+	refresh("")
+}
+
+func TestRefreshStatusesIgnoresMembersWhoLeft(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(db)
+
+	alice, bob, carol := createTestUser(t, db), createTestUser(t, db), createTestUser(t, db)
+	chatID := createTestChat(t, db, models.ChatTypeGroup, alice, bob, carol)
+	messageID := createTestMessage(t, db, chatID, alice, "hello", time.Now())
+
+	if _, err := repo.MarkRead(ctx, chatID, bob, nil); err != nil {
+		t.Fatalf("MarkRead() error = %v", err)
+	}
+	if err := db.Exec("UPDATE chat_members SET left_at = NOW() WHERE chat_id = ? AND user_id = ?", chatID, carol).Error; err != nil {
+		t.Fatalf("failed to leave chat: %v", err)
+	}
+
+	changes, err := repo.RefreshStatuses(ctx, []uuid.UUID{messageID})
+	if err != nil {
+		t.Fatalf("RefreshStatuses() error = %v", err)
+	}
+	if len(changes) != 1 || changes[0].Status != models.MessageStatusRead {
+		t.Errorf("RefreshStatuses() = %+v, want read", changes)
+	}
+}
+
+func TestCreateSkipsDuplicateClientMsgID(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(db)
+
+	alice, bob := createTestUser(t, db), createTestUser(t, db)
+	chatID := createTestChat(t, db, models.ChatTypeGroup, alice, bob)
+	clientMsgID := "c-1"
+
+	newMessage := func(senderID uuid.UUID) *models.Message {
+		return &models.Message{
+			ChatID:      chatID,
+			SenderID:    senderID,
+			Content:     "hello",
+			MessageType: models.MessageTypeText,
+			Status:      models.MessageStatusSent,
+			ClientMsgID: &clientMsgID,
+		}
+	}
+
+	first := newMessage(alice)
+	if created, err := repo.Create(ctx, first); err != nil || !created {
+		t.Fatalf("Create() = %v, %v; want created", created, err)
+	}
+	if created, err := repo.Create(ctx, newMessage(alice)); err != nil || created {
+		t.Fatalf("Create(duplicate) = %v, %v; want skipped", created, err)
+	}
+	if created, err := repo.Create(ctx, newMessage(bob)); err != nil || !created {
+		t.Fatalf("Create(other sender) = %v, %v; want created", created, err)
+	}
+
+	existing, err := repo.GetByClientMsgID(ctx, alice, clientMsgID)
+	if err != nil {
+		t.Fatalf("GetByClientMsgID() error = %v", err)
+	}
+	if existing == nil || existing.ID != first.ID {
+		t.Errorf("GetByClientMsgID() = %v, want %s", existing, first.ID)
+	}
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PinRepository определяет интерфейс для работы с закреплёнными сообщениями
+type PinRepository interface {
+	Add(ctx context.Context, pin *models.PinnedMessage) (bool, error)
+	Get(ctx context.Context, chatID, messageID uuid.UUID) (*models.PinnedMessage, error)
+	Remove(ctx context.Context, chatID, messageID uuid.UUID) (bool, error)
+	Count(ctx context.Context, chatID uuid.UUID) (int64, error)
+	GetChatPins(ctx context.Context, chatID uuid.UUID) ([]models.PinnedMessage, error)
+}
+
+type pinRepository struct {
+	db *gorm.DB
+}
+
+// NewPinRepository создаёт новый PinRepository
+func NewPinRepository(db *gorm.DB) PinRepository {
+	return &pinRepository{db: db}
+}
+
+// Add закрепляет сообщение. Возвращает false, если оно уже закреплено.
+func (r *pinRepository) Add(ctx context.Context, pin *models.PinnedMessage) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Omit(clause.Associations).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chat_id"}, {Name: "message_id"}},
+			DoNothing: true,
+		}).
+		Create(pin)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *pinRepository) Get(ctx context.Context, chatID, messageID uuid.UUID) (*models.PinnedMessage, error) {
+	var pin models.PinnedMessage
+	err := r.db.WithContext(ctx).
+		First(&pin, "chat_id = ? AND message_id = ?", chatID, messageID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &pin, nil
+}
+
+// Remove открепляет сообщение. Возвращает false, если оно не было закреплено.
+func (r *pinRepository) Remove(ctx context.Context, chatID, messageID uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("chat_id = ? AND message_id = ?", chatID, messageID).
+		Delete(&models.PinnedMessage{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *pinRepository) Count(ctx context.Context, chatID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.PinnedMessage{}).
+		Where("chat_id = ?", chatID).
+		Count(&count).Error
+	return count, err
+}
+
+// GetChatPins возвращает закреплённые сообщения чата, начиная с последнего закреплённого.
+// Сообщения, удалённые у всех, пропускаются.
+func (r *pinRepository) GetChatPins(ctx context.Context, chatID uuid.UUID) ([]models.PinnedMessage, error) {
+	var pins []models.PinnedMessage
+	err := r.db.WithContext(ctx).
+		Preload("Message.Sender").
+		Preload("Message.Attachment").
+		Select("pinned_messages.*").
+		Joins("INNER JOIN messages m ON m.id = pinned_messages.message_id AND m.is_deleted = false").
+		Where("pinned_messages.chat_id = ?", chatID).
+		Order("pinned_messages.pinned_at DESC, pinned_messages.id DESC").
+		Find(&pins).Error
+	return pins, err
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReactionRepository определяет интерфейс для работы с реакциями на сообщения
+type ReactionRepository interface {
+	Add(ctx context.Context, reaction *models.MessageReaction) (bool, error)
+	Remove(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error)
+	CountByUser(ctx context.Context, messageID, userID uuid.UUID) (int64, error)
+	GetSummaries(ctx context.Context, messageIDs []uuid.UUID, viewerID uuid.UUID) (map[uuid.UUID][]models.ReactionCount, error)
+	GetMessageReactions(ctx context.Context, messageID uuid.UUID, emoji string, limit int) ([]models.MessageReaction, error)
+}
+
+type reactionRepository struct {
+	db *gorm.DB
+}
+
+// NewReactionRepository создаёт новый ReactionRepository
+func NewReactionRepository(db *gorm.DB) ReactionRepository {
+	return &reactionRepository{db: db}
+}
+
+// Add добавляет реакцию. Возвращает false, если такая реакция уже есть.
+func (r *reactionRepository) Add(ctx context.Context, reaction *models.MessageReaction) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "message_id"}, {Name: "user_id"}, {Name: "emoji"}},
+			DoNothing: true,
+		}).
+		Create(reaction)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Remove удаляет реакцию. Возвращает false, если её не было.
+func (r *reactionRepository) Remove(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&models.MessageReaction{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *reactionRepository) CountByUser(ctx context.Context, messageID, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.MessageReaction{}).
+		Where("message_id = ? AND user_id = ?", messageID, userID).
+		Count(&count).Error
+	return count, err
+}
+
+// GetSummaries возвращает реакции на сообщения, сгруппированные по эмодзи.
+// Внутри сообщения реакции упорядочены по убыванию числа, затем по времени первой реакции.
+func (r *reactionRepository) GetSummaries(ctx context.Context, messageIDs []uuid.UUID, viewerID uuid.UUID) (map[uuid.UUID][]models.ReactionCount, error) {
+	summaries := make(map[uuid.UUID][]models.ReactionCount)
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+
+	var rows []struct {
+		MessageID uuid.UUID
+		Emoji     string
+		Count     int64
+		Reacted   bool
+	}
+	err := r.db.WithContext(ctx).
+		Model(&models.MessageReaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = ?) AS reacted", viewerID).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		Order("message_id, count DESC, MIN(created_at)").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		summaries[row.MessageID] = append(summaries[row.MessageID], models.ReactionCount{
+			Emoji:   row.Emoji,
+			Count:   row.Count,
+			Reacted: row.Reacted,
+		})
+	}
+	return summaries, nil
+}
+
+// GetMessageReactions возвращает последние реакции на сообщение с пользователями.
+// Пустой emoji — реакции с любым эмодзи.
+func (r *reactionRepository) GetMessageReactions(ctx context.Context, messageID uuid.UUID, emoji string, limit int) ([]models.MessageReaction, error) {
+	var reactions []models.MessageReaction
+
+	db := r.db.WithContext(ctx).
+		Preload("User").
+		Where("message_id = ?", messageID)
+	if emoji != "" {
+		db = db.Where("emoji = ?", emoji)
+	}
+
+	err := db.Order("created_at DESC").
+		Limit(limit).
+		Find(&reactions).Error
+	return reactions, err
+}
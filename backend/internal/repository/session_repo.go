@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SessionRepository определяет интерфейс для работы с сессиями пользователей
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.UserSession) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.UserSession, error)
+	GetByRefreshTokenHash(ctx context.Context, hash string) (*models.UserSession, error)
+	GetUserSessions(ctx context.Context, userID uuid.UUID) ([]models.UserSession, error)
+	Rotate(ctx context.Context, id uuid.UUID, oldHash, newHash, ipAddress string, expiresAt time.Time) (bool, error)
+	Revoke(ctx context.Context, userID, id uuid.UUID) (bool, error)
+	RevokeByUsedToken(ctx context.Context, hash string) (*models.UserSession, error)
+	RevokeAll(ctx context.Context, userID, exceptID uuid.UUID) ([]uuid.UUID, error)
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+// NewSessionRepository создаёт новый SessionRepository
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *models.UserSession) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *sessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.UserSession, error) {
+	var session models.UserSession
+	err := r.db.WithContext(ctx).First(&session, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) GetByRefreshTokenHash(ctx context.Context, hash string) (*models.UserSession, error) {
+	var session models.UserSession
+	err := r.db.WithContext(ctx).First(&session, "refresh_token_hash = ?", hash).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) GetUserSessions(ctx context.Context, userID uuid.UUID) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Rotate заменяет refresh токен сессии, только если текущий хеш совпадает с oldHash.
+// Возвращает false, если токен уже был использован параллельным запросом.
+// Старый токен запоминается до своего истечения, чтобы распознать его повторное
+// предъявление; истекшие использованные токены сессии заодно удаляются.
+func (r *sessionRepository) Rotate(ctx context.Context, id uuid.UUID, oldHash, newHash, ipAddress string, expiresAt time.Time) (bool, error) {
+	var rotated bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Строка сессии блокируется: из параллельных ротаций одного токена
+		// проходит только первая, у остальных хеш уже не совпадает
+		result := tx.Exec(`
+			WITH old AS (
+				SELECT id, refresh_token_hash, expires_at
+				FROM user_sessions
+				WHERE id = ? AND refresh_token_hash = ? AND revoked_at IS NULL
+				FOR UPDATE
+			), rotated AS (
+				UPDATE user_sessions s
+				SET refresh_token_hash = ?, ip_address = ?, expires_at = ?, last_used_at = NOW()
+				FROM old
+				WHERE s.id = old.id
+				RETURNING s.id
+			)
+			INSERT INTO user_session_used_tokens (refresh_token_hash, session_id, expires_at)
+			SELECT old.refresh_token_hash, old.id, old.expires_at
+			FROM old
+			JOIN rotated ON rotated.id = old.id
+		`, id, oldHash, newHash, ipAddress, expiresAt)
+		if result.Error != nil {
+			return result.Error
+		}
+		rotated = result.RowsAffected > 0
+		if !rotated {
+			return nil
+		}
+
+		return tx.Exec(
+			"DELETE FROM user_session_used_tokens WHERE session_id = ? AND expires_at < NOW()", id,
+		).Error
+	})
+	return rotated, err
+}
+
+func (r *sessionRepository) Revoke(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.UserSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeByUsedToken отзывает сессию, которой принадлежал уже использованный
+// и ещё не истекший refresh токен. Возвращает отозванную сессию или nil,
+// если токен не использовался или сессия уже отозвана.
+func (r *sessionRepository) RevokeByUsedToken(ctx context.Context, hash string) (*models.UserSession, error) {
+	var revoked []models.UserSession
+	err := r.db.WithContext(ctx).
+		Model(&revoked).
+		Clauses(clause.Returning{}).
+		Where("id = (?) AND revoked_at IS NULL",
+			r.db.Table("user_session_used_tokens").
+				Select("session_id").
+				Where("refresh_token_hash = ? AND expires_at > NOW()", hash),
+		).
+		Update("revoked_at", time.Now()).Error
+	if err != nil || len(revoked) == 0 {
+		return nil, err
+	}
+	return &revoked[0], nil
+}
+
+func (r *sessionRepository) RevokeAll(ctx context.Context, userID, exceptID uuid.UUID) ([]uuid.UUID, error) {
+	var revoked []models.UserSession
+	err := r.db.WithContext(ctx).
+		Model(&revoked).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("user_id = ? AND id != ? AND revoked_at IS NULL", userID, exceptID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(revoked))
+	for _, s := range revoked {
+		ids = append(ids, s.ID)
+	}
+	return ids, nil
+}
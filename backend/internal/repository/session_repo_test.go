@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dildogram/backend/internal/models"
+)
+
+func TestRevokeByUsedTokenAfterRotation(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewSessionRepository(db)
+
+	session := &models.UserSession{
+		UserID:           createTestUser(t, db),
+		RefreshTokenHash: "first",
+		ExpiresAt:        time.Now().Add(time.Hour),
+	}
+	if err := repo.Create(ctx, session); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// Неиспользованный токен сессию не отзывает
+	if revoked, err := repo.RevokeByUsedToken(ctx, "first"); err != nil || revoked != nil {
+		t.Fatalf("RevokeByUsedToken() before rotation = %v, %v, want nil", revoked, err)
+	}
+
+	rotated, err := repo.Rotate(ctx, session.ID, "first", "second", "", time.Now().Add(time.Hour))
+	if err != nil || !rotated {
+		t.Fatalf("Rotate() = %v, %v, want true", rotated, err)
+	}
+	if rotated, err := repo.Rotate(ctx, session.ID, "first", "third", "", time.Now().Add(time.Hour)); err != nil || rotated {
+		t.Fatalf("second Rotate() of the same token = %v, %v, want false", rotated, err)
+	}
+
+	revoked, err := repo.RevokeByUsedToken(ctx, "first")
+	if err != nil {
+		t.Fatalf("RevokeByUsedToken() error = %v", err)
+	}
+	if revoked == nil || revoked.ID != session.ID || revoked.UserID != session.UserID {
+		t.Fatalf("RevokeByUsedToken() = %+v, want session %s", revoked, session.ID)
+	}
+
+	// Отозванная сессия не продлевается и текущим токеном
+	current, err := repo.GetByRefreshTokenHash(ctx, "second")
+	if err != nil || current == nil {
+		t.Fatalf("GetByRefreshTokenHash() = %v, %v", current, err)
+	}
+	if current.IsActive() {
+		t.Error("session is still active after token reuse")
+	}
+}
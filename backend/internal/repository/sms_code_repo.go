@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SendStats описывает отправленные за окно коды
+type SendStats struct {
+	Count  int64
+	Oldest *time.Time
+}
+
+// SendHistory описывает прежние отправки на номер и с IP, по которым проверяются лимиты
+type SendHistory struct {
+	Latest *models.SMSCode
+	Phone  *SendStats
+	// IP — nil, если IP не известен
+	IP *SendStats
+}
+
+// SMSCodeRepository определяет интерфейс для работы с SMS кодами
+type SMSCodeRepository interface {
+	CreateIfAllowed(ctx context.Context, code *models.SMSCode, since time.Time, check func(*SendHistory) error) error
+	GetActive(ctx context.Context, phone string, maxAttempts int) (*models.SMSCode, error)
+	GetLockedUntil(ctx context.Context, phone string) (*time.Time, error)
+	RegisterFailedAttempt(ctx context.Context, id uuid.UUID, maxAttempts int, lockUntil time.Time) (int, error)
+	MarkUsed(ctx context.Context, id uuid.UUID, maxAttempts int) (bool, error)
+	DeleteCreatedBefore(ctx context.Context, before time.Time) error
+}
+
+type smsCodeRepository struct {
+	db *gorm.DB
+}
+
+// NewSMSCodeRepository создаёт новый SMSCodeRepository
+func NewSMSCodeRepository(db *gorm.DB) SMSCodeRepository {
+	return &smsCodeRepository{db: db}
+}
+
+// CreateIfAllowed сохраняет новый код и гасит предыдущие неиспользованные коды номера,
+// если check разрешает отправку по истории с момента since. Ошибка check возвращается как есть.
+//
+// Проверка и запись идут в одной транзакции под advisory lock номера и IP:
+// параллельные запросы ждут друг друга и видят уже сохранённые коды, поэтому лимит не превышается.
+// Блокировка номера всегда берётся первой, так что взаимоблокировок нет.
+func (r *smsCodeRepository) CreateIfAllowed(ctx context.Context, code *models.SMSCode, since time.Time, check func(*SendHistory) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "sms_phone:"+code.Phone).Error; err != nil {
+			return err
+		}
+		if code.IPAddress != "" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "sms_ip:"+code.IPAddress).Error; err != nil {
+				return err
+			}
+		}
+
+		var history SendHistory
+		var err error
+		if history.Latest, err = getLatest(tx, code.Phone); err != nil {
+			return err
+		}
+		if history.Phone, err = stats(tx, "phone = ?", code.Phone, since); err != nil {
+			return err
+		}
+		if code.IPAddress != "" {
+			if history.IP, err = stats(tx, "ip_address = ?", code.IPAddress, since); err != nil {
+				return err
+			}
+		}
+		if err := check(&history); err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.SMSCode{}).
+			Where("phone = ? AND is_used = false", code.Phone).
+			Update("is_used", true).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(code).Error
+	})
+}
+
+// getLatest возвращает последний код номера
+func getLatest(db *gorm.DB, phone string) (*models.SMSCode, error) {
+	var code models.SMSCode
+	err := db.
+		Where("phone = ?", phone).
+		Order("created_at DESC").
+		First(&code).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &code, nil
+}
+
+// GetActive возвращает неиспользованный, неистёкший код с оставшимися попытками
+func (r *smsCodeRepository) GetActive(ctx context.Context, phone string, maxAttempts int) (*models.SMSCode, error) {
+	var code models.SMSCode
+	err := r.db.WithContext(ctx).
+		Where("phone = ? AND is_used = false AND expires_at > NOW() AND attempts < ?", phone, maxAttempts).
+		Order("created_at DESC").
+		First(&code).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &code, nil
+}
+
+// GetLockedUntil возвращает время окончания блокировки номера или nil
+func (r *smsCodeRepository) GetLockedUntil(ctx context.Context, phone string) (*time.Time, error) {
+	var result struct {
+		LockedUntil *time.Time
+	}
+	err := r.db.WithContext(ctx).
+		Model(&models.SMSCode{}).
+		Select("MAX(locked_until) AS locked_until").
+		Where("phone = ? AND locked_until > NOW()", phone).
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result.LockedUntil, nil
+}
+
+// stats считает коды, отправленные с момента since, и время самого раннего из них
+func stats(db *gorm.DB, condition string, value string, since time.Time) (*SendStats, error) {
+	var stats SendStats
+	err := db.
+		Model(&models.SMSCode{}).
+		Select("COUNT(*) AS count, MIN(created_at) AS oldest").
+		Where(condition, value).
+		Where("created_at > ?", since).
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// RegisterFailedAttempt атомарно увеличивает счётчик неудачных попыток.
+// При достижении maxAttempts номер блокируется до lockUntil.
+func (r *smsCodeRepository) RegisterFailedAttempt(ctx context.Context, id uuid.UUID, maxAttempts int, lockUntil time.Time) (int, error) {
+	var attempts int
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE sms_codes
+		SET attempts = attempts + 1,
+			locked_until = CASE WHEN attempts + 1 >= ? THEN ?::timestamptz ELSE locked_until END
+		WHERE id = ?
+		RETURNING attempts
+	`, maxAttempts, lockUntil, id).Scan(&attempts).Error
+	if err != nil {
+		return 0, err
+	}
+	return attempts, nil
+}
+
+// MarkUsed помечает код использованным.
+// Возвращает false, если код уже использован, истёк или исчерпал попытки.
+func (r *smsCodeRepository) MarkUsed(ctx context.Context, id uuid.UUID, maxAttempts int) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.SMSCode{}).
+		Where("id = ? AND is_used = false AND expires_at > NOW() AND attempts < ?", id, maxAttempts).
+		Update("is_used", true)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteCreatedBefore удаляет старые коды, которые уже не участвуют в лимитах
+func (r *smsCodeRepository) DeleteCreatedBefore(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).
+		Where("created_at < ? AND (locked_until IS NULL OR locked_until < NOW())", before).
+		Delete(&models.SMSCode{}).Error
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UpdateState описывает журнал обновлений пользователя
+type UpdateState struct {
+	// Seq — номер последнего обновления, 0 если обновлений не было
+	Seq int64
+	// MinSeq — самый ранний сохранённый номер, 0 если журнал пуст
+	MinSeq int64
+}
+
+// channelPtsHorizon — за это время запись, получившая отметку канала,
+// гарантированно фиксируется. Более свежие отметки могли обогнать ещё не
+// видимые записи с меньшими отметками.
+const channelPtsHorizon = 5 * time.Second
+
+// ChannelChange канал, отметка изменений которого выросла.
+// Pending — отметка выдана недавно: до неё ещё могут появиться каналы
+// с меньшими отметками, поэтому клиент не должен продолжать с неё.
+type ChannelChange struct {
+	ChatID  uuid.UUID
+	Pts     int64
+	Pending bool
+}
+
+// UpdateRepository определяет интерфейс для работы с журналом обновлений пользователей
+type UpdateRepository interface {
+	AppendForChat(ctx context.Context, chatID uuid.UUID, updateType string, data json.RawMessage) (map[uuid.UUID]int64, error)
+	AppendForUser(ctx context.Context, userID uuid.UUID, updateType string, data json.RawMessage) (int64, error)
+	GetSince(ctx context.Context, userID uuid.UUID, since int64, limit int) ([]models.Update, error)
+	GetState(ctx context.Context, userID uuid.UUID) (*UpdateState, error)
+	DeleteCreatedBefore(ctx context.Context, before time.Time) error
+	GetChangedChannels(ctx context.Context, userID uuid.UUID, since int64) ([]ChannelChange, error)
+}
+
+type updateRepository struct {
+	db *gorm.DB
+}
+
+// NewUpdateRepository создаёт новый UpdateRepository
+func NewUpdateRepository(db *gorm.DB) UpdateRepository {
+	return &updateRepository{db: db}
+}
+
+// AppendForChat записывает обновление всем активным участникам чата.
+// Возвращает выданные номера по пользователям.
+//
+// В каналах обновление получают только владелец и админы: подписчиков может быть
+// очень много. Вместо этого тем же запросом продвигается отметка изменений
+// канала: подписчики узнают по ней о канале и догружают пропущенное из истории.
+// Отметки берутся из общей последовательности без блокировки, поэтому
+// фиксируются не строго по порядку (см. GetChangedChannels).
+//
+// Счётчики блокируются в порядке user_id, чтобы параллельные записи
+// в чаты с общими участниками не взаимоблокировались. Блокировка счётчика
+// держится до фиксации, поэтому номера становятся видны строго по порядку.
+func (r *updateRepository) AppendForChat(ctx context.Context, chatID uuid.UUID, updateType string, data json.RawMessage) (map[uuid.UUID]int64, error) {
+	var rows []struct {
+		UserID uuid.UUID
+		Seq    int64
+	}
+	err := r.db.WithContext(ctx).Raw(`
+		WITH channel AS (
+			UPDATE chats SET channel_pts = nextval('channel_pts_seq'), channel_changed_at = NOW()
+			WHERE id = ? AND type = 'channel'
+		), seqs AS (
+			INSERT INTO user_update_seqs (user_id, seq)
+			SELECT cm.user_id, 1 FROM chat_members cm
+			INNER JOIN chats c ON c.id = cm.chat_id
+			WHERE cm.chat_id = ? AND cm.left_at IS NULL
+				AND (c.type <> 'channel' OR cm.role <> 'member')
+			ORDER BY cm.user_id
+			ON CONFLICT (user_id) DO UPDATE SET seq = user_update_seqs.seq + 1
+			RETURNING user_id, seq
+		)
+		INSERT INTO user_updates (user_id, seq, type, data)
+		SELECT user_id, seq, ?::varchar, ?::jsonb FROM seqs
+		RETURNING user_id, seq
+	`, chatID, chatID, updateType, string(data)).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seqs := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		seqs[row.UserID] = row.Seq
+	}
+	return seqs, nil
+}
+
+// AppendForUser записывает обновление одному пользователю и возвращает его номер
+func (r *updateRepository) AppendForUser(ctx context.Context, userID uuid.UUID, updateType string, data json.RawMessage) (int64, error) {
+	var seq int64
+	err := r.db.WithContext(ctx).Raw(`
+		WITH seqs AS (
+			INSERT INTO user_update_seqs (user_id, seq)
+			VALUES (?, 1)
+			ON CONFLICT (user_id) DO UPDATE SET seq = user_update_seqs.seq + 1
+			RETURNING user_id, seq
+		)
+		INSERT INTO user_updates (user_id, seq, type, data)
+		SELECT user_id, seq, ?::varchar, ?::jsonb FROM seqs
+		RETURNING seq
+	`, userID, updateType, string(data)).Scan(&seq).Error
+	if err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// GetSince возвращает обновления пользователя с номером больше since по возрастанию
+func (r *updateRepository) GetSince(ctx context.Context, userID uuid.UUID, since int64, limit int) ([]models.Update, error) {
+	var updates []models.Update
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND seq > ?", userID, since).
+		Order("seq").
+		Limit(limit).
+		Find(&updates).Error
+	return updates, err
+}
+
+func (r *updateRepository) GetState(ctx context.Context, userID uuid.UUID) (*UpdateState, error) {
+	var state UpdateState
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT
+			COALESCE((SELECT seq FROM user_update_seqs WHERE user_id = ?), 0) AS seq,
+			COALESCE((SELECT MIN(seq) FROM user_updates WHERE user_id = ?), 0) AS min_seq
+	`, userID, userID).Scan(&state).Error
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// DeleteCreatedBefore удаляет старые обновления. Счётчики остаются,
+// чтобы номера не начинались заново.
+func (r *updateRepository) DeleteCreatedBefore(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).
+		Where("created_at < ?", before).
+		Delete(&models.Update{}).Error
+}
+
+// GetChangedChannels возвращает каналы пользователя с отметкой больше since по возрастанию отметки.
+// Отметки моложе channelPtsHorizon помечаются как Pending.
+func (r *updateRepository) GetChangedChannels(ctx context.Context, userID uuid.UUID, since int64) ([]ChannelChange, error) {
+	var changes []ChannelChange
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT c.id AS chat_id, c.channel_pts AS pts,
+			COALESCE(c.channel_changed_at > NOW() - make_interval(secs => ?), FALSE) AS pending
+		FROM chats c
+		INNER JOIN chat_members cm ON cm.chat_id = c.id
+		WHERE cm.user_id = ? AND cm.left_at IS NULL
+			AND c.type = 'channel' AND c.channel_pts > ?
+		ORDER BY c.channel_pts
+	`, channelPtsHorizon.Seconds(), userID, since).Scan(&changes).Error
+	return changes, err
+}
@@ -10,6 +10,13 @@ import (
 	"gorm.io/gorm"
 )
 
+// PresenceCandidate пользователь, которому может быть виден статус присутствия
+type PresenceCandidate struct {
+	UserID uuid.UUID
+	// IsContact — записан ли он в контактах самого пользователя
+	IsContact bool
+}
+
 // UserRepository определяет интерфейс для работы с пользователями
 type UserRepository interface {
 	Create(ctx context.Context, user *models.User) error
@@ -17,9 +24,12 @@ type UserRepository interface {
 	GetByPhone(ctx context.Context, phone string) (*models.User, error)
 	GetByUsername(ctx context.Context, username string) (*models.User, error)
 	Update(ctx context.Context, user *models.User) error
-	UpdateAvatar(ctx context.Context, id uuid.UUID, avatarURL string) error
+	UpdateAvatar(ctx context.Context, id uuid.UUID, avatarURL string, preview models.ImagePreview) error
 	SetOnline(ctx context.Context, id uuid.UUID, isOnline bool) error
 	Search(ctx context.Context, query string, limit int) ([]models.User, error)
+	UpdatePrivacy(ctx context.Context, id uuid.UUID, settings models.PrivacySettings) error
+	GetPresenceCandidates(ctx context.Context, userID uuid.UUID) ([]PresenceCandidate, error)
+	GetByPhoneHashes(ctx context.Context, hashes []string) ([]models.User, error)
 }
 
 type userRepository struct {
@@ -75,10 +85,15 @@ func (r *userRepository) Update(ctx context.Context, user *models.User) error {
 	return r.db.WithContext(ctx).Save(user).Error
 }
 
-func (r *userRepository) UpdateAvatar(ctx context.Context, id uuid.UUID, avatarURL string) error {
+func (r *userRepository) UpdateAvatar(ctx context.Context, id uuid.UUID, avatarURL string, preview models.ImagePreview) error {
 	return r.db.WithContext(ctx).Model(&models.User{}).
 		Where("id = ?", id).
-		Update("avatar_url", avatarURL).Error
+		Updates(map[string]interface{}{
+			"avatar_url":            avatarURL,
+			"avatar_thumbnails":     preview.Thumbnails,
+			"avatar_blurhash":       preview.Blurhash,
+			"avatar_dominant_color": preview.DominantColor,
+		}).Error
 }
 
 func (r *userRepository) SetOnline(ctx context.Context, id uuid.UUID, isOnline bool) error {
@@ -103,3 +118,58 @@ func (r *userRepository) Search(ctx context.Context, query string, limit int) ([
 		Find(&users).Error
 	return users, err
 }
+
+func (r *userRepository) UpdatePrivacy(ctx context.Context, id uuid.UUID, settings models.PrivacySettings) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"privacy_last_seen": settings.LastSeen,
+			"privacy_online":    settings.Online,
+			"privacy_phone":     settings.Phone,
+			"privacy_avatar":    settings.Avatar,
+		}).Error
+}
+
+// chatPartnersQuery выбирает пользователей, с которыми у userID есть общий неудалённый чат
+const chatPartnersQuery = `
+	SELECT DISTINCT other.user_id
+	FROM chat_members own
+	INNER JOIN chats c ON c.id = own.chat_id AND c.deleted_at IS NULL
+	INNER JOIN chat_members other ON other.chat_id = own.chat_id
+		AND other.left_at IS NULL AND other.user_id != own.user_id
+	WHERE own.user_id = ? AND own.left_at IS NULL
+`
+
+// GetPresenceCandidates возвращает собеседников по общим чатам и тех, у кого
+// пользователь записан в контактах, кроме заблокированных им, одним запросом:
+// он выполняется при каждой смене присутствия
+func (r *userRepository) GetPresenceCandidates(ctx context.Context, userID uuid.UUID) ([]PresenceCandidate, error) {
+	var candidates []PresenceCandidate
+	err := r.db.WithContext(ctx).Raw(`
+		WITH candidates AS (`+chatPartnersQuery+`
+			UNION
+			SELECT user_id FROM contacts WHERE contact_user_id = ?
+		)
+		SELECT cand.user_id,
+			EXISTS (
+				SELECT 1 FROM contacts ct WHERE ct.user_id = ? AND ct.contact_user_id = cand.user_id
+			) AS is_contact
+		FROM candidates cand
+		WHERE NOT EXISTS (
+			SELECT 1 FROM user_blocks b WHERE b.user_id = ? AND b.blocked_user_id = cand.user_id
+		)
+	`, userID, userID, userID, userID).Scan(&candidates).Error
+	return candidates, err
+}
+
+// GetByPhoneHashes возвращает активных пользователей, хеши номеров которых есть в hashes
+func (r *userRepository) GetByPhoneHashes(ctx context.Context, hashes []string) ([]models.User, error) {
+	var users []models.User
+	if len(hashes) == 0 {
+		return users, nil
+	}
+	err := r.db.WithContext(ctx).
+		Where("phone_hash IN ? AND is_active = true", hashes).
+		Find(&users).Error
+	return users, err
+}
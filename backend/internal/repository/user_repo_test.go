@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"dildogram/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestGetPresenceCandidatesSkipsBlockedUsers(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	alice := createTestUser(t, db)
+	partner, contactOwner, blocked, stranger := createTestUser(t, db), createTestUser(t, db), createTestUser(t, db), createTestUser(t, db)
+	createTestChat(t, db, models.ChatTypePrivate, alice, partner)
+	createTestChat(t, db, models.ChatTypeGroup, alice, blocked)
+
+	// У contactOwner alice в контактах, а сама alice записала partner
+	err := NewContactRepository(db).Upsert(ctx, []models.Contact{
+		{UserID: contactOwner, ContactUserID: alice},
+		{UserID: alice, ContactUserID: partner},
+	})
+	if err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if _, err := NewBlockRepository(db).Block(ctx, alice, blocked); err != nil {
+		t.Fatalf("Block() error = %v", err)
+	}
+
+	candidates, err := NewUserRepository(db).GetPresenceCandidates(ctx, alice)
+	if err != nil {
+		t.Fatalf("GetPresenceCandidates() error = %v", err)
+	}
+
+	got := make(map[uuid.UUID]bool, len(candidates))
+	for _, candidate := range candidates {
+		got[candidate.UserID] = candidate.IsContact
+	}
+	want := map[uuid.UUID]bool{partner: true, contactOwner: false}
+	if len(got) != len(want) {
+		t.Fatalf("GetPresenceCandidates() = %v, want %v", got, want)
+	}
+	for id, isContact := range want {
+		if gotContact, ok := got[id]; !ok || gotContact != isContact {
+			t.Errorf("candidate %s: IsContact = %v (present %v), want %v", id, gotContact, ok, isContact)
+		}
+	}
+	if _, ok := got[stranger]; ok {
+		t.Errorf("stranger %s is a candidate", stranger)
+	}
+}
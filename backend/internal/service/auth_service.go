@@ -2,204 +2,494 @@ package service
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"math/big"
 	"time"
 
 	"dildogram/backend/internal/config"
 	"dildogram/backend/internal/models"
 	"dildogram/backend/internal/repository"
+	"dildogram/backend/internal/sms"
 	"dildogram/backend/pkg/hasher"
 	"dildogram/backend/pkg/jwt"
+	"dildogram/backend/pkg/phone"
 	"github.com/google/uuid"
 )
 
 var (
-	ErrUserNotFound      = errors.New("user not found")
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrUserExists        = errors.New("user already exists")
-	ErrInvalidCode       = errors.New("invalid or expired code")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrUserExists          = errors.New("user already exists")
+	ErrInvalidCode         = errors.New("invalid or expired code")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionRevoked      = errors.New("session revoked or expired")
+	ErrSMSTooFrequent      = errors.New("sms code was requested too recently")
+	ErrSMSLimitExceeded    = errors.New("too many sms codes requested")
+	ErrSMSLocked           = errors.New("too many invalid code attempts")
+	ErrSMSDeliveryFailed   = errors.New("failed to deliver sms code")
+	ErrInvalidPrivacyLevel = errors.New("invalid privacy level")
 )
 
-// AuthService предоставляет методы для аутентификации
-type AuthService struct {
-	userRepo   repository.UserRepository
-	smsRepo    *smsCodeStorage
-	tokenMgr   *jwt.TokenManager
-	config     *config.Config
+const (
+	// Окно часовых лимитов отправки SMS
+	smsLimitWindow = time.Hour
+	// Сколько хранить отправленные коды
+	smsRetention = 24 * time.Hour
+	// Текст SMS с кодом
+	smsCodeText = "Dildogram code: %s. Do not share it with anyone."
+)
+
+// RateLimitError сообщает, что действие временно запрещено, и когда его можно повторить
+type RateLimitError struct {
+	Reason     error
+	RetryAfter time.Duration
 }
 
-// smsCodeStorage хранит SMS коды в памяти (для имитации)
-type smsCodeStorage struct {
-	codes map[string]*models.SMSCode
+func (e *RateLimitError) Error() string {
+	return e.Reason.Error()
 }
 
-func newSMSCodeStorage() *smsCodeStorage {
-	return &smsCodeStorage{
-		codes: make(map[string]*models.SMSCode),
-	}
+func (e *RateLimitError) Unwrap() error {
+	return e.Reason
+}
+
+// TokenReuseError сообщает, что предъявлен уже использованный refresh токен
+// и его сессия отозвана. Соединения сессии нужно закрыть.
+type TokenReuseError struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
 }
 
-func (s *smsCodeStorage) Save(code *models.SMSCode) {
-	s.codes[code.Phone] = code
+func (e *TokenReuseError) Error() string {
+	return ErrInvalidRefreshToken.Error()
 }
 
-func (s *smsCodeStorage) Get(phone string) *models.SMSCode {
-	return s.codes[phone]
+func (e *TokenReuseError) Unwrap() error {
+	return ErrInvalidRefreshToken
 }
 
-func (s *smsCodeStorage) Delete(phone string) {
-	delete(s.codes, phone)
+// TokenPair представляет пару access/refresh токенов сессии
+type TokenPair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	SessionID    uuid.UUID `json:"session_id"`
+}
+
+// SessionInfo описывает устройство, с которого выполняется вход
+type SessionInfo struct {
+	DeviceInfo string
+	IPAddress  string
+}
+
+// AuthService предоставляет методы для аутентификации
+type AuthService struct {
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	smsRepo     repository.SMSCodeRepository
+	contactRepo repository.ContactRepository
+	blockRepo   repository.BlockRepository
+	smsSender   sms.Sender
+	tokenMgr    *jwt.TokenManager
+	config      *config.Config
 }
 
 // NewAuthService создаёт новый AuthService
-func NewAuthService(userRepo repository.UserRepository, cfg *config.Config) *AuthService {
+func NewAuthService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, smsRepo repository.SMSCodeRepository, contactRepo repository.ContactRepository, blockRepo repository.BlockRepository, smsSender sms.Sender, cfg *config.Config) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
-		smsRepo:  newSMSCodeStorage(),
-		tokenMgr: jwt.NewTokenManager(cfg.JWT.Secret, cfg.JWT.ExpireHours),
-		config:   cfg,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		smsRepo:     smsRepo,
+		contactRepo: contactRepo,
+		blockRepo:   blockRepo,
+		smsSender:   smsSender,
+		tokenMgr:    jwt.NewTokenManager(cfg.JWT.Secret, cfg.JWT.AccessExpireDur),
+		config:      cfg,
 	}
 }
 
 // Register регистрирует нового пользователя с паролем
-func (s *AuthService) Register(ctx context.Context, phone, username, password string) (*models.User, string, error) {
+func (s *AuthService) Register(ctx context.Context, phone, username, password string, info SessionInfo) (*models.User, *TokenPair, error) {
 	// Проверяем существование пользователя
 	existing, _ := s.userRepo.GetByPhone(ctx, phone)
 	if existing != nil {
-		return nil, "", ErrUserExists
+		return nil, nil, ErrUserExists
 	}
 
 	existing, _ = s.userRepo.GetByUsername(ctx, username)
 	if existing != nil {
-		return nil, "", ErrUserExists
+		return nil, nil, ErrUserExists
 	}
 
 	// Хешируем пароль
 	hash, err := hasher.HashPassword(password)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to hash password: %w", err)
+		return nil, nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
 	// Создаём пользователя
 	user := &models.User{
 		Phone:        phone,
+		PhoneHash:    phoneHash(phone),
 		Username:     username,
 		PasswordHash: &hash,
 	}
 
 	if err := s.userRepo.Create(ctx, user); err != nil {
-		return nil, "", fmt.Errorf("failed to create user: %w", err)
+		return nil, nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	// Генерируем токен
-	token, err := s.tokenMgr.Generate(user.ID, user.Username)
+	// Создаём сессию и выдаём токены
+	tokens, err := s.createSession(ctx, user, info)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, nil, err
 	}
 
-	return user, token, nil
+	return user, tokens, nil
 }
 
 // Login выполняет вход по паролю
-func (s *AuthService) Login(ctx context.Context, phone, password string) (*models.User, string, error) {
+func (s *AuthService) Login(ctx context.Context, phone, password string, info SessionInfo) (*models.User, *TokenPair, error) {
 	user, err := s.userRepo.GetByPhone(ctx, phone)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 	if user == nil {
-		return nil, "", ErrUserNotFound
+		return nil, nil, ErrUserNotFound
 	}
 
 	// Проверяем пароль
 	if user.PasswordHash == nil || !hasher.VerifyPassword(password, *user.PasswordHash) {
-		return nil, "", ErrInvalidCredentials
+		return nil, nil, ErrInvalidCredentials
 	}
 
-	// Генерируем токен
-	token, err := s.tokenMgr.Generate(user.ID, user.Username)
+	// Создаём сессию и выдаём токены
+	tokens, err := s.createSession(ctx, user, info)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, nil, err
 	}
 
-	return user, token, nil
+	return user, tokens, nil
 }
 
-// RequestSMSCode запрашивает SMS код (имитация)
-func (s *AuthService) RequestSMSCode(ctx context.Context, phone string) (string, error) {
-	// Генерируем 6-значный код
-	bytes := make([]byte, 3)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", fmt.Errorf("failed to generate code: %w", err)
+// SMSCodeStatus описывает отправленный код
+type SMSCodeStatus struct {
+	ExpiresIn   time.Duration
+	ResendAfter time.Duration
+}
+
+// RequestSMSCode генерирует код, сохраняет его HMAC и отправляет код по SMS.
+// Отправка ограничена по номеру (интервал и часовой лимит) и по IP.
+func (s *AuthService) RequestSMSCode(ctx context.Context, phone, ipAddress string) (*SMSCodeStatus, error) {
+	now := time.Now()
+	cfg := s.config.SMS
+
+	if err := s.checkSMSLock(ctx, phone, now); err != nil {
+		return nil, err
+	}
+
+	code, err := generateSMSCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate code: %w", err)
 	}
-	code := hex.EncodeToString(bytes)[:6]
 
-	// Сохраняем код
+	// Сохраняем код до отправки: неудачные отправки тоже учитываются в лимитах.
+	// Лимиты проверяются в одной транзакции с записью, чтобы параллельные запросы их не превысили.
 	smsCode := &models.SMSCode{
 		Phone:     phone,
-		Code:      code,
-		ExpiresAt: time.Now().Add(s.config.SMS.CodeExpireDur),
+		Code:      s.hashSMSCode(phone, code),
+		IPAddress: truncate(ipAddress, 45),
+		ExpiresAt: now.Add(cfg.CodeExpireDur),
+	}
+	err = s.smsRepo.CreateIfAllowed(ctx, smsCode, now.Add(-smsLimitWindow), func(history *repository.SendHistory) error {
+		if latest := history.Latest; latest != nil && now.Before(latest.CreatedAt.Add(cfg.ResendIntervalDur)) {
+			return &RateLimitError{Reason: ErrSMSTooFrequent, RetryAfter: latest.CreatedAt.Add(cfg.ResendIntervalDur).Sub(now)}
+		}
+		if err := checkSendLimit(history.Phone, cfg.PhoneHourlyLimit, now); err != nil {
+			return err
+		}
+		if history.IP != nil {
+			return checkSendLimit(history.IP, cfg.IPHourlyLimit, now)
+		}
+		return nil
+	})
+	if err != nil {
+		var limitErr *RateLimitError
+		if errors.As(err, &limitErr) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to save code: %w", err)
 	}
-	s.smsRepo.Save(smsCode)
 
-	// В реальном приложении здесь была бы отправка SMS
-	// Для разработки выводим код в лог
-	fmt.Printf("[SMS CODE] Phone: %s, Code: %s\n", phone, code)
+	if err := s.smsSender.Send(ctx, phone, fmt.Sprintf(smsCodeText, code)); err != nil {
+		log.Printf("Failed to send SMS code to %s: %v", phone, err)
+		if _, markErr := s.smsRepo.MarkUsed(ctx, smsCode.ID, cfg.MaxAttempts); markErr != nil {
+			log.Printf("Failed to invalidate undelivered SMS code %s: %v", smsCode.ID, markErr)
+		}
+		return nil, ErrSMSDeliveryFailed
+	}
 
-	return code, nil
+	// Старые коды больше не участвуют в лимитах
+	if err := s.smsRepo.DeleteCreatedBefore(ctx, now.Add(-smsRetention)); err != nil {
+		log.Printf("Failed to clean up SMS codes: %v", err)
+	}
+
+	return &SMSCodeStatus{
+		ExpiresIn:   cfg.CodeExpireDur,
+		ResendAfter: cfg.ResendIntervalDur,
+	}, nil
 }
 
-// VerifySMSCode проверяет SMS код и выполняет вход
-func (s *AuthService) VerifySMSCode(ctx context.Context, phone, code string) (*models.User, string, error) {
-	smsCode := s.smsRepo.Get(phone)
-	if smsCode == nil {
-		return nil, "", ErrInvalidCode
+// VerifySMSCode проверяет SMS код и выполняет вход.
+// После MaxAttempts неверных попыток номер блокируется на LockoutDur.
+func (s *AuthService) VerifySMSCode(ctx context.Context, phone, code string, info SessionInfo) (*models.User, *TokenPair, error) {
+	now := time.Now()
+	cfg := s.config.SMS
+
+	if err := s.checkSMSLock(ctx, phone, now); err != nil {
+		return nil, nil, err
 	}
 
-	if smsCode.IsUsed || smsCode.IsExpired() {
-		s.smsRepo.Delete(phone)
-		return nil, "", ErrInvalidCode
+	smsCode, err := s.smsRepo.GetActive(ctx, phone, cfg.MaxAttempts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if smsCode == nil {
+		return nil, nil, ErrInvalidCode
 	}
 
-	if smsCode.Code != code {
-		return nil, "", ErrInvalidCode
+	if !hmac.Equal([]byte(smsCode.Code), []byte(s.hashSMSCode(phone, code))) {
+		attempts, err := s.smsRepo.RegisterFailedAttempt(ctx, smsCode.ID, cfg.MaxAttempts, now.Add(cfg.LockoutDur))
+		if err != nil {
+			return nil, nil, err
+		}
+		if attempts >= cfg.MaxAttempts {
+			return nil, nil, &RateLimitError{Reason: ErrSMSLocked, RetryAfter: cfg.LockoutDur}
+		}
+		return nil, nil, ErrInvalidCode
 	}
 
-	// Помечаем код как использованный
-	smsCode.IsUsed = true
-	s.smsRepo.Delete(phone)
+	// Условное обновление: параллельная проверка того же кода не пройдёт
+	used, err := s.smsRepo.MarkUsed(ctx, smsCode.ID, cfg.MaxAttempts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !used {
+		return nil, nil, ErrInvalidCode
+	}
 
 	// Ищем или создаём пользователя
 	user, err := s.userRepo.GetByPhone(ctx, phone)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	if user == nil {
 		// Создаём нового пользователя с phone как username
 		user = &models.User{
-			Phone:    phone,
-			Username: phone,
+			Phone:     phone,
+			PhoneHash: phoneHash(phone),
+			Username:  phone,
 		}
 		if err := s.userRepo.Create(ctx, user); err != nil {
-			return nil, "", fmt.Errorf("failed to create user: %w", err)
+			return nil, nil, fmt.Errorf("failed to create user: %w", err)
+		}
+	}
+
+	// Создаём сессию и выдаём токены
+	tokens, err := s.createSession(ctx, user, info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, tokens, nil
+}
+
+// checkSMSLock возвращает ошибку, если номер заблокирован после неверных попыток
+func (s *AuthService) checkSMSLock(ctx context.Context, phone string, now time.Time) error {
+	lockedUntil, err := s.smsRepo.GetLockedUntil(ctx, phone)
+	if err != nil {
+		return err
+	}
+	if lockedUntil != nil && lockedUntil.After(now) {
+		return &RateLimitError{Reason: ErrSMSLocked, RetryAfter: lockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+// checkSendLimit проверяет число отправок за окно smsLimitWindow
+func checkSendLimit(stats *repository.SendStats, limit int, now time.Time) error {
+	if limit <= 0 || stats.Count < int64(limit) {
+		return nil
+	}
+
+	retryAfter := smsLimitWindow
+	if stats.Oldest != nil {
+		retryAfter = stats.Oldest.Add(smsLimitWindow).Sub(now)
+	}
+	return &RateLimitError{Reason: ErrSMSLimitExceeded, RetryAfter: retryAfter}
+}
+
+// generateSMSCode генерирует случайный цифровой код
+func generateSMSCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashSMSCode возвращает HMAC кода, привязанный к номеру.
+// Ключ нужен потому, что 6-значный код без него подбирается по хешу мгновенно.
+func (s *AuthService) hashSMSCode(phone, code string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.JWT.Secret))
+	mac.Write([]byte(phone + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// createSession создаёт сессию устройства и выдаёт для неё пару токенов
+func (s *AuthService) createSession(ctx context.Context, user *models.User, info SessionInfo) (*TokenPair, error) {
+	refreshToken, err := jwt.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.UserSession{
+		UserID:           user.ID,
+		RefreshTokenHash: jwt.HashRefreshToken(refreshToken),
+		DeviceInfo:       truncate(info.DeviceInfo, 255),
+		IPAddress:        truncate(info.IPAddress, 45),
+		ExpiresAt:        time.Now().Add(s.config.JWT.RefreshExpireDur),
+		LastUsedAt:       time.Now(),
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return s.issueTokens(user, session.ID, refreshToken)
+}
+
+// issueTokens генерирует access токен для сессии
+func (s *AuthService) issueTokens(user *models.User, sessionID uuid.UUID, refreshToken string) (*TokenPair, error) {
+	token, err := s.tokenMgr.Generate(user.ID, user.Username, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(s.tokenMgr.GetExpiration()),
+		SessionID:    sessionID,
+	}, nil
+}
+
+// RefreshSession обменивает refresh токен на новую пару токенов (с ротацией)
+func (s *AuthService) RefreshSession(ctx context.Context, refreshToken string, info SessionInfo) (*models.User, *TokenPair, error) {
+	oldHash := jwt.HashRefreshToken(refreshToken)
+
+	session, err := s.sessionRepo.GetByRefreshTokenHash(ctx, oldHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session == nil {
+		// Токен мог быть уже заменён ротацией: значит, им пользуются двое,
+		// и неизвестно, кто из них владелец. Отзываем сессию целиком.
+		revoked, err := s.sessionRepo.RevokeByUsedToken(ctx, oldHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		if revoked != nil {
+			return nil, nil, &TokenReuseError{UserID: revoked.UserID, SessionID: revoked.ID}
 		}
+		return nil, nil, ErrInvalidRefreshToken
 	}
+	if !session.IsActive() {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	newRefreshToken, err := jwt.GenerateRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Ротация: старый refresh токен становится недействительным
+	rotated, err := s.sessionRepo.Rotate(
+		ctx,
+		session.ID,
+		oldHash,
+		jwt.HashRefreshToken(newRefreshToken),
+		truncate(info.IPAddress, 45),
+		time.Now().Add(s.config.JWT.RefreshExpireDur),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to rotate session: %w", err)
+	}
+	if !rotated {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	tokens, err := s.issueTokens(user, session.ID, newRefreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, tokens, nil
+}
+
+// GetSessions возвращает активные сессии пользователя
+func (s *AuthService) GetSessions(ctx context.Context, userID uuid.UUID) ([]models.UserSession, error) {
+	return s.sessionRepo.GetUserSessions(ctx, userID)
+}
 
-	// Генерируем токен
-	token, err := s.tokenMgr.Generate(user.ID, user.Username)
+// RevokeSession отзывает одну сессию пользователя
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	revoked, err := s.sessionRepo.Revoke(ctx, userID, sessionID)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+		return err
+	}
+	if !revoked {
+		return ErrSessionNotFound
 	}
+	return nil
+}
 
-	return user, token, nil
+// RevokeOtherSessions отзывает все сессии пользователя, кроме текущей
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]uuid.UUID, error) {
+	return s.sessionRepo.RevokeAll(ctx, userID, currentSessionID)
 }
 
-// ValidateToken проверяет JWT токен
+// ValidateToken проверяет JWT токен и активность его сессии
 func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (*jwt.Claims, error) {
-	return s.tokenMgr.Verify(tokenString)
+	claims, err := s.tokenMgr.Verify(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.sessionRepo.GetByID(ctx, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.UserID != claims.UserID || !session.IsActive() {
+		return nil, ErrSessionRevoked
+	}
+
+	return claims, nil
 }
 
 // GetUserByID получает пользователя по ID
@@ -236,8 +526,8 @@ func (s *AuthService) UpdateProfile(ctx context.Context, userID uuid.UUID, first
 }
 
 // UpdateAvatar обновляет аватар пользователя
-func (s *AuthService) UpdateAvatar(ctx context.Context, userID uuid.UUID, avatarURL string) (*models.User, error) {
-	if err := s.userRepo.UpdateAvatar(ctx, userID, avatarURL); err != nil {
+func (s *AuthService) UpdateAvatar(ctx context.Context, userID uuid.UUID, avatarURL string, preview models.ImagePreview) (*models.User, error) {
+	if err := s.userRepo.UpdateAvatar(ctx, userID, avatarURL, preview); err != nil {
 		return nil, err
 	}
 
@@ -249,7 +539,210 @@ func (s *AuthService) SetOnline(ctx context.Context, userID uuid.UUID, isOnline
 	return s.userRepo.SetOnline(ctx, userID, isOnline)
 }
 
-// SearchUsers ищет пользователей
-func (s *AuthService) SearchUsers(ctx context.Context, query string, limit int) ([]models.User, error) {
-	return s.userRepo.Search(ctx, query, limit)
+// truncate обрезает строку до максимальной длины колонки
+func truncate(value string, max int) string {
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
+
+// GetPublicUser возвращает профиль пользователя с учётом его настроек приватности для viewerID
+func (s *AuthService) GetPublicUser(ctx context.Context, viewerID, userID uuid.UUID) (*models.PublicUser, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	access, err := loadProfileAccess(ctx, s.contactRepo, s.blockRepo, viewerID, []uuid.UUID{userID})
+	if err != nil {
+		return nil, err
+	}
+
+	public := toPublicUser(user, viewerID, access[userID])
+	return &public, nil
+}
+
+// SearchUsers ищет пользователей и скрывает поля согласно их настройкам приватности
+func (s *AuthService) SearchUsers(ctx context.Context, viewerID uuid.UUID, query string, limit int) ([]models.PublicUser, error) {
+	users, err := s.userRepo.Search(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(users))
+	for i := range users {
+		ids[i] = users[i].ID
+	}
+	access, err := loadProfileAccess(ctx, s.contactRepo, s.blockRepo, viewerID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.PublicUser, len(users))
+	for i := range users {
+		result[i] = toPublicUser(&users[i], viewerID, access[users[i].ID])
+	}
+	return result, nil
+}
+
+// profileAccess отношение владельца профиля к тому, кто профиль смотрит
+type profileAccess struct {
+	// isContact — владелец записал смотрящего в контакты
+	isContact bool
+	// blocked — владелец заблокировал смотрящего
+	blocked bool
+}
+
+// loadProfileAccess возвращает отношение каждого из userIDs к viewerID
+func loadProfileAccess(ctx context.Context, contactRepo repository.ContactRepository, blockRepo repository.BlockRepository, viewerID uuid.UUID, userIDs []uuid.UUID) (map[uuid.UUID]profileAccess, error) {
+	contacts, err := contactRepo.FilterOwners(ctx, userIDs, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	blockers, err := blockRepo.FilterBlockers(ctx, userIDs, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	access := make(map[uuid.UUID]profileAccess, len(userIDs))
+	for _, id := range userIDs {
+		access[id] = profileAccess{isContact: contacts[id], blocked: blockers[id]}
+	}
+	return access, nil
+}
+
+// toPublicUser собирает профиль для viewerID. Свой профиль пользователь видит полностью.
+// Заблокированным не видны фото и присутствие независимо от настроек приватности.
+func toPublicUser(user *models.User, viewerID uuid.UUID, access profileAccess) models.PublicUser {
+	self := user.ID == viewerID
+	public := models.PublicUser{
+		ID:        user.ID,
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Bio:       user.Bio,
+	}
+
+	isContact, visible := access.isContact, !access.blocked
+	if self || user.Privacy.Phone.Allows(isContact) {
+		public.Phone = user.Phone
+	}
+	if self || (visible && user.Privacy.Avatar.Allows(isContact)) {
+		preview := user.AvatarPreview
+		public.AvatarURL = user.AvatarURL
+		public.AvatarPreview = &preview
+	}
+	if self || (visible && user.Privacy.Online.Allows(isContact)) {
+		public.IsOnline = user.IsOnline
+	}
+	if self || (visible && user.Privacy.LastSeen.Allows(isContact)) {
+		lastSeen := user.LastSeen
+		public.LastSeen = &lastSeen
+	}
+
+	return public
+}
+
+// GetPrivacy возвращает настройки приватности пользователя
+func (s *AuthService) GetPrivacy(ctx context.Context, userID uuid.UUID) (*models.PrivacySettings, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &user.Privacy, nil
+}
+
+// PrivacyUpdate изменение настроек приватности. nil — оставить как есть.
+type PrivacyUpdate struct {
+	LastSeen *models.PrivacyLevel
+	Online   *models.PrivacyLevel
+	Phone    *models.PrivacyLevel
+	Avatar   *models.PrivacyLevel
+}
+
+// UpdatePrivacy изменяет настройки приватности пользователя
+func (s *AuthService) UpdatePrivacy(ctx context.Context, userID uuid.UUID, update PrivacyUpdate) (*models.PrivacySettings, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := user.Privacy
+	fields := []struct {
+		value  *models.PrivacyLevel
+		target *models.PrivacyLevel
+	}{
+		{update.LastSeen, &settings.LastSeen},
+		{update.Online, &settings.Online},
+		{update.Phone, &settings.Phone},
+		{update.Avatar, &settings.Avatar},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		if !field.value.IsValid() {
+			return nil, ErrInvalidPrivacyLevel
+		}
+		*field.target = *field.value
+	}
+
+	if err := s.userRepo.UpdatePrivacy(ctx, userID, settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// PresenceAudience получатели статуса присутствия пользователя
+type PresenceAudience struct {
+	// Online — кому отправлять статус онлайн
+	Online []uuid.UUID
+	// LastSeen — кому из Online можно видеть время последнего визита
+	LastSeen map[uuid.UUID]bool
+}
+
+// GetPresenceAudience возвращает, кому виден статус присутствия пользователя.
+// Статус получают собеседники по общим чатам и те, у кого пользователь записан
+// в контактах, с учётом его настроек приватности и чёрного списка.
+func (s *AuthService) GetPresenceAudience(ctx context.Context, userID uuid.UUID) (*PresenceAudience, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	audience := &PresenceAudience{LastSeen: make(map[uuid.UUID]bool)}
+	if user.Privacy.Online == models.PrivacyNobody {
+		return audience, nil
+	}
+
+	candidates, err := s.userRepo.GetPresenceCandidates(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		if !user.Privacy.Online.Allows(candidate.IsContact) {
+			continue
+		}
+		audience.Online = append(audience.Online, candidate.UserID)
+		if user.Privacy.LastSeen.Allows(candidate.IsContact) {
+			audience.LastSeen[candidate.UserID] = true
+		}
+	}
+	return audience, nil
+}
+
+// phoneHash возвращает хеш номера для поиска по адресной книге или nil,
+// если номер не в формате E.164
+func phoneHash(raw string) *string {
+	e164, ok := phone.Normalize(raw)
+	if !ok {
+		return nil
+	}
+	hash := phone.Hash(e164)
+	return &hash
 }
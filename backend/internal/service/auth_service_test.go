@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"dildogram/backend/internal/config"
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"dildogram/backend/pkg/jwt"
+	"github.com/google/uuid"
+)
+
+// fakeSessionRepo знает только уже использованные refresh токены
+type fakeSessionRepo struct {
+	repository.SessionRepository
+	used map[string]*models.UserSession
+}
+
+func (r *fakeSessionRepo) GetByRefreshTokenHash(ctx context.Context, hash string) (*models.UserSession, error) {
+	return nil, nil
+}
+
+func (r *fakeSessionRepo) RevokeByUsedToken(ctx context.Context, hash string) (*models.UserSession, error) {
+	session := r.used[hash]
+	delete(r.used, hash)
+	return session, nil
+}
+
+func TestRefreshSessionRevokesSessionOnTokenReuse(t *testing.T) {
+	session := &models.UserSession{ID: uuid.New(), UserID: uuid.New()}
+	sessions := &fakeSessionRepo{used: map[string]*models.UserSession{
+		jwt.HashRefreshToken("stolen"): session,
+	}}
+	s := NewAuthService(nil, sessions, nil, nil, nil, nil, &config.Config{})
+
+	_, _, err := s.RefreshSession(context.Background(), "stolen", SessionInfo{})
+	var reuseErr *TokenReuseError
+	if !errors.As(err, &reuseErr) {
+		t.Fatalf("RefreshSession() error = %v, want TokenReuseError", err)
+	}
+	if reuseErr.SessionID != session.ID || reuseErr.UserID != session.UserID {
+		t.Errorf("TokenReuseError = %+v, want session %s of %s", reuseErr, session.ID, session.UserID)
+	}
+	if !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshSession() error = %v, want it to wrap %v", err, ErrInvalidRefreshToken)
+	}
+
+	// Неизвестный токен просто недействителен
+	if _, _, err := s.RefreshSession(context.Background(), "unknown", SessionInfo{}); err != ErrInvalidRefreshToken {
+		t.Errorf("RefreshSession() unknown token error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+// fakeUserRepo хранит пользователей и кандидатов на получение их присутствия
+type fakeUserRepo struct {
+	repository.UserRepository
+	users      map[uuid.UUID]*models.User
+	candidates map[uuid.UUID][]repository.PresenceCandidate
+}
+
+func newFakeUserRepo() *fakeUserRepo {
+	return &fakeUserRepo{
+		users:      make(map[uuid.UUID]*models.User),
+		candidates: make(map[uuid.UUID][]repository.PresenceCandidate),
+	}
+}
+
+func (r *fakeUserRepo) addUser(privacy models.PrivacySettings) *models.User {
+	user := &models.User{ID: uuid.New(), Privacy: privacy}
+	r.users[user.ID] = user
+	return user
+}
+
+func (r *fakeUserRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return r.users[id], nil
+}
+
+func (r *fakeUserRepo) GetPresenceCandidates(ctx context.Context, userID uuid.UUID) ([]repository.PresenceCandidate, error) {
+	return r.candidates[userID], nil
+}
+
+func TestGetPresenceAudienceFollowsPrivacy(t *testing.T) {
+	contact, stranger := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name         string
+		online       models.PrivacyLevel
+		lastSeen     models.PrivacyLevel
+		wantOnline   []uuid.UUID
+		wantLastSeen []uuid.UUID
+	}{
+		{"everyone", models.PrivacyEveryone, models.PrivacyEveryone, []uuid.UUID{contact, stranger}, []uuid.UUID{contact, stranger}},
+		{"contacts", models.PrivacyContacts, models.PrivacyContacts, []uuid.UUID{contact}, []uuid.UUID{contact}},
+		{"nobody", models.PrivacyNobody, models.PrivacyEveryone, nil, nil},
+		{"online to everyone, last seen to contacts", models.PrivacyEveryone, models.PrivacyContacts, []uuid.UUID{contact, stranger}, []uuid.UUID{contact}},
+		{"online to everyone, last seen to nobody", models.PrivacyEveryone, models.PrivacyNobody, []uuid.UUID{contact, stranger}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			users := newFakeUserRepo()
+			user := users.addUser(models.PrivacySettings{Online: tc.online, LastSeen: tc.lastSeen})
+			users.candidates[user.ID] = []repository.PresenceCandidate{
+				{UserID: contact, IsContact: true},
+				{UserID: stranger},
+			}
+			s := NewAuthService(users, nil, nil, nil, nil, nil, &config.Config{})
+
+			audience, err := s.GetPresenceAudience(context.Background(), user.ID)
+			if err != nil {
+				t.Fatalf("GetPresenceAudience() error = %v", err)
+			}
+			if len(audience.Online) != len(tc.wantOnline) {
+				t.Fatalf("Online = %v, want %v", audience.Online, tc.wantOnline)
+			}
+			for i, id := range tc.wantOnline {
+				if audience.Online[i] != id {
+					t.Errorf("Online = %v, want %v", audience.Online, tc.wantOnline)
+				}
+			}
+			if len(audience.LastSeen) != len(tc.wantLastSeen) {
+				t.Fatalf("LastSeen = %v, want %v", audience.LastSeen, tc.wantLastSeen)
+			}
+			for _, id := range tc.wantLastSeen {
+				if !audience.LastSeen[id] {
+					t.Errorf("LastSeen = %v, want %v", audience.LastSeen, tc.wantLastSeen)
+				}
+			}
+		})
+	}
+}
+
+func (r *fakeUserRepo) Search(ctx context.Context, query string, limit int) ([]models.User, error) {
+	users := make([]models.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, *user)
+	}
+	return users, nil
+}
+
+// fakeContactRepo хранит пары «владелец — записанный в его контакты»
+type fakeContactRepo struct {
+	repository.ContactRepository
+	contacts map[userPair]bool
+}
+
+func (r *fakeContactRepo) FilterOwners(ctx context.Context, ownerIDs []uuid.UUID, contactUserID uuid.UUID) (map[uuid.UUID]bool, error) {
+	owners := make(map[uuid.UUID]bool)
+	for _, id := range ownerIDs {
+		if r.contacts[userPair{id, contactUserID}] {
+			owners[id] = true
+		}
+	}
+	return owners, nil
+}
+
+func TestPublicProfileHiddenFromBlockedUsers(t *testing.T) {
+	users := newFakeUserRepo()
+	contacts := &fakeContactRepo{contacts: make(map[userPair]bool)}
+	blocks := newFakeBlockRepo()
+	s := NewAuthService(users, nil, nil, contacts, blocks, nil, &config.Config{})
+	ctx := context.Background()
+
+	everyone := models.PrivacySettings{
+		LastSeen: models.PrivacyEveryone,
+		Online:   models.PrivacyEveryone,
+		Phone:    models.PrivacyEveryone,
+		Avatar:   models.PrivacyEveryone,
+	}
+	alice, carol := users.addUser(everyone), users.addUser(everyone)
+	for _, user := range []*models.User{alice, carol} {
+		user.Phone = "+10000000000"
+		user.AvatarURL = "/avatars/" + user.ID.String()
+		user.IsOnline = true
+	}
+	viewer := uuid.New()
+
+	// alice записала смотрящего в контакты, но заблокировала его
+	contacts.contacts[userPair{alice.ID, viewer}] = true
+	blocks.blocked[userPair{alice.ID, viewer}] = true
+
+	public, err := s.GetPublicUser(ctx, viewer, alice.ID)
+	if err != nil {
+		t.Fatalf("GetPublicUser() error = %v", err)
+	}
+	if public.AvatarURL != "" || public.AvatarPreview != nil || public.IsOnline || public.LastSeen != nil {
+		t.Errorf("blocked viewer sees %+v, want no avatar and presence", public)
+	}
+	if public.Phone != alice.Phone {
+		t.Errorf("Phone = %q, want %q: phone follows privacy settings only", public.Phone, alice.Phone)
+	}
+
+	// Свой профиль виден полностью
+	self, err := s.GetPublicUser(ctx, alice.ID, alice.ID)
+	if err != nil {
+		t.Fatalf("GetPublicUser(self) error = %v", err)
+	}
+	if self.AvatarURL == "" || !self.IsOnline || self.LastSeen == nil {
+		t.Errorf("own profile = %+v, want it in full", self)
+	}
+
+	// В поиске блокировка скрывает только профиль заблокировавшего
+	found, err := s.SearchUsers(ctx, viewer, "", 10)
+	if err != nil {
+		t.Fatalf("SearchUsers() error = %v", err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("SearchUsers() returned %d users, want 2", len(found))
+	}
+	for _, user := range found {
+		hidden := user.AvatarURL == "" && !user.IsOnline && user.LastSeen == nil
+		if hidden != (user.ID == alice.ID) {
+			t.Errorf("SearchUsers() profile %s hidden = %v, want %v", user.ID, hidden, user.ID == alice.ID)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUserBlocked     = errors.New("user is blocked")
+	ErrCannotBlockSelf = errors.New("cannot block yourself")
+	ErrNotBlocked      = errors.New("user is not blocked")
+)
+
+// BlockService предоставляет методы для работы с чёрным списком
+type BlockService struct {
+	blockRepo   repository.BlockRepository
+	contactRepo repository.ContactRepository
+	userRepo    repository.UserRepository
+}
+
+// NewBlockService создаёт новый BlockService
+func NewBlockService(blockRepo repository.BlockRepository, contactRepo repository.ContactRepository, userRepo repository.UserRepository) *BlockService {
+	return &BlockService{
+		blockRepo:   blockRepo,
+		contactRepo: contactRepo,
+		userRepo:    userRepo,
+	}
+}
+
+// GetBlockedUsers возвращает чёрный список пользователя
+func (s *BlockService) GetBlockedUsers(ctx context.Context, userID uuid.UUID) ([]models.BlockInfo, error) {
+	blocks, err := s.blockRepo.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(blocks))
+	for _, block := range blocks {
+		ids = append(ids, block.BlockedUserID)
+	}
+	access, err := loadProfileAccess(ctx, s.contactRepo, s.blockRepo, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]models.BlockInfo, 0, len(blocks))
+	for _, block := range blocks {
+		if block.BlockedUser == nil {
+			continue
+		}
+		infos = append(infos, models.BlockInfo{
+			User:      toPublicUser(block.BlockedUser, userID, access[block.BlockedUserID]),
+			CreatedAt: block.CreatedAt,
+		})
+	}
+	return infos, nil
+}
+
+// BlockUser добавляет пользователя в чёрный список.
+// Возвращает false, если он уже был заблокирован.
+func (s *BlockService) BlockUser(ctx context.Context, userID, blockedUserID uuid.UUID) (bool, error) {
+	if userID == blockedUserID {
+		return false, ErrCannotBlockSelf
+	}
+
+	user, err := s.userRepo.GetByID(ctx, blockedUserID)
+	if err != nil {
+		return false, err
+	}
+	if user == nil {
+		return false, ErrUserNotFound
+	}
+
+	return s.blockRepo.Block(ctx, userID, blockedUserID)
+}
+
+// UnblockUser убирает пользователя из чёрного списка
+func (s *BlockService) UnblockUser(ctx context.Context, userID, blockedUserID uuid.UUID) error {
+	removed, err := s.blockRepo.Unblock(ctx, userID, blockedUserID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrNotBlocked
+	}
+	return nil
+}
@@ -3,7 +3,8 @@ package service
 import (
 	"context"
 	"errors"
-	"time"
+	"regexp"
+	"strings"
 
 	"dildogram/backend/internal/models"
 	"dildogram/backend/internal/repository"
@@ -11,30 +12,63 @@ import (
 )
 
 var (
-	ErrChatNotFound     = errors.New("chat not found")
-	ErrChatExists       = errors.New("chat already exists with these users")
-	ErrNotMember        = errors.New("user is not a member of this chat")
-	ErrNoPermission     = errors.New("no permission to perform this action")
-	ErrCannotAddSelf    = errors.New("cannot add yourself to chat")
+	ErrChatNotFound      = errors.New("chat not found")
+	ErrChatExists        = errors.New("chat already exists with these users")
+	ErrNotMember         = errors.New("user is not a member of this chat")
+	ErrNoPermission      = errors.New("no permission to perform this action")
+	ErrCannotAddSelf     = errors.New("cannot add yourself to chat")
 	ErrCannotRemoveOwner = errors.New("cannot remove chat owner")
+	ErrTooManyPins       = errors.New("too many pinned messages in this chat")
+	ErrNotGroupChat      = errors.New("action is only available in group chats")
+	ErrOwnerMustTransfer = errors.New("transfer ownership before leaving the chat")
+	ErrNotAdmin          = errors.New("user is not an admin of this chat")
+	ErrPrivateChat       = errors.New("action is not available in private chats")
+	ErrNotChannel        = errors.New("action is only available in channels")
+	ErrInvalidHandle     = errors.New("handle must be 5-32 latin letters, digits or underscores and start with a letter")
+	ErrHandleTaken       = errors.New("handle is already taken")
 )
 
+// Допустимый публичный адрес канала
+var handlePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{4,31}$`)
+
+// Уникальный индекс адресов неудалённых чатов
+const chatHandleIndex = "idx_chats_handle"
+
+// Сколько сообщений можно закрепить в одном чате
+const maxPinsPerChat = 50
+
 // ChatService предоставляет методы для управления чатами
 type ChatService struct {
-	chatRepo repository.ChatRepository
-	userRepo repository.UserRepository
+	chatRepo    repository.ChatRepository
+	userRepo    repository.UserRepository
+	messageRepo repository.MessageRepository
+	pinRepo     repository.PinRepository
+	blockRepo   repository.BlockRepository
+	profiles    publicProfiles
 }
 
 // NewChatService создаёт новый ChatService
-func NewChatService(chatRepo repository.ChatRepository, userRepo repository.UserRepository) *ChatService {
+func NewChatService(chatRepo repository.ChatRepository, userRepo repository.UserRepository, messageRepo repository.MessageRepository, pinRepo repository.PinRepository, contactRepo repository.ContactRepository, blockRepo repository.BlockRepository) *ChatService {
 	return &ChatService{
-		chatRepo: chatRepo,
-		userRepo: userRepo,
+		chatRepo:    chatRepo,
+		userRepo:    userRepo,
+		messageRepo: messageRepo,
+		pinRepo:     pinRepo,
+		blockRepo:   blockRepo,
+		profiles:    publicProfiles{contactRepo: contactRepo, blockRepo: blockRepo},
 	}
 }
 
 // CreatePrivateChat создаёт личный чат между двумя пользователями
 func (s *ChatService) CreatePrivateChat(ctx context.Context, userID, otherUserID uuid.UUID) (*models.Chat, error) {
+	blocked, err := s.blockRepo.IsBlockedEither(ctx, userID, otherUserID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrUserBlocked
+	}
+
 	// Проверяем существование чата
 	existingChat, err := s.chatRepo.FindPrivateChat(ctx, userID, otherUserID)
 	if err != nil {
@@ -70,7 +104,7 @@ func (s *ChatService) CreatePrivateChat(ctx context.Context, userID, otherUserID
 		UserID: userID,
 		Role:   models.MemberRoleOwner,
 	}
-	if err := s.chatRepo.AddMember(ctx, ownerMembership); err != nil {
+	if _, err := s.chatRepo.AddMember(ctx, ownerMembership); err != nil {
 		return nil, err
 	}
 
@@ -80,7 +114,7 @@ func (s *ChatService) CreatePrivateChat(ctx context.Context, userID, otherUserID
 		UserID: otherUserID,
 		Role:   models.MemberRoleMember,
 	}
-	if err := s.chatRepo.AddMember(ctx, memberMembership); err != nil {
+	if _, err := s.chatRepo.AddMember(ctx, memberMembership); err != nil {
 		return nil, err
 	}
 
@@ -89,12 +123,22 @@ func (s *ChatService) CreatePrivateChat(ctx context.Context, userID, otherUserID
 
 // CreateGroupChat создаёт групповой чат
 func (s *ChatService) CreateGroupChat(ctx context.Context, userID uuid.UUID, name, description string, memberIDs []uuid.UUID) (*models.Chat, error) {
+	// Нельзя добавить в группу того, кто заблокировал создателя
+	blockers, err := s.blockRepo.FilterBlockers(ctx, memberIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(blockers) > 0 {
+		return nil, ErrUserBlocked
+	}
+
 	// Создаём чат
 	chat := &models.Chat{
-		Type:        models.ChatTypeGroup,
-		Name:        name,
-		Description: description,
-		CreatedBy:   userID,
+		Type:               models.ChatTypeGroup,
+		Name:               name,
+		Description:        description,
+		CreatedBy:          userID,
+		DefaultPermissions: models.DefaultMemberPermissions(),
 	}
 
 	if err := s.chatRepo.Create(ctx, chat); err != nil {
@@ -107,7 +151,7 @@ func (s *ChatService) CreateGroupChat(ctx context.Context, userID uuid.UUID, nam
 		UserID: userID,
 		Role:   models.MemberRoleOwner,
 	}
-	if err := s.chatRepo.AddMember(ctx, ownerMembership); err != nil {
+	if _, err := s.chatRepo.AddMember(ctx, ownerMembership); err != nil {
 		return nil, err
 	}
 
@@ -122,7 +166,7 @@ func (s *ChatService) CreateGroupChat(ctx context.Context, userID uuid.UUID, nam
 			UserID: memberID,
 			Role:   models.MemberRoleMember,
 		}
-		if err := s.chatRepo.AddMember(ctx, membership); err != nil {
+		if _, err := s.chatRepo.AddMember(ctx, membership); err != nil {
 			return nil, err
 		}
 	}
@@ -130,35 +174,210 @@ func (s *ChatService) CreateGroupChat(ctx context.Context, userID uuid.UUID, nam
 	return chat, nil
 }
 
-// GetChat получает чат по ID
-func (s *ChatService) GetChat(ctx context.Context, chatID, userID uuid.UUID) (*models.Chat, error) {
-	chat, err := s.chatRepo.GetByID(ctx, chatID)
+// CreateChannel создаёт канал. handle != nil — канал публичный.
+func (s *ChatService) CreateChannel(ctx context.Context, userID uuid.UUID, name, description string, handle *string) (*models.Chat, error) {
+	handle, err := s.checkHandle(ctx, uuid.Nil, handle)
 	if err != nil {
 		return nil, err
 	}
-	if chat == nil {
-		return nil, ErrChatNotFound
+
+	// Подписчики только читают, поэтому права участников пустые
+	chat := &models.Chat{
+		Type:        models.ChatTypeChannel,
+		Name:        name,
+		Description: description,
+		Handle:      handle,
+		CreatedBy:   userID,
 	}
 
-	// Проверяем доступ
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	// Адрес мог занять параллельный запрос после checkHandle
+	if err := s.chatRepo.Create(ctx, chat); err != nil {
+		if repository.IsUniqueViolation(err, chatHandleIndex) {
+			return nil, ErrHandleTaken
+		}
+		return nil, err
+	}
+
+	ownerMembership := &models.ChatMembership{
+		ChatID: chat.ID,
+		UserID: userID,
+		Role:   models.MemberRoleOwner,
+	}
+	if _, err := s.chatRepo.AddMember(ctx, ownerMembership); err != nil {
+		return nil, err
+	}
+
+	return s.getChatFor(ctx, chat.ID, userID)
+}
+
+// UpdateHandle меняет публичный адрес канала. handle == nil — канал становится частным.
+func (s *ChatService) UpdateHandle(ctx context.Context, chatID, userID uuid.UUID, handle *string) (*models.Chat, error) {
+	chat, _, err := authorize(ctx, s.chatRepo, chatID, userID, models.PermissionChangeInfo)
 	if err != nil {
 		return nil, err
 	}
-	if !isMember {
-		return nil, ErrNotMember
+	if chat.Type != models.ChatTypeChannel {
+		return nil, ErrNotChannel
 	}
 
+	if chat.Handle, err = s.checkHandle(ctx, chatID, handle); err != nil {
+		return nil, err
+	}
+	if err := s.chatRepo.Update(ctx, chat); err != nil {
+		if repository.IsUniqueViolation(err, chatHandleIndex) {
+			return nil, ErrHandleTaken
+		}
+		return nil, err
+	}
 	return chat, nil
 }
 
-// GetUserChats получает список чатов пользователя
-func (s *ChatService) GetUserChats(ctx context.Context, userID uuid.UUID) ([]models.ChatWithLastMessage, error) {
-	return s.chatRepo.GetUserChats(ctx, userID)
+// checkHandle проверяет формат адреса и что он не занят другим чатом, кроме chatID.
+// Пустой адрес равнозначен его отсутствию.
+func (s *ChatService) checkHandle(ctx context.Context, chatID uuid.UUID, handle *string) (*string, error) {
+	if handle == nil {
+		return nil, nil
+	}
+	value := strings.TrimPrefix(strings.TrimSpace(*handle), "@")
+	if value == "" {
+		return nil, nil
+	}
+	if !handlePattern.MatchString(value) {
+		return nil, ErrInvalidHandle
+	}
+
+	existing, err := s.chatRepo.GetByHandle(ctx, value)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != chatID {
+		return nil, ErrHandleTaken
+	}
+	return &value, nil
 }
 
-// UpdateChat обновляет чат
-func (s *ChatService) UpdateChat(ctx context.Context, chatID, userID uuid.UUID, name, description, avatarURL string) (*models.Chat, error) {
+// GetChannel возвращает сведения о публичном канале по адресу
+func (s *ChatService) GetChannel(ctx context.Context, handle string, userID uuid.UUID) (*models.ChannelInfo, error) {
+	chat, err := s.getPublicChannel(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	memberCount, err := s.chatRepo.CountMembers(ctx, chat.ID)
+	if err != nil {
+		return nil, err
+	}
+	isMember, err := s.chatRepo.IsMember(ctx, chat.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := toChannelInfo(chat, memberCount)
+	info.IsMember = isMember
+	return &info, nil
+}
+
+// JoinChannel подписывает пользователя на публичный канал
+func (s *ChatService) JoinChannel(ctx context.Context, handle string, userID uuid.UUID) (*models.Chat, error) {
+	chat, err := s.getPublicChannel(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	isMember, err := s.chatRepo.IsMember(ctx, chat.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if isMember {
+		return nil, ErrAlreadyMember
+	}
+
+	membership := &models.ChatMembership{
+		ChatID: chat.ID,
+		UserID: userID,
+		Role:   models.MemberRoleMember,
+	}
+	added, err := s.chatRepo.AddMember(ctx, membership)
+	if err != nil {
+		return nil, err
+	}
+	if !added {
+		return nil, ErrAlreadyMember
+	}
+
+	memberCount, err := s.chatRepo.CountMembers(ctx, chat.ID)
+	if err != nil {
+		return nil, err
+	}
+	chat.MemberCount = &memberCount
+	return chat, nil
+}
+
+// SearchChannels ищет публичные каналы по адресу и названию
+func (s *ChatService) SearchChannels(ctx context.Context, query string, limit int) ([]models.ChannelInfo, error) {
+	query = strings.TrimPrefix(strings.TrimSpace(query), "@")
+	if query == "" {
+		return []models.ChannelInfo{}, nil
+	}
+
+	chats, err := s.chatRepo.SearchChannels(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(chats))
+	for _, chat := range chats {
+		ids = append(ids, chat.ID)
+	}
+	counts, err := s.chatRepo.CountMembersMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]models.ChannelInfo, 0, len(chats))
+	for i := range chats {
+		channels = append(channels, toChannelInfo(&chats[i], counts[chats[i].ID]))
+	}
+	return channels, nil
+}
+
+// getPublicChannel возвращает канал с публичным адресом
+func (s *ChatService) getPublicChannel(ctx context.Context, handle string) (*models.Chat, error) {
+	chat, err := s.chatRepo.GetByHandle(ctx, strings.TrimPrefix(handle, "@"))
+	if err != nil {
+		return nil, err
+	}
+	if chat == nil || chat.Type != models.ChatTypeChannel {
+		return nil, ErrChatNotFound
+	}
+	return chat, nil
+}
+
+// toChannelInfo собирает сведения о канале для тех, кто на него не подписан
+func toChannelInfo(chat *models.Chat, memberCount int64) models.ChannelInfo {
+	info := models.ChannelInfo{
+		ID:          chat.ID,
+		Name:        chat.Name,
+		Description: chat.Description,
+		AvatarURL:   chat.AvatarURL,
+		MemberCount: memberCount,
+	}
+	if chat.Handle != nil {
+		info.Handle = *chat.Handle
+	}
+	if chat.AvatarURL != "" {
+		info.AvatarPreview = &chat.AvatarPreview
+	}
+	return info
+}
+
+// GetChat получает чат по ID. Для каналов вместо списка подписчиков отдаётся их число.
+func (s *ChatService) GetChat(ctx context.Context, chatID, userID uuid.UUID) (*models.Chat, error) {
+	if _, _, err := authorize(ctx, s.chatRepo, chatID, userID, ""); err != nil {
+		return nil, err
+	}
+
+	// Перечитываем вместе с участниками
 	chat, err := s.chatRepo.GetByID(ctx, chatID)
 	if err != nil {
 		return nil, err
@@ -167,13 +386,42 @@ func (s *ChatService) UpdateChat(ctx context.Context, chatID, userID uuid.UUID,
 		return nil, ErrChatNotFound
 	}
 
-	// Проверяем права (только админ и владелец)
-	membership, err := s.chatRepo.GetMember(ctx, chatID, userID)
-	if err != nil {
+	if chat.Type == models.ChatTypeChannel {
+		memberCount, err := s.chatRepo.CountMembers(ctx, chatID)
+		if err != nil {
+			return nil, err
+		}
+		chat.MemberCount = &memberCount
+	}
+
+	if err := s.profiles.chat(ctx, userID, chat); err != nil {
 		return nil, err
 	}
-	if membership == nil || (membership.Role != models.MemberRoleOwner && membership.Role != models.MemberRoleAdmin) {
-		return nil, ErrNoPermission
+	return chat, nil
+}
+
+// getChatFor перечитывает чат с участниками и их профилями, какими их видит userID
+func (s *ChatService) getChatFor(ctx context.Context, chatID, userID uuid.UUID) (*models.Chat, error) {
+	chat, err := s.chatRepo.GetByID(ctx, chatID)
+	if err != nil || chat == nil {
+		return chat, err
+	}
+	if err := s.profiles.chat(ctx, userID, chat); err != nil {
+		return nil, err
+	}
+	return chat, nil
+}
+
+// GetUserChats получает список чатов пользователя
+func (s *ChatService) GetUserChats(ctx context.Context, userID uuid.UUID) ([]models.ChatWithLastMessage, error) {
+	return s.chatRepo.GetUserChats(ctx, userID)
+}
+
+// UpdateChat обновляет чат. protectedContent == nil — настройка пересылки не меняется.
+func (s *ChatService) UpdateChat(ctx context.Context, chatID, userID uuid.UUID, name, description, avatarURL string, protectedContent *bool) (*models.Chat, error) {
+	chat, _, err := authorize(ctx, s.chatRepo, chatID, userID, models.PermissionChangeInfo)
+	if err != nil {
+		return nil, err
 	}
 
 	// Обновляем поля
@@ -183,33 +431,101 @@ func (s *ChatService) UpdateChat(ctx context.Context, chatID, userID uuid.UUID,
 	if description != "" {
 		chat.Description = description
 	}
-	if avatarURL != "" {
+	if avatarURL != "" && avatarURL != chat.AvatarURL {
+		// Превью относятся к прежнему аватару
 		chat.AvatarURL = avatarURL
+		chat.AvatarPreview = models.ImagePreview{}
+	}
+	if protectedContent != nil {
+		chat.ProtectedContent = *protectedContent
 	}
 
 	if err := s.chatRepo.Update(ctx, chat); err != nil {
 		return nil, err
 	}
 
-	return chat, nil
+	// Перечитываем вместе с участниками для ответа
+	return s.getChatFor(ctx, chatID, userID)
 }
 
-// DeleteChat удаляет чат
-func (s *ChatService) DeleteChat(ctx context.Context, chatID, userID uuid.UUID) error {
-	chat, err := s.chatRepo.GetByID(ctx, chatID)
+// CheckCanChangeInfo проверяет право менять сведения о чате.
+// Нужна до загрузки аватара, чтобы не сохранять файлы без права их установить.
+func (s *ChatService) CheckCanChangeInfo(ctx context.Context, chatID, userID uuid.UUID) error {
+	_, _, err := authorize(ctx, s.chatRepo, chatID, userID, models.PermissionChangeInfo)
+	return err
+}
+
+// UpdateAvatar устанавливает загруженный аватар чата вместе с превью
+func (s *ChatService) UpdateAvatar(ctx context.Context, chatID, userID uuid.UUID, avatarURL string, preview models.ImagePreview) (*models.Chat, error) {
+	chat, _, err := authorize(ctx, s.chatRepo, chatID, userID, models.PermissionChangeInfo)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if chat == nil {
-		return ErrChatNotFound
+
+	chat.AvatarURL = avatarURL
+	chat.AvatarPreview = preview
+
+	if err := s.chatRepo.Update(ctx, chat); err != nil {
+		return nil, err
 	}
 
+	// Перечитываем вместе с участниками для ответа
+	return s.getChatFor(ctx, chatID, userID)
+}
+
+// authorize проверяет, что пользователь — активный участник чата с правом permission.
+// Пустое permission — достаточно быть участником. Все проверки прав в чатах идут через неё.
+func authorize(ctx context.Context, chatRepo repository.ChatRepository, chatID, userID uuid.UUID, permission models.ChatPermission) (*models.Chat, *models.ChatMembership, error) {
+	membership, err := chatRepo.GetMemberWithChat(ctx, chatID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if membership == nil || membership.Chat == nil {
+		chat, err := chatRepo.GetByID(ctx, chatID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if chat == nil {
+			return nil, nil, ErrChatNotFound
+		}
+		return nil, nil, ErrNotMember
+	}
+	if !membership.IsActive() {
+		return nil, nil, ErrNotMember
+	}
+
+	chat := membership.Chat
+	if permission != "" && !membership.Permissions(chat).Has(permission) {
+		return nil, nil, ErrNoPermission
+	}
+
+	return chat, membership, nil
+}
+
+// canManageMember проверяет, может ли участник actor удалить или разжаловать target.
+// Владелец управляет всеми, админ — только обычными участниками.
+func canManageMember(chat *models.Chat, actor, target *models.ChatMembership) bool {
+	if chat.Type == models.ChatTypePrivate || target.Role == models.MemberRoleOwner {
+		return false
+	}
+	switch actor.Role {
+	case models.MemberRoleOwner:
+		return true
+	case models.MemberRoleAdmin:
+		return target.Role == models.MemberRoleMember
+	default:
+		return false
+	}
+}
+
+// DeleteChat удаляет чат
+func (s *ChatService) DeleteChat(ctx context.Context, chatID, userID uuid.UUID) error {
 	// Только владелец может удалить чат
-	membership, err := s.chatRepo.GetMember(ctx, chatID, userID)
+	_, membership, err := authorize(ctx, s.chatRepo, chatID, userID, "")
 	if err != nil {
 		return err
 	}
-	if membership == nil || membership.Role != models.MemberRoleOwner {
+	if membership.Role != models.MemberRoleOwner {
 		return ErrNoPermission
 	}
 
@@ -222,30 +538,26 @@ func (s *ChatService) AddMember(ctx context.Context, chatID, userID, newMemberID
 		return ErrCannotAddSelf
 	}
 
-	chat, err := s.chatRepo.GetByID(ctx, chatID)
-	if err != nil {
+	if _, _, err := authorize(ctx, s.chatRepo, chatID, userID, models.PermissionAddMembers); err != nil {
 		return err
 	}
-	if chat == nil {
-		return ErrChatNotFound
-	}
 
-	// Только владелец и админ могут добавлять
-	membership, err := s.chatRepo.GetMember(ctx, chatID, userID)
+	// Проверяем, не состоит ли уже
+	existing, err := s.chatRepo.GetMember(ctx, chatID, newMemberID)
 	if err != nil {
 		return err
 	}
-	if membership == nil || (membership.Role != models.MemberRoleOwner && membership.Role != models.MemberRoleAdmin) {
-		return ErrNoPermission
+	if existing != nil && existing.LeftAt == nil {
+		return ErrChatExists
 	}
 
-	// Проверяем, не состоит ли уже
-	existing, err := s.chatRepo.GetMember(ctx, chatID, newMemberID)
+	// Заблокировавшего добавлять нельзя
+	blockers, err := s.blockRepo.FilterBlockers(ctx, []uuid.UUID{newMemberID}, userID)
 	if err != nil {
 		return err
 	}
-	if existing != nil && existing.LeftAt == nil {
-		return ErrChatExists
+	if blockers[newMemberID] {
+		return ErrUserBlocked
 	}
 
 	// Добавляем участника
@@ -254,96 +566,330 @@ func (s *ChatService) AddMember(ctx context.Context, chatID, userID, newMemberID
 		UserID: newMemberID,
 		Role:   models.MemberRoleMember,
 	}
-	return s.chatRepo.AddMember(ctx, newMembership)
-}
-
-// RemoveMember удаляет участника из чата
-func (s *ChatService) RemoveMember(ctx context.Context, chatID, userID, removeMemberID uuid.UUID) error {
-	chat, err := s.chatRepo.GetByID(ctx, chatID)
+	added, err := s.chatRepo.AddMember(ctx, newMembership)
 	if err != nil {
 		return err
 	}
-	if chat == nil {
-		return ErrChatNotFound
+	if !added {
+		// Участника добавили параллельно
+		return ErrChatExists
 	}
+	return nil
+}
 
-	// Проверяем права
-	membership, err := s.chatRepo.GetMember(ctx, chatID, userID)
-	if err != nil {
-		return err
+// RemoveMember удаляет участника из чата. Возвращает чат, чтобы разослать изменение.
+func (s *ChatService) RemoveMember(ctx context.Context, chatID, userID, removeMemberID uuid.UUID) (*models.Chat, error) {
+	// Выход из чата
+	if userID == removeMemberID {
+		return s.LeaveChat(ctx, chatID, userID)
 	}
-	if membership == nil {
-		return ErrNotMember
+
+	chat, membership, err := authorize(ctx, s.chatRepo, chatID, userID, "")
+	if err != nil {
+		return nil, err
 	}
 
 	// Проверяем удаляемого
 	removeMembership, err := s.chatRepo.GetMember(ctx, chatID, removeMemberID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if removeMembership == nil {
-		return ErrNotMember
+	if removeMembership == nil || !removeMembership.IsActive() {
+		return nil, ErrNotMember
 	}
 
 	// Нельзя удалить владельца
 	if removeMembership.Role == models.MemberRoleOwner {
-		return ErrCannotRemoveOwner
+		return nil, ErrCannotRemoveOwner
 	}
 
-	// Владелец и админ могут удалять участников
-	if membership.Role == models.MemberRoleOwner || membership.Role == models.MemberRoleAdmin {
-		return s.chatRepo.RemoveMember(ctx, chatID, removeMemberID)
+	if !canManageMember(chat, membership, removeMembership) {
+		return nil, ErrNoPermission
 	}
 
-	// Пользователь может удалить сам себя
-	if userID == removeMemberID {
-		return s.chatRepo.RemoveMember(ctx, chatID, userID)
+	if err := s.chatRepo.RemoveMember(ctx, chatID, removeMemberID); err != nil {
+		return nil, err
 	}
-
-	return ErrNoPermission
+	return chat, nil
 }
 
-// GetMembers получает список участников чата
+// GetMembers получает список участников чата.
+// Подписчики каналов список не видят, только владелец и админы.
 func (s *ChatService) GetMembers(ctx context.Context, chatID, userID uuid.UUID) ([]models.ChatMembership, error) {
 	// Проверяем доступ
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	chat, membership, err := authorize(ctx, s.chatRepo, chatID, userID, "")
 	if err != nil {
 		return nil, err
 	}
-	if !isMember {
-		return nil, ErrNotMember
+	if chat.Type == models.ChatTypeChannel && membership.Role == models.MemberRoleMember {
+		return nil, ErrNoPermission
 	}
 
-	return s.chatRepo.GetMembers(ctx, chatID)
+	members, err := s.chatRepo.GetMembers(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.profiles.members(ctx, userID, members); err != nil {
+		return nil, err
+	}
+	return members, nil
 }
 
 // LeaveChat покидает чат
-func (s *ChatService) LeaveChat(ctx context.Context, chatID, userID uuid.UUID) error {
-	membership, err := s.chatRepo.GetMember(ctx, chatID, userID)
+func (s *ChatService) LeaveChat(ctx context.Context, chatID, userID uuid.UUID) (*models.Chat, error) {
+	chat, membership, err := authorize(ctx, s.chatRepo, chatID, userID, "")
 	if err != nil {
-		return err
-	}
-	if membership == nil {
-		return ErrNotMember
+		return nil, err
 	}
 
 	// Владелец не может покинуть чат, должен передать права
 	if membership.Role == models.MemberRoleOwner {
-		return ErrCannotRemoveOwner
+		return nil, ErrOwnerMustTransfer
+	}
+
+	if err := s.chatRepo.RemoveMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+	return chat, nil
+}
+
+// UpdateDefaultPermissions меняет права обычных участников группы
+func (s *ChatService) UpdateDefaultPermissions(ctx context.Context, chatID, userID uuid.UUID, permissions models.ChatPermissions) (*models.Chat, error) {
+	chat, _, err := authorize(ctx, s.chatRepo, chatID, userID, models.PermissionChangeInfo)
+	if err != nil {
+		return nil, err
+	}
+	if chat.Type != models.ChatTypeGroup {
+		return nil, ErrNotGroupChat
+	}
+
+	if err := s.chatRepo.UpdateDefaultPermissions(ctx, chatID, permissions); err != nil {
+		return nil, err
+	}
+
+	chat.DefaultPermissions = permissions
+	return chat, nil
+}
+
+// PromoteAdmin назначает участника админом или меняет права админа.
+// Назначать админов может только владелец. permissions == nil — все права.
+func (s *ChatService) PromoteAdmin(ctx context.Context, chatID, userID, targetID uuid.UUID, permissions *models.ChatPermissions) (*models.ChatMembership, error) {
+	target, err := s.getOwnerTarget(ctx, chatID, userID, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	target.Role = models.MemberRoleAdmin
+	target.AdminPermissions = models.AllChatPermissions()
+	if permissions != nil {
+		target.AdminPermissions = *permissions
+	}
+
+	if err := s.chatRepo.UpdateMemberRole(ctx, chatID, targetID, target.Role, target.AdminPermissions); err != nil {
+		return nil, err
+	}
+	if err := s.profiles.member(ctx, userID, target); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// DemoteAdmin снимает с участника права админа.
+// Разжаловать может владелец, админ — только самого себя.
+func (s *ChatService) DemoteAdmin(ctx context.Context, chatID, userID, targetID uuid.UUID) (*models.ChatMembership, error) {
+	var target *models.ChatMembership
+	if userID == targetID {
+		chat, membership, err := authorize(ctx, s.chatRepo, chatID, userID, "")
+		if err != nil {
+			return nil, err
+		}
+		if chat.Type == models.ChatTypePrivate {
+			return nil, ErrPrivateChat
+		}
+		if membership.Role == models.MemberRoleOwner {
+			return nil, ErrOwnerMustTransfer
+		}
+		target = membership
+	} else {
+		var err error
+		target, err = s.getOwnerTarget(ctx, chatID, userID, targetID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return s.chatRepo.RemoveMember(ctx, chatID, userID)
+	if target.Role != models.MemberRoleAdmin {
+		return nil, ErrNotAdmin
+	}
+
+	target.Role = models.MemberRoleMember
+	target.AdminPermissions = models.ChatPermissions{}
+	if err := s.chatRepo.UpdateMemberRole(ctx, chatID, targetID, target.Role, target.AdminPermissions); err != nil {
+		return nil, err
+	}
+	if err := s.profiles.member(ctx, userID, target); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// TransferOwnership передаёт владение группой или каналом другому участнику.
+// Прежний владелец остаётся админом со всеми правами.
+// Возвращает обновлённые членства прежнего и нового владельца.
+func (s *ChatService) TransferOwnership(ctx context.Context, chatID, userID, newOwnerID uuid.UUID) ([]models.ChatMembership, error) {
+	if _, err := s.getOwnerTarget(ctx, chatID, userID, newOwnerID); err != nil {
+		return nil, err
+	}
+	if err := s.chatRepo.TransferOwnership(ctx, chatID, userID, newOwnerID); err != nil {
+		return nil, err
+	}
+
+	members := make([]models.ChatMembership, 0, 2)
+	for _, memberID := range []uuid.UUID{userID, newOwnerID} {
+		member, err := s.chatRepo.GetMember(ctx, chatID, memberID)
+		if err != nil {
+			return nil, err
+		}
+		if member != nil {
+			members = append(members, *member)
+		}
+	}
+	return members, nil
+}
+
+// getOwnerTarget проверяет, что userID — владелец группы или канала, а targetID — другой его активный участник
+func (s *ChatService) getOwnerTarget(ctx context.Context, chatID, userID, targetID uuid.UUID) (*models.ChatMembership, error) {
+	chat, membership, err := authorize(ctx, s.chatRepo, chatID, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	if chat.Type == models.ChatTypePrivate {
+		return nil, ErrPrivateChat
+	}
+	if membership.Role != models.MemberRoleOwner {
+		return nil, ErrNoPermission
+	}
+	if userID == targetID {
+		return nil, ErrCannotRemoveOwner
+	}
+
+	target, err := s.chatRepo.GetMember(ctx, chatID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil || !target.IsActive() {
+		return nil, ErrNotMember
+	}
+	return target, nil
+}
+
+// PinMessage закрепляет сообщение в чате.
+// Второе значение — false, если сообщение уже было закреплено.
+func (s *ChatService) PinMessage(ctx context.Context, chatID, messageID, userID uuid.UUID) (*models.PinnedMessage, bool, error) {
+	if err := s.checkCanPin(ctx, chatID, userID); err != nil {
+		return nil, false, err
+	}
+
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, false, err
+	}
+	if message == nil || message.ChatID != chatID {
+		return nil, false, ErrMessageNotFound
+	}
+	if message.IsDeleted {
+		return nil, false, ErrMessageDeleted
+	}
+
+	existing, err := s.pinRepo.Get(ctx, chatID, messageID)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		if err := s.profiles.messages(ctx, userID, message); err != nil {
+			return nil, false, err
+		}
+		existing.Message = message
+		return existing, false, nil
+	}
+
+	count, err := s.pinRepo.Count(ctx, chatID)
+	if err != nil {
+		return nil, false, err
+	}
+	if count >= maxPinsPerChat {
+		return nil, false, ErrTooManyPins
+	}
+
+	pin := &models.PinnedMessage{
+		ChatID:    chatID,
+		MessageID: messageID,
+		PinnedBy:  &userID,
+	}
+	added, err := s.pinRepo.Add(ctx, pin)
+	if err != nil {
+		return nil, false, err
+	}
+	if !added {
+		// Сообщение успели закрепить параллельным запросом
+		if pin, err = s.pinRepo.Get(ctx, chatID, messageID); err != nil {
+			return nil, false, err
+		}
+		if pin == nil {
+			return nil, false, ErrMessageNotFound
+		}
+	}
+
+	if err := s.profiles.messages(ctx, userID, message); err != nil {
+		return nil, false, err
+	}
+	pin.Message = message
+	return pin, added, nil
+}
+
+// UnpinMessage открепляет сообщение. Возвращает false, если оно не было закреплено.
+func (s *ChatService) UnpinMessage(ctx context.Context, chatID, messageID, userID uuid.UUID) (bool, error) {
+	if err := s.checkCanPin(ctx, chatID, userID); err != nil {
+		return false, err
+	}
+
+	return s.pinRepo.Remove(ctx, chatID, messageID)
+}
+
+// GetPins возвращает закреплённые сообщения чата, начиная с последнего закреплённого
+func (s *ChatService) GetPins(ctx context.Context, chatID, userID uuid.UUID) ([]models.PinnedMessage, error) {
+	if _, _, err := authorize(ctx, s.chatRepo, chatID, userID, ""); err != nil {
+		return nil, err
+	}
+
+	pins, err := s.pinRepo.GetChatPins(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*models.Message, 0, len(pins))
+	for i := range pins {
+		if pins[i].Message != nil {
+			messages = append(messages, pins[i].Message)
+		}
+	}
+	if err := s.profiles.messages(ctx, userID, messages...); err != nil {
+		return nil, err
+	}
+	return pins, nil
+}
+
+// checkCanPin проверяет право закреплять сообщения
+func (s *ChatService) checkCanPin(ctx context.Context, chatID, userID uuid.UUID) error {
+	_, _, err := authorize(ctx, s.chatRepo, chatID, userID, models.PermissionPinMessages)
+	return err
 }
 
 // MarkChatRead отмечает все сообщения в чате как прочитанные
 func (s *ChatService) MarkChatRead(ctx context.Context, chatID, userID uuid.UUID) error {
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
-	if err != nil {
+	if _, _, err := authorize(ctx, s.chatRepo, chatID, userID, ""); err != nil {
 		return err
 	}
-	if !isMember {
-		return ErrNotMember
-	}
 
 	// Обновляем время last_seen пользователя
 	return s.userRepo.SetOnline(ctx, userID, true)
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeChatRepo хранит чаты и участников в памяти.
+// Методы, которые тестам не нужны, не реализованы и паникуют.
+type fakeChatRepo struct {
+	repository.ChatRepository
+	chats   map[uuid.UUID]*models.Chat
+	members map[chatMember]*models.ChatMembership
+	// updateErr возвращается из Update, например чтобы изобразить гонку за адрес
+	updateErr error
+}
+
+// chatMember ключ участника в fakeChatRepo
+type chatMember struct {
+	chatID uuid.UUID
+	userID uuid.UUID
+}
+
+func newFakeChatRepo() *fakeChatRepo {
+	return &fakeChatRepo{
+		chats:   make(map[uuid.UUID]*models.Chat),
+		members: make(map[chatMember]*models.ChatMembership),
+	}
+}
+
+// addChat добавляет чат типа chatType, первый из userIDs становится владельцем
+func (r *fakeChatRepo) addChat(chatType models.ChatType, userIDs ...uuid.UUID) *models.Chat {
+	chat := &models.Chat{ID: uuid.New(), Type: chatType, DefaultPermissions: models.AllChatPermissions()}
+	r.chats[chat.ID] = chat
+	for i, userID := range userIDs {
+		role := models.MemberRoleMember
+		if i == 0 && chatType != models.ChatTypePrivate {
+			role = models.MemberRoleOwner
+		}
+		r.addMember(chat, userID, role)
+	}
+	return chat
+}
+
+// addMember добавляет участника userID в роли role
+func (r *fakeChatRepo) addMember(chat *models.Chat, userID uuid.UUID, role models.MemberRole) *models.ChatMembership {
+	member := &models.ChatMembership{ChatID: chat.ID, UserID: userID, Role: role, Chat: chat}
+	r.members[chatMember{chat.ID, userID}] = member
+	return member
+}
+
+// addChannel добавляет канал с участником userID в роли role
+func (r *fakeChatRepo) addChannel(handle string, userID uuid.UUID, role models.MemberRole) *models.Chat {
+	chat := &models.Chat{ID: uuid.New(), Type: models.ChatTypeChannel}
+	if handle != "" {
+		chat.Handle = &handle
+	}
+	r.chats[chat.ID] = chat
+	r.addMember(chat, userID, role)
+	return chat
+}
+
+func (r *fakeChatRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Chat, error) {
+	return r.chats[id], nil
+}
+
+func (r *fakeChatRepo) GetByHandle(ctx context.Context, handle string) (*models.Chat, error) {
+	for _, chat := range r.chats {
+		if chat.Handle != nil && chat.DeletedAt == nil && strings.EqualFold(*chat.Handle, handle) {
+			return chat, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeChatRepo) GetMemberWithChat(ctx context.Context, chatID, userID uuid.UUID) (*models.ChatMembership, error) {
+	return r.members[chatMember{chatID, userID}], nil
+}
+
+func (r *fakeChatRepo) GetMember(ctx context.Context, chatID, userID uuid.UUID) (*models.ChatMembership, error) {
+	return r.members[chatMember{chatID, userID}], nil
+}
+
+func (r *fakeChatRepo) IsMember(ctx context.Context, chatID, userID uuid.UUID) (bool, error) {
+	member, err := r.GetMemberWithChat(ctx, chatID, userID)
+	return member != nil && member.IsActive(), err
+}
+
+func (r *fakeChatRepo) Update(ctx context.Context, chat *models.Chat) error {
+	if r.updateErr != nil {
+		return r.updateErr
+	}
+	r.chats[chat.ID] = chat
+	return nil
+}
+
+func TestUpdateHandleValidation(t *testing.T) {
+	tests := []struct {
+		handle  string
+		want    string
+		wantErr error
+	}{
+		{"news_channel", "news_channel", nil},
+		{"@News2024", "News2024", nil},
+		{"  @spaced_out  ", "spaced_out", nil},
+		{"abcd", "", ErrInvalidHandle},
+		{"1channel", "", ErrInvalidHandle},
+		{"_channel", "", ErrInvalidHandle},
+		{"bad-handle", "", ErrInvalidHandle},
+		{"новости_канала", "", ErrInvalidHandle},
+		{"a" + strings.Repeat("b", 32), "", ErrInvalidHandle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.handle, func(t *testing.T) {
+			repo := newFakeChatRepo()
+			owner := uuid.New()
+			chat := repo.addChannel("", owner, models.MemberRoleOwner)
+			s := &ChatService{chatRepo: repo}
+
+			handle := tt.handle
+			updated, err := s.UpdateHandle(context.Background(), chat.ID, owner, &handle)
+			if err != tt.wantErr {
+				t.Fatalf("UpdateHandle(%q) error = %v, want %v", tt.handle, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if updated.Handle == nil || *updated.Handle != tt.want {
+				t.Errorf("UpdateHandle(%q) handle = %v, want %q", tt.handle, updated.Handle, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateHandleClears(t *testing.T) {
+	for _, handle := range []*string{nil, new(string)} {
+		repo := newFakeChatRepo()
+		owner := uuid.New()
+		chat := repo.addChannel("old_handle", owner, models.MemberRoleOwner)
+		s := &ChatService{chatRepo: repo}
+
+		updated, err := s.UpdateHandle(context.Background(), chat.ID, owner, handle)
+		if err != nil {
+			t.Fatalf("UpdateHandle() error = %v", err)
+		}
+		if updated.Handle != nil {
+			t.Errorf("UpdateHandle() handle = %q, want nil", *updated.Handle)
+		}
+	}
+}
+
+func TestUpdateHandleUniqueness(t *testing.T) {
+	repo := newFakeChatRepo()
+	owner := uuid.New()
+	chat := repo.addChannel("my_channel", owner, models.MemberRoleOwner)
+	repo.addChannel("taken_name", uuid.New(), models.MemberRoleOwner)
+	s := &ChatService{chatRepo: repo}
+
+	// Адрес другого канала занят без учёта регистра
+	handle := "Taken_Name"
+	if _, err := s.UpdateHandle(context.Background(), chat.ID, owner, &handle); err != ErrHandleTaken {
+		t.Errorf("UpdateHandle(taken) error = %v, want %v", err, ErrHandleTaken)
+	}
+
+	// Свой адрес можно сохранить повторно, в том числе сменив регистр
+	handle = "My_Channel"
+	if _, err := s.UpdateHandle(context.Background(), chat.ID, owner, &handle); err != nil {
+		t.Errorf("UpdateHandle(own) error = %v", err)
+	}
+}
+
+func TestUpdateHandleDeletedChannelFreesHandle(t *testing.T) {
+	repo := newFakeChatRepo()
+	owner := uuid.New()
+	chat := repo.addChannel("", owner, models.MemberRoleOwner)
+	deleted := repo.addChannel("old_name", uuid.New(), models.MemberRoleOwner)
+	deleted.DeletedAt = &deleted.CreatedAt
+	s := &ChatService{chatRepo: repo}
+
+	handle := "old_name"
+	if _, err := s.UpdateHandle(context.Background(), chat.ID, owner, &handle); err != nil {
+		t.Errorf("UpdateHandle() error = %v, want handle of deleted channel to be free", err)
+	}
+}
+
+func TestUpdateHandleUniqueViolation(t *testing.T) {
+	repo := newFakeChatRepo()
+	owner := uuid.New()
+	chat := repo.addChannel("", owner, models.MemberRoleOwner)
+	s := &ChatService{chatRepo: repo}
+
+	// Адрес заняли между проверкой и сохранением
+	repo.updateErr = &pgconn.PgError{Code: "23505", ConstraintName: chatHandleIndex}
+
+	handle := "raced_name"
+	if _, err := s.UpdateHandle(context.Background(), chat.ID, owner, &handle); err != ErrHandleTaken {
+		t.Errorf("UpdateHandle() error = %v, want %v", err, ErrHandleTaken)
+	}
+}
+
+func TestUpdateHandlePermissions(t *testing.T) {
+	repo := newFakeChatRepo()
+	subscriber := uuid.New()
+	chat := repo.addChannel("", subscriber, models.MemberRoleMember)
+	s := &ChatService{chatRepo: repo}
+
+	handle := "subscriber_pick"
+	if _, err := s.UpdateHandle(context.Background(), chat.ID, subscriber, &handle); err != ErrNoPermission {
+		t.Errorf("UpdateHandle() by subscriber error = %v, want %v", err, ErrNoPermission)
+	}
+}
+
+func TestUpdateHandleNotChannel(t *testing.T) {
+	repo := newFakeChatRepo()
+	owner := uuid.New()
+	chat := repo.addChannel("", owner, models.MemberRoleOwner)
+	chat.Type = models.ChatTypeGroup
+	s := &ChatService{chatRepo: repo}
+
+	handle := "group_handle"
+	if _, err := s.UpdateHandle(context.Background(), chat.ID, owner, &handle); err != ErrNotChannel {
+		t.Errorf("UpdateHandle() in group error = %v, want %v", err, ErrNotChannel)
+	}
+}
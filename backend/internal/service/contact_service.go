@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"dildogram/backend/pkg/phone"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrContactNotFound      = errors.New("contact not found")
+	ErrCannotAddSelfContact = errors.New("cannot add yourself to contacts")
+	ErrNothingToImport      = errors.New("no contacts to import")
+	ErrTooManyContacts      = errors.New("too many contacts in one import")
+	ErrContactImportLimit   = errors.New("contact import limit exceeded, try again later")
+	ErrContactLimitReached  = errors.New("too many contacts saved")
+)
+
+const (
+	// Сколько номеров можно импортировать за один запрос
+	maxContactImport = 1000
+	// Сколько номеров пользователь может сверить с базой за contactImportWindow.
+	// Без квоты повторные импорты позволяли бы перебирать номера пользователей.
+	maxContactImportPerWindow = 5000
+	contactImportWindow       = 24 * time.Hour
+	// Сколько номеров может быть сохранено у пользователя: контакты и ожидающие регистрации
+	maxStoredContacts = 10000
+)
+
+// Максимальная длина имени контакта (размер колонки)
+const maxContactNameLength = 50
+
+// ContactImport запись адресной книги клиента.
+// Номер передаётся либо как есть, либо SHA-256 от номера в E.164 (PhoneHash).
+type ContactImport struct {
+	ClientID  string
+	Phone     string
+	PhoneHash string
+	FirstName string
+	LastName  string
+}
+
+// ImportedContactResult зарегистрированный пользователь, найденный по записи адресной книги
+type ImportedContactResult struct {
+	ClientID string             `json:"client_id,omitempty"`
+	Contact  models.ContactInfo `json:"contact"`
+}
+
+// ImportResult результат импорта адресной книги
+type ImportResult struct {
+	Imported []ImportedContactResult `json:"imported"`
+	// Unregistered — записи, владельцы которых пока не зарегистрированы.
+	// Когда они зарегистрируются, импортировавший получит уведомление.
+	Unregistered []string `json:"unregistered"`
+	// Invalid — записи с номером не в формате E.164 или некорректным хешем
+	Invalid []string `json:"invalid"`
+}
+
+// ContactService предоставляет методы для работы с контактами
+type ContactService struct {
+	contactRepo repository.ContactRepository
+	blockRepo   repository.BlockRepository
+	userRepo    repository.UserRepository
+}
+
+// NewContactService создаёт новый ContactService
+func NewContactService(contactRepo repository.ContactRepository, blockRepo repository.BlockRepository, userRepo repository.UserRepository) *ContactService {
+	return &ContactService{
+		contactRepo: contactRepo,
+		blockRepo:   blockRepo,
+		userRepo:    userRepo,
+	}
+}
+
+// GetContacts возвращает контакты пользователя
+func (s *ContactService) GetContacts(ctx context.Context, userID uuid.UUID) ([]models.ContactInfo, error) {
+	contacts, err := s.contactRepo.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.toContactInfos(ctx, userID, contacts)
+}
+
+// AddContact добавляет пользователя в контакты или переименовывает существующий контакт
+func (s *ContactService) AddContact(ctx context.Context, userID, contactUserID uuid.UUID, firstName, lastName string) (*models.ContactInfo, error) {
+	if userID == contactUserID {
+		return nil, ErrCannotAddSelfContact
+	}
+
+	user, err := s.userRepo.GetByID(ctx, contactUserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, ErrUserNotFound
+	}
+
+	// Без имени контакт записывается под именем из профиля
+	firstName, lastName = strings.TrimSpace(firstName), strings.TrimSpace(lastName)
+	if firstName == "" && lastName == "" {
+		firstName, lastName = user.FirstName, user.LastName
+	}
+
+	contact := models.Contact{
+		UserID:        userID,
+		ContactUserID: contactUserID,
+		FirstName:     truncate(firstName, maxContactNameLength),
+		LastName:      truncate(lastName, maxContactNameLength),
+	}
+	if err := s.contactRepo.Upsert(ctx, []models.Contact{contact}); err != nil {
+		return nil, err
+	}
+
+	saved, err := s.contactRepo.Get(ctx, userID, contactUserID)
+	if err != nil {
+		return nil, err
+	}
+	if saved == nil {
+		return nil, ErrContactNotFound
+	}
+
+	infos, err := s.toContactInfos(ctx, userID, []models.Contact{*saved})
+	if err != nil {
+		return nil, err
+	}
+	return &infos[0], nil
+}
+
+// RemoveContact удаляет пользователя из контактов
+func (s *ContactService) RemoveContact(ctx context.Context, userID, contactUserID uuid.UUID) error {
+	removed, err := s.contactRepo.Delete(ctx, userID, contactUserID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrContactNotFound
+	}
+	return nil
+}
+
+// ImportContacts сопоставляет адресную книгу с зарегистрированными пользователями.
+// Найденные пользователи добавляются в контакты, остальные номера запоминаются
+// по хешу, чтобы добавить их в контакты и уведомить импортировавшего при регистрации.
+// Число сверяемых номеров ограничено суточной квотой, а сохранённых — maxStoredContacts.
+func (s *ContactService) ImportContacts(ctx context.Context, userID uuid.UUID, entries []ContactImport) (*ImportResult, error) {
+	if len(entries) == 0 {
+		return nil, ErrNothingToImport
+	}
+	if len(entries) > maxContactImport {
+		return nil, ErrTooManyContacts
+	}
+
+	result := &ImportResult{
+		Imported:     []ImportedContactResult{},
+		Unregistered: []string{},
+		Invalid:      []string{},
+	}
+
+	// Хеш номера -> записи адресной книги с этим номером
+	byHash := make(map[string][]ContactImport)
+	var hashes []string
+	for _, entry := range entries {
+		hash, ok := importHash(entry)
+		if !ok {
+			result.Invalid = append(result.Invalid, entry.ClientID)
+			continue
+		}
+		if _, seen := byHash[hash]; !seen {
+			hashes = append(hashes, hash)
+		}
+		byHash[hash] = append(byHash[hash], entry)
+	}
+
+	if err := s.recordImport(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	users, err := s.userRepo.GetByPhoneHashes(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	registered := make(map[string]bool, len(users))
+	hashByUser := make(map[uuid.UUID]string, len(users))
+	var contacts []models.Contact
+	var contactIDs []uuid.UUID
+	for _, user := range users {
+		if user.ID == userID || user.PhoneHash == nil {
+			continue
+		}
+		registered[*user.PhoneHash] = true
+		hashByUser[user.ID] = *user.PhoneHash
+		contactIDs = append(contactIDs, user.ID)
+
+		// При повторах номера в адресной книге берём имя из первой записи
+		entry := byHash[*user.PhoneHash][0]
+		contacts = append(contacts, models.Contact{
+			UserID:        userID,
+			ContactUserID: user.ID,
+			FirstName:     truncate(strings.TrimSpace(entry.FirstName), maxContactNameLength),
+			LastName:      truncate(strings.TrimSpace(entry.LastName), maxContactNameLength),
+		})
+	}
+
+	var pending []models.ImportedContact
+	for _, hash := range hashes {
+		if registered[hash] {
+			continue
+		}
+		entry := byHash[hash][0]
+		pending = append(pending, models.ImportedContact{
+			UserID:    userID,
+			PhoneHash: hash,
+			FirstName: truncate(strings.TrimSpace(entry.FirstName), maxContactNameLength),
+			LastName:  truncate(strings.TrimSpace(entry.LastName), maxContactNameLength),
+		})
+		for _, e := range byHash[hash] {
+			result.Unregistered = append(result.Unregistered, e.ClientID)
+		}
+	}
+
+	if err := s.contactRepo.Upsert(ctx, contacts); err != nil {
+		return nil, err
+	}
+	if err := s.contactRepo.SaveImported(ctx, pending); err != nil {
+		return nil, err
+	}
+
+	saved, err := s.contactRepo.GetMany(ctx, userID, contactIDs)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := s.toContactInfos(ctx, userID, saved)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range infos {
+		for _, entry := range byHash[hashByUser[info.User.ID]] {
+			result.Imported = append(result.Imported, ImportedContactResult{
+				ClientID: entry.ClientID,
+				Contact:  info,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// recordImport учитывает импорт в суточной квоте и проверяет, что новые номера
+// не превысят лимит сохранённых у пользователя
+func (s *ContactService) recordImport(ctx context.Context, userID uuid.UUID, hashes []string) error {
+	now := time.Now()
+	return s.contactRepo.RecordImportIfAllowed(ctx, userID, hashes, now.Add(-contactImportWindow), func(history *repository.ImportHistory) error {
+		if history.Numbers+int64(len(hashes)) > maxContactImportPerWindow {
+			retryAfter := contactImportWindow
+			if history.Oldest != nil {
+				retryAfter = history.Oldest.Add(contactImportWindow).Sub(now)
+			}
+			return &RateLimitError{Reason: ErrContactImportLimit, RetryAfter: retryAfter}
+		}
+		if history.Stored+history.New > maxStoredContacts {
+			return ErrContactLimitReached
+		}
+		return nil
+	})
+}
+
+// ClaimImportedContacts добавляет зарегистрировавшегося пользователя в контакты тех,
+// кто импортировал его номер раньше. Возвращает созданные контакты.
+func (s *ContactService) ClaimImportedContacts(ctx context.Context, user *models.User) ([]models.Contact, error) {
+	if user.PhoneHash == nil {
+		return nil, nil
+	}
+	return s.contactRepo.ClaimImported(ctx, *user.PhoneHash, user.ID)
+}
+
+// toContactInfos собирает контакты с профилями, видимыми владельцу userID
+func (s *ContactService) toContactInfos(ctx context.Context, userID uuid.UUID, contacts []models.Contact) ([]models.ContactInfo, error) {
+	ids := make([]uuid.UUID, 0, len(contacts))
+	for _, contact := range contacts {
+		ids = append(ids, contact.ContactUserID)
+	}
+
+	// Контакт взаимный, если владелец тоже записан у пользователя в контактах
+	access, err := loadProfileAccess(ctx, s.contactRepo, s.blockRepo, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]models.ContactInfo, 0, len(contacts))
+	for _, contact := range contacts {
+		if contact.ContactUser == nil {
+			continue
+		}
+		infos = append(infos, models.ContactInfo{
+			User:      toPublicUser(contact.ContactUser, userID, access[contact.ContactUserID]),
+			FirstName: contact.FirstName,
+			LastName:  contact.LastName,
+			Mutual:    access[contact.ContactUserID].isContact,
+			CreatedAt: contact.CreatedAt,
+		})
+	}
+	return infos, nil
+}
+
+// importHash возвращает хеш номера записи адресной книги
+func importHash(entry ContactImport) (string, bool) {
+	if entry.Phone != "" {
+		e164, ok := phone.Normalize(entry.Phone)
+		if !ok {
+			return "", false
+		}
+		return phone.Hash(e164), true
+	}
+
+	hash := strings.ToLower(strings.TrimSpace(entry.PhoneHash))
+	return hash, phone.IsHash(hash)
+}
@@ -0,0 +1,383 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Размер кода ссылки в байтах до кодирования
+const inviteCodeSize = 16
+
+// Максимальная длина названия ссылки
+const maxInviteNameLength = 64
+
+var (
+	ErrInviteNotFound        = errors.New("invite link not found")
+	ErrInviteExpired         = errors.New("invite link is revoked, expired or has reached its usage limit")
+	ErrInvalidInviteSettings = errors.New("invalid invite link settings")
+	ErrAlreadyMember         = errors.New("user is already a member of this chat")
+	ErrJoinRequestNotFound   = errors.New("join request not found")
+)
+
+// InviteParams параметры новой ссылки-приглашения
+type InviteParams struct {
+	Name             string
+	ExpiresAt        *time.Time
+	UsageLimit       *int
+	RequiresApproval bool
+}
+
+// JoinResult результат перехода по ссылке: либо вступление в чат,
+// либо заявка, о которой нужно сообщить Approvers.
+// Approvers пуст, если та же заявка уже была подана раньше.
+type JoinResult struct {
+	Chat      *models.Chat
+	Request   *models.ChatJoinRequest
+	Approvers []uuid.UUID
+}
+
+// InviteService предоставляет методы для работы со ссылками-приглашениями в группы
+type InviteService struct {
+	inviteRepo  repository.InviteRepository
+	chatRepo    repository.ChatRepository
+	contactRepo repository.ContactRepository
+	blockRepo   repository.BlockRepository
+	profiles    publicProfiles
+}
+
+// NewInviteService создаёт новый InviteService
+func NewInviteService(inviteRepo repository.InviteRepository, chatRepo repository.ChatRepository, contactRepo repository.ContactRepository, blockRepo repository.BlockRepository) *InviteService {
+	return &InviteService{
+		inviteRepo:  inviteRepo,
+		chatRepo:    chatRepo,
+		contactRepo: contactRepo,
+		blockRepo:   blockRepo,
+		profiles:    publicProfiles{contactRepo: contactRepo, blockRepo: blockRepo},
+	}
+}
+
+// CreateInvite создаёт ссылку-приглашение в группу.
+// Лимит использований не сочетается с одобрением: по такой ссылке вступают только через заявку.
+func (s *InviteService) CreateInvite(ctx context.Context, chatID, userID uuid.UUID, params InviteParams) (*models.ChatInvite, error) {
+	if _, err := s.authorizeGroup(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	params.Name = strings.TrimSpace(params.Name)
+	if len([]rune(params.Name)) > maxInviteNameLength {
+		return nil, ErrInvalidInviteSettings
+	}
+	if params.ExpiresAt != nil && !params.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidInviteSettings
+	}
+	if params.UsageLimit != nil && (*params.UsageLimit <= 0 || params.RequiresApproval) {
+		return nil, ErrInvalidInviteSettings
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		return nil, err
+	}
+
+	invite := &models.ChatInvite{
+		ChatID:           chatID,
+		Code:             code,
+		CreatorID:        userID,
+		Name:             params.Name,
+		ExpiresAt:        params.ExpiresAt,
+		UsageLimit:       params.UsageLimit,
+		RequiresApproval: params.RequiresApproval,
+	}
+	if err := s.inviteRepo.Create(ctx, invite); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// GetInvites возвращает ссылки-приглашения группы
+func (s *InviteService) GetInvites(ctx context.Context, chatID, userID uuid.UUID) ([]models.ChatInvite, error) {
+	if _, err := s.authorizeGroup(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+	invites, err := s.inviteRepo.List(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	ptrs := make([]*models.ChatInvite, len(invites))
+	for i := range invites {
+		ptrs[i] = &invites[i]
+	}
+	if err := s.profiles.invites(ctx, userID, ptrs...); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// RevokeInvite отзывает ссылку-приглашение
+func (s *InviteService) RevokeInvite(ctx context.Context, chatID, userID, inviteID uuid.UUID) error {
+	if _, err := s.authorizeGroup(ctx, chatID, userID); err != nil {
+		return err
+	}
+
+	revoked, err := s.inviteRepo.Revoke(ctx, chatID, inviteID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// GetPreview возвращает сведения о группе по ссылке, не вступая в неё
+func (s *InviteService) GetPreview(ctx context.Context, code string, userID uuid.UUID) (*models.InvitePreview, error) {
+	invite, chat, err := s.getUsableInvite(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	memberCount, err := s.chatRepo.CountMembers(ctx, chat.ID)
+	if err != nil {
+		return nil, err
+	}
+	isMember, err := s.chatRepo.IsMember(ctx, chat.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	request, err := s.inviteRepo.GetJoinRequest(ctx, chat.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &models.InvitePreview{
+		ChatID:           chat.ID,
+		Name:             chat.Name,
+		Description:      chat.Description,
+		AvatarURL:        chat.AvatarURL,
+		MemberCount:      memberCount,
+		RequiresApproval: invite.RequiresApproval,
+		IsMember:         isMember,
+		RequestPending:   request != nil,
+	}
+	if chat.AvatarURL != "" {
+		preview.AvatarPreview = &chat.AvatarPreview
+	}
+	return preview, nil
+}
+
+// JoinByInvite вступает в группу по ссылке или, если ссылка требует одобрения, подаёт заявку
+func (s *InviteService) JoinByInvite(ctx context.Context, code string, userID uuid.UUID) (*JoinResult, error) {
+	invite, chat, err := s.getUsableInvite(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	isMember, err := s.chatRepo.IsMember(ctx, chat.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if isMember {
+		return nil, ErrAlreadyMember
+	}
+
+	if invite.RequiresApproval {
+		request := &models.ChatJoinRequest{
+			ChatID:   chat.ID,
+			UserID:   userID,
+			InviteID: &invite.ID,
+		}
+		created, err := s.inviteRepo.CreateJoinRequest(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			// Об этой заявке уже сообщили, повтор не должен спамить одобряющих
+			return &JoinResult{Request: request}, nil
+		}
+		approvers, err := s.joinRequestApprovers(ctx, chat)
+		if err != nil {
+			return nil, err
+		}
+		return &JoinResult{Request: request, Approvers: approvers}, nil
+	}
+
+	// Использование засчитывается вместе с вступлением, чтобы не превысить лимит при гонке
+	// и не потратить его на неудавшееся вступление
+	used, added, err := s.inviteRepo.UseToJoin(ctx, invite.ID, newMember(chat.ID, userID))
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInviteExpired
+	}
+	if !added {
+		return nil, ErrAlreadyMember
+	}
+
+	chat, err = s.chatRepo.GetByID(ctx, chat.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.profiles.chat(ctx, userID, chat); err != nil {
+		return nil, err
+	}
+	return &JoinResult{Chat: chat}, nil
+}
+
+// GetJoinRequests возвращает заявки на вступление в группу.
+// Заявители ещё не участники, поэтому их профили отдаются с учётом приватности.
+func (s *InviteService) GetJoinRequests(ctx context.Context, chatID, userID uuid.UUID) ([]models.JoinRequestInfo, error) {
+	if _, err := s.authorizeGroup(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	requests, err := s.inviteRepo.ListJoinRequests(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(requests))
+	for _, request := range requests {
+		ids = append(ids, request.UserID)
+	}
+	access, err := loadProfileAccess(ctx, s.contactRepo, s.blockRepo, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]models.JoinRequestInfo, 0, len(requests))
+	for _, request := range requests {
+		if request.User == nil {
+			continue
+		}
+		infos = append(infos, models.JoinRequestInfo{
+			User:      toPublicUser(request.User, userID, access[request.UserID]),
+			InviteID:  request.InviteID,
+			CreatedAt: request.CreatedAt,
+		})
+	}
+	return infos, nil
+}
+
+// ApproveJoinRequest одобряет заявку и добавляет пользователя в группу.
+// Возвращает nil без ошибки, если пользователь уже состоит в группе.
+func (s *InviteService) ApproveJoinRequest(ctx context.Context, chatID, userID, requesterID uuid.UUID) (*models.Chat, error) {
+	if _, err := s.authorizeGroup(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	// Заявка удаляется вместе с добавлением, чтобы сбой не оставил заявителя
+	// без заявки и без членства
+	found, added, err := s.inviteRepo.ApproveJoinRequest(ctx, newMember(chatID, requesterID))
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrJoinRequestNotFound
+	}
+	if !added {
+		// Заявитель уже вступил, например по другой ссылке: рассылать нечего
+		return nil, nil
+	}
+	return s.chatRepo.GetByID(ctx, chatID)
+}
+
+// DeclineJoinRequest отклоняет заявку на вступление
+func (s *InviteService) DeclineJoinRequest(ctx context.Context, chatID, userID, requesterID uuid.UUID) error {
+	if _, err := s.authorizeGroup(ctx, chatID, userID); err != nil {
+		return err
+	}
+
+	deleted, err := s.inviteRepo.DeleteJoinRequest(ctx, chatID, requesterID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrJoinRequestNotFound
+	}
+	return nil
+}
+
+// authorizeGroup проверяет, что чат — группа или канал, а пользователь может добавлять в него участников
+func (s *InviteService) authorizeGroup(ctx context.Context, chatID, userID uuid.UUID) (*models.Chat, error) {
+	chat, _, err := authorize(ctx, s.chatRepo, chatID, userID, models.PermissionAddMembers)
+	if err != nil {
+		return nil, err
+	}
+	if chat.Type == models.ChatTypePrivate {
+		return nil, ErrPrivateChat
+	}
+	return chat, nil
+}
+
+// getUsableInvite возвращает действующую ссылку и её чат
+func (s *InviteService) getUsableInvite(ctx context.Context, code string) (*models.ChatInvite, *models.Chat, error) {
+	invite, err := s.inviteRepo.GetByCode(ctx, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if invite == nil {
+		return nil, nil, ErrInviteNotFound
+	}
+	if !invite.IsUsable(time.Now()) {
+		return nil, nil, ErrInviteExpired
+	}
+
+	chat, err := s.chatRepo.GetByID(ctx, invite.ChatID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if chat == nil || chat.DeletedAt != nil {
+		return nil, nil, ErrInviteNotFound
+	}
+	return invite, chat, nil
+}
+
+// newMember возвращает запись обычного участника группы
+func newMember(chatID, userID uuid.UUID) *models.ChatMembership {
+	return &models.ChatMembership{
+		ChatID: chatID,
+		UserID: userID,
+		Role:   models.MemberRoleMember,
+	}
+}
+
+// joinRequestApprovers возвращает участников, которые могут одобрять заявки.
+// Подписчики каналов одобрять не могут, поэтому для каналов загружаются только админы.
+func (s *InviteService) joinRequestApprovers(ctx context.Context, chat *models.Chat) ([]uuid.UUID, error) {
+	members := chat.Members
+	if chat.Type == models.ChatTypeChannel {
+		var err error
+		if members, err = s.chatRepo.GetAdmins(ctx, chat.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	var approvers []uuid.UUID
+	for i := range members {
+		member := &members[i]
+		if member.IsActive() && member.Permissions(chat).Has(models.PermissionAddMembers) {
+			approvers = append(approvers, member.UserID)
+		}
+	}
+	return approvers, nil
+}
+
+// generateInviteCode создаёт случайный код ссылки
+func generateInviteCode() (string, error) {
+	bytes := make([]byte, inviteCodeSize)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate invite code: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
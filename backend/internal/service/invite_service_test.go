@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// fakeInviteRepo хранит ссылки и заявки на вступление в памяти
+type fakeInviteRepo struct {
+	repository.InviteRepository
+	invites  map[string]*models.ChatInvite
+	requests map[uuid.UUID]*models.ChatJoinRequest
+}
+
+func newFakeInviteRepo() *fakeInviteRepo {
+	return &fakeInviteRepo{
+		invites:  make(map[string]*models.ChatInvite),
+		requests: make(map[uuid.UUID]*models.ChatJoinRequest),
+	}
+}
+
+func (r *fakeInviteRepo) GetByCode(ctx context.Context, code string) (*models.ChatInvite, error) {
+	return r.invites[code], nil
+}
+
+func (r *fakeInviteRepo) CreateJoinRequest(ctx context.Context, request *models.ChatJoinRequest) (bool, error) {
+	if _, ok := r.requests[request.UserID]; ok {
+		return false, nil
+	}
+	r.requests[request.UserID] = request
+	return true, nil
+}
+
+func TestJoinByInviteRepeatedRequestSkipsApprovers(t *testing.T) {
+	chats := newFakeChatRepo()
+	owner := uuid.New()
+	group := &models.Chat{ID: uuid.New(), Type: models.ChatTypeGroup}
+	group.Members = []models.ChatMembership{{ChatID: group.ID, UserID: owner, Role: models.MemberRoleOwner}}
+	chats.chats[group.ID] = group
+
+	invites := newFakeInviteRepo()
+	invites.invites["code"] = &models.ChatInvite{ID: uuid.New(), ChatID: group.ID, Code: "code", RequiresApproval: true}
+
+	s := NewInviteService(invites, chats, nil, nil)
+	requester := uuid.New()
+
+	first, err := s.JoinByInvite(context.Background(), "code", requester)
+	if err != nil {
+		t.Fatalf("JoinByInvite() error = %v", err)
+	}
+	if len(first.Approvers) != 1 || first.Approvers[0] != owner {
+		t.Errorf("first request approvers = %v, want [%s]", first.Approvers, owner)
+	}
+
+	repeated, err := s.JoinByInvite(context.Background(), "code", requester)
+	if err != nil {
+		t.Fatalf("repeated JoinByInvite() error = %v", err)
+	}
+	if repeated.Request == nil {
+		t.Fatal("repeated request is not reported as pending")
+	}
+	if len(repeated.Approvers) != 0 {
+		t.Errorf("repeated request approvers = %v, want none", repeated.Approvers)
+	}
+}
@@ -0,0 +1,526 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"dildogram/backend/internal/config"
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"dildogram/backend/internal/storage"
+	"dildogram/backend/pkg/imaging"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAttachmentNotFound    = errors.New("attachment not found")
+	ErrAttachmentUnavailable = errors.New("attachment cannot be used for this message")
+	ErrFileTooLarge          = errors.New("file is too large")
+	ErrUnsupportedMedia      = errors.New("unsupported media type")
+	ErrInvalidDuration       = errors.New("invalid duration")
+)
+
+const (
+	// Сколько байт читаем для определения типа содержимого
+	sniffLen = 3072
+
+	// Качество JPEG при перекодировании повёрнутого оригинала
+	originalJPEGQuality = 92
+
+	// Максимальная длительность голосового сообщения в секундах
+	maxVoiceDuration = 4 * 60 * 60
+
+	// Аватары хранятся под avatars/ и доступны по постоянному URL с редиректом
+	avatarKeyPrefix = "avatars/"
+	avatarURLPrefix = "/uploads/avatars/"
+
+	// Как часто и какими порциями удаляются неотправленные вложения
+	mediaCleanupPeriod = 30 * time.Minute
+	mediaCleanupBatch  = 100
+)
+
+// Допустимые типы содержимого изображений
+var imageMimeTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// MediaUpload описывает загружаемый файл
+type MediaUpload struct {
+	Kind     models.MessageType // Пустой — определяется по содержимому
+	FileName string
+	Duration *float64 // Длительность голосового, сообщает клиент
+	Content  io.Reader
+}
+
+// MediaService предоставляет методы для загрузки и выдачи вложений
+type MediaService struct {
+	attachmentRepo repository.AttachmentRepository
+	messageRepo    repository.MessageRepository
+	chatRepo       repository.ChatRepository
+	blockRepo      repository.BlockRepository
+	storage        storage.Storage
+	config         *config.Config
+}
+
+// NewMediaService создаёт новый MediaService
+func NewMediaService(attachmentRepo repository.AttachmentRepository, messageRepo repository.MessageRepository, chatRepo repository.ChatRepository, blockRepo repository.BlockRepository, store storage.Storage, cfg *config.Config) *MediaService {
+	return &MediaService{
+		attachmentRepo: attachmentRepo,
+		messageRepo:    messageRepo,
+		chatRepo:       chatRepo,
+		blockRepo:      blockRepo,
+		storage:        store,
+		config:         cfg,
+	}
+}
+
+// Upload сохраняет файл участника чата с правом отправлять медиа и создаёт
+// запись о вложении. Тип содержимого определяется по сигнатуре файла, а не по расширению.
+func (s *MediaService) Upload(ctx context.Context, chatID, userID uuid.UUID, upload MediaUpload) (*models.Attachment, error) {
+	chat, membership, err := authorize(ctx, s.chatRepo, chatID, userID, models.PermissionSendMedia)
+	if err != nil {
+		return nil, err
+	}
+	// Загружать файл имеет смысл только тому, кто может его отправить
+	if err := checkCanSend(chat, membership, true); err != nil {
+		return nil, err
+	}
+	if err := checkNotBlocked(ctx, s.blockRepo, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	// Определяем тип по первым байтам
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(upload.Content, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	if n == 0 {
+		return nil, ErrUnsupportedMedia
+	}
+
+	mimeType := mimetype.Detect(head).String()
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+
+	kind, err := mediaKind(upload.Kind, mimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := &models.Attachment{
+		ID:         uuid.New(),
+		ChatID:     chatID,
+		UploaderID: userID,
+		Kind:       kind,
+		FileName:   sanitizeFileName(upload.FileName),
+		MimeType:   mimeType,
+	}
+	attachment.StorageKey = "media/" + chatID.String() + "/" + attachment.ID.String()
+
+	if kind == models.MessageTypeVoice && upload.Duration != nil {
+		if *upload.Duration < 0 || *upload.Duration > maxVoiceDuration {
+			return nil, ErrInvalidDuration
+		}
+		attachment.Duration = upload.Duration
+	}
+
+	src := io.MultiReader(bytes.NewReader(head), upload.Content)
+	var keys []string
+
+	if kind == models.MessageTypeImage {
+		// Изображения обрабатываем целиком в памяти: превью и очистка метаданных
+		data, err := readLimited(src, s.config.Upload.MaxFileSize)
+		if err != nil {
+			return nil, err
+		}
+
+		img, err := processImage(data, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if keys, err = s.putImage(ctx, img, attachment.StorageKey, mimeType, func(size int) string {
+			return attachment.StorageKey + "_" + strconv.Itoa(size)
+		}); err != nil {
+			return nil, err
+		}
+
+		attachment.Size = int64(len(img.original))
+		attachment.Width = &img.width
+		attachment.Height = &img.height
+		attachment.Preview = img.preview(func(size int) string {
+			return attachment.URL() + "?size=" + strconv.Itoa(size)
+		})
+	} else {
+		// Остальные файлы пишем потоково, ограничивая размер
+		counter := &sizeLimitReader{r: src, limit: s.config.Upload.MaxFileSize}
+		if err := s.storage.Put(ctx, attachment.StorageKey, counter, -1, mimeType); err != nil {
+			if counter.exceeded {
+				return nil, ErrFileTooLarge
+			}
+			return nil, err
+		}
+		keys = []string{attachment.StorageKey}
+		attachment.Size = counter.n
+	}
+
+	if err := s.attachmentRepo.Create(ctx, attachment); err != nil {
+		s.deleteKeys(ctx, keys)
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// DownloadURL проверяет доступ к вложению и возвращает временную ссылку на файл
+// или, если size > 0, на его превью.
+// Непривязанное вложение видно только загрузившему, привязанное — участникам чата
+// и участникам чатов, куда сообщение переслано.
+func (s *MediaService) DownloadURL(ctx context.Context, attachmentID, userID uuid.UUID, size int) (string, error) {
+	attachment, err := s.attachmentRepo.GetByID(ctx, attachmentID)
+	if err != nil {
+		return "", err
+	}
+	if attachment == nil {
+		return "", ErrAttachmentNotFound
+	}
+
+	if attachment.MessageID == nil {
+		if attachment.UploaderID != userID {
+			return "", ErrAttachmentNotFound
+		}
+	} else if err := s.checkMessageAttachment(ctx, attachment, userID); err != nil {
+		return "", err
+	}
+
+	if size > 0 {
+		if _, ok := attachment.Preview.Thumbnails[strconv.Itoa(size)]; !ok {
+			return "", ErrAttachmentNotFound
+		}
+		return s.storage.SignedURL(ctx, attachment.StorageKey+"_"+strconv.Itoa(size), storage.URLOptions{
+			Expires:            s.config.Upload.URLExpireDur,
+			ContentType:        "image/jpeg",
+			ContentDisposition: "inline",
+		})
+	}
+
+	// Изображения и голосовые показываем в браузере, остальное — только скачивание
+	disposition := "attachment"
+	if attachment.Kind == models.MessageTypeImage || attachment.Kind == models.MessageTypeVoice {
+		disposition = "inline"
+	}
+	if attachment.FileName != "" {
+		disposition = mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName})
+	}
+
+	return s.storage.SignedURL(ctx, attachment.StorageKey, storage.URLOptions{
+		Expires:            s.config.Upload.URLExpireDur,
+		ContentType:        attachment.MimeType,
+		ContentDisposition: disposition,
+	})
+}
+
+// checkMessageAttachment проверяет доступ к вложению отправленного сообщения:
+// через исходное сообщение или через его пересланную копию в чате пользователя
+func (s *MediaService) checkMessageAttachment(ctx context.Context, attachment *models.Attachment, userID uuid.UUID) error {
+	_, _, accessErr := authorize(ctx, s.chatRepo, attachment.ChatID, userID, "")
+	if accessErr != nil && accessErr != ErrNotMember && accessErr != ErrChatNotFound {
+		return accessErr
+	}
+	isMember := accessErr == nil
+	if isMember {
+		// Файлы сообщений, удалённых у всех, в исходном чате больше не выдаём
+		message, err := s.messageRepo.GetByID(ctx, *attachment.MessageID)
+		if err != nil {
+			return err
+		}
+		if message != nil && !message.IsDeleted {
+			return nil
+		}
+	}
+
+	forwarded, err := s.messageRepo.HasForwardedMedia(ctx, attachment.URL(), userID)
+	if err != nil {
+		return err
+	}
+	if forwarded {
+		return nil
+	}
+
+	if !isMember {
+		return ErrNotMember
+	}
+	return ErrAttachmentNotFound
+}
+
+// UploadAvatar сохраняет аватар (пользователя или чата) с квадратными превью
+// и возвращает его постоянный URL
+func (s *MediaService) UploadAvatar(ctx context.Context, content io.Reader) (string, models.ImagePreview, error) {
+	data, err := readLimited(content, s.config.Upload.MaxFileSize)
+	if err != nil {
+		return "", models.ImagePreview{}, err
+	}
+
+	mimeType := mimetype.Detect(data)
+	if !imageMimeTypes[mimeType.String()] {
+		return "", models.ImagePreview{}, ErrUnsupportedMedia
+	}
+
+	img, err := processImage(data, true)
+	if err != nil {
+		return "", models.ImagePreview{}, err
+	}
+
+	id := uuid.New().String()
+	name := id + mimeType.Extension()
+	variantName := func(size int) string {
+		return id + "_" + strconv.Itoa(size) + ".jpg"
+	}
+
+	if _, err := s.putImage(ctx, img, avatarKeyPrefix+name, mimeType.String(), func(size int) string {
+		return avatarKeyPrefix + variantName(size)
+	}); err != nil {
+		return "", models.ImagePreview{}, err
+	}
+
+	preview := img.preview(func(size int) string {
+		return avatarURLPrefix + variantName(size)
+	})
+	return avatarURLPrefix + name, preview, nil
+}
+
+// AvatarURL возвращает временную ссылку на файл аватара по его имени
+func (s *MediaService) AvatarURL(ctx context.Context, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "/\\") {
+		return "", ErrAttachmentNotFound
+	}
+	return s.storage.SignedURL(ctx, avatarKeyPrefix+name, storage.URLOptions{
+		Expires: s.config.Upload.URLExpireDur,
+	})
+}
+
+// mediaKind проверяет, что содержимое соответствует заявленному типу сообщения
+func mediaKind(kind models.MessageType, mimeType string) (models.MessageType, error) {
+	isVoice := strings.HasPrefix(mimeType, "audio/") || mimeType == "video/webm"
+
+	switch kind {
+	case "":
+		if imageMimeTypes[mimeType] {
+			return models.MessageTypeImage, nil
+		}
+		return models.MessageTypeFile, nil
+	case models.MessageTypeImage:
+		if !imageMimeTypes[mimeType] {
+			return "", ErrUnsupportedMedia
+		}
+	case models.MessageTypeVoice:
+		if !isVoice {
+			return "", ErrUnsupportedMedia
+		}
+	case models.MessageTypeFile:
+	default:
+		return "", ErrUnsupportedMedia
+	}
+	return kind, nil
+}
+
+// sanitizeFileName оставляет только имя файла без пути и ограничивает длину
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return truncate(name, 255)
+}
+
+// sizeLimitReader считает прочитанные байты и возвращает ErrFileTooLarge при превышении лимита
+type sizeLimitReader struct {
+	r        io.Reader
+	limit    int64
+	n        int64
+	exceeded bool
+}
+
+func (r *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.n > r.limit {
+		r.exceeded = true
+		return n, ErrFileTooLarge
+	}
+	return n, err
+}
+
+// readLimited читает содержимое целиком, но не больше limit байт
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrFileTooLarge
+	}
+	return data, nil
+}
+
+// processedImage загруженное изображение без метаданных и его превью
+type processedImage struct {
+	original      []byte
+	width, height int
+	thumbnails    map[int][]byte
+	blurhash      string
+	dominantColor string
+}
+
+// processImage удаляет метаданные (EXIF, GPS) и строит JPEG-превью всех размеров.
+// Для аватаров превью квадратные, для сообщений — с сохранением пропорций.
+func processImage(data []byte, square bool) (*processedImage, error) {
+	img, format, orientation, err := imaging.Decode(data)
+	if err != nil {
+		if err == imaging.ErrTooManyPixels {
+			return nil, ErrFileTooLarge
+		}
+		return nil, ErrUnsupportedMedia
+	}
+
+	result := &processedImage{
+		width:      img.Bounds().Dx(),
+		height:     img.Bounds().Dy(),
+		thumbnails: make(map[int][]byte),
+	}
+
+	// Повёрнутый JPEG перекодируем, иначе после удаления EXIF он отобразится боком
+	if format == "jpeg" && orientation != 1 {
+		result.original, err = imaging.EncodeJPEG(img, originalJPEGQuality)
+	} else {
+		result.original, err = imaging.StripMetadata(data, format)
+	}
+	if err != nil {
+		return nil, ErrUnsupportedMedia
+	}
+
+	// Каждое следующее превью строим из предыдущего — так быстрее
+	current := img
+	for _, size := range []int{models.ThumbnailLarge, models.ThumbnailMedium, models.ThumbnailSmall} {
+		if square {
+			current = imaging.Square(current, size)
+		} else {
+			current = imaging.Fit(current, size)
+		}
+		if result.thumbnails[size], err = imaging.EncodeJPEG(current, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	result.blurhash = imaging.Blurhash(current)
+	result.dominantColor = imaging.DominantColor(current)
+
+	return result, nil
+}
+
+// preview описывает превью изображения с URL, построенными функцией url
+func (p *processedImage) preview(url func(size int) string) models.ImagePreview {
+	thumbnails := make(models.Thumbnails, len(p.thumbnails))
+	for size := range p.thumbnails {
+		thumbnails[strconv.Itoa(size)] = url(size)
+	}
+	return models.ImagePreview{
+		Thumbnails:    thumbnails,
+		Blurhash:      p.blurhash,
+		DominantColor: p.dominantColor,
+	}
+}
+
+// putImage сохраняет оригинал и превью изображения.
+// При ошибке удаляет уже записанные файлы; при успехе возвращает их ключи.
+func (s *MediaService) putImage(ctx context.Context, img *processedImage, key, mimeType string, variantKey func(size int) string) ([]string, error) {
+	keys := make([]string, 0, len(img.thumbnails)+1)
+
+	if err := s.storage.Put(ctx, key, bytes.NewReader(img.original), int64(len(img.original)), mimeType); err != nil {
+		return nil, err
+	}
+	keys = append(keys, key)
+
+	for size, data := range img.thumbnails {
+		vkey := variantKey(size)
+		if err := s.storage.Put(ctx, vkey, bytes.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+			s.deleteKeys(ctx, keys)
+			return nil, err
+		}
+		keys = append(keys, vkey)
+	}
+
+	return keys, nil
+}
+
+// RunCleanup периодически удаляет вложения, которые загрузили, но так и не
+// отправили, пока не отменён ctx. Как и очистка журнала обновлений,
+// безопасна на каждой реплике: запись вложения удаляется один раз.
+func (s *MediaService) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(mediaCleanupPeriod)
+	defer ticker.Stop()
+
+	for {
+		s.cleanup(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanup удаляет устаревшие непривязанные вложения из базы, затем их файлы
+func (s *MediaService) cleanup(ctx context.Context) {
+	before := time.Now().Add(-s.config.Upload.UnlinkedTTLDur)
+	for {
+		attachments, err := s.attachmentRepo.DeleteUnlinkedBefore(ctx, before, mediaCleanupBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to clean up unlinked attachments: %v", err)
+			}
+			return
+		}
+
+		for _, attachment := range attachments {
+			s.deleteKeys(ctx, attachmentKeys(&attachment))
+		}
+		if len(attachments) < mediaCleanupBatch {
+			return
+		}
+	}
+}
+
+// attachmentKeys возвращает ключи файла вложения и его превью в хранилище
+func attachmentKeys(attachment *models.Attachment) []string {
+	keys := []string{attachment.StorageKey}
+	for size := range attachment.Preview.Thumbnails {
+		keys = append(keys, attachment.StorageKey+"_"+size)
+	}
+	return keys
+}
+
+// deleteKeys удаляет файлы из хранилища, игнорируя ошибки
+func (s *MediaService) deleteKeys(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			log.Printf("failed to delete %s from storage: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"dildogram/backend/internal/config"
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"dildogram/backend/internal/storage"
+	"github.com/google/uuid"
+)
+
+func TestUploadRequiresSendMedia(t *testing.T) {
+	chats := newFakeChatRepo()
+	subscriber := uuid.New()
+	channel := chats.addChannel("", subscriber, models.MemberRoleMember)
+
+	s := NewMediaService(nil, nil, chats, nil, nil, nil)
+	_, err := s.Upload(context.Background(), channel.ID, subscriber, MediaUpload{
+		FileName: "note.txt",
+		Content:  strings.NewReader("hello"),
+	})
+	if err != ErrNoPermission {
+		t.Errorf("Upload() error = %v, want %v", err, ErrNoPermission)
+	}
+}
+
+// fakeAttachmentRepo отдаёт заранее заданные устаревшие вложения
+type fakeAttachmentRepo struct {
+	repository.AttachmentRepository
+	stale []models.Attachment
+}
+
+func (r *fakeAttachmentRepo) DeleteUnlinkedBefore(ctx context.Context, before time.Time, limit int) ([]models.Attachment, error) {
+	n := min(limit, len(r.stale))
+	deleted := r.stale[:n]
+	r.stale = r.stale[n:]
+	return deleted, nil
+}
+
+// fakeStorage запоминает удалённые ключи
+type fakeStorage struct {
+	storage.Storage
+	deleted []string
+}
+
+func (s *fakeStorage) Delete(ctx context.Context, key string) error {
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func TestCleanupDeletesStaleAttachmentFiles(t *testing.T) {
+	// Больше одной порции, чтобы очистка дошла до конца
+	stale := make([]models.Attachment, mediaCleanupBatch+1)
+	for i := range stale {
+		stale[i].StorageKey = "media/chat/" + strconv.Itoa(i)
+	}
+	stale[0].Preview.Thumbnails = models.Thumbnails{"320": "/api/v1/media/0?size=320"}
+
+	repo := &fakeAttachmentRepo{stale: stale}
+	store := &fakeStorage{}
+	s := NewMediaService(repo, nil, nil, nil, store, &config.Config{})
+	s.cleanup(context.Background())
+
+	if len(repo.stale) != 0 {
+		t.Errorf("%d stale attachments left", len(repo.stale))
+	}
+	if len(store.deleted) != len(stale)+1 {
+		t.Fatalf("deleted %d files, want %d", len(store.deleted), len(stale)+1)
+	}
+	if !slices.Contains(store.deleted, "media/chat/0_320") {
+		t.Errorf("thumbnail was not deleted: %v", store.deleted[:2])
+	}
+}
+
+func TestProcessImageDropsExifFromOriginalAndThumbnails(t *testing.T) {
+	tests := []struct {
+		fixture string
+		square  bool
+		w, h    int
+		sizes   map[int][2]int
+	}{
+		{
+			fixture: "../../pkg/imaging/testdata/gps.jpg",
+			w:       1600,
+			h:       800,
+			sizes: map[int][2]int{
+				models.ThumbnailLarge:  {1024, 512},
+				models.ThumbnailMedium: {256, 128},
+				models.ThumbnailSmall:  {64, 32},
+			},
+		},
+		{
+			// Повёрнутый снимок перекодируется, а не копируется
+			fixture: "../../pkg/imaging/testdata/gps_rotated.jpg",
+			w:       800,
+			h:       1600,
+			sizes: map[int][2]int{
+				models.ThumbnailLarge:  {512, 1024},
+				models.ThumbnailMedium: {128, 256},
+				models.ThumbnailSmall:  {32, 64},
+			},
+		},
+		{
+			fixture: "../../pkg/imaging/testdata/gps.jpg",
+			square:  true,
+			w:       1600,
+			h:       800,
+			sizes: map[int][2]int{
+				models.ThumbnailLarge:  {800, 800},
+				models.ThumbnailMedium: {256, 256},
+				models.ThumbnailSmall:  {64, 64},
+			},
+		},
+	}
+
+	exif := []byte("Exif\x00\x00")
+	for _, tt := range tests {
+		data, err := os.ReadFile(tt.fixture)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", tt.fixture, err)
+		}
+
+		result, err := processImage(data, tt.square)
+		if err != nil {
+			t.Fatalf("processImage(%s) error = %v", tt.fixture, err)
+		}
+		if result.width != tt.w || result.height != tt.h {
+			t.Fatalf("%s: size = %dx%d, want %dx%d", tt.fixture, result.width, result.height, tt.w, tt.h)
+		}
+
+		stored := map[string][]byte{"original": result.original}
+		for size, thumbnail := range result.thumbnails {
+			stored[strconv.Itoa(size)] = thumbnail
+		}
+		if len(result.thumbnails) != len(tt.sizes) {
+			t.Fatalf("%s: %d thumbnails, want %d", tt.fixture, len(result.thumbnails), len(tt.sizes))
+		}
+		for name, file := range stored {
+			if bytes.Contains(file, exif) {
+				t.Fatalf("%s: %s contains EXIF", tt.fixture, name)
+			}
+		}
+
+		for size, want := range tt.sizes {
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(result.thumbnails[size]))
+			if err != nil {
+				t.Fatalf("%s: failed to decode thumbnail %d: %v", tt.fixture, size, err)
+			}
+			if cfg.Width != want[0] || cfg.Height != want[1] {
+				t.Fatalf("%s: thumbnail %d = %dx%d, want %dx%d", tt.fixture, size, cfg.Width, cfg.Height, want[0], want[1])
+			}
+		}
+	}
+}
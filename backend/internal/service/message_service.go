@@ -3,47 +3,187 @@ package service
 import (
 	"context"
 	"errors"
+	"log"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"dildogram/backend/internal/config"
 	"dildogram/backend/internal/models"
 	"dildogram/backend/internal/repository"
 	"github.com/google/uuid"
 )
 
 var (
-	ErrMessageNotFound = errors.New("message not found")
-	ErrEmptyContent    = errors.New("message content cannot be empty")
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrEmptyContent       = errors.New("message content cannot be empty")
+	ErrMessageDeleted     = errors.New("message has been deleted")
+	ErrEditWindowExpired  = errors.New("message can no longer be edited")
+	ErrInvalidCursor      = errors.New("cursor message not found in this chat")
+	ErrEmptyQuery         = errors.New("search query cannot be empty")
+	ErrInvalidReaction    = errors.New("reaction must be an emoji")
+	ErrTooManyReactions   = errors.New("too many reactions on this message")
+	ErrReplyNotFound      = errors.New("replied message not found in this chat")
+	ErrNothingToForward   = errors.New("no messages or target chats to forward to")
+	ErrTooManyForwards    = errors.New("too many messages or target chats to forward")
+	ErrForwardRestricted  = errors.New("messages from this chat cannot be forwarded")
+	ErrInvalidClientMsgID = errors.New("client message ID must be 1 to 64 characters")
+	ErrClientMsgIDReused  = errors.New("client message ID was already used in another chat")
+)
+
+const (
+	// Размер страницы истории по умолчанию и максимальный
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+
+	// Сколько разных реакций один пользователь может поставить на сообщение
+	maxReactionsPerUser = 3
+	// Сколько реакций отдаётся в списке «кто отреагировал»
+	maxReactionsList = 100
+
+	// Сколько сообщений и в сколько чатов можно переслать за раз
+	maxForwardMessages = 100
+	maxForwardTargets  = 10
+
+	// Максимальная длина клиентского ID сообщения
+	maxClientMsgIDLength = 64
 )
 
 // MessageService предоставляет методы для работы с сообщениями
 type MessageService struct {
-	messageRepo repository.MessageRepository
-	chatRepo    repository.ChatRepository
+	messageRepo    repository.MessageRepository
+	chatRepo       repository.ChatRepository
+	attachmentRepo repository.AttachmentRepository
+	reactionRepo   repository.ReactionRepository
+	blockRepo      repository.BlockRepository
+	profiles       publicProfiles
+	config         *config.Config
 }
 
 // NewMessageService создаёт новый MessageService
-func NewMessageService(messageRepo repository.MessageRepository, chatRepo repository.ChatRepository) *MessageService {
+func NewMessageService(messageRepo repository.MessageRepository, chatRepo repository.ChatRepository, attachmentRepo repository.AttachmentRepository, reactionRepo repository.ReactionRepository, contactRepo repository.ContactRepository, blockRepo repository.BlockRepository, cfg *config.Config) *MessageService {
 	return &MessageService{
-		messageRepo: messageRepo,
-		chatRepo:    chatRepo,
+		messageRepo:    messageRepo,
+		chatRepo:       chatRepo,
+		attachmentRepo: attachmentRepo,
+		reactionRepo:   reactionRepo,
+		blockRepo:      blockRepo,
+		profiles:       publicProfiles{contactRepo: contactRepo, blockRepo: blockRepo},
+		config:         cfg,
 	}
 }
 
-// SendMessage отправляет сообщение в чат
-func (s *MessageService) SendMessage(ctx context.Context, chatID, senderID uuid.UUID, content string, messageType models.MessageType, mediaURL *string, replyToID *uuid.UUID) (*models.Message, error) {
+// SendMessage отправляет сообщение в чат.
+// clientMsgID делает отправку идемпотентной: повтор с тем же ID возвращает
+// уже созданное сообщение и false вместо создания нового.
+func (s *MessageService) SendMessage(ctx context.Context, chatID, senderID uuid.UUID, content string, messageType models.MessageType, mediaURL *string, replyToID *uuid.UUID, clientMsgID *string) (*models.Message, bool, error) {
 	if content == "" && messageType == models.MessageTypeText {
-		return nil, ErrEmptyContent
+		return nil, false, ErrEmptyContent
+	}
+	if clientMsgID != nil && (*clientMsgID == "" || len(*clientMsgID) > maxClientMsgIDLength) {
+		return nil, false, ErrInvalidClientMsgID
 	}
 
 	// Проверяем существование чата и доступ
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, senderID)
+	chat, membership, err := authorize(ctx, s.chatRepo, chatID, senderID, "")
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Повторная отправка: вложение уже привязано, поэтому проверяем до его проверки
+	if clientMsgID != nil {
+		existing, err := s.getSentMessage(ctx, chatID, senderID, *clientMsgID)
+		if err != nil || existing != nil {
+			return existing, false, err
+		}
+	}
+
+	if err := checkCanSend(chat, membership, messageType != models.MessageTypeText || mediaURL != nil); err != nil {
+		return nil, false, err
+	}
+
+	if err := s.CheckNotBlocked(ctx, chatID, senderID); err != nil {
+		return nil, false, err
+	}
+
+	message, err := s.createMessage(ctx, chatID, senderID, content, messageType, mediaURL, replyToID, clientMsgID)
 	if err != nil {
+		// Параллельный повтор мог создать сообщение раньше
+		if clientMsgID != nil && err == errMessageNotCreated {
+			existing, getErr := s.getSentMessage(ctx, chatID, senderID, *clientMsgID)
+			if getErr != nil {
+				return nil, false, getErr
+			}
+			if existing != nil {
+				return existing, false, nil
+			}
+		}
+		return nil, false, err
+	}
+
+	if err := s.profiles.messages(ctx, senderID, message); err != nil {
+		return nil, false, err
+	}
+
+	// Тип чата нужен при рассылке: о доставке в каналах не сообщается
+	message.Chat = chat
+	return message, true, nil
+}
+
+// checkCanSend проверяет право писать в чат и, если withMedia, отправлять медиа
+func checkCanSend(chat *models.Chat, membership *models.ChatMembership, withMedia bool) error {
+	permissions := membership.Permissions(chat)
+	if !permissions.Has(models.PermissionSendMessages) {
+		return ErrNoPermission
+	}
+	if withMedia && !permissions.Has(models.PermissionSendMedia) {
+		return ErrNoPermission
+	}
+	return nil
+}
+
+// CheckNotBlocked возвращает ErrUserBlocked, если чат личный и кто-то из собеседников
+// заблокировал другого. Тогда в чате нельзя писать, редактировать сообщения,
+// ставить реакции и показывать набор текста.
+func (s *MessageService) CheckNotBlocked(ctx context.Context, chatID, userID uuid.UUID) error {
+	return checkNotBlocked(ctx, s.blockRepo, chatID, userID)
+}
+
+// checkNotBlocked реализует CheckNotBlocked для сервисов, которым нужен только blockRepo
+func checkNotBlocked(ctx context.Context, blockRepo repository.BlockRepository, chatID, userID uuid.UUID) error {
+	blocked, err := blockRepo.IsBlockedInPrivateChat(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrUserBlocked
+	}
+	return nil
+}
+
+// errMessageNotCreated — сообщение с тем же client_msg_id уже создано параллельным запросом
+var errMessageNotCreated = errors.New("message with this client ID already exists")
+
+// getSentMessage возвращает сообщение, уже отправленное с clientMsgID, или nil
+func (s *MessageService) getSentMessage(ctx context.Context, chatID, senderID uuid.UUID, clientMsgID string) (*models.Message, error) {
+	message, err := s.messageRepo.GetByClientMsgID(ctx, senderID, clientMsgID)
+	if err != nil || message == nil {
 		return nil, err
 	}
-	if !isMember {
-		return nil, ErrNotMember
+	if message.ChatID != chatID {
+		return nil, ErrClientMsgIDReused
 	}
 
+	messages := []models.Message{*message}
+	if err := s.decorate(ctx, messages, senderID); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// createMessage проверяет ответ и вложение и сохраняет новое сообщение
+func (s *MessageService) createMessage(ctx context.Context, chatID, senderID uuid.UUID, content string, messageType models.MessageType, mediaURL *string, replyToID *uuid.UUID, clientMsgID *string) (*models.Message, error) {
 	// Создаём сообщение
 	message := &models.Message{
 		ChatID:      chatID,
@@ -52,37 +192,451 @@ func (s *MessageService) SendMessage(ctx context.Context, chatID, senderID uuid.
 		MessageType: messageType,
 		MediaURL:    mediaURL,
 		ReplyToID:   replyToID,
+		ClientMsgID: clientMsgID,
 		Status:      models.MessageStatusSent,
 	}
 
-	if err := s.messageRepo.Create(ctx, message); err != nil {
-		return nil, err
+	// Ответ попадает в ветку исходного сообщения (или открывает её)
+	if replyToID != nil {
+		parent, err := s.messageRepo.GetByID(ctx, *replyToID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil || parent.ChatID != chatID {
+			return nil, ErrReplyNotFound
+		}
+
+		threadID := parent.ID
+		if parent.ThreadID != nil {
+			threadID = *parent.ThreadID
+		}
+		message.ThreadID = &threadID
+		message.ReplyTo = parent
+		message.ReplyPreview = models.NewReplyPreview(parent)
+	}
+
+	// Загруженное вложение привязываем к сообщению атомарно
+	if mediaURL != nil && strings.HasPrefix(*mediaURL, models.MediaURLPrefix) {
+		attachment, err := s.getSendableAttachment(ctx, chatID, senderID, messageType, *mediaURL)
+		if err != nil {
+			return nil, err
+		}
+
+		created, linked, err := s.messageRepo.CreateWithAttachment(ctx, message, attachment.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			return nil, errMessageNotCreated
+		}
+		if !linked {
+			return nil, ErrAttachmentUnavailable
+		}
+		message.Attachment = attachment
+	} else {
+		created, err := s.messageRepo.Create(ctx, message)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			return nil, errMessageNotCreated
+		}
 	}
 
 	// Загружаем отправителя
-	message.Sender, _ = s.messageRepo.GetByID(ctx, message.ID)
-	if message.Sender != nil {
-		sender, _ := s.chatRepo.GetMember(ctx, chatID, senderID)
-		if sender != nil {
-			message.Sender.Sender = sender.User
+	if sender, _ := s.chatRepo.GetMember(ctx, chatID, senderID); sender != nil {
+		message.Sender = sender.User
+	}
+
+	// Отправитель ответа и автор исходного сообщения следят за веткой
+	if message.ThreadID != nil {
+		if err := s.messageRepo.MarkThreadRead(ctx, *message.ThreadID, senderID, message.CreatedAt); err != nil {
+			log.Printf("Failed to follow thread %s: %v", *message.ThreadID, err)
+		}
+		if parent := message.ReplyTo; parent.SenderID != senderID {
+			if err := s.messageRepo.MarkThreadRead(ctx, *message.ThreadID, parent.SenderID, parent.CreatedAt); err != nil {
+				log.Printf("Failed to follow thread %s: %v", *message.ThreadID, err)
+			}
 		}
 	}
 
 	return message, nil
 }
 
-// GetMessages получает историю сообщений чата
-func (s *MessageService) GetMessages(ctx context.Context, chatID, userID uuid.UUID, limit, offset int) ([]models.Message, error) {
+// getSendableAttachment проверяет, что вложение загружено отправителем в этот чат
+// и ещё не отправлено
+func (s *MessageService) getSendableAttachment(ctx context.Context, chatID, senderID uuid.UUID, messageType models.MessageType, mediaURL string) (*models.Attachment, error) {
+	attachmentID, err := uuid.Parse(strings.TrimPrefix(mediaURL, models.MediaURLPrefix))
+	if err != nil {
+		return nil, ErrAttachmentNotFound
+	}
+
+	attachment, err := s.attachmentRepo.GetByID(ctx, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	if attachment == nil || attachment.ChatID != chatID || attachment.UploaderID != senderID {
+		return nil, ErrAttachmentNotFound
+	}
+	if attachment.MessageID != nil || attachment.Kind != messageType {
+		return nil, ErrAttachmentUnavailable
+	}
+
+	return attachment, nil
+}
+
+// ForwardMessages пересылает сообщения чата fromChatID в чаты targetChatIDs от имени пользователя.
+// Копии ссылаются на те же вложения и хранят автора и время исходного сообщения.
+// Возвращает созданные копии: по чатам, внутри чата в порядке исходных сообщений.
+func (s *MessageService) ForwardMessages(ctx context.Context, userID, fromChatID uuid.UUID, messageIDs, targetChatIDs []uuid.UUID) ([]models.Message, error) {
+	messageIDs = uniqueIDs(messageIDs)
+	targetChatIDs = uniqueIDs(targetChatIDs)
+	if len(messageIDs) == 0 || len(targetChatIDs) == 0 {
+		return nil, ErrNothingToForward
+	}
+	if len(messageIDs) > maxForwardMessages || len(targetChatIDs) > maxForwardTargets {
+		return nil, ErrTooManyForwards
+	}
+
+	chat, _, err := authorize(ctx, s.chatRepo, fromChatID, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if chat.ProtectedContent {
+		return nil, ErrForwardRestricted
+	}
+
+	sources, err := s.messageRepo.GetByIDs(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) != len(messageIDs) {
+		return nil, ErrMessageNotFound
+	}
+	for i := range sources {
+		if sources[i].ChatID != fromChatID {
+			return nil, ErrMessageNotFound
+		}
+		if sources[i].IsDeleted {
+			return nil, ErrMessageDeleted
+		}
+	}
+
+	withMedia := false
+	for i := range sources {
+		withMedia = withMedia || sources[i].MessageType != models.MessageTypeText || sources[i].MediaURL != nil
+	}
+
+	// Пересылать можно только в чаты, где пользователь — активный участник с правом писать
+	senders := make(map[uuid.UUID]*models.User, len(targetChatIDs))
+	targets := make(map[uuid.UUID]*models.Chat, len(targetChatIDs))
+	for _, targetID := range targetChatIDs {
+		target, membership, err := authorize(ctx, s.chatRepo, targetID, userID, "")
+		if err != nil {
+			return nil, err
+		}
+		if err := checkCanSend(target, membership, withMedia); err != nil {
+			return nil, err
+		}
+
+		blocked, err := s.blockRepo.IsBlockedInPrivateChat(ctx, targetID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, ErrUserBlocked
+		}
+		senders[targetID] = membership.User
+		targets[targetID] = target
+	}
+
+	now := time.Now()
+	copies := make([]models.Message, 0, len(sources)*len(targetChatIDs))
+	for _, targetID := range targetChatIDs {
+		for i := range sources {
+			source := &sources[i]
+
+			// Сдвиг на микросекунду сохраняет порядок пересланных сообщений в истории
+			createdAt := now.Add(time.Duration(len(copies)) * time.Microsecond)
+			message := models.Message{
+				ChatID:      targetID,
+				SenderID:    userID,
+				Content:     source.Content,
+				MessageType: source.MessageType,
+				MediaURL:    source.MediaURL,
+				Status:      models.MessageStatusSent,
+				CreatedAt:   createdAt,
+				UpdatedAt:   createdAt,
+				Sender:      senders[targetID],
+				Attachment:  source.Attachment,
+				Chat:        targets[targetID],
+			}
+
+			// При пересылке пересланного указываем первоисточник
+			if source.IsForwarded() {
+				message.ForwardedFromMessageID = source.ForwardedFromMessageID
+				message.ForwardedFromUserID = source.ForwardedFromUserID
+				message.ForwardedFromCreatedAt = source.ForwardedFromCreatedAt
+				message.ForwardedFromUser = source.ForwardedFromUser
+			} else {
+				message.ForwardedFromMessageID = &source.ID
+				message.ForwardedFromUserID = &source.SenderID
+				message.ForwardedFromCreatedAt = &source.CreatedAt
+				message.ForwardedFromUser = source.Sender
+			}
+
+			copies = append(copies, message)
+		}
+	}
+
+	if err := s.messageRepo.CreateBatch(ctx, copies); err != nil {
+		return nil, err
+	}
+	if err := s.profiles.messageList(ctx, userID, copies); err != nil {
+		return nil, err
+	}
+
+	return copies, nil
+}
+
+// uniqueIDs убирает повторы, сохраняя порядок
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	result := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// MessagePageParams параметры запроса страницы истории.
+// Задаётся не более одного из Before, After и Around.
+type MessagePageParams struct {
+	Before *uuid.UUID
+	After  *uuid.UUID
+	Around *uuid.UUID
+	Limit  int
+}
+
+// MessagePage страница истории сообщений с курсорами для прокрутки в обе стороны
+type MessagePage struct {
+	Messages      []models.Message `json:"messages"`
+	HasMoreBefore bool             `json:"has_more_before"`
+	HasMoreAfter  bool             `json:"has_more_after"`
+	BeforeCursor  *uuid.UUID       `json:"before_cursor,omitempty"`
+	AfterCursor   *uuid.UUID       `json:"after_cursor,omitempty"`
+}
+
+// GetMessagesPage получает страницу истории сообщений чата (keyset-пагинация)
+func (s *MessageService) GetMessagesPage(ctx context.Context, chatID, userID uuid.UUID, params MessagePageParams) (*MessagePage, error) {
 	// Проверяем доступ
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	if _, _, err := authorize(ctx, s.chatRepo, chatID, userID, ""); err != nil {
+		return nil, err
+	}
+
+	return s.getPage(ctx, repository.MessagePageQuery{
+		ChatID: chatID,
+		UserID: userID,
+	}, params)
+}
+
+// getPage выбирает страницу истории чата или ветки по параметрам прокрутки
+func (s *MessageService) getPage(ctx context.Context, query repository.MessagePageQuery, params MessagePageParams) (*MessagePage, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	chatID := query.ChatID
+	query.Limit = limit
+	page := &MessagePage{}
+
+	var err error
+
+	switch {
+	case params.Before != nil:
+		if query.Cursor, err = s.getCursor(ctx, chatID, *params.Before); err != nil {
+			return nil, err
+		}
+		query.Direction = repository.PageBefore
+		if page.Messages, page.HasMoreBefore, err = s.messageRepo.GetChatMessagesPage(ctx, query); err != nil {
+			return nil, err
+		}
+		page.HasMoreAfter = true
+
+	case params.After != nil:
+		if query.Cursor, err = s.getCursor(ctx, chatID, *params.After); err != nil {
+			return nil, err
+		}
+		query.Direction = repository.PageAfter
+		if page.Messages, page.HasMoreAfter, err = s.messageRepo.GetChatMessagesPage(ctx, query); err != nil {
+			return nil, err
+		}
+		page.HasMoreBefore = true
+
+	case params.Around != nil:
+		if query.Cursor, err = s.getCursor(ctx, chatID, *params.Around); err != nil {
+			return nil, err
+		}
+
+		// Половина страницы до опорного сообщения, остальное — начиная с него
+		before := query
+		before.Direction = repository.PageBefore
+		before.Limit = limit / 2
+		older, hasMoreBefore, err := s.messageRepo.GetChatMessagesPage(ctx, before)
+		if err != nil {
+			return nil, err
+		}
+
+		after := query
+		after.Direction = repository.PageAfter
+		after.Inclusive = true
+		after.Limit = limit - len(older)
+		newer, hasMoreAfter, err := s.messageRepo.GetChatMessagesPage(ctx, after)
+		if err != nil {
+			return nil, err
+		}
+
+		page.Messages = append(older, newer...)
+		page.HasMoreBefore = hasMoreBefore
+		page.HasMoreAfter = hasMoreAfter
+
+	default:
+		query.Direction = repository.PageBefore
+		if page.Messages, page.HasMoreBefore, err = s.messageRepo.GetChatMessagesPage(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.decorate(ctx, page.Messages, query.UserID); err != nil {
+		return nil, err
+	}
+
+	if len(page.Messages) > 0 {
+		page.BeforeCursor = &page.Messages[0].ID
+		page.AfterCursor = &page.Messages[len(page.Messages)-1].ID
+	}
+
+	return page, nil
+}
+
+// getCursor возвращает позицию сообщения чата для keyset-пагинации
+func (s *MessageService) getCursor(ctx context.Context, chatID, messageID uuid.UUID) (*repository.MessageCursor, error) {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil || message.ChatID != chatID {
+		return nil, ErrInvalidCursor
+	}
+	return &repository.MessageCursor{
+		CreatedAt: message.CreatedAt,
+		ID:        message.ID,
+	}, nil
+}
+
+// MessageSearchParams параметры поиска сообщений
+type MessageSearchParams struct {
+	Query       string
+	ChatID      *uuid.UUID
+	SenderID    *uuid.UUID
+	MessageType *models.MessageType
+	Before      *time.Time
+	After       *time.Time
+	Cursor      *uuid.UUID
+	Limit       int
+}
+
+// MessageSearchPage страница результатов поиска
+type MessageSearchPage struct {
+	Results    []models.MessageSearchResult `json:"results"`
+	HasMore    bool                         `json:"has_more"`
+	NextCursor *uuid.UUID                   `json:"next_cursor,omitempty"`
+}
+
+// SearchMessages ищет сообщения по всем активным чатам пользователя
+func (s *MessageService) SearchMessages(ctx context.Context, userID uuid.UUID, params MessageSearchParams) (*MessageSearchPage, error) {
+	text := strings.TrimSpace(params.Query)
+	if text == "" {
+		return nil, ErrEmptyQuery
+	}
+
+	// Поиск в конкретном чате доступен только его участникам
+	if params.ChatID != nil {
+		if _, _, err := authorize(ctx, s.chatRepo, *params.ChatID, userID, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	query := repository.MessageSearchQuery{
+		UserID:      userID,
+		Query:       text,
+		ChatID:      params.ChatID,
+		SenderID:    params.SenderID,
+		MessageType: params.MessageType,
+		Before:      params.Before,
+		After:       params.After,
+		Limit:       limit,
+	}
+
+	if params.Cursor != nil {
+		message, err := s.messageRepo.GetByID(ctx, *params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if message == nil || (params.ChatID != nil && message.ChatID != *params.ChatID) {
+			return nil, ErrInvalidCursor
+		}
+		// Курсор из чужого чата раскрыл бы время его сообщения
+		if _, _, err := authorize(ctx, s.chatRepo, message.ChatID, userID, ""); err != nil {
+			if err == ErrNotMember || err == ErrChatNotFound {
+				return nil, ErrInvalidCursor
+			}
+			return nil, err
+		}
+		query.Cursor = &repository.MessageCursor{
+			CreatedAt: message.CreatedAt,
+			ID:        message.ID,
+		}
+	}
+
+	results, hasMore, err := s.messageRepo.Search(ctx, query)
 	if err != nil {
 		return nil, err
 	}
-	if !isMember {
-		return nil, ErrNotMember
+
+	messages := make([]*models.Message, len(results))
+	for i := range results {
+		messages[i] = &results[i].Message
+	}
+	if err := s.profiles.messages(ctx, userID, messages...); err != nil {
+		return nil, err
 	}
 
-	return s.messageRepo.GetChatMessages(ctx, chatID, limit, offset)
+	page := &MessageSearchPage{
+		Results: results,
+		HasMore: hasMore,
+	}
+	if hasMore && len(results) > 0 {
+		page.NextCursor = &results[len(results)-1].ID
+	}
+
+	return page, nil
 }
 
 // GetMessage получает сообщение по ID
@@ -96,142 +650,566 @@ func (s *MessageService) GetMessage(ctx context.Context, messageID, userID uuid.
 	}
 
 	// Проверяем доступ к чату
-	isMember, err := s.chatRepo.IsMember(ctx, message.ChatID, userID)
-	if err != nil {
+	if _, _, err := authorize(ctx, s.chatRepo, message.ChatID, userID, ""); err != nil {
 		return nil, err
 	}
-	if !isMember {
-		return nil, ErrNotMember
-	}
 
+	if err := s.profiles.messages(ctx, userID, message); err != nil {
+		return nil, err
+	}
 	return message, nil
 }
 
-// UpdateMessage обновляет сообщение
-func (s *MessageService) UpdateMessage(ctx context.Context, messageID, userID uuid.UUID, content string) (*models.Message, error) {
-	message, err := s.messageRepo.GetByID(ctx, messageID)
+// UpdateMessage редактирует текст сообщения в пределах окна редактирования
+func (s *MessageService) UpdateMessage(ctx context.Context, chatID, messageID, userID uuid.UUID, content string) (*models.Message, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, ErrEmptyContent
+	}
+
+	message, err := s.getChatMessage(ctx, chatID, messageID)
 	if err != nil {
 		return nil, err
 	}
-	if message == nil {
-		return nil, ErrMessageNotFound
-	}
 
 	// Только отправитель может редактировать
 	if message.SenderID != userID {
 		return nil, ErrNoPermission
 	}
 
+	if _, _, err := authorize(ctx, s.chatRepo, chatID, userID, ""); err != nil {
+		return nil, err
+	}
+
+	if message.IsDeleted {
+		return nil, ErrMessageDeleted
+	}
+
+	if time.Since(message.CreatedAt) > s.config.Message.EditWindowDur {
+		return nil, ErrEditWindowExpired
+	}
+
+	if err := s.CheckNotBlocked(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+
 	message.Content = content
 	message.IsEdited = true
 
 	if err := s.messageRepo.Update(ctx, message); err != nil {
 		return nil, err
 	}
+	if err := s.profiles.messages(ctx, userID, message); err != nil {
+		return nil, err
+	}
 
 	return message, nil
 }
 
-// DeleteMessage удаляет сообщение
-func (s *MessageService) DeleteMessage(ctx context.Context, messageID, userID uuid.UUID) error {
-	message, err := s.messageRepo.GetByID(ctx, messageID)
+// DeleteMessage удаляет сообщение у всех участников или только у пользователя
+func (s *MessageService) DeleteMessage(ctx context.Context, chatID, messageID, userID uuid.UUID, forEveryone bool) (*models.Message, error) {
+	message, err := s.getChatMessage(ctx, chatID, messageID)
 	if err != nil {
-		return err
-	}
-	if message == nil {
-		return ErrMessageNotFound
+		return nil, err
 	}
 
-	// Только отправитель или админ чата может удалить
-	isMember, err := s.chatRepo.GetMember(ctx, message.ChatID, userID)
+	chat, membership, err := authorize(ctx, s.chatRepo, chatID, userID, "")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if isMember == nil {
-		return ErrNotMember
+
+	// Удаление только у себя доступно любому участнику
+	if !forEveryone {
+		if err := s.messageRepo.DeleteForUser(ctx, messageID, userID); err != nil {
+			return nil, err
+		}
+		return message, nil
 	}
 
+	// У всех удаляет отправитель или участник с правом удалять чужие сообщения
 	canDelete := message.SenderID == userID ||
-		isMember.Role == models.MemberRoleOwner ||
-		isMember.Role == models.MemberRoleAdmin
+		membership.Permissions(chat).Has(models.PermissionDeleteMessages)
 
 	if !canDelete {
-		return ErrNoPermission
+		return nil, ErrNoPermission
+	}
+
+	if message.IsDeleted {
+		return message, nil
 	}
 
+	now := time.Now()
 	message.IsDeleted = true
 	message.Content = "This message was deleted"
+	message.MediaURL = nil
+	message.DeletedAt = &now
+
+	if err := s.messageRepo.Update(ctx, message); err != nil {
+		return nil, err
+	}
 
-	return s.messageRepo.Update(ctx, message)
+	return message, nil
 }
 
-// MarkAsRead отмечает сообщение как прочитанное
-func (s *MessageService) MarkAsRead(ctx context.Context, messageID, userID uuid.UUID) error {
+// getChatMessage получает сообщение и проверяет, что оно принадлежит чату
+func (s *MessageService) getChatMessage(ctx context.Context, chatID, messageID uuid.UUID) (*models.Message, error) {
 	message, err := s.messageRepo.GetByID(ctx, messageID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if message == nil {
-		return ErrMessageNotFound
+	if message == nil || message.ChatID != chatID {
+		return nil, ErrMessageNotFound
+	}
+	return message, nil
+}
+
+// ReactionUpdate описывает изменение реакций на сообщение
+type ReactionUpdate struct {
+	ChatID    uuid.UUID              `json:"chat_id"`
+	MessageID uuid.UUID              `json:"message_id"`
+	UserID    uuid.UUID              `json:"user_id"`
+	Emoji     string                 `json:"emoji"`
+	Added     bool                   `json:"added"`
+	Reactions []models.ReactionCount `json:"reactions"`
+	// Changed — false, если реакция уже была поставлена (или снята)
+	Changed bool `json:"-"`
+	// Anonymous — реакция в канале: подписчикам не сообщается, кто её поставил
+	Anonymous bool `json:"-"`
+}
+
+// ReactionList реакции на сообщение: сводка Counts и поставившие их пользователи.
+// В каналах подписчики не видят, кто поставил реакции, Reactions для них пуст.
+type ReactionList struct {
+	Reactions []models.MessageReaction `json:"reactions"`
+	Counts    []models.ReactionCount   `json:"counts"`
+}
+
+// AddReaction ставит реакцию на сообщение чата
+func (s *MessageService) AddReaction(ctx context.Context, chatID, messageID, userID uuid.UUID, emoji string) (*ReactionUpdate, error) {
+	if !isEmoji(emoji) {
+		return nil, ErrInvalidReaction
 	}
 
-	// Не можем отметить своё сообщение
-	if message.SenderID == userID {
-		return nil
+	membership, err := s.getReactableMessage(ctx, chatID, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Снять свою реакцию можно и после блокировки, поставить новую — нет
+	if err := s.CheckNotBlocked(ctx, chatID, userID); err != nil {
+		return nil, err
 	}
 
-	// Создаём запись о прочтении
-	read := models.MessageRead{
+	count, err := s.reactionRepo.CountByUser(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxReactionsPerUser {
+		return nil, ErrTooManyReactions
+	}
+
+	added, err := s.reactionRepo.Add(ctx, &models.MessageReaction{
 		MessageID: messageID,
 		UserID:    userID,
+		Emoji:     emoji,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Используем transaction для предотвращения дубликатов
-	return s.messageRepo.MarkChatAsRead(ctx, message.ChatID, userID)
+	return s.reactionUpdate(ctx, membership.Chat, messageID, userID, emoji, true, added)
 }
 
-// MarkChatAsRead отмечает все сообщения в чате как прочитанные
-func (s *MessageService) MarkChatAsRead(ctx context.Context, chatID, userID uuid.UUID) error {
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+// RemoveReaction снимает реакцию пользователя с сообщения
+func (s *MessageService) RemoveReaction(ctx context.Context, chatID, messageID, userID uuid.UUID, emoji string) (*ReactionUpdate, error) {
+	membership, err := s.getReactableMessage(ctx, chatID, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := s.reactionRepo.Remove(ctx, messageID, userID, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reactionUpdate(ctx, membership.Chat, messageID, userID, emoji, false, removed)
+}
+
+// GetReactions возвращает пользователей, поставивших реакции на сообщение.
+// Пустой emoji — реакции с любым эмодзи. Подписчики канала получают только
+// сводку, список поставивших доступен владельцу и админам.
+func (s *MessageService) GetReactions(ctx context.Context, chatID, messageID, userID uuid.UUID, emoji string) (*ReactionList, error) {
+	membership, err := s.getReactableMessage(ctx, chatID, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries, err := s.reactionRepo.GetSummaries(ctx, []uuid.UUID{messageID}, userID)
+	if err != nil {
+		return nil, err
+	}
+	list := &ReactionList{
+		Reactions: []models.MessageReaction{},
+		Counts:    []models.ReactionCount{},
+	}
+	for _, count := range summaries[messageID] {
+		if emoji == "" || count.Emoji == emoji {
+			list.Counts = append(list.Counts, count)
+		}
+	}
+	if membership.Chat.Type == models.ChatTypeChannel && membership.Role == models.MemberRoleMember {
+		return list, nil
+	}
+
+	reactions, err := s.reactionRepo.GetMessageReactions(ctx, messageID, emoji, maxReactionsList)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.profiles.reactions(ctx, userID, reactions); err != nil {
+		return nil, err
+	}
+	if reactions != nil {
+		list.Reactions = reactions
+	}
+	return list, nil
+}
+
+// getReactableMessage проверяет доступ к сообщению, на которое ставится реакция.
+// Возвращает участие пользователя вместе с чатом.
+func (s *MessageService) getReactableMessage(ctx context.Context, chatID, messageID, userID uuid.UUID) (*models.ChatMembership, error) {
+	_, membership, err := authorize(ctx, s.chatRepo, chatID, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := s.getChatMessage(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.IsDeleted {
+		return nil, ErrMessageDeleted
+	}
+
+	return membership, nil
+}
+
+// reactionUpdate собирает событие изменения реакций с актуальной сводкой.
+// Сводка общая для всех участников, поэтому Reacted в ней не заполняется.
+func (s *MessageService) reactionUpdate(ctx context.Context, chat *models.Chat, messageID, userID uuid.UUID, emoji string, added, changed bool) (*ReactionUpdate, error) {
+	summaries, err := s.reactionRepo.GetSummaries(ctx, []uuid.UUID{messageID}, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions := summaries[messageID]
+	if reactions == nil {
+		reactions = []models.ReactionCount{}
+	}
+
+	return &ReactionUpdate{
+		ChatID:    chat.ID,
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     emoji,
+		Added:     added,
+		Reactions: reactions,
+		Changed:   changed,
+		Anonymous: chat.Type == models.ChatTypeChannel,
+	}, nil
+}
+
+// ThreadPage ветка ответов: корневое сообщение и страница ответов
+type ThreadPage struct {
+	Root *models.Message `json:"root"`
+	MessagePage
+}
+
+// GetThread получает корневое сообщение ветки и страницу ответов в ней
+func (s *MessageService) GetThread(ctx context.Context, chatID, rootID, userID uuid.UUID, params MessagePageParams) (*ThreadPage, error) {
+	root, err := s.getThreadRoot(ctx, chatID, rootID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.getPage(ctx, repository.MessagePageQuery{
+		ChatID:   chatID,
+		UserID:   userID,
+		ThreadID: &root.ID,
+	}, params)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := []models.Message{*root}
+	if err := s.decorate(ctx, roots, userID); err != nil {
+		return nil, err
+	}
+
+	return &ThreadPage{
+		Root:        &roots[0],
+		MessagePage: *page,
+	}, nil
+}
+
+// MarkThreadRead отмечает ветку прочитанной и подписывает пользователя на неё
+func (s *MessageService) MarkThreadRead(ctx context.Context, chatID, rootID, userID uuid.UUID) error {
+	root, err := s.getThreadRoot(ctx, chatID, rootID, userID)
 	if err != nil {
 		return err
 	}
-	if !isMember {
-		return ErrNotMember
+
+	return s.messageRepo.MarkThreadRead(ctx, root.ID, userID, time.Now())
+}
+
+// GetThreadStats возвращает сводку ветки для рассылки участникам чата
+// (без непрочитанных, они у каждого свои)
+func (s *MessageService) GetThreadStats(ctx context.Context, threadID uuid.UUID) (*models.ThreadStats, error) {
+	stats, err := s.messageRepo.GetThreadStats(ctx, []uuid.UUID{threadID}, uuid.Nil)
+	if err != nil {
+		return nil, err
 	}
 
-	return s.messageRepo.MarkChatAsRead(ctx, chatID, userID)
+	thread := stats[threadID]
+	return &thread, nil
 }
 
-// GetUnreadCount получает количество непрочитанных сообщений
-func (s *MessageService) GetUnreadCount(ctx context.Context, chatID, userID uuid.UUID) (int64, error) {
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+// getThreadRoot проверяет доступ к ветке и возвращает её корневое сообщение
+func (s *MessageService) getThreadRoot(ctx context.Context, chatID, rootID, userID uuid.UUID) (*models.Message, error) {
+	if _, _, err := authorize(ctx, s.chatRepo, chatID, userID, ""); err != nil {
+		return nil, err
+	}
+
+	root, err := s.getChatMessage(ctx, chatID, rootID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	if !isMember {
-		return 0, ErrNotMember
+	// Ответ не может быть корнем: ветки не вкладываются
+	if root.ThreadID != nil {
+		return nil, ErrMessageNotFound
 	}
 
-	return s.messageRepo.GetUnreadCount(ctx, chatID, userID)
+	return root, nil
+}
+
+// decorate заполняет для пользователя viewerID сводки реакций и веток сообщений
+// и профили их авторов
+func (s *MessageService) decorate(ctx context.Context, messages []models.Message, viewerID uuid.UUID) error {
+	if err := s.profiles.messageList(ctx, viewerID, messages); err != nil {
+		return err
+	}
+	if err := s.attachReactions(ctx, messages, viewerID); err != nil {
+		return err
+	}
+	return s.attachThreadStats(ctx, messages, viewerID)
+}
+
+// attachThreadStats заполняет сводку веток для сообщений, у которых есть ответы
+func (s *MessageService) attachThreadStats(ctx context.Context, messages []models.Message, viewerID uuid.UUID) error {
+	var ids []uuid.UUID
+	for i := range messages {
+		if messages[i].ThreadID == nil {
+			ids = append(ids, messages[i].ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	stats, err := s.messageRepo.GetThreadStats(ctx, ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		if thread, ok := stats[messages[i].ID]; ok {
+			messages[i].Thread = &thread
+		}
+	}
+	return nil
+}
+
+// attachReactions заполняет сводку реакций сообщений для пользователя viewerID
+func (s *MessageService) attachReactions(ctx context.Context, messages []models.Message, viewerID uuid.UUID) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+	}
+
+	summaries, err := s.reactionRepo.GetSummaries(ctx, ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].Reactions = summaries[messages[i].ID]
+	}
+	return nil
+}
+
+// isEmoji проверяет, что короткая строка состоит только из эмодзи (включая составные: ZWJ-последовательности,
+// модификаторы тона кожи, флаги и keycap)
+func isEmoji(value string) bool {
+	if value == "" || len(value) > 32 || !utf8.ValidString(value) {
+		return false
+	}
+
+	hasSymbol := false
+	keycap := strings.ContainsRune(value, 0x20E3)
+	for _, r := range value {
+		switch {
+		case unicode.Is(unicode.So, r):
+			hasSymbol = true
+		case r == 0x20E3:
+			hasSymbol = true
+		case unicode.Is(unicode.Sk, r) && r >= 0x1F3FB && r <= 0x1F3FF:
+			// Модификаторы тона кожи
+		case r == 0x200D, r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0020 && r <= 0xE007F:
+			// ZWJ, селекторы вариантов и теги флагов регионов
+		case keycap && (r == '#' || r == '*' || (r >= '0' && r <= '9')):
+		default:
+			return false
+		}
+	}
+	return hasSymbol && utf8.RuneCountInString(value) <= 10
+}
+
+// ReadUpdate итог отметки прочтения
+type ReadUpdate struct {
+	ChatID uuid.UUID
+	UserID uuid.UUID
+	// LastReadID — самое новое из впервые прочитанных сообщений
+	LastReadID uuid.UUID
+	ReadAt     time.Time
+	// Count — сколько сообщений прочитано впервые
+	Count int
+	// StatusChanges — сообщения, сводный статус которых изменился
+	StatusChanges []models.MessageStatusChange
+	// IsChannel — прочтение в канале: засчитывается как просмотр и другим подписчикам не рассылается
+	IsChannel bool
+}
+
+// MarkAsRead отмечает прочитанными сообщения чата до messageID включительно
+func (s *MessageService) MarkAsRead(ctx context.Context, messageID, userID uuid.UUID) (*ReadUpdate, error) {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, ErrMessageNotFound
+	}
+
+	chat, _, err := authorize(ctx, s.chatRepo, message.ChatID, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return s.markRead(ctx, chat, userID, &repository.MessageCursor{
+		CreatedAt: message.CreatedAt,
+		ID:        message.ID,
+	})
+}
+
+// MarkChatAsRead отмечает все сообщения в чате как прочитанные
+func (s *MessageService) MarkChatAsRead(ctx context.Context, chatID, userID uuid.UUID) (*ReadUpdate, error) {
+	chat, _, err := authorize(ctx, s.chatRepo, chatID, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return s.markRead(ctx, chat, userID, nil)
+}
+
+// markRead записывает прочтение и пересчитывает статусы прочитанных сообщений.
+// В каналах вместо статусов растёт число просмотров.
+func (s *MessageService) markRead(ctx context.Context, chat *models.Chat, userID uuid.UUID, upTo *repository.MessageCursor) (*ReadUpdate, error) {
+	read, err := s.messageRepo.MarkRead(ctx, chat.ID, userID, upTo)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &ReadUpdate{
+		ChatID:    chat.ID,
+		UserID:    userID,
+		ReadAt:    time.Now(),
+		Count:     len(read),
+		IsChannel: chat.Type == models.ChatTypeChannel,
+	}
+	if len(read) == 0 {
+		return update, nil
+	}
+	update.LastReadID = read[len(read)-1].ID
+
+	ids := make([]uuid.UUID, len(read))
+	for i := range read {
+		ids[i] = read[i].ID
+	}
+	if update.IsChannel {
+		if err := s.messageRepo.AddViews(ctx, ids); err != nil {
+			return nil, err
+		}
+		return update, nil
+	}
+	if update.StatusChanges, err = s.messageRepo.RefreshStatuses(ctx, ids); err != nil {
+		return nil, err
+	}
+
+	return update, nil
 }
 
-// UpdateMessageStatus обновляет статус сообщения
-func (s *MessageService) UpdateMessageStatus(ctx context.Context, messageID uuid.UUID, status models.MessageStatus) error {
-	return s.messageRepo.UpdateStatus(ctx, messageID, status)
+// MarkDelivered отмечает доставку сообщения пользователям, до устройств которых оно дошло.
+// Возвращает изменения сводного статуса для отправителя.
+func (s *MessageService) MarkDelivered(ctx context.Context, messageID uuid.UUID, userIDs []uuid.UUID) ([]models.MessageStatusChange, error) {
+	marked, err := s.messageRepo.MarkDelivered(ctx, messageID, userIDs)
+	if err != nil || marked == 0 {
+		return nil, err
+	}
+
+	return s.messageRepo.RefreshStatuses(ctx, []uuid.UUID{messageID})
 }
 
-// DeliverMessage обновляет статус сообщения на "delivered"
-func (s *MessageService) DeliverMessage(ctx context.Context, messageID uuid.UUID) error {
-	return s.messageRepo.UpdateStatus(ctx, messageID, models.MessageStatusDelivered)
+// MarkChatDelivered отмечает доставку пользователю сообщений чата messageIDs,
+// например страницы истории, отправленной при подписке
+func (s *MessageService) MarkChatDelivered(ctx context.Context, chatID, userID uuid.UUID, messageIDs []uuid.UUID) ([]models.MessageStatusChange, error) {
+	ids, err := s.messageRepo.MarkChatDelivered(ctx, chatID, userID, messageIDs)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	return s.messageRepo.RefreshStatuses(ctx, ids)
 }
 
-// ReadMessage обновляет статус сообщения на "read"
-func (s *MessageService) ReadMessage(ctx context.Context, messageID uuid.UUID) error {
-	return s.messageRepo.UpdateStatus(ctx, messageID, models.MessageStatusRead)
+// GetReceipts возвращает, кому доставлено и кем прочитано сообщение.
+// Доступно только отправителю.
+func (s *MessageService) GetReceipts(ctx context.Context, chatID, messageID, userID uuid.UUID) ([]models.MessageReceipt, error) {
+	if _, _, err := authorize(ctx, s.chatRepo, chatID, userID, ""); err != nil {
+		return nil, err
+	}
+
+	message, err := s.getChatMessage(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.SenderID != userID {
+		return nil, ErrNoPermission
+	}
+
+	receipts, err := s.messageRepo.GetReceipts(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.profiles.receipts(ctx, userID, receipts); err != nil {
+		return nil, err
+	}
+	return receipts, nil
 }
 
-// BroadcastReadStatus обновляет статусы всех сообщений от пользователя
-func (s *MessageService) BroadcastReadStatus(ctx context.Context, chatID, readerID uuid.UUID) error {
-	return s.messageRepo.MarkAsRead(ctx, chatID, readerID)
+// GetUnreadCount получает количество непрочитанных сообщений
+func (s *MessageService) GetUnreadCount(ctx context.Context, chatID, userID uuid.UUID) (int64, error) {
+	if _, _, err := authorize(ctx, s.chatRepo, chatID, userID, ""); err != nil {
+		return 0, err
+	}
+
+	return s.messageRepo.GetUnreadCount(ctx, chatID, userID)
 }
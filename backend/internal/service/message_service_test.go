@@ -0,0 +1,922 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"dildogram/backend/internal/config"
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// fakeMessageRepo хранит сообщения в памяти, отдаёт заданные прочитанные
+// сообщения и запоминает, чему засчитаны просмотры и у чего пересчитаны статусы
+type fakeMessageRepo struct {
+	repository.MessageRepository
+	messages  map[uuid.UUID]*models.Message
+	hiddenFor map[uuid.UUID][]uuid.UUID // Сообщения, удалённые пользователем у себя
+	read      []repository.MessageCursor
+	viewed    [][]uuid.UUID
+	refreshed [][]uuid.UUID
+	searched  []repository.MessageSearchQuery
+	// threadReads — до какого момента пользователь прочитал ветку
+	threadReads map[uuid.UUID]map[uuid.UUID]time.Time
+	// delivered — кому сообщение уже доставлено
+	delivered map[uuid.UUID][]uuid.UUID
+	// changes — что вернёт RefreshStatuses
+	changes []models.MessageStatusChange
+	// beforeCreate вызывается перед созданием сообщения, например чтобы
+	// изобразить параллельный запрос
+	beforeCreate func()
+}
+
+func newFakeMessageRepo() *fakeMessageRepo {
+	return &fakeMessageRepo{
+		messages:    make(map[uuid.UUID]*models.Message),
+		hiddenFor:   make(map[uuid.UUID][]uuid.UUID),
+		threadReads: make(map[uuid.UUID]map[uuid.UUID]time.Time),
+		delivered:   make(map[uuid.UUID][]uuid.UUID),
+	}
+}
+
+// addMessage добавляет текстовое сообщение, отправленное age назад
+func (r *fakeMessageRepo) addMessage(chatID, senderID uuid.UUID, age time.Duration) *models.Message {
+	message := &models.Message{
+		ID:          uuid.New(),
+		ChatID:      chatID,
+		SenderID:    senderID,
+		Content:     "hello",
+		MessageType: models.MessageTypeText,
+		CreatedAt:   time.Now().Add(-age),
+	}
+	r.messages[message.ID] = message
+	return message
+}
+
+// Create не создаёт сообщение, если у отправителя уже есть сообщение с тем же client_msg_id
+func (r *fakeMessageRepo) Create(ctx context.Context, message *models.Message) (bool, error) {
+	if r.beforeCreate != nil {
+		r.beforeCreate()
+	}
+	if message.ClientMsgID != nil {
+		if existing, _ := r.GetByClientMsgID(ctx, message.SenderID, *message.ClientMsgID); existing != nil {
+			return false, nil
+		}
+	}
+
+	message.ID = uuid.New()
+	message.CreatedAt = time.Now()
+	copied := *message
+	r.messages[message.ID] = &copied
+	return true, nil
+}
+
+func (r *fakeMessageRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Message, error) {
+	message, ok := r.messages[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *message
+	return &copied, nil
+}
+
+func (r *fakeMessageRepo) GetByClientMsgID(ctx context.Context, senderID uuid.UUID, clientMsgID string) (*models.Message, error) {
+	for _, message := range r.messages {
+		if message.SenderID == senderID && message.ClientMsgID != nil && *message.ClientMsgID == clientMsgID {
+			return r.GetByID(ctx, message.ID)
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeMessageRepo) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Message, error) {
+	var messages []models.Message
+	for _, id := range ids {
+		if message, ok := r.messages[id]; ok {
+			messages = append(messages, *message)
+		}
+	}
+	return messages, nil
+}
+
+func (r *fakeMessageRepo) CreateBatch(ctx context.Context, messages []models.Message) error {
+	for i := range messages {
+		messages[i].ID = uuid.New()
+		copied := messages[i]
+		r.messages[copied.ID] = &copied
+	}
+	return nil
+}
+
+func (r *fakeMessageRepo) Update(ctx context.Context, message *models.Message) error {
+	copied := *message
+	r.messages[message.ID] = &copied
+	return nil
+}
+
+// GetChatMessagesPage выбирает страницу по (created_at, id), как репозиторий
+func (r *fakeMessageRepo) GetChatMessagesPage(ctx context.Context, query repository.MessagePageQuery) ([]models.Message, bool, error) {
+	var messages []models.Message
+	for _, message := range r.messages {
+		if message.ChatID != query.ChatID || message.IsDeleted || slices.Contains(r.hiddenFor[query.UserID], message.ID) {
+			continue
+		}
+		if query.ThreadID != nil && (message.ThreadID == nil || *message.ThreadID != *query.ThreadID) {
+			continue
+		}
+		if query.Cursor != nil {
+			cmp := compareCursor(message, query.Cursor)
+			if query.Direction == repository.PageBefore {
+				cmp = -cmp
+			}
+			if cmp < 0 || (cmp == 0 && !query.Inclusive) {
+				continue
+			}
+		}
+		messages = append(messages, *message)
+	}
+
+	slices.SortFunc(messages, func(a, b models.Message) int {
+		return compareCursor(&a, &repository.MessageCursor{CreatedAt: b.CreatedAt, ID: b.ID})
+	})
+	if query.Direction == repository.PageBefore {
+		slices.Reverse(messages)
+	}
+
+	hasMore := len(messages) > query.Limit
+	if hasMore {
+		messages = messages[:query.Limit]
+	}
+	if query.Direction == repository.PageBefore {
+		slices.Reverse(messages)
+	}
+	return messages, hasMore, nil
+}
+
+// compareCursor сравнивает позицию сообщения с курсором
+func compareCursor(message *models.Message, cursor *repository.MessageCursor) int {
+	if c := message.CreatedAt.Compare(cursor.CreatedAt); c != 0 {
+		return c
+	}
+	return bytes.Compare(message.ID[:], cursor.ID[:])
+}
+
+// Search запоминает запрос; отбор по участию в чатах делает SQL репозитория
+func (r *fakeMessageRepo) Search(ctx context.Context, query repository.MessageSearchQuery) ([]models.MessageSearchResult, bool, error) {
+	r.searched = append(r.searched, query)
+	return []models.MessageSearchResult{}, false, nil
+}
+
+// GetThreadStats считает ответы в ветках; непрочитанные считает SQL репозитория
+func (r *fakeMessageRepo) GetThreadStats(ctx context.Context, threadIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]models.ThreadStats, error) {
+	stats := make(map[uuid.UUID]models.ThreadStats)
+	for _, message := range r.messages {
+		if message.ThreadID == nil || message.IsDeleted || !slices.Contains(threadIDs, *message.ThreadID) {
+			continue
+		}
+		thread := stats[*message.ThreadID]
+		thread.ReplyCount++
+		if message.CreatedAt.After(thread.LastReplyAt) {
+			thread.LastReplyAt = message.CreatedAt
+		}
+		stats[*message.ThreadID] = thread
+	}
+	return stats, nil
+}
+
+func (r *fakeMessageRepo) MarkThreadRead(ctx context.Context, threadID, userID uuid.UUID, readAt time.Time) error {
+	reads, ok := r.threadReads[threadID]
+	if !ok {
+		reads = make(map[uuid.UUID]time.Time)
+		r.threadReads[threadID] = reads
+	}
+	if readAt.After(reads[userID]) {
+		reads[userID] = readAt
+	}
+	return nil
+}
+
+func (r *fakeMessageRepo) DeleteForUser(ctx context.Context, messageID, userID uuid.UUID) error {
+	r.hiddenFor[userID] = append(r.hiddenFor[userID], messageID)
+	return nil
+}
+
+func (r *fakeMessageRepo) MarkRead(ctx context.Context, chatID, userID uuid.UUID, upTo *repository.MessageCursor) ([]repository.MessageCursor, error) {
+	read := r.read
+	// Повторное прочтение ничего не отмечает
+	r.read = nil
+	return read, nil
+}
+
+func (r *fakeMessageRepo) AddViews(ctx context.Context, messageIDs []uuid.UUID) error {
+	r.viewed = append(r.viewed, messageIDs)
+	return nil
+}
+
+func (r *fakeMessageRepo) MarkDelivered(ctx context.Context, messageID uuid.UUID, userIDs []uuid.UUID) (int64, error) {
+	var marked int64
+	for _, userID := range userIDs {
+		if !slices.Contains(r.delivered[messageID], userID) {
+			r.delivered[messageID] = append(r.delivered[messageID], userID)
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (r *fakeMessageRepo) RefreshStatuses(ctx context.Context, messageIDs []uuid.UUID) ([]models.MessageStatusChange, error) {
+	r.refreshed = append(r.refreshed, messageIDs)
+	return r.changes, nil
+}
+
+// unreadMessages возвращает курсоры n сообщений по возрастанию
+func unreadMessages(n int) []repository.MessageCursor {
+	now := time.Now()
+	cursors := make([]repository.MessageCursor, n)
+	for i := range cursors {
+		cursors[i] = repository.MessageCursor{CreatedAt: now.Add(time.Duration(i) * time.Second), ID: uuid.New()}
+	}
+	return cursors
+}
+
+func newReadTest(chatType models.ChatType, read []repository.MessageCursor) (*MessageService, *fakeMessageRepo, uuid.UUID, uuid.UUID) {
+	chatRepo := newFakeChatRepo()
+	userID := uuid.New()
+	chat := chatRepo.addChannel("", userID, models.MemberRoleMember)
+	chat.Type = chatType
+
+	messageRepo := newFakeMessageRepo()
+	messageRepo.read = read
+	return &MessageService{chatRepo: chatRepo, messageRepo: messageRepo}, messageRepo, chat.ID, userID
+}
+
+func TestMarkChatAsReadCountsChannelViews(t *testing.T) {
+	read := unreadMessages(3)
+	s, repo, chatID, userID := newReadTest(models.ChatTypeChannel, read)
+
+	update, err := s.MarkChatAsRead(context.Background(), chatID, userID)
+	if err != nil {
+		t.Fatalf("MarkChatAsRead() error = %v", err)
+	}
+
+	if !update.IsChannel {
+		t.Error("IsChannel = false, want true")
+	}
+	if update.Count != len(read) || update.LastReadID != read[len(read)-1].ID {
+		t.Errorf("Count = %d, LastReadID = %s, want %d, %s", update.Count, update.LastReadID, len(read), read[len(read)-1].ID)
+	}
+	if len(repo.viewed) != 1 || len(repo.viewed[0]) != len(read) {
+		t.Fatalf("AddViews calls = %v, want one call with %d messages", repo.viewed, len(read))
+	}
+	for i, id := range repo.viewed[0] {
+		if id != read[i].ID {
+			t.Errorf("viewed[%d] = %s, want %s", i, id, read[i].ID)
+		}
+	}
+	// В каналах статусы сообщений не ведутся
+	if len(repo.refreshed) != 0 {
+		t.Errorf("RefreshStatuses calls = %v, want none", repo.refreshed)
+	}
+}
+
+func TestMarkChatAsReadCountsViewOnce(t *testing.T) {
+	s, repo, chatID, userID := newReadTest(models.ChatTypeChannel, unreadMessages(2))
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.MarkChatAsRead(context.Background(), chatID, userID); err != nil {
+			t.Fatalf("MarkChatAsRead() error = %v", err)
+		}
+	}
+
+	// Повторное прочтение тех же сообщений просмотр не добавляет
+	if len(repo.viewed) != 1 {
+		t.Errorf("AddViews calls = %d, want 1", len(repo.viewed))
+	}
+}
+
+func TestMarkChatAsReadGroupRefreshesStatuses(t *testing.T) {
+	read := unreadMessages(2)
+	s, repo, chatID, userID := newReadTest(models.ChatTypeGroup, read)
+
+	update, err := s.MarkChatAsRead(context.Background(), chatID, userID)
+	if err != nil {
+		t.Fatalf("MarkChatAsRead() error = %v", err)
+	}
+
+	if update.IsChannel {
+		t.Error("IsChannel = true, want false")
+	}
+	if len(repo.viewed) != 0 {
+		t.Errorf("AddViews calls = %v, want none outside channels", repo.viewed)
+	}
+	if len(repo.refreshed) != 1 || len(repo.refreshed[0]) != len(read) {
+		t.Errorf("RefreshStatuses calls = %v, want one call with %d messages", repo.refreshed, len(read))
+	}
+}
+
+// fakeReactionRepo хранит реакции в памяти
+type fakeReactionRepo struct {
+	repository.ReactionRepository
+	reactions []models.MessageReaction
+}
+
+func (r *fakeReactionRepo) Add(ctx context.Context, reaction *models.MessageReaction) (bool, error) {
+	for _, existing := range r.reactions {
+		if existing.MessageID == reaction.MessageID && existing.UserID == reaction.UserID && existing.Emoji == reaction.Emoji {
+			return false, nil
+		}
+	}
+	r.reactions = append(r.reactions, *reaction)
+	return true, nil
+}
+
+func (r *fakeReactionRepo) CountByUser(ctx context.Context, messageID, userID uuid.UUID) (int64, error) {
+	var count int64
+	for _, reaction := range r.reactions {
+		if reaction.MessageID == messageID && reaction.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeReactionRepo) GetSummaries(ctx context.Context, messageIDs []uuid.UUID, viewerID uuid.UUID) (map[uuid.UUID][]models.ReactionCount, error) {
+	summaries := make(map[uuid.UUID][]models.ReactionCount)
+	for _, reaction := range r.reactions {
+		if !slices.Contains(messageIDs, reaction.MessageID) {
+			continue
+		}
+		counts := summaries[reaction.MessageID]
+		i := slices.IndexFunc(counts, func(c models.ReactionCount) bool { return c.Emoji == reaction.Emoji })
+		if i < 0 {
+			counts = append(counts, models.ReactionCount{Emoji: reaction.Emoji})
+			i = len(counts) - 1
+		}
+		counts[i].Count++
+		counts[i].Reacted = counts[i].Reacted || reaction.UserID == viewerID
+		summaries[reaction.MessageID] = counts
+	}
+	return summaries, nil
+}
+
+// userPair упорядоченная пара пользователей: кто и кого
+type userPair struct {
+	userID, otherID uuid.UUID
+}
+
+// fakeBlockRepo считает заблокированными заданные личные чаты и пары пользователей
+type fakeBlockRepo struct {
+	repository.BlockRepository
+	blockedChats map[uuid.UUID]bool
+	blocked      map[userPair]bool
+}
+
+func newFakeBlockRepo() *fakeBlockRepo {
+	return &fakeBlockRepo{
+		blockedChats: make(map[uuid.UUID]bool),
+		blocked:      make(map[userPair]bool),
+	}
+}
+
+func (r *fakeBlockRepo) IsBlockedInPrivateChat(ctx context.Context, chatID, userID uuid.UUID) (bool, error) {
+	return r.blockedChats[chatID], nil
+}
+
+func (r *fakeBlockRepo) FilterBlockers(ctx context.Context, blockerIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]bool, error) {
+	blockers := make(map[uuid.UUID]bool)
+	for _, id := range blockerIDs {
+		if r.blocked[userPair{id, userID}] {
+			blockers[id] = true
+		}
+	}
+	return blockers, nil
+}
+
+// messageTest сервис сообщений поверх чатов, сообщений и блокировок в памяти
+type messageTest struct {
+	service   *MessageService
+	chats     *fakeChatRepo
+	messages  *fakeMessageRepo
+	reactions *fakeReactionRepo
+	blocks    *fakeBlockRepo
+}
+
+func newMessageTest() *messageTest {
+	cfg := &config.Config{}
+	cfg.Message.EditWindowDur = 48 * time.Hour
+
+	tt := &messageTest{
+		chats:     newFakeChatRepo(),
+		messages:  newFakeMessageRepo(),
+		reactions: &fakeReactionRepo{},
+		blocks:    newFakeBlockRepo(),
+	}
+	tt.service = NewMessageService(tt.messages, tt.chats, nil, tt.reactions, nil, tt.blocks, cfg)
+	return tt
+}
+
+func TestUpdateMessageEditWindow(t *testing.T) {
+	tt := newMessageTest()
+	alice, bob := uuid.New(), uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice, bob)
+
+	fresh := tt.messages.addMessage(chat.ID, alice, time.Hour)
+	stale := tt.messages.addMessage(chat.ID, alice, 49*time.Hour)
+
+	edited, err := tt.service.UpdateMessage(context.Background(), chat.ID, fresh.ID, alice, "edited")
+	if err != nil {
+		t.Fatalf("UpdateMessage() error = %v", err)
+	}
+	if edited.Content != "edited" || !edited.IsEdited {
+		t.Errorf("edited = %q, IsEdited %v; want \"edited\", true", edited.Content, edited.IsEdited)
+	}
+
+	if _, err := tt.service.UpdateMessage(context.Background(), chat.ID, stale.ID, alice, "edited"); !errors.Is(err, ErrEditWindowExpired) {
+		t.Errorf("UpdateMessage(stale) error = %v, want ErrEditWindowExpired", err)
+	}
+	if tt.messages.messages[stale.ID].IsEdited {
+		t.Error("stale message was edited")
+	}
+
+	// Чужое сообщение не редактируется даже в пределах окна
+	if _, err := tt.service.UpdateMessage(context.Background(), chat.ID, fresh.ID, bob, "edited"); !errors.Is(err, ErrNoPermission) {
+		t.Errorf("UpdateMessage(not sender) error = %v, want ErrNoPermission", err)
+	}
+}
+
+func TestDeleteMessageForMe(t *testing.T) {
+	tt := newMessageTest()
+	alice, bob := uuid.New(), uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice, bob)
+	message := tt.messages.addMessage(chat.ID, alice, time.Minute)
+
+	// Удалить у себя можно и чужое сообщение, у остальных оно остаётся
+	if _, err := tt.service.DeleteMessage(context.Background(), chat.ID, message.ID, bob, false); err != nil {
+		t.Fatalf("DeleteMessage(for me) error = %v", err)
+	}
+	if hidden := tt.messages.hiddenFor[bob]; len(hidden) != 1 || hidden[0] != message.ID {
+		t.Errorf("hidden for bob = %v, want %s", hidden, message.ID)
+	}
+	if tt.messages.messages[message.ID].IsDeleted {
+		t.Error("message was deleted for everyone")
+	}
+}
+
+func TestDeleteMessageForEveryone(t *testing.T) {
+	tt := newMessageTest()
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice, bob, carol)
+	chat.DefaultPermissions.DeleteMessages = false
+	message := tt.messages.addMessage(chat.ID, bob, time.Minute)
+
+	// Участник без права удалять чужие сообщения не удаляет их у всех
+	if _, err := tt.service.DeleteMessage(context.Background(), chat.ID, message.ID, carol, true); !errors.Is(err, ErrNoPermission) {
+		t.Fatalf("DeleteMessage(other member) error = %v, want ErrNoPermission", err)
+	}
+	if tt.messages.messages[message.ID].IsDeleted {
+		t.Fatal("message was deleted by member without permission")
+	}
+
+	// Владелец может
+	deleted, err := tt.service.DeleteMessage(context.Background(), chat.ID, message.ID, alice, true)
+	if err != nil {
+		t.Fatalf("DeleteMessage(owner) error = %v", err)
+	}
+	if !deleted.IsDeleted || deleted.DeletedAt == nil {
+		t.Error("message is not marked deleted")
+	}
+	if stored := tt.messages.messages[message.ID]; !stored.IsDeleted || stored.MediaURL != nil {
+		t.Errorf("stored message = %+v, want deleted without media", stored)
+	}
+	if len(tt.messages.hiddenFor) != 0 {
+		t.Errorf("hidden = %v, want none for deletion for everyone", tt.messages.hiddenFor)
+	}
+
+	// Удалённое сообщение больше не редактируется
+	if _, err := tt.service.UpdateMessage(context.Background(), chat.ID, message.ID, bob, "edited"); !errors.Is(err, ErrMessageDeleted) {
+		t.Errorf("UpdateMessage(deleted) error = %v, want ErrMessageDeleted", err)
+	}
+}
+
+// pageIDs возвращает ID сообщений страницы
+func pageIDs(page *MessagePage) []uuid.UUID {
+	ids := make([]uuid.UUID, len(page.Messages))
+	for i := range page.Messages {
+		ids[i] = page.Messages[i].ID
+	}
+	return ids
+}
+
+func TestGetMessagesPageBoundaries(t *testing.T) {
+	tt := newMessageTest()
+	alice := uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice)
+
+	// m[0] — самое старое сообщение, m[4] — самое новое
+	m := make([]uuid.UUID, 5)
+	for i := range m {
+		m[i] = tt.messages.addMessage(chat.ID, alice, time.Duration(len(m)-i)*time.Minute).ID
+	}
+
+	tests := []struct {
+		name          string
+		params        MessagePageParams
+		want          []uuid.UUID
+		hasMoreBefore bool
+		hasMoreAfter  bool
+	}{
+		{"latest", MessagePageParams{Limit: 2}, m[3:5], true, false},
+		{"before", MessagePageParams{Before: &m[3], Limit: 2}, m[1:3], true, true},
+		{"before reaches start", MessagePageParams{Before: &m[2], Limit: 2}, m[0:2], false, true},
+		{"before oldest", MessagePageParams{Before: &m[0], Limit: 2}, nil, false, true},
+		{"after", MessagePageParams{After: &m[0], Limit: 2}, m[1:3], true, true},
+		{"after reaches end", MessagePageParams{After: &m[2], Limit: 2}, m[3:5], true, false},
+		{"after newest", MessagePageParams{After: &m[4], Limit: 2}, nil, true, false},
+		{"around", MessagePageParams{Around: &m[2], Limit: 4}, m[0:4], false, true},
+		{"around oldest", MessagePageParams{Around: &m[0], Limit: 4}, m[0:4], false, true},
+		{"around newest", MessagePageParams{Around: &m[4], Limit: 4}, m[2:5], true, false},
+	}
+
+	for _, tc := range tests {
+		page, err := tt.service.GetMessagesPage(context.Background(), chat.ID, alice, tc.params)
+		if err != nil {
+			t.Fatalf("%s: GetMessagesPage() error = %v", tc.name, err)
+		}
+		if got := pageIDs(page); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: messages = %v, want %v", tc.name, got, tc.want)
+		}
+		if page.HasMoreBefore != tc.hasMoreBefore || page.HasMoreAfter != tc.hasMoreAfter {
+			t.Errorf("%s: has more before/after = %v/%v, want %v/%v",
+				tc.name, page.HasMoreBefore, page.HasMoreAfter, tc.hasMoreBefore, tc.hasMoreAfter)
+		}
+		if len(tc.want) > 0 && (*page.BeforeCursor != tc.want[0] || *page.AfterCursor != tc.want[len(tc.want)-1]) {
+			t.Errorf("%s: cursors = %s..%s, want %s..%s",
+				tc.name, *page.BeforeCursor, *page.AfterCursor, tc.want[0], tc.want[len(tc.want)-1])
+		}
+	}
+}
+
+func TestGetMessagesPageRejectsForeignCursor(t *testing.T) {
+	tt := newMessageTest()
+	alice := uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice)
+	other := tt.chats.addChat(models.ChatTypeGroup, alice)
+	foreign := tt.messages.addMessage(other.ID, alice, time.Minute)
+
+	_, err := tt.service.GetMessagesPage(context.Background(), chat.ID, alice, MessagePageParams{Before: &foreign.ID})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("GetMessagesPage() error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestSearchMessagesOnlyInUserChats(t *testing.T) {
+	tt := newMessageTest()
+	alice, bob := uuid.New(), uuid.New()
+	shared := tt.chats.addChat(models.ChatTypeGroup, alice, bob)
+	foreign := tt.chats.addChat(models.ChatTypeGroup, bob)
+	foreignMessage := tt.messages.addMessage(foreign.ID, bob, time.Minute)
+
+	// Поиск по всем чатам ограничен чатами пользователя
+	if _, err := tt.service.SearchMessages(context.Background(), alice, MessageSearchParams{Query: "hello"}); err != nil {
+		t.Fatalf("SearchMessages() error = %v", err)
+	}
+	if len(tt.messages.searched) != 1 || tt.messages.searched[0].UserID != alice {
+		t.Fatalf("search queries = %+v, want one for alice", tt.messages.searched)
+	}
+
+	if _, err := tt.service.SearchMessages(context.Background(), alice, MessageSearchParams{Query: "hello", ChatID: &shared.ID}); err != nil {
+		t.Fatalf("SearchMessages(shared chat) error = %v", err)
+	}
+
+	// Чужой чат и курсор из него не выдают его содержимое
+	if _, err := tt.service.SearchMessages(context.Background(), alice, MessageSearchParams{Query: "hello", ChatID: &foreign.ID}); !errors.Is(err, ErrNotMember) {
+		t.Errorf("SearchMessages(foreign chat) error = %v, want ErrNotMember", err)
+	}
+	if _, err := tt.service.SearchMessages(context.Background(), alice, MessageSearchParams{Query: "hello", Cursor: &foreignMessage.ID}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("SearchMessages(foreign cursor) error = %v, want ErrInvalidCursor", err)
+	}
+	if len(tt.messages.searched) != 2 {
+		t.Errorf("search queries = %d, want 2", len(tt.messages.searched))
+	}
+}
+
+func TestIsEmoji(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"👍", true},
+		{"❤️", true},      // С селектором варианта
+		{"👍🏽", true},      // С тоном кожи
+		{"👨‍👩‍👧", true},   // ZWJ-последовательность
+		{"🇷🇺", true},      // Флаг
+		{"🏴󠁧󠁢󠁳󠁣󠁴󠁿", true}, // Флаг с тегами
+		{"1️⃣", true},     // Keycap
+		{"👍👍", true},
+		{"", false},
+		{"a", false},
+		{"1", false},
+		{"🏽", false}, // Только модификатор
+		{"👍a", false},
+		{"<b>👍</b>", false},
+		{"👍👍👍👍👍👍👍👍👍👍👍", false}, // Длиннее 10 символов
+		{"\xff", false},
+	}
+
+	for _, tt := range tests {
+		if got := isEmoji(tt.value); got != tt.want {
+			t.Errorf("isEmoji(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestAddReactionLimitsReactionsPerUser(t *testing.T) {
+	tt := newMessageTest()
+	alice, bob := uuid.New(), uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice, bob)
+	message := tt.messages.addMessage(chat.ID, bob, time.Minute)
+	ctx := context.Background()
+
+	if _, err := tt.service.AddReaction(ctx, chat.ID, message.ID, alice, "hi"); !errors.Is(err, ErrInvalidReaction) {
+		t.Fatalf("AddReaction(text) error = %v, want ErrInvalidReaction", err)
+	}
+
+	emojis := []string{"👍", "❤️", "🔥", "😂"}
+	for _, emoji := range emojis[:maxReactionsPerUser] {
+		update, err := tt.service.AddReaction(ctx, chat.ID, message.ID, alice, emoji)
+		if err != nil {
+			t.Fatalf("AddReaction(%s) error = %v", emoji, err)
+		}
+		if !update.Added || !update.Changed {
+			t.Errorf("AddReaction(%s) = added %v, changed %v; want both", emoji, update.Added, update.Changed)
+		}
+	}
+
+	if _, err := tt.service.AddReaction(ctx, chat.ID, message.ID, alice, emojis[maxReactionsPerUser]); !errors.Is(err, ErrTooManyReactions) {
+		t.Fatalf("AddReaction() over limit error = %v, want ErrTooManyReactions", err)
+	}
+
+	// Ограничение действует на каждого пользователя отдельно
+	update, err := tt.service.AddReaction(ctx, chat.ID, message.ID, bob, emojis[0])
+	if err != nil {
+		t.Fatalf("AddReaction(bob) error = %v", err)
+	}
+	if len(update.Reactions) != maxReactionsPerUser || update.Reactions[0].Count != 2 {
+		t.Errorf("reactions = %+v, want %d emojis with 2 × %s", update.Reactions, maxReactionsPerUser, emojis[0])
+	}
+}
+
+func TestRepliesJoinRootThread(t *testing.T) {
+	tt := newMessageTest()
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice, bob, carol)
+	root := tt.messages.addMessage(chat.ID, bob, time.Minute)
+	ctx := context.Background()
+
+	reply, _, err := tt.service.SendMessage(ctx, chat.ID, alice, "reply", models.MessageTypeText, nil, &root.ID, nil)
+	if err != nil {
+		t.Fatalf("SendMessage(reply) error = %v", err)
+	}
+	if reply.ThreadID == nil || *reply.ThreadID != root.ID {
+		t.Fatalf("reply ThreadID = %v, want %s", reply.ThreadID, root.ID)
+	}
+
+	// Ответ на ответ остаётся в ветке корня: ветки не вкладываются
+	nested, _, err := tt.service.SendMessage(ctx, chat.ID, carol, "nested", models.MessageTypeText, nil, &reply.ID, nil)
+	if err != nil {
+		t.Fatalf("SendMessage(nested reply) error = %v", err)
+	}
+	if nested.ThreadID == nil || *nested.ThreadID != root.ID {
+		t.Fatalf("nested reply ThreadID = %v, want %s", nested.ThreadID, root.ID)
+	}
+	if *nested.ReplyToID != reply.ID {
+		t.Errorf("nested reply ReplyToID = %s, want %s", *nested.ReplyToID, reply.ID)
+	}
+
+	// За веткой следят автор корня и все ответившие
+	for _, userID := range []uuid.UUID{alice, bob, carol} {
+		if _, ok := tt.messages.threadReads[root.ID][userID]; !ok {
+			t.Errorf("user %s does not follow the thread", userID)
+		}
+	}
+}
+
+func TestGetThreadReturnsRepliesWithStats(t *testing.T) {
+	tt := newMessageTest()
+	alice, bob := uuid.New(), uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice, bob)
+	root := tt.messages.addMessage(chat.ID, bob, time.Hour)
+	tt.messages.addMessage(chat.ID, alice, time.Minute)
+
+	var replies []uuid.UUID
+	for _, age := range []time.Duration{30 * time.Minute, 10 * time.Minute} {
+		reply := tt.messages.addMessage(chat.ID, alice, age)
+		reply.ThreadID = &root.ID
+		replies = append(replies, reply.ID)
+	}
+
+	thread, err := tt.service.GetThread(context.Background(), chat.ID, root.ID, bob, MessagePageParams{})
+	if err != nil {
+		t.Fatalf("GetThread() error = %v", err)
+	}
+	if got := pageIDs(&thread.MessagePage); !slices.Equal(got, replies) {
+		t.Errorf("replies = %v, want %v", got, replies)
+	}
+	if thread.Root.ID != root.ID || thread.Root.Thread == nil {
+		t.Fatalf("root = %s with stats %v, want %s with stats", thread.Root.ID, thread.Root.Thread, root.ID)
+	}
+	last := tt.messages.messages[replies[1]].CreatedAt
+	if thread.Root.Thread.ReplyCount != 2 || !thread.Root.Thread.LastReplyAt.Equal(last) {
+		t.Errorf("thread stats = %+v, want 2 replies, last at %v", *thread.Root.Thread, last)
+	}
+}
+
+func TestThreadRootCannotBeReply(t *testing.T) {
+	tt := newMessageTest()
+	alice := uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice)
+	root := tt.messages.addMessage(chat.ID, alice, time.Hour)
+	reply := tt.messages.addMessage(chat.ID, alice, time.Minute)
+	reply.ThreadID = &root.ID
+
+	if _, err := tt.service.GetThread(context.Background(), chat.ID, reply.ID, alice, MessagePageParams{}); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("GetThread(reply) error = %v, want ErrMessageNotFound", err)
+	}
+	if err := tt.service.MarkThreadRead(context.Background(), chat.ID, reply.ID, alice); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("MarkThreadRead(reply) error = %v, want ErrMessageNotFound", err)
+	}
+	if len(tt.messages.threadReads) != 0 {
+		t.Errorf("thread reads = %v, want none", tt.messages.threadReads)
+	}
+}
+
+func TestForwardMessagesFromProtectedChat(t *testing.T) {
+	tt := newMessageTest()
+	alice, bob := uuid.New(), uuid.New()
+	source := tt.chats.addChat(models.ChatTypeGroup, bob, alice)
+	target := tt.chats.addChat(models.ChatTypeGroup, alice)
+	message := tt.messages.addMessage(source.ID, bob, time.Minute)
+	ctx := context.Background()
+
+	copies, err := tt.service.ForwardMessages(ctx, alice, source.ID, []uuid.UUID{message.ID}, []uuid.UUID{target.ID})
+	if err != nil {
+		t.Fatalf("ForwardMessages() error = %v", err)
+	}
+	if len(copies) != 1 || copies[0].ChatID != target.ID || *copies[0].ForwardedFromMessageID != message.ID || *copies[0].ForwardedFromUserID != bob {
+		t.Fatalf("copies = %+v, want one copy of %s in %s", copies, message.ID, target.ID)
+	}
+
+	// После включения защиты содержимого пересылка из чата запрещена
+	source.ProtectedContent = true
+	stored := len(tt.messages.messages)
+	if _, err := tt.service.ForwardMessages(ctx, alice, source.ID, []uuid.UUID{message.ID}, []uuid.UUID{target.ID}); !errors.Is(err, ErrForwardRestricted) {
+		t.Fatalf("ForwardMessages(protected) error = %v, want ErrForwardRestricted", err)
+	}
+	// Даже владельцу
+	if _, err := tt.service.ForwardMessages(ctx, bob, source.ID, []uuid.UUID{message.ID}, []uuid.UUID{source.ID}); !errors.Is(err, ErrForwardRestricted) {
+		t.Fatalf("ForwardMessages(protected, owner) error = %v, want ErrForwardRestricted", err)
+	}
+	if len(tt.messages.messages) != stored {
+		t.Errorf("%d messages stored, want %d", len(tt.messages.messages), stored)
+	}
+
+	// Защита чата-получателя пересылке в него не мешает
+	source.ProtectedContent = false
+	target.ProtectedContent = true
+	if _, err := tt.service.ForwardMessages(ctx, alice, source.ID, []uuid.UUID{message.ID}, []uuid.UUID{target.ID}); err != nil {
+		t.Errorf("ForwardMessages(into protected) error = %v", err)
+	}
+}
+
+func TestMarkDeliveredRefreshesOnlyNewDeliveries(t *testing.T) {
+	tt := newMessageTest()
+	alice, bob := uuid.New(), uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice, bob)
+	message := tt.messages.addMessage(chat.ID, alice, time.Minute)
+	change := models.MessageStatusChange{MessageID: message.ID, ChatID: chat.ID, SenderID: alice, Status: models.MessageStatusDelivered}
+	tt.messages.changes = []models.MessageStatusChange{change}
+
+	changes, err := tt.service.MarkDelivered(context.Background(), message.ID, []uuid.UUID{bob})
+	if err != nil {
+		t.Fatalf("MarkDelivered() error = %v", err)
+	}
+	if len(changes) != 1 || changes[0] != change {
+		t.Errorf("MarkDelivered() = %+v, want %+v", changes, change)
+	}
+
+	// Повторная доставка на другое устройство статус не пересчитывает
+	changes, err = tt.service.MarkDelivered(context.Background(), message.ID, []uuid.UUID{bob})
+	if err != nil {
+		t.Fatalf("MarkDelivered() error = %v", err)
+	}
+	if len(changes) != 0 || len(tt.messages.refreshed) != 1 {
+		t.Errorf("repeated MarkDelivered() = %+v after %d refreshes, want no changes after 1", changes, len(tt.messages.refreshed))
+	}
+}
+
+func TestSendMessageDeduplicatesRetries(t *testing.T) {
+	tt := newMessageTest()
+	alice, bob := uuid.New(), uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice, bob)
+	other := tt.chats.addChat(models.ChatTypeGroup, alice)
+	clientMsgID := "c-1"
+	ctx := context.Background()
+
+	first, created, err := tt.service.SendMessage(ctx, chat.ID, alice, "hello", models.MessageTypeText, nil, nil, &clientMsgID)
+	if err != nil || !created {
+		t.Fatalf("SendMessage() = created %v, error %v; want created", created, err)
+	}
+
+	// Повтор после обрыва связи возвращает уже созданное сообщение
+	retry, created, err := tt.service.SendMessage(ctx, chat.ID, alice, "hello", models.MessageTypeText, nil, nil, &clientMsgID)
+	if err != nil || created {
+		t.Fatalf("retry SendMessage() = created %v, error %v; want existing", created, err)
+	}
+	if retry.ID != first.ID || len(tt.messages.messages) != 1 {
+		t.Fatalf("retry = %s with %d messages stored, want %s with 1", retry.ID, len(tt.messages.messages), first.ID)
+	}
+
+	// Тот же ID в другом чате — ошибка клиента, а не повтор
+	if _, _, err := tt.service.SendMessage(ctx, other.ID, alice, "hello", models.MessageTypeText, nil, nil, &clientMsgID); !errors.Is(err, ErrClientMsgIDReused) {
+		t.Errorf("SendMessage(other chat) error = %v, want ErrClientMsgIDReused", err)
+	}
+
+	// ID уникален только в пределах отправителя
+	if _, created, err := tt.service.SendMessage(ctx, chat.ID, bob, "hello", models.MessageTypeText, nil, nil, &clientMsgID); err != nil || !created {
+		t.Errorf("SendMessage(bob) = created %v, error %v; want created", created, err)
+	}
+}
+
+func TestSendMessageDeduplicatesConcurrentRetry(t *testing.T) {
+	tt := newMessageTest()
+	alice := uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice)
+	clientMsgID := "c-1"
+
+	// Параллельный повтор успевает создать сообщение между проверкой и вставкой
+	raced := &models.Message{ID: uuid.New(), ChatID: chat.ID, SenderID: alice, Content: "hello", ClientMsgID: &clientMsgID, CreatedAt: time.Now()}
+	tt.messages.beforeCreate = func() {
+		tt.messages.messages[raced.ID] = raced
+	}
+
+	message, created, err := tt.service.SendMessage(context.Background(), chat.ID, alice, "hello", models.MessageTypeText, nil, nil, &clientMsgID)
+	if err != nil || created {
+		t.Fatalf("SendMessage() = created %v, error %v; want existing", created, err)
+	}
+	if message.ID != raced.ID || len(tt.messages.messages) != 1 {
+		t.Errorf("SendMessage() = %s with %d messages stored, want %s with 1", message.ID, len(tt.messages.messages), raced.ID)
+	}
+}
+
+func TestSendMessageValidatesClientMsgID(t *testing.T) {
+	tt := newMessageTest()
+	alice := uuid.New()
+	chat := tt.chats.addChat(models.ChatTypeGroup, alice)
+
+	for _, clientMsgID := range []string{"", strings.Repeat("x", maxClientMsgIDLength+1)} {
+		_, _, err := tt.service.SendMessage(context.Background(), chat.ID, alice, "hello", models.MessageTypeText, nil, nil, &clientMsgID)
+		if !errors.Is(err, ErrInvalidClientMsgID) {
+			t.Errorf("SendMessage(%d chars) error = %v, want ErrInvalidClientMsgID", len(clientMsgID), err)
+		}
+	}
+}
+
+func TestBlockedPrivateChatRejectsWrites(t *testing.T) {
+	tt := newMessageTest()
+	alice, bob := uuid.New(), uuid.New()
+	private := tt.chats.addChat(models.ChatTypePrivate, alice, bob)
+	group := tt.chats.addChat(models.ChatTypeGroup, alice, bob)
+	message := tt.messages.addMessage(private.ID, alice, time.Minute)
+	forwarded := tt.messages.addMessage(group.ID, bob, time.Minute)
+	ctx := context.Background()
+
+	tt.blocks.blockedChats[private.ID] = true
+	stored := len(tt.messages.messages)
+
+	if _, _, err := tt.service.SendMessage(ctx, private.ID, alice, "hello", models.MessageTypeText, nil, nil, nil); !errors.Is(err, ErrUserBlocked) {
+		t.Errorf("SendMessage() error = %v, want ErrUserBlocked", err)
+	}
+	if _, err := tt.service.UpdateMessage(ctx, private.ID, message.ID, alice, "edited"); !errors.Is(err, ErrUserBlocked) {
+		t.Errorf("UpdateMessage() error = %v, want ErrUserBlocked", err)
+	}
+	if _, err := tt.service.AddReaction(ctx, private.ID, message.ID, bob, "👍"); !errors.Is(err, ErrUserBlocked) {
+		t.Errorf("AddReaction() error = %v, want ErrUserBlocked", err)
+	}
+	if _, err := tt.service.ForwardMessages(ctx, bob, group.ID, []uuid.UUID{forwarded.ID}, []uuid.UUID{group.ID, private.ID}); !errors.Is(err, ErrUserBlocked) {
+		t.Errorf("ForwardMessages() error = %v, want ErrUserBlocked", err)
+	}
+	if len(tt.messages.messages) != stored || tt.messages.messages[message.ID].IsEdited {
+		t.Errorf("blocked chat was written to: %d messages stored, want %d", len(tt.messages.messages), stored)
+	}
+
+	// Группы с теми же участниками блокировка не касается
+	if _, _, err := tt.service.SendMessage(ctx, group.ID, alice, "hello", models.MessageTypeText, nil, nil, nil); err != nil {
+		t.Errorf("SendMessage(group) error = %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// publicProfiles заполняет в ответах профили пользователей, какими их видит
+// запросивший. Модели User наружу не отдаются: телефон, фото и присутствие
+// видны только с учётом настроек приватности и блокировок.
+type publicProfiles struct {
+	contactRepo repository.ContactRepository
+	blockRepo   repository.BlockRepository
+}
+
+// load собирает профили users для viewerID по ID пользователя. nil пропускаются.
+func (p publicProfiles) load(ctx context.Context, viewerID uuid.UUID, users []*models.User) (map[uuid.UUID]*models.PublicUser, error) {
+	byID := make(map[uuid.UUID]*models.User, len(users))
+	ids := make([]uuid.UUID, 0, len(users))
+	for _, user := range users {
+		if user == nil {
+			continue
+		}
+		if _, ok := byID[user.ID]; !ok {
+			byID[user.ID] = user
+			ids = append(ids, user.ID)
+		}
+	}
+
+	profiles := make(map[uuid.UUID]*models.PublicUser, len(ids))
+	if len(ids) == 0 {
+		return profiles, nil
+	}
+
+	access, err := loadProfileAccess(ctx, p.contactRepo, p.blockRepo, viewerID, ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, user := range byID {
+		public := toPublicUser(user, viewerID, access[id])
+		profiles[id] = &public
+	}
+	return profiles, nil
+}
+
+// profileOf возвращает профиль user из profiles или nil
+func profileOf(profiles map[uuid.UUID]*models.PublicUser, user *models.User) *models.PublicUser {
+	if user == nil {
+		return nil
+	}
+	return profiles[user.ID]
+}
+
+// chat заполняет профили создателя и участников чата
+func (p publicProfiles) chat(ctx context.Context, viewerID uuid.UUID, chat *models.Chat) error {
+	if chat == nil {
+		return nil
+	}
+
+	users := make([]*models.User, 0, len(chat.Members)+1)
+	users = append(users, chat.Creator)
+	for i := range chat.Members {
+		users = append(users, chat.Members[i].User)
+	}
+	profiles, err := p.load(ctx, viewerID, users)
+	if err != nil {
+		return err
+	}
+
+	chat.CreatorProfile = profileOf(profiles, chat.Creator)
+	for i := range chat.Members {
+		chat.Members[i].UserProfile = profileOf(profiles, chat.Members[i].User)
+	}
+	return nil
+}
+
+// members заполняет профили участников
+func (p publicProfiles) members(ctx context.Context, viewerID uuid.UUID, members []models.ChatMembership) error {
+	users := make([]*models.User, len(members))
+	for i := range members {
+		users[i] = members[i].User
+	}
+	profiles, err := p.load(ctx, viewerID, users)
+	if err != nil {
+		return err
+	}
+
+	for i := range members {
+		members[i].UserProfile = profileOf(profiles, members[i].User)
+	}
+	return nil
+}
+
+// member заполняет профиль участника
+func (p publicProfiles) member(ctx context.Context, viewerID uuid.UUID, member *models.ChatMembership) error {
+	profiles, err := p.load(ctx, viewerID, []*models.User{member.User})
+	if err != nil {
+		return err
+	}
+	member.UserProfile = profileOf(profiles, member.User)
+	return nil
+}
+
+// messages заполняет профили отправителей и авторов пересланных сообщений
+func (p publicProfiles) messages(ctx context.Context, viewerID uuid.UUID, messages ...*models.Message) error {
+	users := make([]*models.User, 0, len(messages)*2)
+	for _, message := range messages {
+		users = append(users, message.Sender, message.ForwardedFromUser)
+	}
+	profiles, err := p.load(ctx, viewerID, users)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		message.SenderProfile = profileOf(profiles, message.Sender)
+		message.ForwardedFromProfile = profileOf(profiles, message.ForwardedFromUser)
+	}
+	return nil
+}
+
+// messageList заполняет профили в списке сообщений
+func (p publicProfiles) messageList(ctx context.Context, viewerID uuid.UUID, messages []models.Message) error {
+	ptrs := make([]*models.Message, len(messages))
+	for i := range messages {
+		ptrs[i] = &messages[i]
+	}
+	return p.messages(ctx, viewerID, ptrs...)
+}
+
+// reactions заполняет профили поставивших реакции
+func (p publicProfiles) reactions(ctx context.Context, viewerID uuid.UUID, reactions []models.MessageReaction) error {
+	users := make([]*models.User, len(reactions))
+	for i := range reactions {
+		users[i] = reactions[i].User
+	}
+	profiles, err := p.load(ctx, viewerID, users)
+	if err != nil {
+		return err
+	}
+
+	for i := range reactions {
+		reactions[i].UserProfile = profileOf(profiles, reactions[i].User)
+	}
+	return nil
+}
+
+// receipts заполняет профили получателей
+func (p publicProfiles) receipts(ctx context.Context, viewerID uuid.UUID, receipts []models.MessageReceipt) error {
+	users := make([]*models.User, len(receipts))
+	for i := range receipts {
+		users[i] = receipts[i].User
+	}
+	profiles, err := p.load(ctx, viewerID, users)
+	if err != nil {
+		return err
+	}
+
+	for i := range receipts {
+		receipts[i].UserProfile = profileOf(profiles, receipts[i].User)
+	}
+	return nil
+}
+
+// invites заполняет профили создателей ссылок
+func (p publicProfiles) invites(ctx context.Context, viewerID uuid.UUID, invites ...*models.ChatInvite) error {
+	users := make([]*models.User, len(invites))
+	for i, invite := range invites {
+		users[i] = invite.Creator
+	}
+	profiles, err := p.load(ctx, viewerID, users)
+	if err != nil {
+		return err
+	}
+
+	for _, invite := range invites {
+		invite.CreatorProfile = profileOf(profiles, invite.Creator)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"dildogram/backend/internal/config"
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidSyncState = errors.New("since and channel_pts must not be negative")
+
+const (
+	// Сколько обновлений отдаётся за один запрос синхронизации
+	defaultSyncLimit = 100
+	maxSyncLimit     = 1000
+
+	// Как часто удаляются обновления старше срока хранения
+	syncCleanupPeriod = 10 * time.Minute
+)
+
+// SyncResult результат синхронизации.
+// Seq — номер, с которого клиент продолжает следующую синхронизацию.
+// TooFarBehind — пропущенные обновления недоступны или их слишком много:
+// клиент перезагружает чаты целиком и продолжает с Seq.
+// Channels — каналы, в которых что-то изменилось после отметки клиента:
+// их историю клиент догружает сам. ChannelPts — отметка для следующего запроса.
+type SyncResult struct {
+	Seq          int64
+	Updates      []models.Update
+	HasMore      bool
+	TooFarBehind bool
+	ChannelPts   int64
+	Channels     []uuid.UUID
+}
+
+// SyncService ведёт журнал обновлений пользователей
+type SyncService struct {
+	updateRepo repository.UpdateRepository
+	config     *config.Config
+}
+
+// NewSyncService создаёт новый SyncService
+func NewSyncService(updateRepo repository.UpdateRepository, cfg *config.Config) *SyncService {
+	return &SyncService{
+		updateRepo: updateRepo,
+		config:     cfg,
+	}
+}
+
+// RecordChatUpdate записывает событие чата в журналы всех его участников,
+// а в каналах ещё и продвигает отметку изменений канала для подписчиков.
+// Возвращает номера обновления по пользователям.
+func (s *SyncService) RecordChatUpdate(ctx context.Context, chatID uuid.UUID, updateType string, data json.RawMessage) (map[uuid.UUID]int64, error) {
+	return s.updateRepo.AppendForChat(ctx, chatID, updateType, data)
+}
+
+// RecordUserUpdate записывает событие в журнал одного пользователя
+func (s *SyncService) RecordUserUpdate(ctx context.Context, userID uuid.UUID, updateType string, data json.RawMessage) (int64, error) {
+	return s.updateRepo.AppendForUser(ctx, userID, updateType, data)
+}
+
+// RunCleanup периодически удаляет обновления старше срока хранения,
+// пока не отменён ctx. Удаление идемпотентно, поэтому его можно
+// запускать на каждой реплике.
+func (s *SyncService) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(syncCleanupPeriod)
+	defer ticker.Stop()
+
+	for {
+		s.cleanup(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanup удаляет обновления, которые клиенту уже не отдаются
+func (s *SyncService) cleanup(ctx context.Context) {
+	if err := s.updateRepo.DeleteCreatedBefore(ctx, time.Now().Add(-s.config.Sync.RetentionDur)); err != nil && ctx.Err() == nil {
+		log.Printf("Failed to clean up user updates: %v", err)
+	}
+}
+
+// GetUpdates возвращает обновления пользователя после since
+// и каналы, изменившиеся после отметки channelPts
+func (s *SyncService) GetUpdates(ctx context.Context, userID uuid.UUID, since, channelPts int64, limit int) (*SyncResult, error) {
+	if since < 0 || channelPts < 0 {
+		return nil, ErrInvalidSyncState
+	}
+	if limit <= 0 {
+		limit = defaultSyncLimit
+	}
+	if limit > maxSyncLimit {
+		limit = maxSyncLimit
+	}
+
+	state, err := s.updateRepo.GetState(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{Seq: state.Seq, Updates: []models.Update{}}
+	if err := s.getChangedChannels(ctx, userID, channelPts, result); err != nil {
+		return nil, err
+	}
+	if since == state.Seq {
+		return result, nil
+	}
+
+	// Номер из будущего (например, после восстановления базы),
+	// часть пропущенного уже удалена или пропущено слишком много
+	if since > state.Seq ||
+		state.MinSeq == 0 || since+1 < state.MinSeq ||
+		state.Seq-since > int64(s.config.Sync.MaxUpdates) {
+		result.TooFarBehind = true
+		return result, nil
+	}
+
+	updates, err := s.updateRepo.GetSince(ctx, userID, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(updates) > limit {
+		updates = updates[:limit]
+		result.HasMore = true
+	}
+
+	result.Updates = updates
+	if len(updates) > 0 {
+		result.Seq = updates[len(updates)-1].Seq
+	}
+	return result, nil
+}
+
+// getChangedChannels заполняет в result каналы, изменившиеся после channelPts.
+// Клиенту отдаются все изменившиеся каналы, но отметка продвигается только
+// до первой недавней: записи с меньшими отметками могут быть ещё не видны,
+// и следующая синхронизация их не пропустит. Каналы после неё придут повторно,
+// это безопасно — клиент просто ещё раз догрузит их историю.
+func (s *SyncService) getChangedChannels(ctx context.Context, userID uuid.UUID, channelPts int64, result *SyncResult) error {
+	changes, err := s.updateRepo.GetChangedChannels(ctx, userID, channelPts)
+	if err != nil {
+		return err
+	}
+
+	result.ChannelPts = channelPts
+	result.Channels = make([]uuid.UUID, 0, len(changes))
+	settled := true
+	for _, change := range changes {
+		result.Channels = append(result.Channels, change.ChatID)
+		if change.Pending {
+			settled = false
+		}
+		if settled && change.Pts > result.ChannelPts {
+			result.ChannelPts = change.Pts
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"dildogram/backend/internal/config"
+	"dildogram/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// fakeUpdateRepo отдаёт пустой журнал и заданные отметки каналов
+type fakeUpdateRepo struct {
+	repository.UpdateRepository
+	channels []repository.ChannelChange
+}
+
+func (r *fakeUpdateRepo) GetState(ctx context.Context, userID uuid.UUID) (*repository.UpdateState, error) {
+	return &repository.UpdateState{}, nil
+}
+
+func (r *fakeUpdateRepo) GetChangedChannels(ctx context.Context, userID uuid.UUID, since int64) ([]repository.ChannelChange, error) {
+	var changes []repository.ChannelChange
+	for _, change := range r.channels {
+		if change.Pts > since {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func newSyncTest(channels ...repository.ChannelChange) *SyncService {
+	return NewSyncService(&fakeUpdateRepo{channels: channels}, &config.Config{Sync: config.SyncConfig{MaxUpdates: 100}})
+}
+
+func TestGetUpdatesReturnsChangedChannels(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+	s := newSyncTest(
+		repository.ChannelChange{ChatID: first, Pts: 7},
+		repository.ChannelChange{ChatID: second, Pts: 12},
+	)
+
+	result, err := s.GetUpdates(context.Background(), uuid.New(), 0, 7, 0)
+	if err != nil {
+		t.Fatalf("GetUpdates() error = %v", err)
+	}
+	if len(result.Channels) != 1 || result.Channels[0] != second {
+		t.Errorf("Channels = %v, want [%s]", result.Channels, second)
+	}
+	if result.ChannelPts != 12 {
+		t.Errorf("ChannelPts = %d, want 12", result.ChannelPts)
+	}
+}
+
+func TestGetUpdatesKeepsChannelPtsWithoutChanges(t *testing.T) {
+	s := newSyncTest(repository.ChannelChange{ChatID: uuid.New(), Pts: 3})
+
+	result, err := s.GetUpdates(context.Background(), uuid.New(), 0, 5, 0)
+	if err != nil {
+		t.Fatalf("GetUpdates() error = %v", err)
+	}
+	if len(result.Channels) != 0 {
+		t.Errorf("Channels = %v, want none", result.Channels)
+	}
+	if result.ChannelPts != 5 {
+		t.Errorf("ChannelPts = %d, want 5", result.ChannelPts)
+	}
+}
+
+func TestGetUpdatesStopsChannelPtsBeforePendingChange(t *testing.T) {
+	settled, pending, later := uuid.New(), uuid.New(), uuid.New()
+	s := newSyncTest(
+		repository.ChannelChange{ChatID: settled, Pts: 4},
+		repository.ChannelChange{ChatID: pending, Pts: 6, Pending: true},
+		repository.ChannelChange{ChatID: later, Pts: 9},
+	)
+
+	result, err := s.GetUpdates(context.Background(), uuid.New(), 0, 2, 0)
+	if err != nil {
+		t.Fatalf("GetUpdates() error = %v", err)
+	}
+	if len(result.Channels) != 3 {
+		t.Errorf("Channels = %v, want all three", result.Channels)
+	}
+	// Канал с отметкой 5 ещё может появиться, поэтому дальше 4 не продвигаемся
+	if result.ChannelPts != 4 {
+		t.Errorf("ChannelPts = %d, want 4", result.ChannelPts)
+	}
+}
+
+func TestGetUpdatesRejectsNegativeChannelPts(t *testing.T) {
+	s := newSyncTest()
+
+	if _, err := s.GetUpdates(context.Background(), uuid.New(), 0, -1, 0); err != ErrInvalidSyncState {
+		t.Errorf("GetUpdates() error = %v, want %v", err, ErrInvalidSyncState)
+	}
+}
@@ -0,0 +1,94 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Таймаут запроса к провайдеру
+const httpSendTimeout = 10 * time.Second
+
+// HTTPOptions параметры HTTP SMS провайдера
+type HTTPOptions struct {
+	URL    string
+	Token  string
+	Sender string
+	Client *http.Client
+}
+
+// HTTPSender отправляет SMS через HTTP API провайдера.
+// Запрос: POST URL с телом {"from": ..., "to": ..., "text": ...}
+// и заголовком Authorization: Bearer <token>. Успехом считается любой ответ 2xx.
+type HTTPSender struct {
+	url    string
+	token  string
+	sender string
+	client *http.Client
+}
+
+// NewHTTPSender создаёт новый HTTPSender
+func NewHTTPSender(opts HTTPOptions) (*HTTPSender, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("sms provider URL is required")
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: httpSendTimeout}
+	}
+
+	return &HTTPSender{
+		url:    opts.URL,
+		token:  opts.Token,
+		sender: opts.Sender,
+		client: client,
+	}, nil
+}
+
+type httpSendRequest struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+func (s *HTTPSender) Send(ctx context.Context, phone, text string) error {
+	body, err := json.Marshal(httpSendRequest{
+		From: s.sender,
+		To:   phone,
+		Text: text,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build sms request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send sms: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Текст ошибки провайдера обрезаем, чтобы не раздувать логи
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sms provider responded with %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	// Дочитываем тело, чтобы соединение вернулось в пул
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return nil
+}
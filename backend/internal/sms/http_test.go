@@ -0,0 +1,111 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPSenderSend(t *testing.T) {
+	var got httpSendRequest
+	var auth, contentType, method string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		auth = r.Header.Get("Authorization")
+		contentType = r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sender, err := NewHTTPSender(HTTPOptions{URL: server.URL, Token: "secret", Sender: "Dildogram"})
+	if err != nil {
+		t.Fatalf("NewHTTPSender: %v", err)
+	}
+
+	if err := sender.Send(context.Background(), "+79990001122", "code 123456"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if method != http.MethodPost {
+		t.Errorf("method = %s, want POST", method)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	want := httpSendRequest{From: "Dildogram", To: "+79990001122", Text: "code 123456"}
+	if got != want {
+		t.Errorf("body = %+v, want %+v", got, want)
+	}
+}
+
+func TestHTTPSenderWithoutToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Authorization = %q, want none", auth)
+		}
+	}))
+	defer server.Close()
+
+	sender, err := NewHTTPSender(HTTPOptions{URL: server.URL})
+	if err != nil {
+		t.Fatalf("NewHTTPSender: %v", err)
+	}
+	if err := sender.Send(context.Background(), "+79990001122", "text"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+}
+
+func TestHTTPSenderProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid number "+strings.Repeat("x", 1024), http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sender, err := NewHTTPSender(HTTPOptions{URL: server.URL})
+	if err != nil {
+		t.Fatalf("NewHTTPSender: %v", err)
+	}
+
+	err = sender.Send(context.Background(), "+79990001122", "text")
+	if err == nil {
+		t.Fatal("Send succeeded on 400 response")
+	}
+	if !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "invalid number") {
+		t.Errorf("error %q does not describe the provider response", err)
+	}
+	// Тело ответа провайдера обрезается
+	if len(err.Error()) > 600 {
+		t.Errorf("error is %d bytes, provider body was not truncated", len(err.Error()))
+	}
+}
+
+func TestHTTPSenderCanceledContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	sender, err := NewHTTPSender(HTTPOptions{URL: server.URL})
+	if err != nil {
+		t.Fatalf("NewHTTPSender: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sender.Send(ctx, "+79990001122", "text"); err == nil {
+		t.Fatal("Send succeeded with canceled context")
+	}
+}
+
+func TestNewHTTPSenderRequiresURL(t *testing.T) {
+	if _, err := NewHTTPSender(HTTPOptions{}); err == nil {
+		t.Fatal("NewHTTPSender accepted empty URL")
+	}
+}
@@ -0,0 +1,25 @@
+package sms
+
+import (
+	"context"
+	"log"
+)
+
+// Sender отправляет SMS сообщения
+type Sender interface {
+	Send(ctx context.Context, phone, text string) error
+}
+
+// LogSender выводит сообщения в лог вместо отправки.
+// Используется в разработке, когда SMS провайдер не настроен.
+type LogSender struct{}
+
+// NewLogSender создаёт новый LogSender
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+func (s *LogSender) Send(ctx context.Context, phone, text string) error {
+	log.Printf("[SMS] to %s: %s", phone, text)
+	return nil
+}
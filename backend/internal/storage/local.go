@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// LocalStorage хранит файлы на локальном диске и выдаёт их по ссылкам,
+// подписанным HMAC. Подходит для single-node и разработки.
+type LocalStorage struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+// NewLocalStorage создаёт новый LocalStorage.
+// baseURL — путь, на котором смонтирован Serve (например, /uploads/files).
+func NewLocalStorage(dir, baseURL, secret string) *LocalStorage {
+	return &LocalStorage{
+		dir:     dir,
+		baseURL: baseURL,
+		secret:  []byte(secret),
+	}
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	// Пишем во временный файл, чтобы не отдавать недописанный объект
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filePath)
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) SignedURL(ctx context.Context, key string, opts URLOptions) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(opts.Expires).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	if opts.ContentType != "" {
+		query.Set("ct", opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		query.Set("cd", opts.ContentDisposition)
+	}
+	query.Set("sig", s.sign(key, expires, opts.ContentType, opts.ContentDisposition))
+
+	return s.baseURL + "/" + key + "?" + query.Encode(), nil
+}
+
+// Serve отдаёт файл по подписанной ссылке, выданной SignedURL
+func (s *LocalStorage) Serve(w http.ResponseWriter, r *http.Request, key string) {
+	if validateKey(key) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	expires := query.Get("expires")
+	contentType := query.Get("ct")
+	disposition := query.Get("cd")
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		http.Error(w, "link expired", http.StatusForbidden)
+		return
+	}
+
+	signature, err := hex.DecodeString(query.Get("sig"))
+	expected, _ := hex.DecodeString(s.sign(key, expires, contentType, disposition))
+	if err != nil || !hmac.Equal(signature, expected) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	file, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(expiresAt-time.Now().Unix(), 10))
+
+	http.ServeContent(w, r, path.Base(key), stat.ModTime(), file)
+}
+
+// sign вычисляет подпись ссылки
+func (s *LocalStorage) sign(key, expires, contentType, disposition string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires + "\n" + contentType + "\n" + disposition))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBaseURL = "/uploads/files"
+
+func newTestStorage(t *testing.T) (*LocalStorage, string) {
+	t.Helper()
+	dir := t.TempDir()
+	return NewLocalStorage(dir, testBaseURL, "test-secret"), dir
+}
+
+// serve отдаёт объект по ссылке так же, как маршрут, на котором смонтирован Serve
+func serve(s *LocalStorage, link string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, link, nil)
+	rec := httptest.NewRecorder()
+	s.Serve(rec, req, strings.TrimPrefix(req.URL.Path, testBaseURL+"/"))
+	return rec
+}
+
+func TestLocalStoragePutServeDelete(t *testing.T) {
+	s, dir := newTestStorage(t)
+	ctx := context.Background()
+	key := "attachments/ab/file.txt"
+
+	if err := s.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "attachments", "ab", "file.txt")); err != nil {
+		t.Fatalf("stored file: %v", err)
+	}
+
+	link, err := s.SignedURL(ctx, key, URLOptions{
+		Expires:            time.Minute,
+		ContentType:        "text/plain",
+		ContentDisposition: `attachment; filename="file.txt"`,
+	})
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+	if !strings.HasPrefix(link, testBaseURL+"/"+key+"?") {
+		t.Fatalf("unexpected link %q", link)
+	}
+
+	rec := serve(s, link)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Serve status = %d, want 200", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	if string(body) != "hello" {
+		t.Errorf("body = %q, want %q", body, "hello")
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="file.txt"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if rec := serve(s, link); rec.Code != http.StatusNotFound {
+		t.Errorf("Serve after delete status = %d, want 404", rec.Code)
+	}
+	// Повторное удаление не ошибка
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+}
+
+func TestLocalStorageRejectsInvalidKeys(t *testing.T) {
+	s, _ := newTestStorage(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"", "/abs", "../escape", "a/../../b", "a//b", "a/./b", `a\b`} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, ""); err != ErrInvalidKey {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if err := s.Delete(ctx, key); err != ErrInvalidKey {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := s.SignedURL(ctx, key, URLOptions{Expires: time.Minute}); err != ErrInvalidKey {
+			t.Errorf("SignedURL(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestLocalStorageRejectsBadLinks(t *testing.T) {
+	s, _ := newTestStorage(t)
+	ctx := context.Background()
+	key := "avatars/a.jpg"
+
+	if err := s.Put(ctx, key, strings.NewReader("img"), 3, "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	link, err := s.SignedURL(ctx, key, URLOptions{Expires: time.Minute, ContentType: "image/jpeg"})
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+
+	tamper := func(name, value string) string {
+		u, _ := url.Parse(link)
+		query := u.Query()
+		query.Set(name, value)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+
+	expired, err := s.SignedURL(ctx, key, URLOptions{Expires: -time.Minute})
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		link string
+	}{
+		{"expired", expired},
+		{"forged signature", tamper("sig", strings.Repeat("0", 64))},
+		{"changed content type", tamper("ct", "text/html")},
+		{"other key", strings.Replace(link, key, "avatars/b.jpg", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(s, tt.link); rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", rec.Code)
+			}
+		})
+	}
+}
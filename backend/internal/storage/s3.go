@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Размер части multipart-загрузки при неизвестном размере файла (минимум S3)
+const s3PartSize = 5 * 1024 * 1024
+
+// S3Options параметры подключения к S3-совместимому хранилищу
+type S3Options struct {
+	Endpoint       string
+	PublicEndpoint string // Адрес для ссылок клиентам, если отличается от Endpoint
+	Region         string
+	Bucket         string
+	AccessKey      string
+	SecretKey      string
+	UseSSL         bool
+}
+
+// S3Storage хранит файлы в S3-совместимом хранилище (AWS S3, MinIO и др.)
+type S3Storage struct {
+	client  *minio.Client
+	presign *minio.Client
+	bucket  string
+}
+
+// NewS3Storage создаёт новый S3Storage и создаёт бакет, если его нет
+func NewS3Storage(ctx context.Context, opts S3Options) (*S3Storage, error) {
+	client, err := newS3Client(opts.Endpoint, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Подпись ссылки включает хост, поэтому для внешнего адреса нужен отдельный клиент
+	presign := client
+	if opts.PublicEndpoint != "" && opts.PublicEndpoint != opts.Endpoint {
+		if presign, err = newS3Client(opts.PublicEndpoint, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	exists, err := client.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", opts.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, opts.Bucket, minio.MakeBucketOptions{Region: opts.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", opts.Bucket, err)
+		}
+	}
+
+	return &S3Storage{
+		client:  client,
+		presign: presign,
+		bucket:  opts.Bucket,
+	}, nil
+}
+
+// newS3Client создаёт клиент для адреса endpoint
+func newS3Client(endpoint string, opts S3Options) (*minio.Client, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client for %s: %w", endpoint, err)
+	}
+	return client, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s3PartSize,
+	})
+	return err
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Storage) SignedURL(ctx context.Context, key string, opts URLOptions) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	if opts.ContentType != "" {
+		params.Set("response-content-type", opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		params.Set("response-content-disposition", opts.ContentDisposition)
+	}
+
+	u, err := s.presign.PresignedGetObject(ctx, s.bucket, key, opts.Expires, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testBucket = "media"
+
+// fakeS3 минимальный S3-совместимый сервер в памяти: бакеты и объекты
+// в path-style адресации, как их использует minio-go для своих адресов
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]bool
+	objects map[string][]byte
+	types   map[string]string
+	// Незавершённые multipart-загрузки: части по номерам
+	uploads map[string]map[int][]byte
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	t.Helper()
+	fake := &fakeS3{
+		buckets: make(map[string]bool),
+		objects: make(map[string][]byte),
+		types:   make(map[string]string),
+		uploads: make(map[string]map[int][]byte),
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+			if !f.buckets[bucket] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			f.buckets[bucket] = true
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+		return
+	}
+
+	if !f.buckets[bucket] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	name := bucket + "/" + key
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.uploads[name] = make(map[int][]byte)
+		f.types[name] = r.Header.Get("Content-Type")
+		w.Header().Set("Content-Type", "application/xml")
+		io.WriteString(w, "<InitiateMultipartUploadResult><Bucket>"+bucket+"</Bucket><Key>"+key+
+			"</Key><UploadId>"+name+"</UploadId></InitiateMultipartUploadResult>")
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		part, err := strconv.Atoi(query.Get("partNumber"))
+		body, readErr := readS3Body(r)
+		if !ok || err != nil || readErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		parts[part] = body
+		w.Header().Set("ETag", `"part`+strconv.Itoa(part)+`"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var object []byte
+		for i := 1; i <= len(parts); i++ {
+			object = append(object, parts[i]...)
+		}
+		f.objects[name] = object
+		delete(f.uploads, name)
+		w.Header().Set("Content-Type", "application/xml")
+		io.WriteString(w, "<CompleteMultipartUploadResult><Bucket>"+bucket+"</Bucket><Key>"+key+
+			"</Key><ETag>\"etag\"</ETag></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodPut:
+		body, err := readS3Body(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[name] = body
+		f.types[name] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// readS3Body читает тело загрузки, снимая aws-chunked кодирование,
+// которым клиент подписывает поток без TLS
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var body bytes.Buffer
+	reader := bufio.NewReader(r.Body)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return body.Bytes(), nil
+		}
+		if _, err := io.CopyN(&body, reader, size); err != nil {
+			return nil, err
+		}
+		if _, err := reader.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *fakeS3) object(name string) ([]byte, string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[name]
+	return data, f.types[name], ok
+}
+
+func (f *fakeS3) hasBucket(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.buckets[name]
+}
+
+func newTestS3Storage(t *testing.T, endpoint, publicEndpoint string) *S3Storage {
+	t.Helper()
+	s, err := NewS3Storage(context.Background(), S3Options{
+		Endpoint:       endpoint,
+		PublicEndpoint: publicEndpoint,
+		Region:         "us-east-1",
+		Bucket:         testBucket,
+		AccessKey:      "access",
+		SecretKey:      "secret-key",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+	return s
+}
+
+func TestS3StorageCreatesBucket(t *testing.T) {
+	fake, server := newFakeS3(t)
+	newTestS3Storage(t, strings.TrimPrefix(server.URL, "http://"), "")
+
+	if !fake.hasBucket(testBucket) {
+		t.Fatalf("bucket %q was not created", testBucket)
+	}
+}
+
+func TestS3StoragePutDelete(t *testing.T) {
+	fake, server := newFakeS3(t)
+	s := newTestS3Storage(t, strings.TrimPrefix(server.URL, "http://"), "")
+	ctx := context.Background()
+	key := "media/chat/file.txt"
+
+	// Размер неизвестен, как при загрузке потоком
+	if err := s.Put(ctx, key, strings.NewReader("hello"), -1, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	data, contentType, ok := fake.object(testBucket + "/" + key)
+	if !ok || string(data) != "hello" {
+		t.Fatalf("stored object = %q, %v, want %q", data, ok, "hello")
+	}
+	if contentType != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", contentType)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, ok := fake.object(testBucket + "/" + key); ok {
+		t.Fatal("object still exists after Delete")
+	}
+}
+
+func TestS3StorageRejectsInvalidKey(t *testing.T) {
+	_, server := newFakeS3(t)
+	s := newTestS3Storage(t, strings.TrimPrefix(server.URL, "http://"), "")
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "../escape", strings.NewReader("x"), 1, "text/plain"); err != ErrInvalidKey {
+		t.Errorf("Put error = %v, want %v", err, ErrInvalidKey)
+	}
+	if _, err := s.SignedURL(ctx, "../escape", URLOptions{Expires: time.Minute}); err != ErrInvalidKey {
+		t.Errorf("SignedURL error = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestS3StorageSignedURL(t *testing.T) {
+	_, server := newFakeS3(t)
+	endpoint := strings.TrimPrefix(server.URL, "http://")
+	s := newTestS3Storage(t, endpoint, "")
+
+	link, err := s.SignedURL(context.Background(), "media/chat/photo.jpg", URLOptions{
+		Expires:            time.Minute,
+		ContentType:        "image/jpeg",
+		ContentDisposition: "inline",
+	})
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parse link %q: %v", link, err)
+	}
+	if u.Host != endpoint {
+		t.Errorf("host = %q, want %q", u.Host, endpoint)
+	}
+	if u.Path != "/"+testBucket+"/media/chat/photo.jpg" {
+		t.Errorf("path = %q", u.Path)
+	}
+
+	query := u.Query()
+	if query.Get("X-Amz-Expires") != "60" {
+		t.Errorf("X-Amz-Expires = %q, want 60", query.Get("X-Amz-Expires"))
+	}
+	if query.Get("X-Amz-Signature") == "" {
+		t.Error("link is not signed")
+	}
+	if query.Get("response-content-type") != "image/jpeg" {
+		t.Errorf("response-content-type = %q", query.Get("response-content-type"))
+	}
+	if query.Get("response-content-disposition") != "inline" {
+		t.Errorf("response-content-disposition = %q", query.Get("response-content-disposition"))
+	}
+}
+
+func TestS3StorageSignedURLUsesPublicEndpoint(t *testing.T) {
+	_, server := newFakeS3(t)
+	const public = "cdn.example.com:9443"
+	s := newTestS3Storage(t, strings.TrimPrefix(server.URL, "http://"), public)
+
+	link, err := s.SignedURL(context.Background(), "media/chat/photo.jpg", URLOptions{Expires: time.Minute})
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parse link %q: %v", link, err)
+	}
+	// Подпись включает хост, поэтому ссылка должна быть подписана внешним клиентом
+	if u.Host != public {
+		t.Errorf("host = %q, want %q", u.Host, public)
+	}
+	if !strings.Contains(u.Query().Get("X-Amz-SignedHeaders"), "host") {
+		t.Errorf("X-Amz-SignedHeaders = %q, want host", u.Query().Get("X-Amz-SignedHeaders"))
+	}
+}
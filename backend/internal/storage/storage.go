@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrInvalidKey = errors.New("invalid object key")
+
+// URLOptions параметры подписанной ссылки на скачивание
+type URLOptions struct {
+	Expires            time.Duration
+	ContentType        string
+	ContentDisposition string
+}
+
+// Storage определяет хранилище загруженных файлов (аватарки, вложения)
+type Storage interface {
+	// Put потоково сохраняет объект. size может быть -1, если размер неизвестен.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Delete(ctx context.Context, key string) error
+	// SignedURL возвращает ссылку на скачивание, действующую opts.Expires
+	SignedURL(ctx context.Context, key string, opts URLOptions) (string, error)
+}
+
+// validateKey запрещает ключи, выходящие за пределы хранилища
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// EventType определяет тип события, распространяемого между репликами
+type EventType string
+
+const (
+	EventTypeChat       EventType = "chat"       // Подписчикам чата
+	EventTypeUser       EventType = "user"       // Всем устройствам пользователя
+	EventTypeUsers      EventType = "users"      // Всем устройствам нескольких пользователей
+	EventTypeDisconnect EventType = "disconnect" // Закрыть соединения отозванных сессий
+	EventTypeLeave      EventType = "leave"      // Отписать устройства пользователя от чата
+)
+
+// Event представляет событие хаба, доставляемое через брокер на все реплики
+type Event struct {
+	Type          EventType   `json:"type"`
+	ChatID        uuid.UUID   `json:"chat_id,omitempty"`
+	UserID        uuid.UUID   `json:"user_id,omitempty"`
+	ExcludeUserID uuid.UUID   `json:"exclude_user_id,omitempty"`
+	ExcludeConnID string      `json:"exclude_conn_id,omitempty"`
+	SessionIDs    []uuid.UUID `json:"session_ids,omitempty"`
+	UserIDs       []uuid.UUID `json:"user_ids,omitempty"`
+	// NewMessageID — событие о новом сообщении: реплики отмечают его доставку
+	// получателям, до устройств которых оно дошло
+	NewMessageID uuid.UUID `json:"new_message_id,omitempty"`
+	// Seqs — номера события в журналах обновлений получателей
+	Seqs    map[uuid.UUID]int64 `json:"seqs,omitempty"`
+	Message json.RawMessage     `json:"message,omitempty"`
+}
+
+// messageFor возвращает событие для устройств пользователя с его номером обновления
+func (e *Event) messageFor(userID uuid.UUID) []byte {
+	if seq, ok := e.Seqs[userID]; ok {
+		return WithSeq(e.Message, seq)
+	}
+	return e.Message
+}
+
+// Broker распространяет события хаба и хранит присутствие пользователей в кластере
+type Broker interface {
+	// Publish отправляет событие всем репликам, включая текущую
+	Publish(ctx context.Context, event *Event) error
+	// Subscribe регистрирует обработчик входящих событий
+	Subscribe(ctx context.Context, handler func(*Event)) error
+
+	// AddConnection регистрирует соединение пользователя.
+	// Возвращает true, если это первое соединение пользователя в кластере.
+	AddConnection(ctx context.Context, userID uuid.UUID, connID string) (bool, error)
+	// RemoveConnection удаляет соединение пользователя.
+	// Возвращает true, если это было последнее соединение пользователя в кластере.
+	RemoveConnection(ctx context.Context, userID uuid.UUID, connID string) (bool, error)
+	// RefreshConnections продлевает жизнь соединений текущей реплики
+	RefreshConnections(ctx context.Context, conns map[uuid.UUID][]string) error
+	// SweepExpired убирает из онлайн пользователей, все соединения которых истекли
+	// (реплика упала, не отключив их). Каждый такой пользователь возвращается
+	// только одной реплике.
+	SweepExpired(ctx context.Context) ([]uuid.UUID, error)
+	IsOnline(ctx context.Context, userID uuid.UUID) (bool, error)
+	OnlineUsers(ctx context.Context) ([]uuid.UUID, error)
+
+	Close() error
+}
+
+// MemoryBroker реализует Broker в пределах одного процесса (single-node и тесты).
+// Как и Redis, доставляет события асинхронно и по порядку: Publish не ждёт
+// обработчиков, поэтому хаб может публиковать из своего же цикла.
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers []func(*Event)
+	conns    map[uuid.UUID]map[string]bool
+
+	queueMu sync.Mutex
+	queue   []*Event
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+// NewMemoryBroker создаёт новый MemoryBroker
+func NewMemoryBroker() *MemoryBroker {
+	b := &MemoryBroker{
+		conns: make(map[uuid.UUID]map[string]bool),
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	go b.dispatch()
+	return b
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, event *Event) error {
+	b.queueMu.Lock()
+	b.queue = append(b.queue, event)
+	b.queueMu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// dispatch передаёт накопленные события обработчикам в порядке публикации
+func (b *MemoryBroker) dispatch() {
+	for {
+		select {
+		case <-b.wake:
+		case <-b.done:
+			return
+		}
+
+		for {
+			b.queueMu.Lock()
+			events := b.queue
+			b.queue = nil
+			b.queueMu.Unlock()
+			if len(events) == 0 {
+				break
+			}
+
+			b.mu.RLock()
+			handlers := b.handlers
+			b.mu.RUnlock()
+
+			for _, event := range events {
+				for _, handler := range handlers {
+					handler(event)
+				}
+			}
+		}
+	}
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, handler func(*Event)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+func (b *MemoryBroker) AddConnection(ctx context.Context, userID uuid.UUID, connID string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	conns, ok := b.conns[userID]
+	if !ok {
+		conns = make(map[string]bool)
+		b.conns[userID] = conns
+	}
+	conns[connID] = true
+	return len(conns) == 1, nil
+}
+
+func (b *MemoryBroker) RemoveConnection(ctx context.Context, userID uuid.UUID, connID string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	conns, ok := b.conns[userID]
+	if !ok || !conns[connID] {
+		return false, nil
+	}
+	delete(conns, connID)
+	if len(conns) > 0 {
+		return false, nil
+	}
+	delete(b.conns, userID)
+	return true, nil
+}
+
+func (b *MemoryBroker) RefreshConnections(ctx context.Context, conns map[uuid.UUID][]string) error {
+	return nil
+}
+
+// SweepExpired ничего не делает: в одном процессе соединения не истекают
+func (b *MemoryBroker) SweepExpired(ctx context.Context) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+func (b *MemoryBroker) IsOnline(ctx context.Context, userID uuid.UUID) (bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.conns[userID]) > 0, nil
+}
+
+func (b *MemoryBroker) OnlineUsers(ctx context.Context) ([]uuid.UUID, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	users := make([]uuid.UUID, 0, len(b.conns))
+	for userID := range b.conns {
+		users = append(users, userID)
+	}
+	return users, nil
+}
+
+func (b *MemoryBroker) Close() error {
+	close(b.done)
+	return nil
+}
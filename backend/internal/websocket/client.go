@@ -24,6 +24,15 @@ const (
 
 	// Максимальный размер сообщения
 	maxMessageSize = 512 * 1024 // 512KB
+
+	// Период продления присутствия в брокере (должен быть меньше presenceTTL)
+	presenceRefreshPeriod = 30 * time.Second
+
+	// Через сколько снимается активность в чате, если клиент её не продлил
+	typingTimeout = 6 * time.Second
+
+	// Как часто продление активности рассылается участникам
+	typingThrottle = 3 * time.Second
 )
 
 var upgrader = websocket.Upgrader{
@@ -37,27 +46,31 @@ var upgrader = websocket.Upgrader{
 
 // Client представляет WebSocket клиента
 type Client struct {
+	id         string // Уникальный ID соединения в кластере
 	hub        *Hub
 	conn       *websocket.Conn
 	userID     uuid.UUID
 	username   string
+	sessionID  uuid.UUID
 	send       chan []byte
 	mu         sync.RWMutex
-	subscribed map[uuid.UUID]bool // Подписки на чаты
-	typing     map[uuid.UUID]bool // Статус набора текста по чатам
+	subscribed map[uuid.UUID]bool            // Подписки на чаты
+	typing     map[uuid.UUID]*typingActivity // Активность (набор текста и т.п.) по чатам
 	lastSeen   time.Time
 }
 
 // NewClient создаёт нового клиента
-func NewClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID, username string) *Client {
+func NewClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID, username string, sessionID uuid.UUID) *Client {
 	return &Client{
+		id:         uuid.NewString(),
 		hub:        hub,
 		conn:       conn,
 		userID:     userID,
 		username:   username,
+		sessionID:  sessionID,
 		send:       make(chan []byte, 256),
 		subscribed: make(map[uuid.UUID]bool),
-		typing:     make(map[uuid.UUID]bool),
+		typing:     make(map[uuid.UUID]*typingActivity),
 		lastSeen:   time.Now(),
 	}
 }
@@ -66,7 +79,6 @@ func NewClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID, username string
 func (c *Client) Read() {
 	defer func() {
 		c.hub.Unregister <- c
-		c.hub.broadcastUserOffline(c.userID)
 		c.conn.Close()
 	}()
 
@@ -86,15 +98,20 @@ func (c *Client) Read() {
 			break
 		}
 
-		// Парсим сообщение
-		var wsMsg WSMessage
-		if err := json.Unmarshal(message, &wsMsg); err != nil {
-			c.sendError("invalid_json", "Failed to parse message")
+		// Парсим сообщение, оставляя payload для разбора обработчиком
+		var incoming incomingMessage
+		if err := json.Unmarshal(message, &incoming); err != nil {
+			c.SendError("invalid_json", "Failed to parse message")
 			continue
 		}
 
 		// Обрабатываем сообщение
-		c.hub.handleMessage(c, &wsMsg)
+		c.hub.handleMessage(c, &WSMessage{
+			Type:      incoming.Type,
+			Payload:   incoming.Payload,
+			RequestID: incoming.RequestID,
+			Timestamp: time.Now(),
+		})
 	}
 }
 
@@ -153,12 +170,21 @@ func (c *Client) Send(msg *WSMessage) {
 		return
 	}
 
+	c.sendRaw(data)
+}
+
+// sendRaw ставит готовое сообщение в очередь отправки.
+// Возвращает false, если очередь переполнена и соединение закрыто.
+func (c *Client) sendRaw(data []byte) bool {
 	select {
 	case c.send <- data:
+		return true
 	default:
-		// Канал переполнен, закрываем соединение
+		// Канал переполнен, закрываем соединение.
+		// Канал send закроет Hub при отмене регистрации клиента.
 		log.Printf("send buffer full for user %s", c.userID)
-		close(c.send)
+		c.conn.Close()
+		return false
 	}
 }
 
@@ -174,6 +200,32 @@ func (c *Client) SendError(code, message string) {
 	})
 }
 
+// SendAck отвечает на запрос с request_id
+func (c *Client) SendAck(requestID string, seq int64, payload AckPayload) {
+	c.Send(&WSMessage{
+		Seq:       seq,
+		Type:      MessageTypeAck,
+		RequestID: requestID,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+}
+
+// ReplyError отвечает на запрос ошибкой: ack, если у запроса есть request_id, иначе error
+func (c *Client) ReplyError(requestID, code, message string) {
+	if requestID == "" {
+		c.SendError(code, message)
+		return
+	}
+
+	c.SendAck(requestID, 0, AckPayload{
+		Error: &ErrorPayload{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
 // Subscribe подписывает клиента на чат
 func (c *Client) Subscribe(chatID uuid.UUID) {
 	c.mu.Lock()
@@ -186,7 +238,18 @@ func (c *Client) Unsubscribe(chatID uuid.UUID) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	delete(c.subscribed, chatID)
-	delete(c.typing, chatID)
+}
+
+// subscriptions возвращает список чатов, на которые подписан клиент
+func (c *Client) subscriptions() []uuid.UUID {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	chatIDs := make([]uuid.UUID, 0, len(c.subscribed))
+	for chatID := range c.subscribed {
+		chatIDs = append(chatIDs, chatID)
+	}
+	return chatIDs
 }
 
 // IsSubscribed проверяет подписку на чат
@@ -196,23 +259,95 @@ func (c *Client) IsSubscribed(chatID uuid.UUID) bool {
 	return c.subscribed[chatID]
 }
 
-// SetTyping устанавливает статус набора текста
-func (c *Client) SetTyping(chatID uuid.UUID, isTyping bool) {
+// typingActivity активность клиента в чате
+type typingActivity struct {
+	action    TypingAction
+	renewedAt time.Time
+	sentAt    time.Time   // Когда о ней последний раз сообщили участникам
+	timer     *time.Timer // Снимает активность, если клиент её не продлил
+}
+
+// StartTyping отмечает или продлевает активность в чате на typingTimeout.
+// Если клиент её не продлит, активность снимается и вызывается onExpire.
+// Возвращает true, если о ней нужно сообщить участникам: активность новая,
+// сменился её вид или с прошлой рассылки прошло typingThrottle.
+func (c *Client) StartTyping(chatID uuid.UUID, action TypingAction, onExpire func(TypingAction)) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if isTyping {
-		c.typing[chatID] = true
-		c.lastSeen = time.Now()
+
+	now := time.Now()
+	c.lastSeen = now
+
+	activity, ok := c.typing[chatID]
+	if !ok {
+		activity = &typingActivity{}
+		activity.timer = time.AfterFunc(c.hub.typingTimeout, func() {
+			c.expireTyping(chatID, activity, onExpire)
+		})
+		c.typing[chatID] = activity
 	} else {
-		delete(c.typing, chatID)
+		activity.timer.Reset(c.hub.typingTimeout)
+	}
+	activity.renewedAt = now
+
+	if ok && activity.action == action && now.Sub(activity.sentAt) < c.hub.typingThrottle {
+		return false
 	}
+	activity.action = action
+	activity.sentAt = now
+	return true
 }
 
-// IsTyping проверяет статус набора текста
+// expireTyping снимает активность, которую клиент не продлил
+func (c *Client) expireTyping(chatID uuid.UUID, activity *typingActivity, onExpire func(TypingAction)) {
+	c.mu.Lock()
+	// Активность могли продлить или снять, пока срабатывал таймер
+	if c.typing[chatID] != activity || time.Since(activity.renewedAt) < c.hub.typingTimeout {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.typing, chatID)
+	action := activity.action
+	c.mu.Unlock()
+
+	onExpire(action)
+}
+
+// StopTyping снимает активность в чате.
+// Возвращает её вид и false, если активности не было.
+func (c *Client) StopTyping(chatID uuid.UUID) (TypingAction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	activity, ok := c.typing[chatID]
+	if !ok {
+		return "", false
+	}
+	activity.timer.Stop()
+	delete(c.typing, chatID)
+	return activity.action, true
+}
+
+// StopAllTyping снимает активность во всех чатах и возвращает её по чатам
+func (c *Client) StopAllTyping() map[uuid.UUID]TypingAction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stopped := make(map[uuid.UUID]TypingAction, len(c.typing))
+	for chatID, activity := range c.typing {
+		activity.timer.Stop()
+		stopped[chatID] = activity.action
+	}
+	c.typing = make(map[uuid.UUID]*typingActivity)
+	return stopped
+}
+
+// IsTyping проверяет, есть ли у клиента активность в чате
 func (c *Client) IsTyping(chatID uuid.UUID) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.typing[chatID]
+	_, ok := c.typing[chatID]
+	return ok
 }
 
 // GetUserID возвращает ID пользователя
@@ -220,26 +355,16 @@ func (c *Client) GetUserID() uuid.UUID {
 	return c.userID
 }
 
+// GetSessionID возвращает ID сессии, с которой подключён клиент
+func (c *Client) GetSessionID() uuid.UUID {
+	return c.sessionID
+}
+
 // GetUsername возвращает имя пользователя
 func (c *Client) GetUsername() string {
 	return c.username
 }
 
-// Broadcast отправляет сообщение всем подключенным клиентам
-func (c *Client) Broadcast(msg *WSMessage, excludeSelf bool) {
-	data, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("failed to marshal broadcast message: %v", err)
-		return
-	}
-
-	c.hub.broadcast <- broadcastMessage{
-		message:   data,
-		excludeID: c.userID,
-		skipCheck: !excludeSelf,
-	}
-}
-
 // BroadcastToChat отправляет сообщение всем подписчикам чата
 func (c *Client) BroadcastToChat(chatID uuid.UUID, msg *WSMessage, excludeSelf bool) {
 	data, err := json.Marshal(msg)
@@ -248,27 +373,15 @@ func (c *Client) BroadcastToChat(chatID uuid.UUID, msg *WSMessage, excludeSelf b
 		return
 	}
 
-	c.hub.broadcastToChat <- chatBroadcastMessage{
-		chatID:    chatID,
-		message:   data,
-		excludeID: c.userID,
-		skipCheck: !excludeSelf,
+	event := &Event{
+		Type:    EventTypeChat,
+		ChatID:  chatID,
+		Message: data,
 	}
-}
-
-// broadcastMessage сообщение для широковещательной рассылки
-type broadcastMessage struct {
-	message   []byte
-	excludeID uuid.UUID
-	skipCheck bool
-}
-
-// chatBroadcastMessage сообщение для рассылки по чату
-type chatBroadcastMessage struct {
-	chatID    uuid.UUID
-	message   []byte
-	excludeID uuid.UUID
-	skipCheck bool
+	if excludeSelf {
+		event.ExcludeUserID = c.userID
+	}
+	c.hub.publish(event)
 }
 
 // wsResponse записывает WebSocket ответ
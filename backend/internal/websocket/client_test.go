@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// startTyping отправляет typing_start от клиента
+func startTyping(hub *Hub, client *Client, chatID uuid.UUID) {
+	hub.handleMessage(client, &WSMessage{
+		Type:    MessageTypeTypingStart,
+		Payload: json.RawMessage(`{"chat_id":"` + chatID.String() + `"}`),
+	})
+}
+
+// expectTyping ждёт рассылку активности и проверяет, начата она или снята
+func expectTyping(t *testing.T, client *Client, isTyping bool) {
+	t.Helper()
+
+	frame := expectFrame(t, client, MessageTypeTyping)
+	var payload TypingStatusPayload
+	if err := json.Unmarshal(frame.Payload, &payload); err != nil {
+		t.Fatalf("failed to parse typing: %v", err)
+	}
+	if payload.IsTyping != isTyping {
+		t.Fatalf("is_typing = %v, want %v", payload.IsTyping, isTyping)
+	}
+}
+
+// typingChat подключает alice и bob к общей группе на хабе
+// с укороченными таймингами активности
+func typingChat(t *testing.T, timeout, throttle time.Duration) (*Hub, *Client, *Client, uuid.UUID) {
+	t.Helper()
+
+	store := newTestStore()
+	hub := newTestHub(t, store, newTestBroker(t))
+	hub.typingTimeout, hub.typingThrottle = timeout, throttle
+
+	alice, bob := store.addUser("alice"), store.addUser("bob")
+	chat := store.addGroup(alice, bob)
+
+	aliceConn := connect(t, hub, store, alice)
+	bobConn := connect(t, hub, store, bob)
+	subscribe(t, hub, aliceConn, chat.ID)
+	subscribe(t, hub, bobConn, chat.ID)
+	return hub, aliceConn, bobConn, chat.ID
+}
+
+func TestTypingExpiresWithoutRenewal(t *testing.T) {
+	hub, alice, bob, chatID := typingChat(t, 200*time.Millisecond, 100*time.Millisecond)
+
+	startTyping(hub, alice, chatID)
+	expectTyping(t, bob, true)
+
+	expectTyping(t, bob, false)
+	if alice.IsTyping(chatID) {
+		t.Fatal("typing is still active after timeout")
+	}
+	expectNoFrame(t, alice)
+}
+
+func TestTypingRenewalsAreThrottled(t *testing.T) {
+	hub, alice, bob, chatID := typingChat(t, 400*time.Millisecond, 150*time.Millisecond)
+
+	startTyping(hub, alice, chatID)
+	expectTyping(t, bob, true)
+
+	// Продление до typingThrottle не рассылается
+	startTyping(hub, alice, chatID)
+	startTyping(hub, alice, chatID)
+	expectNoFrame(t, bob)
+
+	// После typingThrottle продление рассылается снова
+	time.Sleep(hub.typingThrottle)
+	startTyping(hub, alice, chatID)
+	expectTyping(t, bob, true)
+
+	// Продления не дают активности истечь
+	if !alice.IsTyping(chatID) {
+		t.Fatal("renewed typing expired")
+	}
+}
+
+func TestTypingStopsOnDisconnect(t *testing.T) {
+	hub, alice, bob, chatID := typingChat(t, time.Minute, time.Minute)
+
+	startTyping(hub, alice, chatID)
+	expectTyping(t, bob, true)
+
+	disconnect(hub, alice)
+	expectTyping(t, bob, false)
+	expectNoFrame(t, bob)
+}
@@ -15,28 +15,45 @@ import (
 
 // Hub управляет WebSocket соединениями
 type Hub struct {
-	clients        map[uuid.UUID]*Client // Клиенты по ID пользователя
-	clientsByChat  map[uuid.UUID]map[uuid.UUID]*Client // Клиенты по ID чата
-	Register       chan *Client
-	Unregister     chan *Client
-	broadcast      chan broadcastMessage
-	broadcastToChat chan chatBroadcastMessage
-	mu             sync.RWMutex
+	clients       map[uuid.UUID]map[*Client]bool // Соединения (устройства) по ID пользователя
+	clientsByChat map[uuid.UUID]map[*Client]bool // Соединения по ID чата
+	Register      chan *Client
+	Unregister    chan *Client
+	events        chan *Event // События, полученные от брокера
+	broker        Broker
+	mu            sync.RWMutex
+
+	// Очереди изменений присутствия, обрабатываемых вне цикла хаба
+	presence []*presenceQueue
+
+	// Устройства пользователя с активностью в чате на этой реплике
+	typing   map[typingKey]map[*Client]TypingAction
+	typingMu sync.Mutex
+	// Тайминги активности, по умолчанию typingTimeout и typingThrottle
+	typingTimeout  time.Duration
+	typingThrottle time.Duration
 
 	// Сервисы
 	messageService *service.MessageService
 	chatService    *service.ChatService
 	authService    *service.AuthService
+	syncService    *service.SyncService
 	messageRepo    repository.MessageRepository
 	chatRepo       repository.ChatRepository
 	userRepo       repository.UserRepository
 }
 
+// typingKey активность пользователя в чате
+type typingKey struct {
+	userID uuid.UUID
+	chatID uuid.UUID
+}
+
 // chatSubscriber хранит информацию о подписчике чата
 type chatSubscriber struct {
-	userID   uuid.UUID
-	client   *Client
-	chatID   uuid.UUID
+	userID uuid.UUID
+	client *Client
+	chatID uuid.UUID
 }
 
 // NewHub создаёт новый Hub
@@ -44,20 +61,32 @@ func NewHub(
 	messageService *service.MessageService,
 	chatService *service.ChatService,
 	authService *service.AuthService,
+	syncService *service.SyncService,
 	messageRepo repository.MessageRepository,
 	chatRepo repository.ChatRepository,
 	userRepo repository.UserRepository,
+	broker Broker,
 ) *Hub {
+	presence := make([]*presenceQueue, presenceShards)
+	for i := range presence {
+		presence[i] = newPresenceQueue()
+	}
+
 	return &Hub{
-		clients:        make(map[uuid.UUID]*Client),
-		clientsByChat:  make(map[uuid.UUID]map[uuid.UUID]*Client),
+		clients:        make(map[uuid.UUID]map[*Client]bool),
+		clientsByChat:  make(map[uuid.UUID]map[*Client]bool),
+		typing:         make(map[typingKey]map[*Client]TypingAction),
+		typingTimeout:  typingTimeout,
+		typingThrottle: typingThrottle,
 		Register:       make(chan *Client),
 		Unregister:     make(chan *Client),
-		broadcast:      make(chan broadcastMessage, 256),
-		broadcastToChat: make(chan chatBroadcastMessage, 256),
+		events:         make(chan *Event, 1024),
+		broker:         broker,
+		presence:       presence,
 		messageService: messageService,
 		chatService:    chatService,
 		authService:    authService,
+		syncService:    syncService,
 		messageRepo:    messageRepo,
 		chatRepo:       chatRepo,
 		userRepo:       userRepo,
@@ -66,6 +95,17 @@ func NewHub(
 
 // Run запускает Hub
 func (h *Hub) Run() {
+	// Все события (включая опубликованные этой репликой) приходят через брокер
+	err := h.broker.Subscribe(context.Background(), func(event *Event) {
+		h.events <- event
+	})
+	if err != nil {
+		log.Fatalf("failed to subscribe to hub broker: %v", err)
+	}
+
+	h.startPresence()
+	go h.runPresenceMaintenance()
+
 	for {
 		select {
 		case client := <-h.Register:
@@ -74,119 +114,226 @@ func (h *Hub) Run() {
 		case client := <-h.Unregister:
 			h.unregisterClient(client)
 
-		case msg := <-h.broadcast:
-			h.handleBroadcast(msg)
-
-		case msg := <-h.broadcastToChat:
-			h.handleBroadcastToChat(msg)
+		case event := <-h.events:
+			h.handleEvent(event)
 		}
 	}
 }
 
-// registerClient регистрирует клиента
+// handleEvent доставляет событие брокера локальным соединениям
+func (h *Hub) handleEvent(event *Event) {
+	switch event.Type {
+	case EventTypeChat:
+		h.handleBroadcastToChat(event)
+	case EventTypeUser:
+		h.handleUserEvent(event)
+	case EventTypeUsers:
+		h.handleUsersEvent(event)
+	case EventTypeDisconnect:
+		h.handleDisconnect(event)
+	case EventTypeLeave:
+		h.handleLeave(event)
+	}
+}
+
+// publish отправляет событие через брокер на все реплики
+func (h *Hub) publish(event *Event) {
+	if err := h.broker.Publish(context.Background(), event); err != nil {
+		log.Printf("failed to publish %s event: %v", event.Type, err)
+	}
+}
+
+// registerClient регистрирует клиента.
+// В цикле хаба меняются только карты соединений: запросы к брокеру и базе
+// и рассылка статуса уходят в очередь присутствия, чтобы подключения
+// не задерживали доставку событий.
 func (h *Hub) registerClient(client *Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	// У пользователя может быть несколько устройств одновременно
+	devices, ok := h.clients[client.userID]
+	if !ok {
+		devices = make(map[*Client]bool)
+		h.clients[client.userID] = devices
+	}
+	devices[client] = true
+	deviceCount := len(devices)
+	h.mu.Unlock()
+
+	log.Printf("client connected: %s (%s), devices: %d", client.username, client.userID, deviceCount)
+
+	h.enqueuePresence(presenceTask{
+		kind:     presenceConnect,
+		userID:   client.userID,
+		username: client.username,
+		connID:   client.id,
+		devices:  deviceCount,
+	})
+}
 
-	// Если уже есть соединение для этого пользователя, закрываем старое
-	if existing, ok := h.clients[client.userID]; ok {
-		close(existing.send)
+// unregisterClient отключает клиента.
+// Как и при регистрации, в цикле хаба только изменения карт соединений.
+func (h *Hub) unregisterClient(client *Client) {
+	h.mu.Lock()
+	devices, ok := h.clients[client.userID]
+	if !ok || !devices[client] {
+		h.mu.Unlock()
+		return
 	}
 
-	h.clients[client.userID] = client
+	delete(devices, client)
+	close(client.send)
+
+	// Отписываем от всех чатов
+	for _, chatID := range client.subscriptions() {
+		h.unsubscribeFromChat(client, chatID)
+	}
 
-	// Устанавливаем статус онлайн
-	_ = h.authService.SetOnline(context.Background(), client.userID, true)
+	deviceCount := len(devices)
+	if deviceCount == 0 {
+		delete(h.clients, client.userID)
+	}
+	h.mu.Unlock()
 
-	// Отправляем уведомление о статусе онлайн
-	h.broadcastUserOnline(client.userID, client.username)
+	log.Printf("client disconnected: %s (%s), devices left: %d", client.username, client.userID, deviceCount)
 
-	log.Printf("client connected: %s (%s)", client.username, client.userID)
+	// Снимаем активность во всех чатах, в том числе без подписки
+	for chatID, action := range client.StopAllTyping() {
+		h.stopTyping(client, chatID, action)
+	}
+
+	h.enqueuePresence(presenceTask{
+		kind:    presenceDisconnect,
+		userID:  client.userID,
+		connID:  client.id,
+		devices: deviceCount,
+	})
 }
 
-// unregisterClient отключает клиента
-func (h *Hub) unregisterClient(client *Client) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// handleBroadcastToChat отправляет сообщение подписчикам чата
+func (h *Hub) handleBroadcastToChat(event *Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 
-	if _, ok := h.clients[client.userID]; ok {
-		delete(h.clients, client.userID)
-		close(client.send)
+	clients, ok := h.clientsByChat[event.ChatID]
+	if !ok {
+		return
+	}
 
-		// Отписываем от всех чатов
-		for chatID := range client.subscribed {
-			h.unsubscribeFromChat(client, chatID)
+	// Отметка доставки нужна только для новых сообщений, в остальных событиях
+	// и в каналах карту получателей не заводим
+	var recipients []uuid.UUID
+	var delivered map[uuid.UUID]bool
+	if event.NewMessageID != uuid.Nil {
+		delivered = make(map[uuid.UUID]bool)
+	}
+	for client := range clients {
+		if client.id == event.ExcludeConnID || client.userID == event.ExcludeUserID {
+			continue
+		}
+		if client.sendRaw(event.messageFor(client.userID)) && event.NewMessageID != uuid.Nil && !delivered[client.userID] {
+			delivered[client.userID] = true
+			recipients = append(recipients, client.userID)
 		}
+	}
 
-		// Устанавливаем статус офлайн
-		_ = h.authService.SetOnline(context.Background(), client.userID, false)
+	// Запись в базу не должна задерживать цикл хаба
+	if len(recipients) > 0 {
+		go h.markDelivered(event.NewMessageID, recipients)
+	}
+}
+
+// markDelivered отмечает доставку нового сообщения получателям и сообщает отправителю о смене статуса
+func (h *Hub) markDelivered(messageID uuid.UUID, userIDs []uuid.UUID) {
+	changes, err := h.messageService.MarkDelivered(context.Background(), messageID, userIDs)
+	if err != nil {
+		log.Printf("Failed to mark message %s delivered: %v", messageID, err)
+		return
+	}
+	h.sendStatusChanges(changes)
+}
 
-		// Отправляем уведомление о статусе офлайн
-		h.broadcastUserOffline(client.userID)
+// handleUserEvent отправляет сообщение всем локальным устройствам пользователя
+func (h *Hub) handleUserEvent(event *Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 
-		log.Printf("client disconnected: %s (%s)", client.username, client.userID)
+	data := event.messageFor(event.UserID)
+	for client := range h.clients[event.UserID] {
+		client.sendRaw(data)
 	}
 }
 
-// handleBroadcast обрабатывает широковещательную рассылку
-func (h *Hub) handleBroadcast(msg broadcastMessage) {
+// handleUsersEvent доставляет событие всем устройствам пользователей из списка
+func (h *Hub) handleUsersEvent(event *Event) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	for _, client := range h.clients {
-		if msg.skipCheck || client.userID != msg.excludeID {
-			select {
-			case client.send <- msg.message:
-			default:
-				close(client.send)
-				delete(h.clients, client.userID)
-			}
+	for _, userID := range event.UserIDs {
+		for client := range h.clients[userID] {
+			client.sendRaw(event.Message)
 		}
 	}
 }
 
-// handleBroadcastToChat отправляет сообщение подписчикам чата
-func (h *Hub) handleBroadcastToChat(msg chatBroadcastMessage) {
+// handleDisconnect закрывает локальные соединения отозванных сессий
+func (h *Hub) handleDisconnect(event *Event) {
+	revoked := make(map[uuid.UUID]bool, len(event.SessionIDs))
+	for _, id := range event.SessionIDs {
+		revoked[id] = true
+	}
+
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	clients, ok := h.clientsByChat[msg.chatID]
-	if !ok {
-		return
+	for client := range h.clients[event.UserID] {
+		if revoked[client.sessionID] {
+			// Закрытие соединения завершит Read, который отменит регистрацию клиента
+			client.conn.Close()
+		}
 	}
+}
 
-	for _, client := range clients {
-		if msg.skipCheck || client.userID != msg.excludeID {
-			select {
-			case client.send <- msg.message:
-			default:
-				close(client.send)
-				delete(h.clients, client.userID)
-			}
+// handleLeave отписывает локальные устройства пользователя, покинувшего чат
+func (h *Hub) handleLeave(event *Event) {
+	h.mu.Lock()
+	var left []*Client
+	for client := range h.clients[event.UserID] {
+		if client.IsSubscribed(event.ChatID) {
+			h.unsubscribeFromChat(client, event.ChatID)
+			left = append(left, client)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, client := range left {
+		if action, ok := client.StopTyping(event.ChatID); ok {
+			h.stopTyping(client, event.ChatID, action)
 		}
 	}
 }
 
-// SubscribeToChat подписывает клиента на чат
-func (h *Hub) SubscribeToChat(client *Client, chatID uuid.UUID) error {
+// SubscribeToChat подписывает клиента на чат.
+// С withHistory клиенту отправляются последние сообщения чата.
+func (h *Hub) SubscribeToChat(client *Client, chatID uuid.UUID, withHistory bool) error {
 	// Проверяем доступ к чату
-	_, err := h.chatService.GetChat(context.Background(), chatID, client.userID)
+	chat, err := h.chatService.GetChat(context.Background(), chatID, client.userID)
 	if err != nil {
 		return err
 	}
 
 	h.mu.Lock()
-	defer h.mu.Unlock()
-
 	// Добавляем в список подписчиков чата
 	if _, ok := h.clientsByChat[chatID]; !ok {
-		h.clientsByChat[chatID] = make(map[uuid.UUID]*Client)
+		h.clientsByChat[chatID] = make(map[*Client]bool)
 	}
-	h.clientsByChat[chatID][client.userID] = client
+	h.clientsByChat[chatID][client] = true
 	client.Subscribe(chatID)
+	h.mu.Unlock()
 
-	// Отправляем непрочитанные сообщения
-	h.sendUnreadMessages(client, chatID)
+	// Отправляем непрочитанные сообщения (вне блокировки: запросы к базе)
+	if withHistory {
+		h.sendUnreadMessages(client, chat)
+	}
 
 	return nil
 }
@@ -194,14 +341,18 @@ func (h *Hub) SubscribeToChat(client *Client, chatID uuid.UUID) error {
 // UnsubscribeFromChat отписывает клиента от чата
 func (h *Hub) UnsubscribeFromChat(client *Client, chatID uuid.UUID) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	h.unsubscribeFromChat(client, chatID)
+	h.mu.Unlock()
+
+	if action, ok := client.StopTyping(chatID); ok {
+		h.stopTyping(client, chatID, action)
+	}
 }
 
-// unsubscribeFromChat внутренняя функция отписки
+// unsubscribeFromChat убирает клиента из подписчиков чата. Вызывается под h.mu.
 func (h *Hub) unsubscribeFromChat(client *Client, chatID uuid.UUID) {
 	if clients, ok := h.clientsByChat[chatID]; ok {
-		delete(clients, client.userID)
+		delete(clients, client)
 		if len(clients) == 0 {
 			delete(h.clientsByChat, chatID)
 		}
@@ -226,22 +377,35 @@ func (h *Hub) handleMessage(client *Client, msg *WSMessage) {
 		h.handleSubscribeChat(client, msg)
 	case MessageTypeUnsubscribeChat:
 		h.handleUnsubscribeChat(client, msg)
+	case MessageTypeEditMessage:
+		h.handleEditMessage(client, msg)
+	case MessageTypeDeleteMessage:
+		h.handleDeleteMessage(client, msg)
+	case MessageTypeAddReaction:
+		h.handleReaction(client, msg, true)
+	case MessageTypeRemoveReaction:
+		h.handleReaction(client, msg, false)
+	case MessageTypeForwardMessages:
+		h.handleForwardMessages(client, msg)
+	case MessageTypeSync:
+		h.handleSync(client, msg)
 	default:
-		client.SendError("unknown_type", "Unknown message type")
+		client.ReplyError(msg.RequestID, "unknown_type", "Unknown message type")
 	}
 }
 
-// handleSendMessage обрабатывает отправку сообщения
+// handleSendMessage обрабатывает отправку сообщения.
+// На запрос с request_id отвечает ack с сохранённым сообщением или ошибкой.
 func (h *Hub) handleSendMessage(client *Client, msg *WSMessage) {
 	var payload SendMessagePayload
 	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &payload); err != nil {
-		client.SendError("invalid_payload", "Failed to parse payload")
+		client.ReplyError(msg.RequestID, "invalid_payload", "Failed to parse payload")
 		return
 	}
 
 	chatID, err := uuid.Parse(payload.ChatID)
 	if err != nil {
-		client.SendError("invalid_chat_id", "Invalid chat ID")
+		client.ReplyError(msg.RequestID, "invalid_chat_id", "Invalid chat ID")
 		return
 	}
 
@@ -259,7 +423,7 @@ func (h *Hub) handleSendMessage(client *Client, msg *WSMessage) {
 	}
 
 	// Отправляем сообщение через сервис
-	sentMsg, err := h.messageService.SendMessage(
+	sentMsg, created, err := h.messageService.SendMessage(
 		context.Background(),
 		chatID,
 		client.userID,
@@ -267,222 +431,893 @@ func (h *Hub) handleSendMessage(client *Client, msg *WSMessage) {
 		messageType,
 		payload.MediaURL,
 		replyToID,
+		payload.ClientMsgID,
 	)
 	if err != nil {
-		client.SendError("send_failed", err.Error())
+		client.ReplyError(msg.RequestID, sendErrorCode(err), err.Error())
 		return
 	}
 
-	// Получаем данные отправителя
-	senderName := client.username
-	senderAvatar := ""
-	if user, _ := h.userRepo.GetByID(context.Background(), client.userID); user != nil {
-		senderName = user.GetFullName()
-		senderAvatar = user.AvatarURL
+	// Отправленное сообщение завершает набор текста в чате
+	if action, ok := client.StopTyping(chatID); ok {
+		h.stopTyping(client, chatID, action)
 	}
 
-	// Формируем ответ
-	response := &WSMessage{
+	response := h.newMessageEvent(sentMsg, client.username)
+
+	// Повтор уже отправленного сообщения: рассылка была при первой отправке
+	if !created {
+		h.replySent(client, msg.RequestID, response, 0, true)
+		return
+	}
+
+	// Рассылаем другим подписчикам чата, включая другие устройства отправителя,
+	// а отправителю — то же событие с его номером обновления
+	event := h.publishNewMessage(sentMsg, response, client)
+	h.replySent(client, msg.RequestID, response, event.Seqs[client.userID], false)
+	h.broadcastThreadUpdated(sentMsg)
+}
+
+// replySent отвечает отправителю на отправку сообщения: ack на запрос с request_id,
+// иначе событием message, как остальным подписчикам
+func (h *Hub) replySent(client *Client, requestID string, response *WSMessage, seq int64, duplicate bool) {
+	payload := response.Payload.(MessagePayload)
+
+	if requestID == "" {
+		client.Send(&WSMessage{
+			Seq:       seq,
+			Type:      response.Type,
+			Timestamp: response.Timestamp,
+			Payload:   payload,
+		})
+		return
+	}
+
+	client.SendAck(requestID, seq, AckPayload{
+		OK:          true,
+		ClientMsgID: payload.ClientMsgID,
+		Duplicate:   duplicate,
+		Message:     &payload,
+	})
+}
+
+// sendErrorCode возвращает код ошибки отправки сообщения для клиента
+func sendErrorCode(err error) string {
+	switch err {
+	case service.ErrNotMember:
+		return "access_denied"
+	case service.ErrEmptyContent:
+		return "empty_content"
+	case service.ErrReplyNotFound:
+		return "reply_not_found"
+	case service.ErrAttachmentNotFound:
+		return "attachment_not_found"
+	case service.ErrAttachmentUnavailable:
+		return "attachment_unavailable"
+	case service.ErrInvalidClientMsgID:
+		return "invalid_client_msg_id"
+	case service.ErrClientMsgIDReused:
+		return "client_msg_id_reused"
+	case service.ErrUserBlocked:
+		return "user_blocked"
+	case service.ErrNoPermission:
+		return "no_permission"
+	case service.ErrChatNotFound:
+		return "chat_not_found"
+	default:
+		return "send_failed"
+	}
+}
+
+// newMessageEvent формирует событие о новом сообщении
+func (h *Hub) newMessageEvent(message *models.Message, fallbackName string) *WSMessage {
+	payload := ToMessagePayload(message)
+	if payload.SenderName == "" {
+		payload.SenderName = fallbackName
+	}
+
+	return &WSMessage{
 		Type:      MessageTypeMessage,
 		Timestamp: time.Now(),
-		Payload: MessagePayload{
-			ID:          sentMsg.ID.String(),
-			ChatID:      sentMsg.ChatID.String(),
-			SenderID:    sentMsg.SenderID.String(),
-			SenderName:  senderName,
-			SenderAvatar: senderAvatar,
-			Content:     sentMsg.Content,
-			MessageType: string(sentMsg.MessageType),
-			MediaURL:    sentMsg.MediaURL,
-			IsEdited:    sentMsg.IsEdited,
-			IsDeleted:   sentMsg.IsDeleted,
-			Status:      string(sentMsg.Status),
-			CreatedAt:   sentMsg.CreatedAt,
-		},
+		Payload:   payload,
 	}
+}
 
-	// Отправляем отправителю
-	client.Send(response)
+// BroadcastNewMessage рассылает сообщение, отправленное через REST, подписчикам чата
+func (h *Hub) BroadcastNewMessage(message *models.Message) {
+	h.publishNewMessage(message, h.newMessageEvent(message, ""), nil)
+	h.broadcastThreadUpdated(message)
+}
 
-	// Рассылаем другим подписчикам чата
-	h.BroadcastToChat(chatID, response, true)
+// publishNewMessage рассылает событие о новом сообщении подписчикам чата, кроме соединения except.
+// Получившие его реплики отмечают доставку. В каналах доставка не отслеживается.
+func (h *Hub) publishNewMessage(message *models.Message, msg *WSMessage, except *Client) *Event {
+	event := &Event{
+		Type:    EventTypeChat,
+		ChatID:  message.ChatID,
+		Message: mustMarshal(msg),
+	}
+	if message.Chat == nil || message.Chat.Type != models.ChatTypeChannel {
+		event.NewMessageID = message.ID
+	}
+	if except != nil {
+		event.ExcludeConnID = except.id
+	}
+	h.recordChatUpdate(event, msg.Type)
+	h.publish(event)
+	return event
 }
 
-// handleReadMessage обрабатывает отметку прочтения сообщения
+// broadcastThreadUpdated рассылает новую сводку ветки после ответа в ней
+func (h *Hub) broadcastThreadUpdated(message *models.Message) {
+	if message.ThreadID == nil {
+		return
+	}
+
+	thread, err := h.messageService.GetThreadStats(context.Background(), *message.ThreadID)
+	if err != nil {
+		log.Printf("Failed to load thread %s stats: %v", *message.ThreadID, err)
+		return
+	}
+
+	h.BroadcastToChat(message.ChatID, &WSMessage{
+		Type:      MessageTypeThreadUpdated,
+		Timestamp: time.Now(),
+		Payload: ThreadUpdatedPayload{
+			ChatID:      message.ChatID.String(),
+			ThreadID:    message.ThreadID.String(),
+			ReplyCount:  thread.ReplyCount,
+			LastReplyAt: thread.LastReplyAt,
+			LastReplyID: message.ID.String(),
+		},
+	})
+}
+
+// handleReadMessage обрабатывает отметку прочтения сообщений чата до указанного включительно
 func (h *Hub) handleReadMessage(client *Client, msg *WSMessage) {
 	var payload ReadMessagePayload
 	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &payload); err != nil {
-		client.SendError("invalid_payload", "Failed to parse payload")
+		client.ReplyError(msg.RequestID, "invalid_payload", "Failed to parse payload")
 		return
 	}
 
 	messageID, err := uuid.Parse(payload.MessageID)
 	if err != nil {
-		client.SendError("invalid_message_id", "Invalid message ID")
+		client.ReplyError(msg.RequestID, "invalid_message_id", "Invalid message ID")
 		return
 	}
 
-	// Получаем сообщение
-	message, err := h.messageRepo.GetByID(context.Background(), messageID)
-	if err != nil || message == nil {
-		client.SendError("message_not_found", "Message not found")
+	update, err := h.messageService.MarkAsRead(context.Background(), messageID, client.userID)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "read_failed", err.Error())
 		return
 	}
 
-	// Отмечаем как прочитанное
-	_ = h.messageService.MarkAsRead(context.Background(), messageID, client.userID)
-
-	// Отправляем уведомление
-	response := &WSMessage{
-		Type:      MessageTypeMessageRead,
-		Timestamp: time.Now(),
-		Payload: MessageReadPayload{
-			MessageID: messageID.String(),
-			UserID:    client.userID.String(),
-			ReadAt:    time.Now(),
-		},
-	}
-
-	// Рассылаем подписчикам чата
-	h.BroadcastToChat(message.ChatID, response, false)
+	h.BroadcastRead(update)
 }
 
 // handleReadChat обрабатывает отметку прочтения чата
 func (h *Hub) handleReadChat(client *Client, msg *WSMessage) {
 	var payload ReadChatPayload
 	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &payload); err != nil {
-		client.SendError("invalid_payload", "Failed to parse payload")
+		client.ReplyError(msg.RequestID, "invalid_payload", "Failed to parse payload")
 		return
 	}
 
 	chatID, err := uuid.Parse(payload.ChatID)
 	if err != nil {
-		client.SendError("invalid_chat_id", "Invalid chat ID")
+		client.ReplyError(msg.RequestID, "invalid_chat_id", "Invalid chat ID")
+		return
+	}
+
+	update, err := h.messageService.MarkChatAsRead(context.Background(), chatID, client.userID)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "read_failed", err.Error())
 		return
 	}
 
-	// Отмечаем все сообщения как прочитанные
-	_ = h.messageService.MarkChatAsRead(context.Background(), chatID, client.userID)
+	h.BroadcastRead(update)
 }
 
-// handleTyping обрабатывает статус набора текста
+// BroadcastRead сообщает подписчикам чата о прочтении, а авторам прочитанных сообщений —
+// об изменении сводного статуса. Повторное прочтение не рассылается.
+// Прочтение в канале видят только другие устройства самого читателя.
+func (h *Hub) BroadcastRead(update *service.ReadUpdate) {
+	if update.Count == 0 {
+		return
+	}
+
+	msg := &WSMessage{
+		Type:      MessageTypeMessageRead,
+		Timestamp: time.Now(),
+		Payload: MessageReadPayload{
+			ChatID:    update.ChatID.String(),
+			MessageID: update.LastReadID.String(),
+			UserID:    update.UserID.String(),
+			ReadAt:    update.ReadAt,
+		},
+	}
+	if update.IsChannel {
+		h.SendToUser(update.UserID, msg)
+		return
+	}
+
+	h.BroadcastToChat(update.ChatID, msg)
+
+	h.sendStatusChanges(update.StatusChanges)
+}
+
+// sendStatusChanges отправляет авторам сообщений новый сводный статус
+func (h *Hub) sendStatusChanges(changes []models.MessageStatusChange) {
+	now := time.Now()
+	for _, change := range changes {
+		h.SendToUser(change.SenderID, &WSMessage{
+			Type:      MessageTypeMessageStatus,
+			Timestamp: now,
+			Payload: MessageStatusPayload{
+				MessageID: change.MessageID.String(),
+				ChatID:    change.ChatID.String(),
+				Status:    string(change.Status),
+				UpdatedAt: now,
+			},
+		})
+	}
+}
+
+// handleTyping обрабатывает начало и конец активности в чате (набор текста, запись голосового, загрузка файла)
 func (h *Hub) handleTyping(client *Client, msg *WSMessage, isTyping bool) {
 	var payload TypingPayload
 	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &payload); err != nil {
-		client.SendError("invalid_payload", "Failed to parse payload")
+		client.ReplyError(msg.RequestID, "invalid_payload", "Failed to parse payload")
 		return
 	}
 
 	chatID, err := uuid.Parse(payload.ChatID)
 	if err != nil {
-		client.SendError("invalid_chat_id", "Invalid chat ID")
+		client.ReplyError(msg.RequestID, "invalid_chat_id", "Invalid chat ID")
 		return
 	}
 
-	// Обновляем статус
-	client.SetTyping(chatID, isTyping)
+	if !isTyping {
+		if action, ok := client.StopTyping(chatID); ok {
+			h.stopTyping(client, chatID, action)
+		}
+		return
+	}
 
-	// Отправляем уведомление другим участникам
-	response := &WSMessage{
+	action := payload.Action
+	if action == "" {
+		action = TypingActionTyping
+	}
+	if !action.IsValid() {
+		client.ReplyError(msg.RequestID, "invalid_action", "Unknown typing action")
+		return
+	}
+
+	// Право писать и блокировку в личном чате проверяем в начале активности,
+	// продления обходятся без запросов к базе.
+	// Подписчики каналов писать не могут, поэтому их активность не рассылается.
+	if !client.IsTyping(chatID) {
+		membership, err := h.chatRepo.GetMemberWithChat(context.Background(), chatID, client.userID)
+		if err != nil || membership == nil || membership.Chat == nil || !membership.IsActive() {
+			client.ReplyError(msg.RequestID, "access_denied", "Access denied")
+			return
+		}
+		if !membership.Permissions(membership.Chat).Has(models.PermissionSendMessages) {
+			client.ReplyError(msg.RequestID, "no_permission", "No permission to write in this chat")
+			return
+		}
+		if err := h.messageService.CheckNotBlocked(context.Background(), chatID, client.userID); err != nil {
+			client.ReplyError(msg.RequestID, sendErrorCode(err), err.Error())
+			return
+		}
+	}
+
+	notify := client.StartTyping(chatID, action, func(action TypingAction) {
+		h.stopTyping(client, chatID, action)
+	})
+	if notify {
+		h.startTyping(client, chatID, action)
+	}
+}
+
+// startTyping отмечает активность устройства и рассылает её от имени пользователя
+func (h *Hub) startTyping(client *Client, chatID uuid.UUID, action TypingAction) {
+	key := typingKey{userID: client.userID, chatID: chatID}
+
+	h.typingMu.Lock()
+	devices := h.typing[key]
+	if devices == nil {
+		devices = make(map[*Client]TypingAction)
+		h.typing[key] = devices
+	}
+	devices[client] = action
+	h.typingMu.Unlock()
+
+	h.broadcastTyping(client, chatID, action, true)
+}
+
+// stopTyping снимает активность устройства. Для собеседников пользователь
+// перестаёт печатать, только когда активность снята на всех его устройствах,
+// иначе им рассылается активность оставшегося устройства.
+//
+// Устройства на других репликах здесь не видны: если одно из них ещё активно,
+// оно повторит рассылку при ближайшем продлении (не позже typingThrottle).
+func (h *Hub) stopTyping(client *Client, chatID uuid.UUID, action TypingAction) {
+	key := typingKey{userID: client.userID, chatID: chatID}
+
+	h.typingMu.Lock()
+	devices := h.typing[key]
+	delete(devices, client)
+	var remaining TypingAction
+	for _, deviceAction := range devices {
+		remaining = deviceAction
+		break
+	}
+	if len(devices) == 0 {
+		delete(h.typing, key)
+	}
+	h.typingMu.Unlock()
+
+	if remaining == "" {
+		h.broadcastTyping(client, chatID, action, false)
+		return
+	}
+	if remaining != action {
+		h.broadcastTyping(client, chatID, remaining, true)
+	}
+}
+
+// broadcastTyping рассылает активность пользователя подписчикам чата.
+// Другим устройствам самого пользователя она не показывается и в журнал обновлений не пишется.
+func (h *Hub) broadcastTyping(client *Client, chatID uuid.UUID, action TypingAction, isTyping bool) {
+	payload := TypingStatusPayload{
+		ChatID:   chatID.String(),
+		UserID:   client.userID.String(),
+		UserName: client.username,
+		IsTyping: isTyping,
+		Action:   action,
+	}
+	if isTyping {
+		payload.ExpiresIn = int(h.typingTimeout / time.Second)
+	}
+
+	client.BroadcastToChat(chatID, &WSMessage{
 		Type:      MessageTypeTyping,
 		Timestamp: time.Now(),
-		Payload: TypingStatusPayload{
-			ChatID:   chatID.String(),
-			UserID:   client.userID.String(),
-			UserName: client.username,
-			IsTyping: isTyping,
-		},
+		Payload:   payload,
+	}, true)
+}
+
+// handleEditMessage обрабатывает редактирование сообщения
+func (h *Hub) handleEditMessage(client *Client, msg *WSMessage) {
+	var payload EditMessagePayload
+	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &payload); err != nil {
+		client.ReplyError(msg.RequestID, "invalid_payload", "Failed to parse payload")
+		return
+	}
+
+	chatID, err := uuid.Parse(payload.ChatID)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "invalid_chat_id", "Invalid chat ID")
+		return
+	}
+
+	messageID, err := uuid.Parse(payload.MessageID)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "invalid_message_id", "Invalid message ID")
+		return
+	}
+
+	edited, err := h.messageService.UpdateMessage(context.Background(), chatID, messageID, client.userID, payload.Content)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "edit_failed", err.Error())
+		return
 	}
 
-	h.BroadcastToChat(chatID, response, true)
+	h.BroadcastMessageEdited(edited)
+}
+
+// handleDeleteMessage обрабатывает удаление сообщения
+func (h *Hub) handleDeleteMessage(client *Client, msg *WSMessage) {
+	var payload DeleteMessagePayload
+	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &payload); err != nil {
+		client.ReplyError(msg.RequestID, "invalid_payload", "Failed to parse payload")
+		return
+	}
+
+	chatID, err := uuid.Parse(payload.ChatID)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "invalid_chat_id", "Invalid chat ID")
+		return
+	}
+
+	messageID, err := uuid.Parse(payload.MessageID)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "invalid_message_id", "Invalid message ID")
+		return
+	}
+
+	if _, err := h.messageService.DeleteMessage(context.Background(), chatID, messageID, client.userID, payload.ForEveryone); err != nil {
+		client.ReplyError(msg.RequestID, "delete_failed", err.Error())
+		return
+	}
+
+	h.BroadcastMessageDeleted(client.userID, chatID, messageID, payload.ForEveryone)
+}
+
+// handleReaction обрабатывает добавление и снятие реакции
+func (h *Hub) handleReaction(client *Client, msg *WSMessage, add bool) {
+	var payload ReactionPayload
+	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &payload); err != nil {
+		client.ReplyError(msg.RequestID, "invalid_payload", "Failed to parse payload")
+		return
+	}
+
+	chatID, err := uuid.Parse(payload.ChatID)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "invalid_chat_id", "Invalid chat ID")
+		return
+	}
+
+	messageID, err := uuid.Parse(payload.MessageID)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "invalid_message_id", "Invalid message ID")
+		return
+	}
+
+	var update *service.ReactionUpdate
+	if add {
+		update, err = h.messageService.AddReaction(context.Background(), chatID, messageID, client.userID, payload.Emoji)
+	} else {
+		update, err = h.messageService.RemoveReaction(context.Background(), chatID, messageID, client.userID, payload.Emoji)
+	}
+	if err != nil {
+		client.ReplyError(msg.RequestID, "reaction_failed", err.Error())
+		return
+	}
+
+	h.BroadcastReactionUpdated(update)
+}
+
+// handleForwardMessages обрабатывает пересылку сообщений в другие чаты
+func (h *Hub) handleForwardMessages(client *Client, msg *WSMessage) {
+	var payload ForwardMessagesPayload
+	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &payload); err != nil {
+		client.ReplyError(msg.RequestID, "invalid_payload", "Failed to parse payload")
+		return
+	}
+
+	chatID, err := uuid.Parse(payload.ChatID)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "invalid_chat_id", "Invalid chat ID")
+		return
+	}
+
+	messageIDs := make([]uuid.UUID, 0, len(payload.MessageIDs))
+	for _, value := range payload.MessageIDs {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			client.ReplyError(msg.RequestID, "invalid_message_id", "Invalid message ID")
+			return
+		}
+		messageIDs = append(messageIDs, id)
+	}
+
+	targetChatIDs := make([]uuid.UUID, 0, len(payload.TargetChatIDs))
+	for _, value := range payload.TargetChatIDs {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			client.ReplyError(msg.RequestID, "invalid_chat_id", "Invalid chat ID")
+			return
+		}
+		targetChatIDs = append(targetChatIDs, id)
+	}
+
+	messages, err := h.messageService.ForwardMessages(context.Background(), client.userID, chatID, messageIDs, targetChatIDs)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "forward_failed", err.Error())
+		return
+	}
+
+	for i := range messages {
+		h.BroadcastNewMessage(&messages[i])
+	}
 }
 
 // handleSubscribeChat обрабатывает подписку на чат
 func (h *Hub) handleSubscribeChat(client *Client, msg *WSMessage) {
 	var payload SubscribePayload
 	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &payload); err != nil {
-		client.SendError("invalid_payload", "Failed to parse payload")
+		client.ReplyError(msg.RequestID, "invalid_payload", "Failed to parse payload")
 		return
 	}
 
 	chatID, err := uuid.Parse(payload.ChatID)
 	if err != nil {
-		client.SendError("invalid_chat_id", "Invalid chat ID")
+		client.ReplyError(msg.RequestID, "invalid_chat_id", "Invalid chat ID")
 		return
 	}
 
-	if err := h.SubscribeToChat(client, chatID); err != nil {
-		client.SendError("subscribe_failed", err.Error())
+	if err := h.SubscribeToChat(client, chatID, !payload.NoHistory); err != nil {
+		client.ReplyError(msg.RequestID, "subscribe_failed", err.Error())
 		return
 	}
 }
 
+// handleSync отправляет клиенту обновления, пропущенные после since
+func (h *Hub) handleSync(client *Client, msg *WSMessage) {
+	var payload SyncPayload
+	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &payload); err != nil {
+		client.ReplyError(msg.RequestID, "invalid_payload", "Failed to parse payload")
+		return
+	}
+
+	result, err := h.syncService.GetUpdates(context.Background(), client.userID, payload.Since, payload.ChannelPts, payload.Limit)
+	if err != nil {
+		client.ReplyError(msg.RequestID, "sync_failed", err.Error())
+		return
+	}
+
+	client.Send(&WSMessage{
+		Type:      MessageTypeSyncResult,
+		RequestID: msg.RequestID,
+		Timestamp: time.Now(),
+		Payload:   ToSyncResultPayload(result),
+	})
+}
+
 // handleUnsubscribeChat обрабатывает отписку от чата
 func (h *Hub) handleUnsubscribeChat(client *Client, msg *WSMessage) {
 	var payload SubscribePayload
 	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &payload); err != nil {
-		client.SendError("invalid_payload", "Failed to parse payload")
+		client.ReplyError(msg.RequestID, "invalid_payload", "Failed to parse payload")
 		return
 	}
 
 	chatID, err := uuid.Parse(payload.ChatID)
 	if err != nil {
-		client.SendError("invalid_chat_id", "Invalid chat ID")
+		client.ReplyError(msg.RequestID, "invalid_chat_id", "Invalid chat ID")
 		return
 	}
 
 	h.UnsubscribeFromChat(client, chatID)
 }
 
-// sendUnreadMessages отправляет непрочитанные сообщения
-func (h *Hub) sendUnreadMessages(client *Client, chatID uuid.UUID) {
-	messages, err := h.messageRepo.GetChatMessages(context.Background(), chatID, 50, 0)
+// sendUnreadMessages отправляет последние сообщения чата
+func (h *Hub) sendUnreadMessages(client *Client, chat *models.Chat) {
+	chatID := chat.ID
+	page, err := h.messageService.GetMessagesPage(context.Background(), chatID, client.userID, service.MessagePageParams{
+		Limit: 50,
+	})
 	if err != nil {
 		return
 	}
 
-	for _, msg := range messages {
-		senderName := ""
-		senderAvatar := ""
-		if msg.Sender != nil {
-			senderName = msg.Sender.GetFullName()
-			senderAvatar = msg.Sender.AvatarURL
-		}
-
+	messageIDs := make([]uuid.UUID, 0, len(page.Messages))
+	for i := range page.Messages {
 		client.Send(&WSMessage{
 			Type:      MessageTypeMessage,
 			Timestamp: time.Now(),
-			Payload: MessagePayload{
-				ID:          msg.ID.String(),
-				ChatID:      msg.ChatID.String(),
-				SenderID:    msg.SenderID.String(),
-				SenderName:  senderName,
-				SenderAvatar: senderAvatar,
-				Content:     msg.Content,
-				MessageType: string(msg.MessageType),
-				MediaURL:    msg.MediaURL,
-				IsEdited:    msg.IsEdited,
-				IsDeleted:   msg.IsDeleted,
-				Status:      string(msg.Status),
-				CreatedAt:   msg.CreatedAt,
+			Payload:   ToMessagePayload(&page.Messages[i]),
+		})
+		messageIDs = append(messageIDs, page.Messages[i].ID)
+	}
+
+	// Доставленной считается только отправленная устройству страница истории,
+	// а не вся история чата. В каналах доставка не отслеживается.
+	if chat.Type == models.ChatTypeChannel || len(messageIDs) == 0 {
+		return
+	}
+	changes, err := h.messageService.MarkChatDelivered(context.Background(), chatID, client.userID, messageIDs)
+	if err != nil {
+		log.Printf("Failed to mark chat %s delivered: %v", chatID, err)
+		return
+	}
+	h.sendStatusChanges(changes)
+}
+
+// BroadcastToChat отправляет сообщение всем подписчикам чата на всех репликах
+// и записывает его в журналы обновлений участников
+func (h *Hub) BroadcastToChat(chatID uuid.UUID, msg *WSMessage) {
+	event := &Event{
+		Type:    EventTypeChat,
+		ChatID:  chatID,
+		Message: mustMarshal(msg),
+	}
+	h.recordChatUpdate(event, msg.Type)
+	h.publish(event)
+}
+
+// SendToUser отправляет сообщение всем соединениям пользователя
+// и записывает его в журнал обновлений пользователя
+func (h *Hub) SendToUser(userID uuid.UUID, msg *WSMessage) {
+	event := &Event{
+		Type:    EventTypeUser,
+		UserID:  userID,
+		Message: mustMarshal(msg),
+	}
+
+	seq, err := h.syncService.RecordUserUpdate(context.Background(), userID, string(msg.Type), event.Message)
+	if err != nil {
+		log.Printf("Failed to record %s update for user %s: %v", msg.Type, userID, err)
+	} else {
+		event.Seqs = map[uuid.UUID]int64{userID: seq}
+	}
+
+	h.publish(event)
+}
+
+// recordChatUpdate записывает событие чата в журналы участников.
+// Без записи событие всё равно доставляется, но не попадёт в досинхронизацию.
+//
+// Номер выдаётся до публикации, а параллельные рассылки (и рассылки разных
+// реплик) публикуются независимо, поэтому по соединению события могут прийти
+// не в порядке seq. Клиент продолжает синхронизацию с последнего номера,
+// до которого получил все события без пропусков, а не с максимального.
+func (h *Hub) recordChatUpdate(event *Event, updateType MessageType) {
+	seqs, err := h.syncService.RecordChatUpdate(context.Background(), event.ChatID, string(updateType), event.Message)
+	if err != nil {
+		log.Printf("Failed to record %s update for chat %s: %v", updateType, event.ChatID, err)
+		return
+	}
+	event.Seqs = seqs
+}
+
+// BroadcastMessageEdited рассылает отредактированное сообщение подписчикам чата
+func (h *Hub) BroadcastMessageEdited(message *models.Message) {
+	h.BroadcastToChat(message.ChatID, &WSMessage{
+		Type:      MessageTypeMessageEdited,
+		Timestamp: time.Now(),
+		Payload:   ToMessagePayload(message),
+	})
+}
+
+// BroadcastReactionUpdated рассылает изменение реакций подписчикам чата.
+// Повторная постановка или снятие той же реакции не рассылается.
+// В каналах событие не говорит, кто поставил реакцию: подписчики видят только сводку.
+func (h *Hub) BroadcastReactionUpdated(update *service.ReactionUpdate) {
+	if !update.Changed {
+		return
+	}
+
+	payload := ReactionUpdatedPayload{
+		ChatID:    update.ChatID.String(),
+		MessageID: update.MessageID.String(),
+		Emoji:     update.Emoji,
+		Added:     update.Added,
+		Reactions: update.Reactions,
+	}
+	if !update.Anonymous {
+		payload.UserID = update.UserID.String()
+	}
+
+	h.BroadcastToChat(update.ChatID, &WSMessage{
+		Type:      MessageTypeReactionUpdated,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+}
+
+// BroadcastMessagePinned рассылает закреплённое сообщение подписчикам чата
+func (h *Hub) BroadcastMessagePinned(pin *models.PinnedMessage) {
+	payload := MessagePinnedPayload{
+		ChatID:    pin.ChatID.String(),
+		MessageID: pin.MessageID.String(),
+		PinnedAt:  pin.PinnedAt,
+	}
+	if pin.PinnedBy != nil {
+		payload.PinnedBy = pin.PinnedBy.String()
+	}
+	if pin.Message != nil {
+		message := ToMessagePayload(pin.Message)
+		payload.Message = &message
+	}
+
+	h.BroadcastToChat(pin.ChatID, &WSMessage{
+		Type:      MessageTypeMessagePinned,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+}
+
+// BroadcastMessageUnpinned уведомляет подписчиков чата об откреплении сообщения
+func (h *Hub) BroadcastMessageUnpinned(chatID, messageID, userID uuid.UUID) {
+	h.BroadcastToChat(chatID, &WSMessage{
+		Type:      MessageTypeMessageUnpinned,
+		Timestamp: time.Now(),
+		Payload: MessageUnpinnedPayload{
+			ChatID:     chatID.String(),
+			MessageID:  messageID.String(),
+			UnpinnedBy: userID.String(),
+		},
+	})
+}
+
+// BroadcastChatUpdated рассылает новые параметры чата подписчикам чата
+func (h *Hub) BroadcastChatUpdated(chat *models.Chat) {
+	h.BroadcastToChat(chat.ID, &WSMessage{
+		Type:      MessageTypeChatUpdated,
+		Timestamp: time.Now(),
+		Payload:   ToChatUpdatedPayload(chat),
+	})
+}
+
+// NotifyNewChat сообщает пользователям о чате, в котором они оказались.
+// Они ещё не подписаны на чат, поэтому событие идёт каждому лично.
+func (h *Hub) NotifyNewChat(chat *models.Chat, userIDs []uuid.UUID) {
+	msg := &WSMessage{
+		Type:      MessageTypeNewChat,
+		Timestamp: time.Now(),
+		Payload:   ToChatUpdatedPayload(chat),
+	}
+
+	notified := make(map[uuid.UUID]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if notified[userID] {
+			continue
+		}
+		notified[userID] = true
+		h.SendToUser(userID, msg)
+	}
+}
+
+// NotifyContactJoined сообщает импортировавшим номер пользователя, что он зарегистрировался
+func (h *Hub) NotifyContactJoined(user *models.User, contacts []models.Contact) {
+	for _, contact := range contacts {
+		h.SendToUser(contact.UserID, &WSMessage{
+			Type:      MessageTypeContactJoined,
+			Timestamp: time.Now(),
+			Payload: ContactJoinedPayload{
+				UserID:    user.ID.String(),
+				Username:  user.Username,
+				FirstName: contact.FirstName,
+				LastName:  contact.LastName,
 			},
 		})
 	}
 }
 
-// BroadcastToChat отправляет сообщение всем подписчикам чата
-func (h *Hub) BroadcastToChat(chatID uuid.UUID, msg *WSMessage, excludeSelf bool) {
-	h.broadcastToChat <- chatBroadcastMessage{
-		chatID:    chatID,
-		message:   mustMarshal(msg),
-		excludeID: uuid.Nil,
-		skipCheck: !excludeSelf,
+// BroadcastChatDeleted уведомляет участников об удалении чата
+func (h *Hub) BroadcastChatDeleted(chatID uuid.UUID) {
+	h.BroadcastToChat(chatID, &WSMessage{
+		Type:      MessageTypeChatDeleted,
+		Timestamp: time.Now(),
+		Payload: ChatDeletedPayload{
+			ChatID: chatID.String(),
+		},
+	})
+}
+
+// BroadcastMemberAdded уведомляет подписчиков чата о новом участнике,
+// а самого участника — о новом чате. О подписчиках каналов другим не сообщается.
+func (h *Hub) BroadcastMemberAdded(chat *models.Chat, userID, actorID uuid.UUID) {
+	if chat.Type == models.ChatTypeChannel {
+		h.NotifyNewChat(chat, []uuid.UUID{userID})
+		return
 	}
+
+	h.BroadcastToChat(chat.ID, &WSMessage{
+		Type:      MessageTypeMemberAdded,
+		Timestamp: time.Now(),
+		Payload: MemberPayload{
+			ChatID:  chat.ID.String(),
+			UserID:  userID.String(),
+			ActorID: actorID.String(),
+		},
+	})
+
+	h.NotifyNewChat(chat, []uuid.UUID{userID})
 }
 
-// broadcastUserOnline отправляет уведомление о статусе онлайн
-func (h *Hub) broadcastUserOnline(userID uuid.UUID, username string) {
+// BroadcastMemberRemoved уведомляет оставшихся участников и удалённого пользователя
+// об удалении участника. Удалённый уже не участник, поэтому получает событие лично.
+// Об отписке от канала узнаёт только сам подписчик.
+func (h *Hub) BroadcastMemberRemoved(chat *models.Chat, userID, actorID uuid.UUID) {
 	msg := &WSMessage{
+		Type:      MessageTypeMemberRemoved,
+		Timestamp: time.Now(),
+		Payload: MemberPayload{
+			ChatID:  chat.ID.String(),
+			UserID:  userID.String(),
+			ActorID: actorID.String(),
+		},
+	}
+
+	// Сначала отписываем удалённого на всех репликах, чтобы события чата,
+	// включая это, до него больше не доходили
+	h.publish(&Event{Type: EventTypeLeave, ChatID: chat.ID, UserID: userID})
+
+	if chat.Type != models.ChatTypeChannel {
+		h.BroadcastToChat(chat.ID, msg)
+	}
+	h.SendToUser(userID, msg)
+}
+
+// BroadcastMemberUpdated уведомляет подписчиков чата о смене роли или прав участника
+func (h *Hub) BroadcastMemberUpdated(membership *models.ChatMembership, actorID uuid.UUID) {
+	h.BroadcastToChat(membership.ChatID, &WSMessage{
+		Type:      MessageTypeMemberUpdated,
+		Timestamp: time.Now(),
+		Payload: MemberUpdatedPayload{
+			ChatID:           membership.ChatID.String(),
+			UserID:           membership.UserID.String(),
+			ActorID:          actorID.String(),
+			Role:             string(membership.Role),
+			AdminPermissions: membership.AdminPermissions,
+		},
+	})
+}
+
+// NotifyJoinRequest сообщает участникам, которые могут одобрить заявку, о новой заявке на вступление
+func (h *Hub) NotifyJoinRequest(request *models.ChatJoinRequest, approverIDs []uuid.UUID) {
+	msg := &WSMessage{
+		Type:      MessageTypeJoinRequest,
+		Timestamp: time.Now(),
+		Payload: JoinRequestPayload{
+			ChatID: request.ChatID.String(),
+			UserID: request.UserID.String(),
+		},
+	}
+
+	for _, userID := range approverIDs {
+		h.SendToUser(userID, msg)
+	}
+}
+
+// BroadcastMessageDeleted уведомляет об удалении сообщения.
+// Удаление "только у себя" доставляется лишь соединениям самого пользователя.
+func (h *Hub) BroadcastMessageDeleted(userID, chatID, messageID uuid.UUID, forEveryone bool) {
+	response := &WSMessage{
+		Type:      MessageTypeMessageDeleted,
+		Timestamp: time.Now(),
+		Payload: MessageDeletedPayload{
+			MessageID:   messageID.String(),
+			ChatID:      chatID.String(),
+			ForEveryone: forEveryone,
+		},
+	}
+
+	if !forEveryone {
+		h.SendToUser(userID, response)
+		return
+	}
+
+	h.BroadcastToChat(chatID, response)
+}
+
+// presenceAudience возвращает, кому виден статус пользователя, или nil при ошибке.
+// Требует запросов к базе, поэтому вызывается только из очередей присутствия.
+func (h *Hub) presenceAudience(userID uuid.UUID) *service.PresenceAudience {
+	audience, err := h.authService.GetPresenceAudience(context.Background(), userID)
+	if err != nil {
+		log.Printf("failed to get presence audience for %s: %v", userID, err)
+		return nil
+	}
+	return audience
+}
+
+// publishToUsers отправляет сообщение всем устройствам пользователей из списка
+func (h *Hub) publishToUsers(userIDs []uuid.UUID, msg *WSMessage) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	h.publish(&Event{
+		Type:    EventTypeUsers,
+		UserIDs: userIDs,
+		Message: mustMarshal(msg),
+	})
+}
+
+// broadcastUserOnline отправляет статус онлайн собеседникам, которым он виден
+func (h *Hub) broadcastUserOnline(userID uuid.UUID, username string) {
+	audience := h.presenceAudience(userID)
+	if audience == nil {
+		return
+	}
+
+	h.publishToUsers(audience.Online, &WSMessage{
 		Type:      MessageTypeUserOnline,
 		Timestamp: time.Now(),
 		Payload: UserStatusPayload{
@@ -490,59 +1325,102 @@ func (h *Hub) broadcastUserOnline(userID uuid.UUID, username string) {
 			Username: username,
 			IsOnline: true,
 		},
+	})
+}
+
+// broadcastUserOffline отправляет статус офлайн собеседникам, которым он виден.
+// Время последнего визита получают только те, кому его разрешено видеть.
+func (h *Hub) broadcastUserOffline(userID uuid.UUID) {
+	audience := h.presenceAudience(userID)
+	if audience == nil {
+		return
 	}
 
-	h.broadcast <- broadcastMessage{
-		message:   mustMarshal(msg),
-		excludeID: userID,
-		skipCheck: false,
+	now := time.Now()
+	var withLastSeen, withoutLastSeen []uuid.UUID
+	for _, id := range audience.Online {
+		if audience.LastSeen[id] {
+			withLastSeen = append(withLastSeen, id)
+		} else {
+			withoutLastSeen = append(withoutLastSeen, id)
+		}
 	}
+
+	h.publishToUsers(withLastSeen, &WSMessage{
+		Type:      MessageTypeUserOffline,
+		Timestamp: now,
+		Payload: UserStatusPayload{
+			UserID:   userID.String(),
+			IsOnline: false,
+			LastSeen: &now,
+		},
+	})
+	h.publishToUsers(withoutLastSeen, &WSMessage{
+		Type:      MessageTypeUserOffline,
+		Timestamp: now,
+		Payload: UserStatusPayload{
+			UserID:   userID.String(),
+			IsOnline: false,
+		},
+	})
 }
 
-// broadcastUserOffline отправляет уведомление о статусе офлайн
-func (h *Hub) broadcastUserOffline(userID uuid.UUID) {
-	msg := &WSMessage{
+// HidePresence скрывает статус пользователя от viewerID, например после блокировки:
+// получатель видит пользователя офлайн без времени последнего визита
+func (h *Hub) HidePresence(userID, viewerID uuid.UUID) {
+	h.publishToUsers([]uuid.UUID{viewerID}, &WSMessage{
 		Type:      MessageTypeUserOffline,
 		Timestamp: time.Now(),
 		Payload: UserStatusPayload{
 			UserID:   userID.String(),
 			IsOnline: false,
-			LastSeen: time.Now(),
 		},
-	}
+	})
+}
 
-	h.broadcast <- broadcastMessage{
-		message:   mustMarshal(msg),
-		excludeID: userID,
-		skipCheck: false,
+// DisconnectSessions закрывает соединения, открытые с отозванных сессий, на всех репликах
+func (h *Hub) DisconnectSessions(userID uuid.UUID, sessionIDs ...uuid.UUID) {
+	if len(sessionIDs) == 0 {
+		return
 	}
+
+	h.publish(&Event{
+		Type:       EventTypeDisconnect,
+		UserID:     userID,
+		SessionIDs: sessionIDs,
+	})
 }
 
-// GetClient возвращает клиента по ID пользователя
-func (h *Hub) GetClient(userID uuid.UUID) *Client {
+// GetClients возвращает все соединения пользователя
+func (h *Hub) GetClients(userID uuid.UUID) []*Client {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	return h.clients[userID]
+
+	clients := make([]*Client, 0, len(h.clients[userID]))
+	for client := range h.clients[userID] {
+		clients = append(clients, client)
+	}
+	return clients
 }
 
-// GetOnlineUsers возвращает список онлайн пользователей
+// GetOnlineUsers возвращает список онлайн пользователей во всём кластере
 func (h *Hub) GetOnlineUsers() []uuid.UUID {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	users := make([]uuid.UUID, 0, len(h.clients))
-	for userID := range h.clients {
-		users = append(users, userID)
+	users, err := h.broker.OnlineUsers(context.Background())
+	if err != nil {
+		log.Printf("failed to get online users: %v", err)
+		return nil
 	}
 	return users
 }
 
-// IsUserOnline проверяет, онлайн ли пользователь
+// IsUserOnline проверяет, онлайн ли пользователь на любой реплике
 func (h *Hub) IsUserOnline(userID uuid.UUID) bool {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	_, ok := h.clients[userID]
-	return ok
+	online, err := h.broker.IsOnline(context.Background(), userID)
+	if err != nil {
+		log.Printf("failed to check presence for %s: %v", userID, err)
+		return false
+	}
+	return online
 }
 
 func mustMarshal(v interface{}) []byte {
@@ -0,0 +1,373 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"dildogram/backend/internal/config"
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/repository"
+	"dildogram/backend/internal/service"
+	"github.com/google/uuid"
+)
+
+// Сколько ждём события, которое должно прийти, и сколько — тишины,
+// чтобы убедиться, что событие не пришло
+const (
+	testEventWait = 2 * time.Second
+	testQuietWait = 150 * time.Millisecond
+)
+
+// testStore хранит пользователей и чаты в памяти и реализует нужные хабу
+// методы репозиториев. Остальные методы не реализованы и паникуют.
+type testStore struct {
+	mu       sync.Mutex
+	users    map[uuid.UUID]*models.User
+	online   map[uuid.UUID]bool
+	audience map[uuid.UUID][]repository.PresenceCandidate
+	chats    map[uuid.UUID]*models.Chat
+	members  map[uuid.UUID]map[uuid.UUID]*models.ChatMembership
+}
+
+func newTestStore() *testStore {
+	return &testStore{
+		users:    make(map[uuid.UUID]*models.User),
+		online:   make(map[uuid.UUID]bool),
+		audience: make(map[uuid.UUID][]repository.PresenceCandidate),
+		chats:    make(map[uuid.UUID]*models.Chat),
+		members:  make(map[uuid.UUID]map[uuid.UUID]*models.ChatMembership),
+	}
+}
+
+// addUser добавляет пользователя, чей статус виден всем
+func (s *testStore) addUser(name string) uuid.UUID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := &models.User{ID: uuid.New(), Username: name}
+	user.Privacy.Online = models.PrivacyEveryone
+	user.Privacy.LastSeen = models.PrivacyEveryone
+	s.users[user.ID] = user
+	return user.ID
+}
+
+// showPresence делает статус userID видимым для viewers
+func (s *testStore) showPresence(userID uuid.UUID, viewers ...uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, viewer := range viewers {
+		s.audience[userID] = append(s.audience[userID], repository.PresenceCandidate{UserID: viewer})
+	}
+}
+
+// addGroup добавляет группу, в которой участники могут всё
+func (s *testStore) addGroup(userIDs ...uuid.UUID) *models.Chat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chat := &models.Chat{ID: uuid.New(), Type: models.ChatTypeGroup, DefaultPermissions: models.AllChatPermissions()}
+	s.chats[chat.ID] = chat
+	s.members[chat.ID] = make(map[uuid.UUID]*models.ChatMembership)
+	for _, userID := range userIDs {
+		s.members[chat.ID][userID] = &models.ChatMembership{ChatID: chat.ID, UserID: userID, Role: models.MemberRoleMember}
+	}
+	return chat
+}
+
+// removeMember исключает участника из чата
+func (s *testStore) removeMember(chatID, userID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.members[chatID][userID].LeftAt = &now
+}
+
+func (s *testStore) isOnline(userID uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.online[userID]
+}
+
+// testUserRepo репозиторий пользователей поверх testStore
+type testUserRepo struct {
+	repository.UserRepository
+	store *testStore
+}
+
+func (r testUserRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.users[id], nil
+}
+
+func (r testUserRepo) SetOnline(ctx context.Context, id uuid.UUID, isOnline bool) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.online[id] = isOnline
+	return nil
+}
+
+func (r testUserRepo) GetPresenceCandidates(ctx context.Context, userID uuid.UUID) ([]repository.PresenceCandidate, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.audience[userID], nil
+}
+
+// testChatRepo репозиторий чатов поверх testStore
+type testChatRepo struct {
+	repository.ChatRepository
+	store *testStore
+}
+
+func (r testChatRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Chat, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	chat, ok := r.store.chats[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *chat
+	return &copied, nil
+}
+
+func (r testChatRepo) GetMemberWithChat(ctx context.Context, chatID, userID uuid.UUID) (*models.ChatMembership, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	member, ok := r.store.members[chatID][userID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *member
+	chat := *r.store.chats[chatID]
+	copied.Chat = &chat
+	return &copied, nil
+}
+
+// testUpdateRepo журнал обновлений, который ничего не хранит
+type testUpdateRepo struct {
+	repository.UpdateRepository
+}
+
+func (testUpdateRepo) AppendForChat(ctx context.Context, chatID uuid.UUID, updateType string, data json.RawMessage) (map[uuid.UUID]int64, error) {
+	return nil, nil
+}
+
+func (testUpdateRepo) AppendForUser(ctx context.Context, userID uuid.UUID, updateType string, data json.RawMessage) (int64, error) {
+	return 0, nil
+}
+
+// testBlockRepo блокировок нет
+type testBlockRepo struct {
+	repository.BlockRepository
+}
+
+func (testBlockRepo) IsBlockedInPrivateChat(ctx context.Context, chatID, userID uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+// newTestHub запускает реплику хаба поверх общих store и broker
+func newTestHub(t *testing.T, store *testStore, broker Broker) *Hub {
+	t.Helper()
+
+	cfg := &config.Config{}
+	users := testUserRepo{store: store}
+	chats := testChatRepo{store: store}
+	blocks := testBlockRepo{}
+
+	hub := NewHub(
+		service.NewMessageService(nil, chats, nil, nil, nil, blocks, cfg),
+		service.NewChatService(chats, users, nil, nil, nil, blocks),
+		service.NewAuthService(users, nil, nil, nil, blocks, nil, cfg),
+		service.NewSyncService(testUpdateRepo{}, cfg),
+		nil,
+		chats,
+		users,
+		broker,
+	)
+	go hub.Run()
+	return hub
+}
+
+// newTestBroker создаёт общий для реплик брокер в памяти
+func newTestBroker(t *testing.T) *MemoryBroker {
+	t.Helper()
+
+	broker := NewMemoryBroker()
+	t.Cleanup(func() { broker.Close() })
+	return broker
+}
+
+// testFrame событие, полученное клиентом
+type testFrame struct {
+	Type    MessageType     `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// connect подключает устройство пользователя к реплике
+func connect(t *testing.T, hub *Hub, store *testStore, userID uuid.UUID) *Client {
+	t.Helper()
+
+	store.mu.Lock()
+	username := store.users[userID].Username
+	store.mu.Unlock()
+
+	client := NewClient(hub, nil, userID, username, uuid.New())
+	hub.Register <- client
+	return client
+}
+
+// disconnect отключает устройство
+func disconnect(hub *Hub, client *Client) {
+	hub.Unregister <- client
+}
+
+// subscribe подписывает устройство на чат без истории
+func subscribe(t *testing.T, hub *Hub, client *Client, chatID uuid.UUID) {
+	t.Helper()
+
+	if err := hub.SubscribeToChat(client, chatID, false); err != nil {
+		t.Fatalf("SubscribeToChat() error = %v", err)
+	}
+}
+
+// expectFrame ждёт следующее событие клиента и проверяет его тип
+func expectFrame(t *testing.T, client *Client, want MessageType) testFrame {
+	t.Helper()
+
+	select {
+	case data, ok := <-client.send:
+		if !ok {
+			t.Fatalf("connection of %s closed while waiting for %s", client.username, want)
+		}
+		var frame testFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			t.Fatalf("failed to parse frame %s: %v", data, err)
+		}
+		if frame.Type != want {
+			t.Fatalf("%s got %s (%s), want %s", client.username, frame.Type, frame.Payload, want)
+		}
+		return frame
+	case <-time.After(testEventWait):
+		t.Fatalf("%s did not get %s", client.username, want)
+	}
+	return testFrame{}
+}
+
+// expectNoFrame проверяет, что клиенту ничего не пришло
+func expectNoFrame(t *testing.T, client *Client) {
+	t.Helper()
+
+	select {
+	case data, ok := <-client.send:
+		if ok {
+			t.Fatalf("%s got unexpected frame %s", client.username, data)
+		}
+	case <-time.After(testQuietWait):
+	}
+}
+
+// testChatMessage событие чата для рассылки в тестах
+func testChatMessage(chat *models.Chat) *WSMessage {
+	return &WSMessage{
+		Type:      MessageTypeChatUpdated,
+		Timestamp: time.Now(),
+		Payload:   ToChatUpdatedPayload(chat),
+	}
+}
+
+func TestHubFansOutChatEventsAcrossReplicas(t *testing.T) {
+	store := newTestStore()
+	broker := newTestBroker(t)
+	first, second := newTestHub(t, store, broker), newTestHub(t, store, broker)
+
+	alice, bob, carol := store.addUser("alice"), store.addUser("bob"), store.addUser("carol")
+	chat := store.addGroup(alice, bob)
+
+	aliceConn := connect(t, first, store, alice)
+	bobConn := connect(t, second, store, bob)
+	carolConn := connect(t, second, store, carol)
+	subscribe(t, first, aliceConn, chat.ID)
+	subscribe(t, second, bobConn, chat.ID)
+
+	// Рассылка с одной реплики доходит до подписчиков на всех
+	first.BroadcastToChat(chat.ID, testChatMessage(chat))
+	expectFrame(t, aliceConn, MessageTypeChatUpdated)
+	expectFrame(t, bobConn, MessageTypeChatUpdated)
+	expectNoFrame(t, carolConn)
+
+	// Личное событие доходит до пользователя на другой реплике
+	first.SendToUser(carol, testChatMessage(chat))
+	expectFrame(t, carolConn, MessageTypeChatUpdated)
+	expectNoFrame(t, aliceConn)
+	expectNoFrame(t, bobConn)
+}
+
+func TestHubStopsDeliveringChatEventsToRemovedMember(t *testing.T) {
+	store := newTestStore()
+	broker := newTestBroker(t)
+	first, second := newTestHub(t, store, broker), newTestHub(t, store, broker)
+
+	alice, bob := store.addUser("alice"), store.addUser("bob")
+	chat := store.addGroup(alice, bob)
+
+	aliceConn := connect(t, first, store, alice)
+	bobConn := connect(t, second, store, bob)
+	subscribe(t, first, aliceConn, chat.ID)
+	subscribe(t, second, bobConn, chat.ID)
+
+	store.removeMember(chat.ID, bob)
+	first.BroadcastMemberRemoved(chat, bob, alice)
+
+	// Об удалении удалённый узнаёт один раз, через свои события
+	expectFrame(t, aliceConn, MessageTypeMemberRemoved)
+	expectFrame(t, bobConn, MessageTypeMemberRemoved)
+	expectNoFrame(t, bobConn)
+	if bobConn.IsSubscribed(chat.ID) {
+		t.Fatal("removed member is still subscribed to the chat")
+	}
+
+	first.BroadcastToChat(chat.ID, testChatMessage(chat))
+	expectFrame(t, aliceConn, MessageTypeChatUpdated)
+	expectNoFrame(t, bobConn)
+}
+
+func TestHubDeliversToEveryDeviceOfUser(t *testing.T) {
+	store := newTestStore()
+	hub := newTestHub(t, store, newTestBroker(t))
+
+	alice, bob := store.addUser("alice"), store.addUser("bob")
+	store.showPresence(alice, bob)
+	chat := store.addGroup(alice, bob)
+	bobConn := connect(t, hub, store, bob)
+
+	phone := connect(t, hub, store, alice)
+	laptop := connect(t, hub, store, alice)
+	expectStatus(t, bobConn, MessageTypeUserOnline, alice)
+	subscribe(t, hub, phone, chat.ID)
+	subscribe(t, hub, laptop, chat.ID)
+
+	hub.BroadcastToChat(chat.ID, testChatMessage(chat))
+	expectFrame(t, phone, MessageTypeChatUpdated)
+	expectFrame(t, laptop, MessageTypeChatUpdated)
+
+	hub.SendToUser(alice, testChatMessage(chat))
+	expectFrame(t, phone, MessageTypeChatUpdated)
+	expectFrame(t, laptop, MessageTypeChatUpdated)
+
+	// Офлайн только после отключения последнего устройства
+	disconnect(hub, phone)
+	expectNoFrame(t, bobConn)
+	hub.SendToUser(alice, testChatMessage(chat))
+	expectFrame(t, laptop, MessageTypeChatUpdated)
+
+	disconnect(hub, laptop)
+	expectStatus(t, bobConn, MessageTypeUserOffline, alice)
+	expectNoFrame(t, bobConn)
+}
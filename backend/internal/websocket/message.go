@@ -1,8 +1,12 @@
 package websocket
 
 import (
+	"encoding/json"
+	"strconv"
 	"time"
 
+	"dildogram/backend/internal/models"
+	"dildogram/backend/internal/service"
 	"github.com/google/uuid"
 )
 
@@ -18,26 +22,74 @@ const (
 	MessageTypeTypingStop      MessageType = "typing_stop"
 	MessageTypeSubscribeChat   MessageType = "subscribe_chat"
 	MessageTypeUnsubscribeChat MessageType = "unsubscribe_chat"
+	MessageTypeEditMessage     MessageType = "edit_message"
+	MessageTypeDeleteMessage   MessageType = "delete_message"
+	MessageTypeAddReaction     MessageType = "add_reaction"
+	MessageTypeRemoveReaction  MessageType = "remove_reaction"
+	MessageTypeForwardMessages MessageType = "forward_messages"
+	MessageTypeSync            MessageType = "sync"
 
 	// Сообщения от сервера
-	MessageTypeMessage       MessageType = "message"
-	MessageTypeMessageStatus MessageType = "message_status"
-	MessageTypeMessageRead   MessageType = "message_read"
-	MessageTypeTyping        MessageType = "typing"
-	MessageTypeUserOnline    MessageType = "user_online"
-	MessageTypeUserOffline   MessageType = "user_offline"
-	MessageTypeChatUpdated   MessageType = "chat_updated"
-	MessageTypeNewChat       MessageType = "new_chat"
-	MessageTypeError         MessageType = "error"
-	MessageTypeAuthError     MessageType = "auth_error"
+	MessageTypeMessage         MessageType = "message"
+	MessageTypeMessageStatus   MessageType = "message_status"
+	MessageTypeMessageRead     MessageType = "message_read"
+	MessageTypeMessageEdited   MessageType = "message_edited"
+	MessageTypeMessageDeleted  MessageType = "message_deleted"
+	MessageTypeReactionUpdated MessageType = "reaction_updated"
+	MessageTypeThreadUpdated   MessageType = "thread_updated"
+	MessageTypeMessagePinned   MessageType = "message_pinned"
+	MessageTypeMessageUnpinned MessageType = "message_unpinned"
+	MessageTypeTyping          MessageType = "typing"
+	MessageTypeUserOnline      MessageType = "user_online"
+	MessageTypeUserOffline     MessageType = "user_offline"
+	MessageTypeChatUpdated     MessageType = "chat_updated"
+	MessageTypeNewChat         MessageType = "new_chat"
+	MessageTypeChatDeleted     MessageType = "chat_deleted"
+	MessageTypeMemberAdded     MessageType = "member_added"
+	MessageTypeMemberRemoved   MessageType = "member_removed"
+	MessageTypeMemberUpdated   MessageType = "member_updated"
+	MessageTypeJoinRequest     MessageType = "join_request"
+	MessageTypeContactJoined   MessageType = "contact_joined"
+	MessageTypeSyncResult      MessageType = "sync_result"
+	MessageTypeAck             MessageType = "ack"
+	MessageTypeError           MessageType = "error"
+	MessageTypeAuthError       MessageType = "auth_error"
 )
 
-// WSMessage представляет WebSocket сообщение
+// TypingAction вид активности пользователя в чате
+type TypingAction string
+
+const (
+	TypingActionTyping         TypingAction = "typing"
+	TypingActionRecordingVoice TypingAction = "recording_voice"
+	TypingActionUploadingFile  TypingAction = "uploading_file"
+)
+
+// IsValid проверяет, известен ли вид активности
+func (a TypingAction) IsValid() bool {
+	switch a {
+	case TypingActionTyping, TypingActionRecordingVoice, TypingActionUploadingFile:
+		return true
+	}
+	return false
+}
+
+// WSMessage представляет WebSocket сообщение.
+// Seq — номер события в журнале обновлений получателя, если событие туда записано.
+// Порядок доставки по соединению не обязан совпадать с порядком Seq.
 type WSMessage struct {
+	Seq       int64       `json:"seq,omitempty"`
+	Type      MessageType `json:"type"`
+	Payload   interface{} `json:"payload,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// incomingMessage сообщение от клиента с отложенным разбором payload
+type incomingMessage struct {
 	Type      MessageType     `json:"type"`
-	Payload   interface{}     `json:"payload,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
 	RequestID string          `json:"request_id,omitempty"`
-	Timestamp time.Time       `json:"timestamp"`
 }
 
 // SendMessagePayload payload для отправки сообщения
@@ -47,6 +99,36 @@ type SendMessagePayload struct {
 	MessageType string  `json:"message_type,omitempty"`
 	MediaURL    *string `json:"media_url,omitempty"`
 	ReplyToID   *string `json:"reply_to_id,omitempty"`
+	// ClientMsgID — ID, сгенерированный клиентом: повтор с ним не создаёт дубликат
+	ClientMsgID *string `json:"client_msg_id,omitempty"`
+}
+
+// EditMessagePayload payload для редактирования сообщения
+type EditMessagePayload struct {
+	ChatID    string `json:"chat_id"`
+	MessageID string `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+// DeleteMessagePayload payload для удаления сообщения
+type DeleteMessagePayload struct {
+	ChatID      string `json:"chat_id"`
+	MessageID   string `json:"message_id"`
+	ForEveryone bool   `json:"for_everyone"`
+}
+
+// ForwardMessagesPayload payload для пересылки сообщений чата в другие чаты
+type ForwardMessagesPayload struct {
+	ChatID        string   `json:"chat_id"`
+	MessageIDs    []string `json:"message_ids"`
+	TargetChatIDs []string `json:"target_chat_ids"`
+}
+
+// ReactionPayload payload для добавления или снятия реакции
+type ReactionPayload struct {
+	ChatID    string `json:"chat_id"`
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
 }
 
 // ReadMessagePayload payload для отметки прочтения сообщения
@@ -59,71 +141,218 @@ type ReadChatPayload struct {
 	ChatID string `json:"chat_id"`
 }
 
-// TypingPayload payload для статуса набора текста
+// TypingPayload payload для статуса набора текста.
+// Action — вид активности для typing_start, по умолчанию typing.
+// Пока активность продолжается, клиент повторяет typing_start чаще typingTimeout.
 type TypingPayload struct {
-	ChatID string `json:"chat_id"`
-	IsTyping bool `json:"is_typing"`
+	ChatID   string       `json:"chat_id"`
+	IsTyping bool         `json:"is_typing"`
+	Action   TypingAction `json:"action,omitempty"`
 }
 
-// SubscribePayload payload для подписки на чат
+// SubscribePayload payload для подписки на чат.
+// NoHistory — не присылать последние сообщения: клиент догоняет пропущенное через sync.
 type SubscribePayload struct {
-	ChatID string `json:"chat_id"`
+	ChatID    string `json:"chat_id"`
+	NoHistory bool   `json:"no_history,omitempty"`
+}
+
+// SyncPayload payload для досинхронизации: обновления после Since
+// и каналы, изменившиеся после отметки ChannelPts
+type SyncPayload struct {
+	Since      int64 `json:"since"`
+	ChannelPts int64 `json:"channel_pts,omitempty"`
+	Limit      int   `json:"limit,omitempty"`
 }
 
 // MessagePayload payload с сообщением
 type MessagePayload struct {
-	ID            string     `json:"id"`
-	ChatID        string     `json:"chat_id"`
-	SenderID      string     `json:"sender_id"`
-	SenderName    string     `json:"sender_name"`
-	SenderAvatar  string     `json:"sender_avatar,omitempty"`
-	Content       string     `json:"content"`
-	MessageType   string     `json:"message_type"`
-	MediaURL      *string    `json:"media_url,omitempty"`
-	ReplyToID     *string    `json:"reply_to_id,omitempty"`
-	IsEdited      bool       `json:"is_edited"`
-	IsDeleted     bool       `json:"is_deleted"`
-	Status        string     `json:"status"`
-	CreatedAt     time.Time  `json:"created_at"`
-}
-
-// MessageStatusPayload payload со статусом сообщения
+	ID                  string                 `json:"id"`
+	ChatID              string                 `json:"chat_id"`
+	SenderID            string                 `json:"sender_id"`
+	SenderName          string                 `json:"sender_name"`
+	SenderAvatar        string                 `json:"sender_avatar,omitempty"`
+	SenderAvatarPreview *models.ImagePreview   `json:"sender_avatar_preview,omitempty"`
+	Content             string                 `json:"content"`
+	MessageType         string                 `json:"message_type"`
+	MediaURL            *string                `json:"media_url,omitempty"`
+	Attachment          *models.Attachment     `json:"attachment,omitempty"`
+	ReplyToID           *string                `json:"reply_to_id,omitempty"`
+	ReplyPreview        *models.ReplyPreview   `json:"reply_preview,omitempty"`
+	ThreadID            *string                `json:"thread_id,omitempty"`
+	Thread              *models.ThreadStats    `json:"thread,omitempty"`
+	ForwardedFrom       *ForwardedFromPayload  `json:"forwarded_from,omitempty"`
+	ClientMsgID         *string                `json:"client_msg_id,omitempty"`
+	Reactions           []models.ReactionCount `json:"reactions,omitempty"`
+	IsEdited            bool                   `json:"is_edited"`
+	IsDeleted           bool                   `json:"is_deleted"`
+	Status              string                 `json:"status"`
+	ViewCount           int                    `json:"view_count,omitempty"`
+	CreatedAt           time.Time              `json:"created_at"`
+	UpdatedAt           time.Time              `json:"updated_at"`
+}
+
+// ForwardedFromPayload источник пересланного сообщения для подписи «Переслано от …».
+// MessageID и UserID пусты, если исходное сообщение или его автор удалены.
+type ForwardedFromPayload struct {
+	MessageID *string   `json:"message_id,omitempty"`
+	UserID    *string   `json:"user_id,omitempty"`
+	UserName  string    `json:"user_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MessageDeletedPayload payload об удалении сообщения
+type MessageDeletedPayload struct {
+	MessageID   string `json:"message_id"`
+	ChatID      string `json:"chat_id"`
+	ForEveryone bool   `json:"for_everyone"`
+}
+
+// ReactionUpdatedPayload payload об изменении реакций на сообщение.
+// Reactions — полная сводка после изменения. В каналах UserID не передаётся.
+type ReactionUpdatedPayload struct {
+	ChatID    string                 `json:"chat_id"`
+	MessageID string                 `json:"message_id"`
+	UserID    string                 `json:"user_id,omitempty"`
+	Emoji     string                 `json:"emoji"`
+	Added     bool                   `json:"added"`
+	Reactions []models.ReactionCount `json:"reactions"`
+}
+
+// ThreadUpdatedPayload payload об ответе в ветке
+type ThreadUpdatedPayload struct {
+	ChatID      string    `json:"chat_id"`
+	ThreadID    string    `json:"thread_id"`
+	ReplyCount  int64     `json:"reply_count"`
+	LastReplyAt time.Time `json:"last_reply_at"`
+	LastReplyID string    `json:"last_reply_id"`
+}
+
+// MessagePinnedPayload payload о закреплении сообщения
+type MessagePinnedPayload struct {
+	ChatID    string          `json:"chat_id"`
+	MessageID string          `json:"message_id"`
+	PinnedBy  string          `json:"pinned_by"`
+	PinnedAt  time.Time       `json:"pinned_at"`
+	Message   *MessagePayload `json:"message,omitempty"`
+}
+
+// MessageUnpinnedPayload payload об откреплении сообщения
+type MessageUnpinnedPayload struct {
+	ChatID     string `json:"chat_id"`
+	MessageID  string `json:"message_id"`
+	UnpinnedBy string `json:"unpinned_by"`
+}
+
+// MessageStatusPayload payload со сводным статусом сообщения, отправляется его автору
 type MessageStatusPayload struct {
-	MessageID string `json:"message_id"`
-	Status    string `json:"status"`
+	MessageID string    `json:"message_id"`
+	ChatID    string    `json:"chat_id"`
+	Status    string    `json:"status"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// MessageReadPayload payload о прочтении сообщения
+// MessageReadPayload payload о прочтении: пользователь прочитал сообщения чата до MessageID включительно
 type MessageReadPayload struct {
+	ChatID    string    `json:"chat_id"`
 	MessageID string    `json:"message_id"`
 	UserID    string    `json:"user_id"`
 	ReadAt    time.Time `json:"read_at"`
 }
 
-// TypingStatusPayload payload со статусом набора текста
+// TypingStatusPayload payload со статусом набора текста.
+// ExpiresIn — через сколько секунд скрыть активность, если не придёт продление.
 type TypingStatusPayload struct {
-	ChatID   string `json:"chat_id"`
-	UserID   string `json:"user_id"`
-	UserName string `json:"user_name"`
-	IsTyping bool   `json:"is_typing"`
+	ChatID    string       `json:"chat_id"`
+	UserID    string       `json:"user_id"`
+	UserName  string       `json:"user_name"`
+	IsTyping  bool         `json:"is_typing"`
+	Action    TypingAction `json:"action,omitempty"`
+	ExpiresIn int          `json:"expires_in,omitempty"`
 }
 
 // UserStatusPayload payload со статусом пользователя
 type UserStatusPayload struct {
-	UserID   string    `json:"user_id"`
-	Username string    `json:"username"`
-	IsOnline bool      `json:"is_online"`
-	LastSeen time.Time `json:"last_seen,omitempty"`
+	UserID   string     `json:"user_id"`
+	Username string     `json:"username"`
+	IsOnline bool       `json:"is_online"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
 }
 
 // ChatUpdatedPayload payload об обновлении чата
 type ChatUpdatedPayload struct {
-	ChatID   string `json:"chat_id"`
-	Type     string `json:"type"`
-	Name     string `json:"name"`
-	Avatar   string `json:"avatar_url,omitempty"`
-	LastMessage *string `json:"last_message,omitempty"`
+	ChatID             string                  `json:"chat_id"`
+	Type               string                  `json:"type"`
+	Name               string                  `json:"name"`
+	Description        string                  `json:"description"`
+	ProtectedContent   bool                    `json:"protected_content"`
+	Handle             *string                 `json:"handle,omitempty"`
+	Avatar             string                  `json:"avatar_url,omitempty"`
+	AvatarPreview      *models.ImagePreview    `json:"avatar_preview,omitempty"`
+	DefaultPermissions *models.ChatPermissions `json:"default_permissions,omitempty"`
+	LastMessage        *string                 `json:"last_message,omitempty"`
+}
+
+// ChatDeletedPayload payload об удалении чата
+type ChatDeletedPayload struct {
+	ChatID string `json:"chat_id"`
+}
+
+// MemberPayload payload о добавлении или удалении участника чата
+type MemberPayload struct {
+	ChatID  string `json:"chat_id"`
+	UserID  string `json:"user_id"`
+	ActorID string `json:"actor_id"`
+}
+
+// MemberUpdatedPayload payload о смене роли или прав участника чата
+type MemberUpdatedPayload struct {
+	ChatID           string                 `json:"chat_id"`
+	UserID           string                 `json:"user_id"`
+	ActorID          string                 `json:"actor_id"`
+	Role             string                 `json:"role"`
+	AdminPermissions models.ChatPermissions `json:"admin_permissions"`
+}
+
+// JoinRequestPayload payload о новой заявке на вступление в группу
+type JoinRequestPayload struct {
+	ChatID string `json:"chat_id"`
+	UserID string `json:"user_id"`
+}
+
+// ContactJoinedPayload payload о регистрации пользователя из адресной книги.
+// FirstName и LastName — имя, под которым получатель записал контакт.
+type ContactJoinedPayload struct {
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// SyncResultPayload payload с результатом досинхронизации.
+// Updates — события в том виде, в каком они приходят по WebSocket, с полем seq.
+// Seq — номер для следующего запроса. TooFarBehind — пропущенное недоступно:
+// клиент перезагружает список чатов и историю и продолжает с Seq.
+// Channels — каналы с изменениями после channel_pts запроса: их историю клиент
+// догружает сам и в следующий раз передаёт ChannelPts из ответа.
+type SyncResultPayload struct {
+	Seq          int64             `json:"seq"`
+	Updates      []json.RawMessage `json:"updates"`
+	HasMore      bool              `json:"has_more"`
+	TooFarBehind bool              `json:"too_far_behind"`
+	ChannelPts   int64             `json:"channel_pts"`
+	Channels     []string          `json:"channels"`
+}
+
+// AckPayload ответ на запрос клиента с request_id.
+// При OK — результат запроса, иначе Error. Duplicate — сообщение с этим
+// client_msg_id уже было отправлено, в Message оно же.
+type AckPayload struct {
+	OK          bool            `json:"ok"`
+	ClientMsgID *string         `json:"client_msg_id,omitempty"`
+	Duplicate   bool            `json:"duplicate,omitempty"`
+	Message     *MessagePayload `json:"message,omitempty"`
+	Error       *ErrorPayload   `json:"error,omitempty"`
 }
 
 // ErrorPayload payload с ошибкой
@@ -132,11 +361,120 @@ type ErrorPayload struct {
 	Message string `json:"message"`
 }
 
+// ToChatUpdatedPayload конвертирует Chat в ChatUpdatedPayload
+func ToChatUpdatedPayload(chat *models.Chat) ChatUpdatedPayload {
+	payload := ChatUpdatedPayload{
+		ChatID:           chat.ID.String(),
+		Type:             string(chat.Type),
+		Name:             chat.Name,
+		Avatar:           chat.AvatarURL,
+		Description:      chat.Description,
+		ProtectedContent: chat.ProtectedContent,
+		Handle:           chat.Handle,
+	}
+	if chat.AvatarURL != "" {
+		payload.AvatarPreview = &chat.AvatarPreview
+	}
+	if chat.Type == models.ChatTypeGroup {
+		payload.DefaultPermissions = &chat.DefaultPermissions
+	}
+	return payload
+}
+
+// ToSyncResultPayload конвертирует SyncResult в SyncResultPayload
+func ToSyncResultPayload(result *service.SyncResult) SyncResultPayload {
+	updates := make([]json.RawMessage, 0, len(result.Updates))
+	for _, update := range result.Updates {
+		updates = append(updates, WithSeq(update.Data, update.Seq))
+	}
+	channels := make([]string, 0, len(result.Channels))
+	for _, chatID := range result.Channels {
+		channels = append(channels, chatID.String())
+	}
+
+	return SyncResultPayload{
+		Seq:          result.Seq,
+		Updates:      updates,
+		HasMore:      result.HasMore,
+		TooFarBehind: result.TooFarBehind,
+		ChannelPts:   result.ChannelPts,
+		Channels:     channels,
+	}
+}
+
 // ToMessagePayload конвертирует Message в MessagePayload
-func ToMessagePayload(msg interface{}, senderName, senderAvatar string) MessagePayload {
-	// Эта функция будет использоваться в handlers
-	// Реализация зависит от конкретной модели
-	return MessagePayload{}
+func ToMessagePayload(msg *models.Message) MessagePayload {
+	payload := MessagePayload{
+		ID:           msg.ID.String(),
+		ChatID:       msg.ChatID.String(),
+		SenderID:     msg.SenderID.String(),
+		Content:      msg.Content,
+		MessageType:  string(msg.MessageType),
+		MediaURL:     msg.MediaURL,
+		Attachment:   msg.Attachment,
+		ReplyPreview: msg.ReplyPreview,
+		Thread:       msg.Thread,
+		ClientMsgID:  msg.ClientMsgID,
+		Reactions:    msg.Reactions,
+		IsEdited:     msg.IsEdited,
+		IsDeleted:    msg.IsDeleted,
+		Status:       string(msg.Status),
+		ViewCount:    msg.ViewCount,
+		CreatedAt:    msg.CreatedAt,
+		UpdatedAt:    msg.UpdatedAt,
+	}
+
+	if msg.Sender != nil {
+		payload.SenderName = msg.Sender.GetFullName()
+		payload.SenderAvatar = msg.Sender.AvatarURL
+		if msg.Sender.AvatarURL != "" {
+			payload.SenderAvatarPreview = &msg.Sender.AvatarPreview
+		}
+	}
+
+	if msg.ReplyToID != nil {
+		replyToID := msg.ReplyToID.String()
+		payload.ReplyToID = &replyToID
+	}
+
+	if msg.ThreadID != nil {
+		threadID := msg.ThreadID.String()
+		payload.ThreadID = &threadID
+	}
+
+	if msg.IsForwarded() {
+		forwarded := &ForwardedFromPayload{
+			CreatedAt: *msg.ForwardedFromCreatedAt,
+		}
+		if msg.ForwardedFromMessageID != nil {
+			messageID := msg.ForwardedFromMessageID.String()
+			forwarded.MessageID = &messageID
+		}
+		if msg.ForwardedFromUserID != nil {
+			userID := msg.ForwardedFromUserID.String()
+			forwarded.UserID = &userID
+		}
+		if msg.ForwardedFromUser != nil {
+			forwarded.UserName = msg.ForwardedFromUser.GetFullName()
+		}
+		payload.ForwardedFrom = forwarded
+	}
+
+	return payload
+}
+
+// WithSeq добавляет номер обновления в сериализованный WSMessage.
+// Событие сериализуется один раз на всех получателей, а номер у каждого свой.
+func WithSeq(data []byte, seq int64) []byte {
+	if len(data) < 3 || data[0] != '{' {
+		return data
+	}
+
+	result := make([]byte, 0, len(data)+24)
+	result = append(result, `{"seq":`...)
+	result = strconv.AppendInt(result, seq, 10)
+	result = append(result, ',')
+	return append(result, data[1:]...)
 }
 
 // GenerateRequestID генерирует ID для запроса
@@ -0,0 +1,173 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Число очередей присутствия. Изменения одного пользователя всегда попадают
+// в одну очередь и обрабатываются по порядку, разные пользователи — параллельно.
+const presenceShards = 16
+
+// presenceKind вид изменения присутствия
+type presenceKind int
+
+const (
+	presenceConnect    presenceKind = iota // Подключилось устройство
+	presenceDisconnect                     // Отключилось устройство
+	presenceExpired                        // Соединения истекли на упавшей реплике
+)
+
+// presenceTask изменение присутствия пользователя, обрабатываемое вне цикла хаба
+type presenceTask struct {
+	kind     presenceKind
+	userID   uuid.UUID
+	username string
+	connID   string
+	// devices — число устройств пользователя на этой реплике после изменения,
+	// запасной ответ, если брокер недоступен
+	devices int
+}
+
+// presenceQueue неограниченная очередь изменений присутствия.
+// Добавление не блокируется, поэтому цикл хаба не ждёт брокер и базу.
+type presenceQueue struct {
+	mu    sync.Mutex
+	tasks []presenceTask
+	wake  chan struct{}
+}
+
+func newPresenceQueue() *presenceQueue {
+	return &presenceQueue{wake: make(chan struct{}, 1)}
+}
+
+func (q *presenceQueue) push(task presenceTask) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, task)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run обрабатывает изменения в порядке поступления
+func (q *presenceQueue) run(handle func(presenceTask)) {
+	for range q.wake {
+		for {
+			q.mu.Lock()
+			tasks := q.tasks
+			q.tasks = nil
+			q.mu.Unlock()
+			if len(tasks) == 0 {
+				break
+			}
+
+			for _, task := range tasks {
+				handle(task)
+			}
+		}
+	}
+}
+
+// startPresence запускает обработчики очередей присутствия
+func (h *Hub) startPresence() {
+	for _, queue := range h.presence {
+		go queue.run(h.handlePresence)
+	}
+}
+
+// enqueuePresence ставит изменение в очередь пользователя
+func (h *Hub) enqueuePresence(task presenceTask) {
+	h.presence[int(task.userID[len(task.userID)-1])%len(h.presence)].push(task)
+}
+
+// handlePresence обновляет присутствие в брокере и базе и рассылает статус.
+// Статус меняется только при подключении первого и отключении последнего
+// устройства пользователя в кластере.
+func (h *Hub) handlePresence(task presenceTask) {
+	ctx := context.Background()
+
+	switch task.kind {
+	case presenceConnect:
+		first, err := h.broker.AddConnection(ctx, task.userID, task.connID)
+		if err != nil {
+			log.Printf("failed to register presence for %s: %v", task.userID, err)
+			first = task.devices == 1
+		}
+		if first {
+			_ = h.authService.SetOnline(ctx, task.userID, true)
+			h.broadcastUserOnline(task.userID, task.username)
+		}
+
+	case presenceDisconnect:
+		last, err := h.broker.RemoveConnection(ctx, task.userID, task.connID)
+		if err != nil {
+			log.Printf("failed to remove presence for %s: %v", task.userID, err)
+			last = task.devices == 0
+		}
+		if last {
+			_ = h.authService.SetOnline(ctx, task.userID, false)
+			h.broadcastUserOffline(task.userID)
+		}
+
+	case presenceExpired:
+		// Пока задача ждала в очереди, пользователь мог снова подключиться
+		online, err := h.broker.IsOnline(ctx, task.userID)
+		if err != nil {
+			log.Printf("failed to check presence for %s: %v", task.userID, err)
+			return
+		}
+		if !online {
+			_ = h.authService.SetOnline(ctx, task.userID, false)
+			h.broadcastUserOffline(task.userID)
+		}
+	}
+}
+
+// runPresenceMaintenance периодически продлевает соединения этой реплики
+// и снимает статус онлайн с пользователей, соединения которых истекли
+func (h *Hub) runPresenceMaintenance() {
+	ticker := time.NewTicker(presenceRefreshPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.refreshPresence()
+		h.sweepPresence()
+	}
+}
+
+// refreshPresence продлевает записи о соединениях этой реплики в брокере
+func (h *Hub) refreshPresence() {
+	h.mu.RLock()
+	conns := make(map[uuid.UUID][]string, len(h.clients))
+	for userID, devices := range h.clients {
+		for client := range devices {
+			conns[userID] = append(conns[userID], client.id)
+		}
+	}
+	h.mu.RUnlock()
+
+	if err := h.broker.RefreshConnections(context.Background(), conns); err != nil {
+		log.Printf("failed to refresh presence: %v", err)
+	}
+}
+
+// sweepPresence находит пользователей, все соединения которых истекли
+// (реплика упала, не отключив их), и ставит в очередь их уход в офлайн
+func (h *Hub) sweepPresence() {
+	userIDs, err := h.broker.SweepExpired(context.Background())
+	if err != nil {
+		log.Printf("failed to sweep expired presence: %v", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		h.enqueuePresence(presenceTask{kind: presenceExpired, userID: userID})
+	}
+}
@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// sweepingBroker брокер в памяти, у которого при следующей чистке
+// истекают соединения заданных пользователей, как после падения реплики
+type sweepingBroker struct {
+	*MemoryBroker
+	mu      sync.Mutex
+	expired []uuid.UUID
+}
+
+func (b *sweepingBroker) expire(userIDs ...uuid.UUID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expired = append(b.expired, userIDs...)
+}
+
+func (b *sweepingBroker) SweepExpired(ctx context.Context) ([]uuid.UUID, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	expired := b.expired
+	b.expired = nil
+	return expired, nil
+}
+
+// expectStatus ждёт смену статуса userID
+func expectStatus(t *testing.T, client *Client, want MessageType, userID uuid.UUID) {
+	t.Helper()
+
+	frame := expectFrame(t, client, want)
+	var payload UserStatusPayload
+	if err := json.Unmarshal(frame.Payload, &payload); err != nil {
+		t.Fatalf("failed to parse status: %v", err)
+	}
+	if payload.UserID != userID.String() {
+		t.Fatalf("%s status for %s, want %s", want, payload.UserID, userID)
+	}
+}
+
+func TestPresenceChangesOnFirstAndLastConnection(t *testing.T) {
+	store := newTestStore()
+	broker := newTestBroker(t)
+	first, second := newTestHub(t, store, broker), newTestHub(t, store, broker)
+
+	alice, bob := store.addUser("alice"), store.addUser("bob")
+	store.showPresence(alice, bob)
+	bobConn := connect(t, second, store, bob)
+
+	// Первое устройство в кластере — Алиса онлайн
+	phone := connect(t, first, store, alice)
+	expectStatus(t, bobConn, MessageTypeUserOnline, alice)
+	if !store.isOnline(alice) {
+		t.Fatal("alice is not online after first connection")
+	}
+
+	// Второе устройство на другой реплике статус не меняет
+	laptop := connect(t, second, store, alice)
+	expectNoFrame(t, bobConn)
+
+	// Отключение одного из устройств статус не меняет
+	disconnect(first, phone)
+	expectNoFrame(t, bobConn)
+	if !store.isOnline(alice) {
+		t.Fatal("alice went offline while another device is connected")
+	}
+
+	// Последнее устройство — Алиса офлайн
+	disconnect(second, laptop)
+	expectStatus(t, bobConn, MessageTypeUserOffline, alice)
+	expectNoFrame(t, bobConn)
+	if store.isOnline(alice) {
+		t.Fatal("alice is still online after last disconnect")
+	}
+}
+
+func TestPresenceSweepsExpiredConnections(t *testing.T) {
+	store := newTestStore()
+	broker := &sweepingBroker{MemoryBroker: newTestBroker(t)}
+	hub := newTestHub(t, store, broker)
+
+	alice, bob, carol := store.addUser("alice"), store.addUser("bob"), store.addUser("carol")
+	store.showPresence(alice, carol)
+	store.showPresence(bob, carol)
+	carolConn := connect(t, hub, store, carol)
+
+	// Боб успел подключиться заново, Алиса — нет
+	bobConn := connect(t, hub, store, bob)
+	expectStatus(t, carolConn, MessageTypeUserOnline, bob)
+	expectNoFrame(t, bobConn)
+
+	broker.expire(alice, bob)
+	hub.sweepPresence()
+
+	expectStatus(t, carolConn, MessageTypeUserOffline, alice)
+	expectNoFrame(t, carolConn)
+	if !store.isOnline(bob) {
+		t.Fatal("bob went offline while connected")
+	}
+}
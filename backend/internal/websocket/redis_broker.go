@@ -0,0 +1,229 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Канал Redis для событий хаба
+	redisEventsChannel = "dildogram:ws:events"
+
+	// Ключи присутствия: соединения пользователя и общий список онлайн.
+	// Общий хеш-тег кладёт их в один слот Redis Cluster, иначе транзакции
+	// и скрипт, затрагивающие ключи пользователя и список онлайн, не выполнятся.
+	redisPresenceUserKey   = "dildogram:{presence}:user:"
+	redisPresenceOnlineKey = "dildogram:{presence}:online"
+
+	// Время жизни записи о соединении без продления (реплика могла упасть)
+	presenceTTL = 90 * time.Second
+
+	// Сколько истекших пользователей снимается за один проход
+	presenceSweepBatch = 1000
+)
+
+// sweepExpiredScript атомарно убирает из списка онлайн (KEYS[1]) пользователей
+// ARGV[2..], запись которых истекла к моменту ARGV[1] и у которых не осталось
+// живых соединений в KEYS[2..], и возвращает их. Все ключи передаются в KEYS,
+// как того требует Redis Cluster. Атомарность гарантирует, что одного
+// пользователя получит только одна реплика.
+var sweepExpiredScript = redis.NewScript(`
+local swept = {}
+for i = 2, #KEYS do
+	local userID = ARGV[i]
+	local score = redis.call('ZSCORE', KEYS[1], userID)
+	if score and tonumber(score) <= tonumber(ARGV[1])
+		and redis.call('ZCOUNT', KEYS[i], ARGV[1], '+inf') == 0 then
+		redis.call('ZREM', KEYS[1], userID)
+		table.insert(swept, userID)
+	end
+end
+return swept
+`)
+
+// RedisBroker реализует Broker поверх Redis pub/sub для нескольких реплик
+type RedisBroker struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+}
+
+// NewRedisBroker создаёт новый RedisBroker
+func NewRedisBroker(client *redis.Client) *RedisBroker {
+	return &RedisBroker{client: client}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return b.client.Publish(ctx, redisEventsChannel, data).Err()
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, handler func(*Event)) error {
+	b.pubsub = b.client.Subscribe(ctx, redisEventsChannel)
+
+	// Дожидаемся подтверждения подписки, чтобы не потерять первые события
+	if _, err := b.pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", redisEventsChannel, err)
+	}
+
+	go func() {
+		for msg := range b.pubsub.Channel() {
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("failed to unmarshal broker event: %v", err)
+				continue
+			}
+			handler(&event)
+		}
+	}()
+
+	return nil
+}
+
+func (b *RedisBroker) AddConnection(ctx context.Context, userID uuid.UUID, connID string) (bool, error) {
+	key := redisPresenceUserKey + userID.String()
+	now := time.Now()
+
+	var card *redis.IntCmd
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", scoreAt(now))
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(presenceTTL).UnixMilli()), Member: connID})
+		card = pipe.ZCard(ctx, key)
+		pipe.Expire(ctx, key, presenceTTL)
+		pipe.ZAdd(ctx, redisPresenceOnlineKey, redis.Z{Score: float64(now.Add(presenceTTL).UnixMilli()), Member: userID.String()})
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return card.Val() == 1, nil
+}
+
+func (b *RedisBroker) RemoveConnection(ctx context.Context, userID uuid.UUID, connID string) (bool, error) {
+	key := redisPresenceUserKey + userID.String()
+
+	var removed, card *redis.IntCmd
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.ZRem(ctx, key, connID)
+		pipe.ZRemRangeByScore(ctx, key, "-inf", scoreAt(time.Now()))
+		card = pipe.ZCard(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if removed.Val() == 0 || card.Val() > 0 {
+		return false, nil
+	}
+
+	if err := b.client.ZRem(ctx, redisPresenceOnlineKey, userID.String()).Err(); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func (b *RedisBroker) RefreshConnections(ctx context.Context, conns map[uuid.UUID][]string) error {
+	if len(conns) == 0 {
+		return nil
+	}
+
+	expiresAt := float64(time.Now().Add(presenceTTL).UnixMilli())
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for userID, connIDs := range conns {
+			key := redisPresenceUserKey + userID.String()
+			for _, connID := range connIDs {
+				pipe.ZAdd(ctx, key, redis.Z{Score: expiresAt, Member: connID})
+			}
+			pipe.Expire(ctx, key, presenceTTL)
+			pipe.ZAdd(ctx, redisPresenceOnlineKey, redis.Z{Score: expiresAt, Member: userID.String()})
+		}
+		return nil
+	})
+	return err
+}
+
+// SweepExpired снимает истекших пользователей из списка онлайн.
+// Сам список не чистится при продлении: истекшие записи ждут этого прохода,
+// чтобы пользователям упавшей реплики был разослан уход в офлайн.
+func (b *RedisBroker) SweepExpired(ctx context.Context) ([]uuid.UUID, error) {
+	now := scoreAt(time.Now())
+	candidates, err := b.client.ZRangeByScore(ctx, redisPresenceOnlineKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   now,
+		Count: presenceSweepBatch,
+	}).Result()
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+
+	// Кандидаты перепроверяются в скрипте: пока шла выборка, пользователь
+	// мог переподключиться, а другая реплика — уже снять его
+	keys := make([]string, 0, len(candidates)+1)
+	args := make([]interface{}, 0, len(candidates)+1)
+	keys = append(keys, redisPresenceOnlineKey)
+	args = append(args, now)
+	for _, member := range candidates {
+		keys = append(keys, redisPresenceUserKey+member)
+		args = append(args, member)
+	}
+
+	members, err := sweepExpiredScript.Run(ctx, b.client, keys, args...).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		if userID, err := uuid.Parse(member); err == nil {
+			users = append(users, userID)
+		}
+	}
+	return users, nil
+}
+
+func (b *RedisBroker) IsOnline(ctx context.Context, userID uuid.UUID) (bool, error) {
+	count, err := b.client.ZCount(ctx, redisPresenceUserKey+userID.String(), scoreAt(time.Now()), "+inf").Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (b *RedisBroker) OnlineUsers(ctx context.Context) ([]uuid.UUID, error) {
+	members, err := b.client.ZRangeByScore(ctx, redisPresenceOnlineKey, &redis.ZRangeBy{
+		Min: scoreAt(time.Now()),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		if userID, err := uuid.Parse(member); err == nil {
+			users = append(users, userID)
+		}
+	}
+	return users, nil
+}
+
+func (b *RedisBroker) Close() error {
+	if b.pubsub != nil {
+		return b.pubsub.Close()
+	}
+	return nil
+}
+
+// scoreAt возвращает score для момента времени в sorted set присутствия
+func scoreAt(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
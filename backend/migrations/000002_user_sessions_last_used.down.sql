@@ -0,0 +1,7 @@
+-- Откат миграции 000002: Отслеживание активности сессий
+
+DROP TABLE IF EXISTS user_session_used_tokens;
+
+DROP INDEX IF EXISTS idx_user_sessions_expires_at;
+
+ALTER TABLE IF EXISTS user_sessions DROP COLUMN IF EXISTS last_used_at;
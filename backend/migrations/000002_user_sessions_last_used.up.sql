@@ -0,0 +1,15 @@
+-- Миграция 000002: Отслеживание активности сессий
+
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_expires_at ON user_sessions(expires_at);
+
+-- После ротации хеш старого refresh токена хранится до его истечения. Повторное
+-- предъявление такого токена означает, что он утёк: сессия отзывается целиком.
+CREATE TABLE IF NOT EXISTS user_session_used_tokens (
+    refresh_token_hash VARCHAR(255) PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES user_sessions(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_session_used_tokens_session_id ON user_session_used_tokens(session_id);
@@ -0,0 +1,3 @@
+-- Откат миграции 000003: Удаление сообщений "только у себя"
+
+DROP TABLE IF EXISTS message_deletions CASCADE;
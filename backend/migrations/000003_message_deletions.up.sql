@@ -0,0 +1,11 @@
+-- Миграция 000003: Удаление сообщений "только у себя"
+
+CREATE TABLE IF NOT EXISTS message_deletions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE(message_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_deletions_user_id ON message_deletions(user_id);
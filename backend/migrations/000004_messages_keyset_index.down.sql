@@ -0,0 +1,3 @@
+-- Откат миграции 000004: Индекс для keyset-пагинации истории сообщений
+
+DROP INDEX IF EXISTS idx_messages_chat_created_id;
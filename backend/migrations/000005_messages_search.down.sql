@@ -0,0 +1,5 @@
+-- Откат миграции 000005: Полнотекстовый поиск по сообщениям
+
+DROP INDEX IF EXISTS idx_messages_search_vector;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,7 @@
+-- Миграция 000005: Полнотекстовый поиск по сообщениям
+
+-- Конфигурация 'simple' без стемминга: в чатах смешиваются русский и английский
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_messages_search_vector ON messages USING GIN(search_vector);
@@ -0,0 +1,3 @@
+-- Откат миграции 000006: Вложения сообщений
+
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,13 @@
+-- Откат миграции 000007: Превью изображений
+
+ALTER TABLE attachments DROP COLUMN IF EXISTS dominant_color;
+ALTER TABLE attachments DROP COLUMN IF EXISTS blurhash;
+ALTER TABLE attachments DROP COLUMN IF EXISTS thumbnails;
+
+ALTER TABLE chats DROP COLUMN IF EXISTS avatar_dominant_color;
+ALTER TABLE chats DROP COLUMN IF EXISTS avatar_blurhash;
+ALTER TABLE chats DROP COLUMN IF EXISTS avatar_thumbnails;
+
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_dominant_color;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_blurhash;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_thumbnails;
@@ -0,0 +1,13 @@
+-- Миграция 000007: Превью изображений (миниатюры, blurhash, основной цвет)
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_thumbnails JSONB;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_blurhash VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_dominant_color VARCHAR(7) NOT NULL DEFAULT '';
+
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS avatar_thumbnails JSONB;
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS avatar_blurhash VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS avatar_dominant_color VARCHAR(7) NOT NULL DEFAULT '';
+
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS thumbnails JSONB;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS blurhash VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS dominant_color VARCHAR(7) NOT NULL DEFAULT '';
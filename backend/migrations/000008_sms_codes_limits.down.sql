@@ -0,0 +1,12 @@
+-- Откат миграции 000008: Хранение SMS кодов в БД
+
+DROP INDEX IF EXISTS idx_sms_codes_ip_created;
+DROP INDEX IF EXISTS idx_sms_codes_phone_created;
+
+ALTER TABLE sms_codes DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE sms_codes DROP COLUMN IF EXISTS attempts;
+ALTER TABLE sms_codes DROP COLUMN IF EXISTS ip_address;
+
+DELETE FROM sms_codes;
+ALTER TABLE sms_codes ALTER COLUMN code TYPE VARCHAR(6);
+CREATE INDEX IF NOT EXISTS idx_sms_codes_code ON sms_codes(code);
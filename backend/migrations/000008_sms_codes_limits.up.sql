@@ -0,0 +1,13 @@
+-- Миграция 000008: Хранение SMS кодов в БД (HMAC кода, попытки, блокировка, IP отправителя)
+
+-- Старые коды хранились открытым текстом и больше не пригодны
+DELETE FROM sms_codes;
+DROP INDEX IF EXISTS idx_sms_codes_code;
+
+ALTER TABLE sms_codes ALTER COLUMN code TYPE VARCHAR(64);
+ALTER TABLE sms_codes ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE sms_codes ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sms_codes ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_sms_codes_phone_created ON sms_codes(phone, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_sms_codes_ip_created ON sms_codes(ip_address, created_at DESC);
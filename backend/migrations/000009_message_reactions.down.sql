@@ -0,0 +1,3 @@
+-- Откат миграции 000009: Реакции на сообщения
+
+DROP TABLE IF EXISTS message_reactions;
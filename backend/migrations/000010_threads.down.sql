@@ -0,0 +1,6 @@
+-- Откат миграции 000010: Ветки ответов
+
+DROP TABLE IF EXISTS thread_reads;
+
+DROP INDEX IF EXISTS idx_messages_thread_created_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS thread_id;
@@ -0,0 +1,27 @@
+-- Миграция 000010: Ветки ответов (threads)
+
+-- Корневое сообщение ветки: ответ на ответ попадает в ветку исходного сообщения
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS thread_id UUID REFERENCES messages(id) ON DELETE SET NULL;
+
+WITH RECURSIVE chain AS (
+    SELECT id, id AS root FROM messages WHERE reply_to_id IS NULL
+    UNION ALL
+    SELECT m.id, chain.root FROM messages m INNER JOIN chain ON m.reply_to_id = chain.id
+)
+UPDATE messages SET thread_id = chain.root
+FROM chain
+WHERE messages.id = chain.id AND messages.reply_to_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_messages_thread_created_id ON messages(thread_id, created_at DESC, id DESC)
+    WHERE thread_id IS NOT NULL;
+
+-- Прочтение веток: запись создаётся, когда пользователь отвечает в ветке или открывает её
+CREATE TABLE IF NOT EXISTS thread_reads (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    thread_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE(thread_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_thread_reads_user_id ON thread_reads(user_id);
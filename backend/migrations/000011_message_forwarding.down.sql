@@ -0,0 +1,9 @@
+-- Откат миграции 000011: Пересылка сообщений
+
+DROP INDEX IF EXISTS idx_messages_forwarded_media_url;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS forwarded_from_created_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS forwarded_from_user_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS forwarded_from_message_id;
+
+ALTER TABLE chats DROP COLUMN IF EXISTS protected_content;
@@ -0,0 +1,13 @@
+-- Миграция 000011: Пересылка сообщений
+
+-- Запрет пересылки сообщений из чата
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS protected_content BOOLEAN NOT NULL DEFAULT false;
+
+-- Источник пересланного сообщения. При пересылке пересланного сохраняется исходный автор
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_message_id UUID REFERENCES messages(id) ON DELETE SET NULL;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_user_id UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_created_at TIMESTAMP WITH TIME ZONE;
+
+-- Доступ к вложению через пересланную копию
+CREATE INDEX IF NOT EXISTS idx_messages_forwarded_media_url ON messages(media_url)
+    WHERE forwarded_from_created_at IS NOT NULL AND media_url IS NOT NULL;
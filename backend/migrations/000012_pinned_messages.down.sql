@@ -0,0 +1,3 @@
+-- Откат миграции 000012: Закреплённые сообщения
+
+DROP TABLE IF EXISTS pinned_messages;
@@ -0,0 +1,10 @@
+-- Откат миграции 000013: Отметки доставки и прочтения
+
+DELETE FROM message_receipts WHERE read_at IS NULL;
+ALTER TABLE message_receipts ALTER COLUMN read_at SET DEFAULT NOW();
+ALTER TABLE message_receipts ALTER COLUMN read_at SET NOT NULL;
+ALTER TABLE message_receipts DROP COLUMN IF EXISTS delivered_at;
+
+ALTER INDEX IF EXISTS idx_message_receipts_user_id RENAME TO idx_message_reads_user_id;
+ALTER INDEX IF EXISTS idx_message_receipts_message_id RENAME TO idx_message_reads_message_id;
+ALTER TABLE IF EXISTS message_receipts RENAME TO message_reads;
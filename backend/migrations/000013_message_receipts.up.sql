@@ -0,0 +1,15 @@
+-- Миграция 000013: Отметки доставки и прочтения по каждому получателю
+
+ALTER TABLE IF EXISTS message_reads RENAME TO message_receipts;
+ALTER INDEX IF EXISTS idx_message_reads_message_id RENAME TO idx_message_receipts_message_id;
+ALTER INDEX IF EXISTS idx_message_reads_user_id RENAME TO idx_message_receipts_user_id;
+
+-- Прочитанное считается доставленным в момент прочтения
+ALTER TABLE message_receipts ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP WITH TIME ZONE;
+UPDATE message_receipts SET delivered_at = read_at WHERE delivered_at IS NULL;
+ALTER TABLE message_receipts ALTER COLUMN delivered_at SET NOT NULL;
+ALTER TABLE message_receipts ALTER COLUMN delivered_at SET DEFAULT NOW();
+
+-- Запись без read_at — доставлено, но не прочитано
+ALTER TABLE message_receipts ALTER COLUMN read_at DROP NOT NULL;
+ALTER TABLE message_receipts ALTER COLUMN read_at DROP DEFAULT;
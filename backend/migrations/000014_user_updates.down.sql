@@ -0,0 +1,4 @@
+-- Откат миграции 000014: Журнал обновлений пользователей
+
+DROP TABLE IF EXISTS user_updates;
+DROP TABLE IF EXISTS user_update_seqs;
@@ -0,0 +1,19 @@
+-- Миграция 000014: Журнал обновлений пользователей для досинхронизации после переподключения
+
+-- Последний выданный номер обновления пользователя
+CREATE TABLE IF NOT EXISTS user_update_seqs (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL DEFAULT 0
+);
+
+-- Номера обновлений возрастают без пропусков в пределах пользователя
+CREATE TABLE IF NOT EXISTS user_updates (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_updates_created_at ON user_updates(created_at);
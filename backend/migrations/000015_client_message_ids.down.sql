@@ -0,0 +1,4 @@
+-- Откат миграции 000015: Клиентские ID сообщений
+
+DROP INDEX IF EXISTS idx_messages_sender_client_msg_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS client_msg_id;
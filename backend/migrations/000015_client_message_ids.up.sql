@@ -0,0 +1,7 @@
+-- Миграция 000015: Клиентские ID сообщений для идемпотентной отправки
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_msg_id VARCHAR(64);
+
+-- Повторная отправка с тем же ID возвращает уже созданное сообщение
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_sender_client_msg_id
+    ON messages(sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL;
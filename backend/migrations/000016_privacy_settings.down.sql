@@ -0,0 +1,7 @@
+-- Откат миграции 000016: Настройки приватности профиля
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS privacy_last_seen,
+    DROP COLUMN IF EXISTS privacy_online,
+    DROP COLUMN IF EXISTS privacy_phone,
+    DROP COLUMN IF EXISTS privacy_avatar;
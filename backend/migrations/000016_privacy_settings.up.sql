@@ -0,0 +1,11 @@
+-- Миграция 000016: Настройки приватности профиля
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS privacy_last_seen VARCHAR(20) NOT NULL DEFAULT 'everyone'
+        CHECK (privacy_last_seen IN ('everyone', 'contacts', 'nobody')),
+    ADD COLUMN IF NOT EXISTS privacy_online VARCHAR(20) NOT NULL DEFAULT 'everyone'
+        CHECK (privacy_online IN ('everyone', 'contacts', 'nobody')),
+    ADD COLUMN IF NOT EXISTS privacy_phone VARCHAR(20) NOT NULL DEFAULT 'contacts'
+        CHECK (privacy_phone IN ('everyone', 'contacts', 'nobody')),
+    ADD COLUMN IF NOT EXISTS privacy_avatar VARCHAR(20) NOT NULL DEFAULT 'everyone'
+        CHECK (privacy_avatar IN ('everyone', 'contacts', 'nobody'));
@@ -0,0 +1,8 @@
+-- Откат миграции 000017: Контакты и импорт адресной книги
+
+DROP TABLE IF EXISTS contact_imports;
+DROP TABLE IF EXISTS imported_contacts;
+DROP TABLE IF EXISTS contacts;
+
+DROP INDEX IF EXISTS idx_users_phone_hash;
+ALTER TABLE users DROP COLUMN IF EXISTS phone_hash;
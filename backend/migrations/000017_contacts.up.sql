@@ -0,0 +1,54 @@
+-- Миграция 000017: Контакты и импорт адресной книги
+
+-- SHA-256 номера в формате E.164 для поиска по хешам из адресной книги.
+-- NULL, если номер не удалось привести к E.164.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_hash VARCHAR(64);
+
+UPDATE users
+SET phone_hash = encode(sha256(convert_to(normalized, 'UTF8')), 'hex')
+FROM (
+    SELECT id AS user_id,
+           regexp_replace(regexp_replace(phone, '[ ().-]', '', 'g'), '^00', '+') AS normalized
+    FROM users
+) n
+WHERE users.id = n.user_id
+  AND n.normalized ~ '^\+[1-9][0-9]{6,14}$'
+  AND users.phone_hash IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_phone_hash ON users(phone_hash);
+
+CREATE TABLE IF NOT EXISTS contacts (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    contact_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    first_name VARCHAR(50) NOT NULL DEFAULT '',
+    last_name VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, contact_user_id),
+    CHECK (user_id <> contact_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_contacts_contact_user_id ON contacts(contact_user_id);
+
+-- Номера из адресной книги, владельцы которых ещё не зарегистрированы
+CREATE TABLE IF NOT EXISTS imported_contacts (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    phone_hash VARCHAR(64) NOT NULL,
+    first_name VARCHAR(50) NOT NULL DEFAULT '',
+    last_name VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, phone_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_imported_contacts_phone_hash ON imported_contacts(phone_hash);
+
+-- Импорты адресной книги: сколько номеров пользователь сверил с базой
+-- для суточной квоты. Хранятся только в пределах окна квоты.
+CREATE TABLE IF NOT EXISTS contact_imports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    numbers INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_contact_imports_user_created ON contact_imports(user_id, created_at);
@@ -0,0 +1,3 @@
+-- Откат миграции 000018: Чёрный список пользователей
+
+DROP TABLE IF EXISTS user_blocks;
@@ -0,0 +1,17 @@
+-- Откат миграции 000019: Права участников групп и админов
+
+ALTER TABLE chat_members
+    DROP COLUMN IF EXISTS perm_send_messages,
+    DROP COLUMN IF EXISTS perm_send_media,
+    DROP COLUMN IF EXISTS perm_add_members,
+    DROP COLUMN IF EXISTS perm_pin_messages,
+    DROP COLUMN IF EXISTS perm_change_info,
+    DROP COLUMN IF EXISTS perm_delete_messages;
+
+ALTER TABLE chats
+    DROP COLUMN IF EXISTS perm_send_messages,
+    DROP COLUMN IF EXISTS perm_send_media,
+    DROP COLUMN IF EXISTS perm_add_members,
+    DROP COLUMN IF EXISTS perm_pin_messages,
+    DROP COLUMN IF EXISTS perm_change_info,
+    DROP COLUMN IF EXISTS perm_delete_messages;
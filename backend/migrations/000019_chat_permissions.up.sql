@@ -0,0 +1,30 @@
+-- Миграция 000019: Права участников групп и админов
+
+-- Права обычных участников. Значения по умолчанию повторяют прежнее поведение:
+-- участники пишут и отправляют медиа, остальное доступно админам.
+ALTER TABLE chats
+    ADD COLUMN IF NOT EXISTS perm_send_messages BOOLEAN NOT NULL DEFAULT true,
+    ADD COLUMN IF NOT EXISTS perm_send_media BOOLEAN NOT NULL DEFAULT true,
+    ADD COLUMN IF NOT EXISTS perm_add_members BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS perm_pin_messages BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS perm_change_info BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS perm_delete_messages BOOLEAN NOT NULL DEFAULT false;
+
+-- Права админов, у остальных ролей не используются
+ALTER TABLE chat_members
+    ADD COLUMN IF NOT EXISTS perm_send_messages BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS perm_send_media BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS perm_add_members BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS perm_pin_messages BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS perm_change_info BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS perm_delete_messages BOOLEAN NOT NULL DEFAULT false;
+
+-- Существующие админы сохраняют все права
+UPDATE chat_members
+SET perm_send_messages = true,
+    perm_send_media = true,
+    perm_add_members = true,
+    perm_pin_messages = true,
+    perm_change_info = true,
+    perm_delete_messages = true
+WHERE role = 'admin';
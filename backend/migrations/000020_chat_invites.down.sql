@@ -0,0 +1,4 @@
+-- Откат миграции 000020: Ссылки-приглашения в группы и заявки на вступление
+
+DROP TABLE IF EXISTS chat_join_requests;
+DROP TABLE IF EXISTS chat_invites;
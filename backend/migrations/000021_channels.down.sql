@@ -0,0 +1,16 @@
+-- Откат миграции 000021: Каналы
+
+ALTER TABLE chats DROP COLUMN IF EXISTS channel_changed_at;
+ALTER TABLE chats DROP COLUMN IF EXISTS channel_pts;
+DROP SEQUENCE IF EXISTS channel_pts_seq;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS view_count;
+
+DROP INDEX IF EXISTS idx_chats_handle;
+ALTER TABLE chats DROP COLUMN IF EXISTS handle;
+
+-- Каналы не укладываются в прежнее ограничение типа
+DELETE FROM chats WHERE type = 'channel';
+
+ALTER TABLE chats DROP CONSTRAINT IF EXISTS chats_type_check;
+ALTER TABLE chats ADD CONSTRAINT chats_type_check CHECK (type IN ('private', 'group'));
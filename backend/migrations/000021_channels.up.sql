@@ -0,0 +1,28 @@
+-- Миграция 000021: Каналы
+
+ALTER TABLE chats DROP CONSTRAINT IF EXISTS chats_type_check;
+ALTER TABLE chats ADD CONSTRAINT chats_type_check CHECK (type IN ('private', 'group', 'channel'));
+
+-- Публичный адрес канала. Канал с адресом виден в поиске, вступить в него может любой.
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS handle VARCHAR(32);
+
+-- Удалённый канал не занимает адрес: GetByHandle его не находит,
+-- поэтому и уникальность проверяется только среди неудалённых чатов
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chats_handle ON chats(LOWER(handle)) WHERE handle IS NOT NULL AND deleted_at IS NULL;
+
+-- Число подписчиков канала, прочитавших сообщение
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS view_count INTEGER NOT NULL DEFAULT 0;
+
+-- События каналов подписчикам в журнал не пишутся. Вместо этого каждое событие
+-- канала продвигает его отметку, и синхронизация сообщает подписчику, в каких
+-- каналах отметка выросла. Отметки берутся из общей последовательности,
+-- чтобы клиенту хватало одной отметки на все каналы.
+CREATE SEQUENCE IF NOT EXISTS channel_pts_seq;
+
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS channel_pts BIGINT NOT NULL DEFAULT 0;
+
+-- Отметки выдаются без общей блокировки, поэтому запись с меньшей отметкой
+-- может зафиксироваться позже записи с большей. Синхронизация продвигает
+-- отметку клиента только до изменений старше небольшого окна, в течение
+-- которого все начатые записи успевают зафиксироваться.
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS channel_changed_at TIMESTAMPTZ;
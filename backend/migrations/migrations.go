@@ -0,0 +1,8 @@
+// Package migrations встраивает SQL миграции схемы в бинарник сервера.
+// Файлы именуются NNNNNN_name.up.sql / NNNNNN_name.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
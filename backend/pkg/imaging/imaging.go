@@ -0,0 +1,185 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Ограничение на число пикселей, чтобы не декодировать «бомбы» в память
+const MaxPixels = 50_000_000
+
+// Качество JPEG для превью
+const thumbnailQuality = 82
+
+var ErrTooManyPixels = errors.New("image dimensions are too large")
+
+// Decode декодирует изображение и применяет поворот из EXIF.
+// Возвращает также формат (jpeg, png, gif, webp) и ориентацию EXIF (1 — без поворота).
+func Decode(data []byte) (image.Image, string, int, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to read image header: %w", err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, "", 0, ErrTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+		img = applyOrientation(img, orientation)
+	}
+
+	return img, format, orientation, nil
+}
+
+// Fit уменьшает изображение так, чтобы большая сторона не превышала size.
+// Изображения меньше size не увеличиваются.
+func Fit(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*size/w)
+		w = size
+	} else {
+		w = max(1, w*size/h)
+		h = size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst
+}
+
+// Square вырезает квадрат по центру и масштабирует его до size×size
+func Square(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		b.Min.X+(b.Dx()-side)/2,
+		b.Min.Y+(b.Dy()-side)/2,
+	))
+
+	size = min(size, side)
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, xdraw.Src, nil)
+	return dst
+}
+
+// EncodeJPEG кодирует изображение в JPEG без метаданных.
+// Прозрачность заливается белым фоном.
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	if quality <= 0 {
+		quality = thumbnailQuality
+	}
+
+	if opaque, ok := img.(interface{ Opaque() bool }); !ok || !opaque.Opaque() {
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		img = flat
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DominantColor возвращает средний цвет изображения в виде #rrggbb.
+// Рассчитан на небольшие превью: обходит все пиксели.
+func DominantColor(img image.Image) string {
+	b := img.Bounds()
+	var r, g, bl, n uint64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+			r += uint64(c.R)
+			g += uint64(c.G)
+			bl += uint64(c.B)
+			n++
+		}
+	}
+	if n == 0 {
+		return "#ffffff"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", r/n, g/n, bl/n)
+}
+
+// toRGBA копирует изображение в *image.RGBA с началом координат в нуле
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// applyOrientation поворачивает и отражает изображение согласно тегу EXIF Orientation
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// Ориентации 5–8 меняют ширину и высоту местами
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Отражение по горизонтали
+				dx, dy = w-1-x, y
+			case 3: // Поворот на 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Отражение по вертикали
+				dx, dy = x, h-1-y
+			case 5: // Транспонирование
+				dx, dy = y, x
+			case 6: // Поворот на 90° по часовой
+				dx, dy = h-1-y, x
+			case 7: // Транспонирование с отражением
+				dx, dy = h-1-y, w-1-x
+			case 8: // Поворот на 90° против часовой
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
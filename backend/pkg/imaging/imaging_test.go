@@ -0,0 +1,109 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+)
+
+// Фикстуры 1600×800 с EXIF: ориентация (1 и 6) и GPS-координаты
+const (
+	fixtureGPS        = "testdata/gps.jpg"
+	fixtureGPSRotated = "testdata/gps_rotated.jpg"
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	if !bytes.Contains(data, exifHeader) {
+		t.Fatalf("%s has no EXIF", name)
+	}
+	return data
+}
+
+func decodeSize(t *testing.T, data []byte) (int, int) {
+	t.Helper()
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+func TestStripMetadataRemovesJPEGExif(t *testing.T) {
+	data := readFixture(t, fixtureGPS)
+
+	stripped, err := StripMetadata(data, "jpeg")
+	if err != nil {
+		t.Fatalf("StripMetadata() error = %v", err)
+	}
+	if bytes.Contains(stripped, exifHeader) {
+		t.Fatal("stripped JPEG still contains EXIF")
+	}
+	if w, h := decodeSize(t, stripped); w != 1600 || h != 800 {
+		t.Fatalf("stripped size = %dx%d, want 1600x800", w, h)
+	}
+}
+
+func TestDecodeAppliesExifOrientation(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		orientation int
+		w, h        int
+	}{
+		{fixtureGPS, 1, 1600, 800},
+		{fixtureGPSRotated, 6, 800, 1600},
+	}
+
+	for _, tt := range tests {
+		img, format, orientation, err := Decode(readFixture(t, tt.fixture))
+		if err != nil {
+			t.Fatalf("Decode(%s) error = %v", tt.fixture, err)
+		}
+		if format != "jpeg" || orientation != tt.orientation {
+			t.Fatalf("Decode(%s) = %s, orientation %d, want jpeg, %d", tt.fixture, format, orientation, tt.orientation)
+		}
+		if b := img.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Fatalf("Decode(%s) size = %dx%d, want %dx%d", tt.fixture, b.Dx(), b.Dy(), tt.w, tt.h)
+		}
+	}
+}
+
+func TestThumbnailsHaveNoExifAndExpectedSize(t *testing.T) {
+	img, _, _, err := Decode(readFixture(t, fixtureGPS))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+		w, h int
+	}{
+		{"fit", Fit(img, 256), 256, 128},
+		{"fit smaller", Fit(img, 4000), 1600, 800},
+		{"square", Square(img, 256), 256, 256},
+		{"square smaller", Square(img, 4000), 800, 800},
+	}
+
+	for _, tt := range tests {
+		data, err := EncodeJPEG(tt.img, 0)
+		if err != nil {
+			t.Fatalf("%s: EncodeJPEG() error = %v", tt.name, err)
+		}
+		if bytes.Contains(data, exifHeader) {
+			t.Fatalf("%s: thumbnail contains EXIF", tt.name)
+		}
+		if w, h := decodeSize(t, data); w != tt.w || h != tt.h {
+			t.Fatalf("%s: size = %dx%d, want %dx%d", tt.name, w, h, tt.w, tt.h)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var ErrMalformed = errors.New("malformed image data")
+
+// StripMetadata удаляет без перекодирования метаданные (EXIF с GPS, XMP, IPTC, комментарии).
+// Поддерживаются jpeg, png и webp; остальные форматы возвращаются как есть.
+// Для JPEG тег ориентации теряется, поэтому повёрнутые снимки нужно перекодировать.
+func StripMetadata(data []byte, format string) ([]byte, error) {
+	switch format {
+	case "jpeg":
+		return stripJPEG(data)
+	case "png":
+		return stripPNG(data)
+	case "webp":
+		return stripWebP(data)
+	default:
+		return data, nil
+	}
+}
+
+// stripJPEG удаляет сегменты APP1 (EXIF, XMP), APP13 (IPTC) и COM.
+// APP0 (JFIF), APP2 (ICC-профиль) и APP14 (Adobe) нужны для корректных цветов.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, ErrMalformed
+		}
+		// Пропускаем байты-заполнители
+		for i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+1 >= len(data) {
+			return nil, ErrMalformed
+		}
+		marker := data[i+1]
+
+		// Маркеры без длины
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+		if marker == 0xD9 {
+			out.Write(data[i:])
+			break
+		}
+
+		if i+4 > len(data) {
+			return nil, ErrMalformed
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) {
+			return nil, ErrMalformed
+		}
+
+		// После SOS идут данные изображения — копируем остаток целиком
+		if marker == 0xDA {
+			out.Write(data[i:])
+			break
+		}
+
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	return out.Bytes(), nil
+}
+
+// stripPNG удаляет чанки eXIf, текстовые чанки и время изменения
+func stripPNG(data []byte) ([]byte, error) {
+	const signatureLen = 8
+	if len(data) < signatureLen {
+		return nil, ErrMalformed
+	}
+
+	drop := map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:signatureLen])
+
+	for i := signatureLen; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		// Длина данных + тип (4) + CRC (4)
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:i+4]))
+		if end > len(data) || end < i {
+			return nil, ErrMalformed
+		}
+		if !drop[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	return out.Bytes(), nil
+}
+
+// stripWebP удаляет чанки EXIF и XMP и сбрасывает их флаги в VP8X
+func stripWebP(data []byte) ([]byte, error) {
+	const headerLen = 12
+	if len(data) < headerLen || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:headerLen])
+
+	for i := headerLen; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		// Данные чанка выравниваются до чётной длины
+		end := i + 8 + size + size%2
+		if end > len(data) || end < i {
+			return nil, ErrMalformed
+		}
+
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:8], uint32(len(result)-8))
+	return result, nil
+}
+
+// jpegOrientation возвращает значение тега EXIF Orientation или 1, если его нет
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) {
+			return 1
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[i+4:end], []byte("Exif\x00\x00")) {
+			return tiffOrientation(data[i+10 : end])
+		}
+		i = end
+	}
+	return 1
+}
+
+// tiffOrientation ищет тег Orientation (0x0112) в IFD0 заголовка TIFF
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset : offset+2]))
+
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
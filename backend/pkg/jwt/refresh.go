@@ -0,0 +1,27 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// refreshTokenSize размер refresh токена в байтах
+const refreshTokenSize = 32
+
+// GenerateRefreshToken создаёт новый случайный refresh токен
+func GenerateRefreshToken() (string, error) {
+	bytes := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// HashRefreshToken возвращает хеш refresh токена для хранения в БД
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -11,8 +11,9 @@ import (
 
 // Claims представляет JWT claims с пользовательскими данными
 type Claims struct {
-	UserID   uuid.UUID `json:"user_id"`
-	Username string    `json:"username"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	SessionID uuid.UUID `json:"session_id"`
 	jwt.RegisteredClaims
 }
 
@@ -23,20 +24,21 @@ type TokenManager struct {
 }
 
 // NewTokenManager создаёт новый TokenManager
-func NewTokenManager(secretKey string, expireHours int) *TokenManager {
+func NewTokenManager(secretKey string, expireDur time.Duration) *TokenManager {
 	return &TokenManager{
 		secretKey: secretKey,
-		expireDur: time.Duration(expireHours) * time.Hour,
+		expireDur: expireDur,
 	}
 }
 
-// Generate создаёт новый JWT токен для пользователя
-func (tm *TokenManager) Generate(userID uuid.UUID, username string) (string, error) {
+// Generate создаёт новый access токен, привязанный к сессии пользователя
+func (tm *TokenManager) Generate(userID uuid.UUID, username string, sessionID uuid.UUID) (string, error) {
 	now := time.Now()
 
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(now.Add(tm.expireDur)),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -0,0 +1,62 @@
+package phone
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Допустимое число цифр в номере E.164
+const (
+	minDigits = 7
+	maxDigits = 15
+)
+
+// Normalize приводит номер к формату E.164 (+79991234567).
+// Пробелы, дефисы, точки и скобки отбрасываются, префикс 00 заменяется на +.
+// Номера без кода страны не принимаются. Возвращает false, если номер некорректен.
+func Normalize(raw string) (string, bool) {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(raw) {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	number := b.String()
+	if strings.HasPrefix(number, "00") {
+		number = "+" + number[2:]
+	}
+	if !strings.HasPrefix(number, "+") {
+		return "", false
+	}
+
+	digits := number[1:]
+	if len(digits) < minDigits || len(digits) > maxDigits || digits[0] == '0' {
+		return "", false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	return number, true
+}
+
+// Hash возвращает SHA-256 номера в формате E.164 в hex.
+// Клиенты могут присылать такие хеши вместо номеров при импорте контактов.
+func Hash(e164 string) string {
+	sum := sha256.Sum256([]byte(e164))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsHash проверяет, похожа ли строка на результат Hash
+func IsHash(value string) bool {
+	if len(value) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil && strings.ToLower(value) == value
+}
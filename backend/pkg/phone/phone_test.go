@@ -0,0 +1,63 @@
+package phone
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"+79991234567", "+79991234567", true},
+		{"  +7 (999) 123-45-67 ", "+79991234567", true},
+		{"+1.202.555.0143", "+12025550143", true},
+		{"0079991234567", "+79991234567", true},
+		{"00 44 20 7946 0958", "+442079460958", true},
+		{"79991234567", "", false},                     // Без кода страны
+		{"89991234567", "", false},                     // Местный формат
+		{"+09991234567", "", false},                    // Код страны не может начинаться с нуля
+		{"000079991234567", "", false},                 // После 00 снова ноль
+		{"+123456", "", false},                         // Короче минимума
+		{"+1234567", "+1234567", true},                 // Ровно минимум
+		{"+123456789012345", "+123456789012345", true}, // Ровно максимум
+		{"+1234567890123456", "", false},               // Длиннее максимума
+		{"+7999123456a", "", false},
+		{"+7999/1234567", "", false},
+		{"++79991234567", "", false},
+		{"", "", false},
+		{"+", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := Normalize(tt.raw)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Normalize(%q) = %q, %v, want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIsHash(t *testing.T) {
+	hash := Hash("+79991234567")
+
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{hash, true},
+		{strings.ToUpper(hash), false},
+		{hash[:len(hash)-1], false},
+		{hash + "0", false},
+		{strings.Repeat("g", len(hash)), false},
+		{"+79991234567", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsHash(tt.value); got != tt.want {
+			t.Errorf("IsHash(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,25 @@
-import axios, { AxiosInstance, AxiosError } from 'axios';
+import axios, { AxiosInstance, AxiosError, InternalAxiosRequestConfig } from 'axios';
 
 const API_BASE_URL = import.meta.env.VITE_API_URL || 'http://localhost:8080/api/v1';
 
+const TOKEN_KEY = 'token';
+const REFRESH_TOKEN_KEY = 'refresh_token';
+
+// Запросы без access токена: их 401 означает неверные данные, а не истёкшую сессию
+const PUBLIC_AUTH_PATHS = ['/auth/login', '/auth/register', '/auth/sms', '/auth/verify-sms', '/auth/refresh'];
+
+interface TokenResponse {
+  token: string;
+  refresh_token: string;
+}
+
+type RetriableConfig = InternalAxiosRequestConfig & { _retry?: boolean };
+
 class ApiClient {
   private client: AxiosInstance;
+  // Один запрос обновления на все запросы, получившие 401 одновременно
+  private refreshPromise: Promise<string> | null = null;
+  private tokenListeners = new Set<(token: string | null) => void>();
 
   constructor() {
     this.client = axios.create({
@@ -15,20 +31,37 @@ class ApiClient {
 
     // Interceptor для добавления токена
     this.client.interceptors.request.use((config) => {
-      const token = localStorage.getItem('token');
+      const token = localStorage.getItem(TOKEN_KEY);
       if (token) {
         config.headers.Authorization = `Bearer ${token}`;
       }
       return config;
     });
 
-    // Interceptor для обработки ошибок
+    // Interceptor для обработки ошибок: при истёкшем access токене
+    // обновляем пару токенов и повторяем запрос один раз
     this.client.interceptors.response.use(
       (response) => response,
-      (error: AxiosError<{ error?: string }>) => {
-        if (error.response?.status === 401) {
-          localStorage.removeItem('token');
-          localStorage.removeItem('user');
+      async (error: AxiosError<{ error?: string }>) => {
+        const config = error.config as RetriableConfig | undefined;
+        if (error.response?.status !== 401 || !config) {
+          return Promise.reject(error);
+        }
+
+        const isAuthRequest = PUBLIC_AUTH_PATHS.includes(config.url ?? '');
+        if (!config._retry && !isAuthRequest && localStorage.getItem(REFRESH_TOKEN_KEY)) {
+          config._retry = true;
+          try {
+            const token = await this.refreshTokens();
+            config.headers.Authorization = `Bearer ${token}`;
+            return this.client(config);
+          } catch {
+            // Обновить не удалось — сессия завершена
+          }
+        }
+
+        if (!isAuthRequest) {
+          this.clearTokens();
           window.location.href = '/login';
         }
         return Promise.reject(error);
@@ -36,9 +69,48 @@ class ApiClient {
     );
   }
 
+  // Tokens
+  setTokens(token: string, refreshToken: string) {
+    localStorage.setItem(TOKEN_KEY, token);
+    localStorage.setItem(REFRESH_TOKEN_KEY, refreshToken);
+    this.tokenListeners.forEach((listener) => listener(token));
+  }
+
+  clearTokens() {
+    localStorage.removeItem(TOKEN_KEY);
+    localStorage.removeItem(REFRESH_TOKEN_KEY);
+    localStorage.removeItem('user');
+    this.tokenListeners.forEach((listener) => listener(null));
+  }
+
+  // onTokenChange подписывает на смену access токена, например после обновления
+  onTokenChange(listener: (token: string | null) => void) {
+    this.tokenListeners.add(listener);
+    return () => {
+      this.tokenListeners.delete(listener);
+    };
+  }
+
+  private refreshTokens(): Promise<string> {
+    if (!this.refreshPromise) {
+      const refreshToken = localStorage.getItem(REFRESH_TOKEN_KEY);
+      this.refreshPromise = this.client
+        .post<TokenResponse>('/auth/refresh', { refresh_token: refreshToken })
+        .then(({ data }) => {
+          this.setTokens(data.token, data.refresh_token);
+          return data.token;
+        })
+        .finally(() => {
+          this.refreshPromise = null;
+        });
+    }
+    return this.refreshPromise;
+  }
+
   // Auth endpoints
   async login(phone: string, password: string) {
     const response = await this.client.post('/auth/login', { phone, password });
+    this.setTokens(response.data.token, response.data.refresh_token);
     return response.data;
   }
 
@@ -48,6 +120,7 @@ class ApiClient {
       username,
       password,
     });
+    this.setTokens(response.data.token, response.data.refresh_token);
     return response.data;
   }
 
@@ -58,6 +131,7 @@ class ApiClient {
 
   async verifySMS(phone: string, code: string) {
     const response = await this.client.post('/auth/verify-sms', { phone, code });
+    this.setTokens(response.data.token, response.data.refresh_token);
     return response.data;
   }
 
@@ -142,9 +216,9 @@ class ApiClient {
   }
 
   // Message endpoints
-  async getMessages(chatId: string, limit = 50, offset = 0) {
+  async getMessages(chatId: string, limit = 50, before?: string) {
     const response = await this.client.get(`/chats/${chatId}/messages`, {
-      params: { limit, offset },
+      params: { limit, before },
     });
     return response.data;
   }
@@ -91,7 +91,8 @@ export class WebSocketService {
     console.log(`Reconnecting in ${delay}ms (attempt ${this.reconnectAttempts})`);
 
     this.reconnectTimeout = window.setTimeout(() => {
-      this.connect(token).catch(console.error);
+      // За время соединения access токен мог обновиться
+      this.connect(localStorage.getItem('token') ?? token).catch(console.error);
     }, delay);
   }
 
@@ -13,7 +13,7 @@ interface AuthState {
   // Actions
   login: (phone: string, password: string) => Promise<void>;
   register: (phone: string, username: string, password: string) => Promise<void>;
-  requestSMS: (phone: string) => Promise<string>;
+  requestSMS: (phone: string) => Promise<void>;
   verifySMS: (phone: string, code: string) => Promise<void>;
   logout: () => void;
   updateProfile: (data: { first_name?: string; last_name?: string; bio?: string }) => Promise<void>;
@@ -58,9 +58,8 @@ export const useAuthStore = create<AuthState>()(
       requestSMS: async (phone: string) => {
         set({ isLoading: true, error: null });
         try {
-          const { code } = await api.requestSMS(phone);
+          await api.requestSMS(phone);
           set({ isLoading: false });
-          return code;
         } catch (error: unknown) {
           const message = error instanceof Error ? error.message : 'SMS request failed';
           set({ error: message, isLoading: false });
@@ -81,7 +80,7 @@ export const useAuthStore = create<AuthState>()(
       },
 
       logout: () => {
-        localStorage.removeItem('token');
+        api.clearTokens();
         set({ user: null, token: null, isAuthenticated: false });
       },
 
@@ -127,3 +126,12 @@ export const useAuthStore = create<AuthState>()(
     }
   )
 );
+
+// Держим токен в сторе актуальным после его обновления клиентом API
+api.onTokenChange((token) => {
+  if (token) {
+    useAuthStore.setState({ token });
+  } else {
+    useAuthStore.setState({ user: null, token: null, isAuthenticated: false });
+  }
+});